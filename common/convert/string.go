@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"hash/fnv"
 	"strconv"
+	"unsafe"
 )
 
 // ToJSONStr converts to JSON string for logging purposes.
@@ -40,6 +41,12 @@ func ToIntSlice(list []string) ([]int, error) {
 	return idxList, nil
 }
 
+// BytesToString converts bytes to string without memory allocation.
+// The bytes must not be modified while the string is in use, such as the request path used for route lookup.
+func BytesToString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
 // Fnv32 Fnv-hash algorithm
 // FNV can quickly hash large amounts of data while maintaining a low collision rate.
 // Its high dispersion makes it suitable for hashing very similar strings.
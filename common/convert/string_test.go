@@ -40,3 +40,12 @@ func TestFnv32(t *testing.T) {
 	t.Log(ret)
 	assert.Equal(t, uint32(3259748752), ret)
 }
+
+func TestBytesToString(t *testing.T) {
+	assert.Equal(t, "", convert.BytesToString(nil))
+	b := []byte("/user/info")
+	assert.Equal(t, "/user/info", convert.BytesToString(b))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		_ = convert.BytesToString(b)
+	}))
+}
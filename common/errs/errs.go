@@ -57,6 +57,12 @@ const (
 
 	// ErrConnClosed Connection pool closed
 	ErrConnClosed = trpcpb.TrpcRetCode(1012)
+
+	// ErrMethodNotAllowed The path is matched, but the HTTP method is not allowed
+	ErrMethodNotAllowed = trpcpb.TrpcRetCode(1013)
+
+	// ErrCircuitBreakerOpen The circuit breaker of the target service is open
+	ErrCircuitBreakerOpen = trpcpb.TrpcRetCode(1014)
 )
 
 const (
@@ -38,6 +38,8 @@ var httpStatusMap = map[trpc.TrpcRetCode]int{
 	errs.RetClientNetErr:       fasthttp.StatusInternalServerError,
 	errs.RetUnknown:            fasthttp.StatusInternalServerError,
 	ErrInvalidReq:              fasthttp.StatusForbidden,
+	ErrMethodNotAllowed:        fasthttp.StatusMethodNotAllowed,
+	ErrCircuitBreakerOpen:      fasthttp.StatusServiceUnavailable,
 }
 
 // Register Registering the mapping relationship between custom err codes and HTTP status codes,
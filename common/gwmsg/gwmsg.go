@@ -52,6 +52,11 @@ type GwMsg interface {
 	// UpstreamMethod returns upstream method
 	UpstreamMethod() string
 
+	// WithUpstreamAttempts sets the number of attempts to the upstream, which is greater than 1 if retried
+	WithUpstreamAttempts(attempts int)
+	// UpstreamAttempts returns the number of attempts to the upstream
+	UpstreamAttempts() int
+
 	// WithUpstreamRspHead sets upstream ClientRspHead
 	WithUpstreamRspHead(rspHead interface{})
 	// UpstreamRspHead returns upstream ClientRspHead
@@ -61,4 +66,9 @@ type GwMsg interface {
 	WithTRPCClientOpts(opts []client.Option)
 	// TRPCClientOpts returns trpc client options
 	TRPCClientOpts() []client.Option
+
+	// WithRspCookie adds a Set-Cookie header value to the response to the client, such as the sticky target cookie
+	WithRspCookie(cookie string)
+	// RspCookies returns the Set-Cookie header values of the response to the client
+	RspCookies() []string
 }
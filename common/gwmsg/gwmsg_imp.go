@@ -22,14 +22,16 @@ import (
 
 // gwMsg is the context of gateway
 type gwMsg struct {
-	cli             *client.BackendConfig
-	pluginConfig    map[string]interface{}
-	routerID        string
-	upstreamLatency int64
-	upstreamAddr    string
-	upstreamMethod  string
-	upstreamRspHead interface{}
-	tRPCClientOpts  []client.Option
+	cli              *client.BackendConfig
+	pluginConfig     map[string]interface{}
+	routerID         string
+	upstreamLatency  int64
+	upstreamAddr     string
+	upstreamMethod   string
+	upstreamAttempts int
+	upstreamRspHead  interface{}
+	tRPCClientOpts   []client.Option
+	rspCookies       []string
 }
 
 // WithPluginConfig sets plugin configuration
@@ -98,6 +100,16 @@ func (gm *gwMsg) UpstreamMethod() string {
 	return gm.upstreamMethod
 }
 
+// WithUpstreamAttempts sets the number of attempts to the upstream
+func (gm *gwMsg) WithUpstreamAttempts(attempts int) {
+	gm.upstreamAttempts = attempts
+}
+
+// UpstreamAttempts returns the number of attempts to the upstream
+func (gm *gwMsg) UpstreamAttempts() int {
+	return gm.upstreamAttempts
+}
+
 // WithUpstreamRspHead sets upstream client response header
 func (gm *gwMsg) WithUpstreamRspHead(rspHead interface{}) {
 	gm.upstreamRspHead = rspHead
@@ -122,6 +134,16 @@ func (gm *gwMsg) TRPCClientOpts() []client.Option {
 	return gm.tRPCClientOpts
 }
 
+// WithRspCookie adds a Set-Cookie header value to the response to the client
+func (gm *gwMsg) WithRspCookie(cookie string) {
+	gm.rspCookies = append(gm.rspCookies, cookie)
+}
+
+// RspCookies returns the Set-Cookie header values of the response to the client
+func (gm *gwMsg) RspCookies() []string {
+	return gm.rspCookies
+}
+
 // gwMsgPool 网关消息对象池，用来进行对象复用，减少GC
 var gwMsgPool = sync.Pool{
 	New: func() interface{} {
@@ -164,8 +186,10 @@ func (gm *gwMsg) resetDefault() {
 	gm.upstreamLatency = 0
 	gm.upstreamAddr = ""
 	gm.upstreamMethod = ""
+	gm.upstreamAttempts = 0
 	gm.upstreamRspHead = nil
 	gm.tRPCClientOpts = nil
+	gm.rspCookies = nil
 }
 
 // GwMessage returns the message of context.
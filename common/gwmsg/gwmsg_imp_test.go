@@ -45,11 +45,15 @@ func TestGwMsg(t *testing.T) {
 	// Get UpstreamAddr
 	assert.Equal(t, "0.0.0.0", msg.UpstreamAddr())
 	assert.Equal(t, "/user/info", msg.UpstreamMethod())
+	assert.Equal(t, 2, msg.UpstreamAttempts())
 	assert.Equal(t, "rsp header", msg.UpstreamRspHead().(string))
 	assert.Equal(t, 2, len(msg.TRPCClientOpts()))
+	assert.Equal(t, []string{"a=1", "b=2"}, msg.RspCookies())
 
 	gwmsg.PutBackGwMessage(msg)
 	assert.Nil(t, msg.TargetService())
+	assert.Nil(t, msg.RspCookies())
+	assert.Zero(t, msg.UpstreamAttempts())
 	iConfig = msg.PluginConfig("demo")
 	assert.Nil(t, iConfig)
 
@@ -71,8 +75,11 @@ func mockFunc(ctx context.Context) {
 	gwmsg.GwMessage(ctx).WithUpstreamAddr("0.0.0.0")
 
 	gwmsg.GwMessage(ctx).WithUpstreamMethod("/user/info")
+	gwmsg.GwMessage(ctx).WithUpstreamAttempts(2)
 
 	gwmsg.GwMessage(ctx).WithUpstreamRspHead("rsp header")
+	gwmsg.GwMessage(ctx).WithRspCookie("a=1")
+	gwmsg.GwMessage(ctx).WithRspCookie("b=2")
 	gwmsg.GwMessage(ctx).WithTRPCClientOpts([]client.Option{
 		func(options *client.Options) {
 		},
@@ -75,6 +75,20 @@ func (mr *MockGwMsgMockRecorder) RouterID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouterID", reflect.TypeOf((*MockGwMsg)(nil).RouterID))
 }
 
+// RspCookies mocks base method.
+func (m *MockGwMsg) RspCookies() []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RspCookies")
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// RspCookies indicates an expected call of RspCookies.
+func (mr *MockGwMsgMockRecorder) RspCookies() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RspCookies", reflect.TypeOf((*MockGwMsg)(nil).RspCookies))
+}
+
 // TRPCClientOpts mocks base method.
 func (m *MockGwMsg) TRPCClientOpts() []client.Option {
 	m.ctrl.T.Helper()
@@ -117,6 +131,20 @@ func (mr *MockGwMsgMockRecorder) UpstreamAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpstreamAddr", reflect.TypeOf((*MockGwMsg)(nil).UpstreamAddr))
 }
 
+// UpstreamAttempts mocks base method.
+func (m *MockGwMsg) UpstreamAttempts() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpstreamAttempts")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// UpstreamAttempts indicates an expected call of UpstreamAttempts.
+func (mr *MockGwMsgMockRecorder) UpstreamAttempts() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpstreamAttempts", reflect.TypeOf((*MockGwMsg)(nil).UpstreamAttempts))
+}
+
 // UpstreamLatency mocks base method.
 func (m *MockGwMsg) UpstreamLatency() int64 {
 	m.ctrl.T.Helper()
@@ -183,6 +211,18 @@ func (mr *MockGwMsgMockRecorder) WithRouterID(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithRouterID", reflect.TypeOf((*MockGwMsg)(nil).WithRouterID), arg0)
 }
 
+// WithRspCookie mocks base method.
+func (m *MockGwMsg) WithRspCookie(arg0 string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "WithRspCookie", arg0)
+}
+
+// WithRspCookie indicates an expected call of WithRspCookie.
+func (mr *MockGwMsgMockRecorder) WithRspCookie(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithRspCookie", reflect.TypeOf((*MockGwMsg)(nil).WithRspCookie), arg0)
+}
+
 // WithTRPCClientOpts mocks base method.
 func (m *MockGwMsg) WithTRPCClientOpts(arg0 []client.Option) {
 	m.ctrl.T.Helper()
@@ -219,6 +259,18 @@ func (mr *MockGwMsgMockRecorder) WithUpstreamAddr(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithUpstreamAddr", reflect.TypeOf((*MockGwMsg)(nil).WithUpstreamAddr), arg0)
 }
 
+// WithUpstreamAttempts mocks base method.
+func (m *MockGwMsg) WithUpstreamAttempts(arg0 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "WithUpstreamAttempts", arg0)
+}
+
+// WithUpstreamAttempts indicates an expected call of WithUpstreamAttempts.
+func (mr *MockGwMsgMockRecorder) WithUpstreamAttempts(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WithUpstreamAttempts", reflect.TypeOf((*MockGwMsg)(nil).WithUpstreamAttempts), arg0)
+}
+
 // WithUpstreamLatency mocks base method.
 func (m *MockGwMsg) WithUpstreamLatency(arg0 int64) {
 	m.ctrl.T.Helper()
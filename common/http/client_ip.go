@@ -0,0 +1,94 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// headerXRealIP is the header of the client IP set by the proxies such as nginx
+const headerXRealIP = "X-Real-Ip"
+
+// trustedProxies is the CIDRs of the trusted proxies, the forwarded headers are only taken from them
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies sets the CIDRs of the trusted proxies, such as 10.0.0.0/8, a single IP is treated as a CIDR of
+// the full length. It should be called on setup before serving the requests.
+func SetTrustedProxies(cidrs []string) error {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, s := range cidrs {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid trusted proxy:%s", s)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid trusted proxy:%s", s)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+// isTrustedProxy reports whether the IP belongs to the trusted proxies
+func isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the client IP of the request. It is the remote IP of the connection, unless the peer is a trusted
+// proxy set by SetTrustedProxies. Then X-Forwarded-For is walked from right to left and the first hop not trusted is
+// returned, or X-Real-Ip if X-Forwarded-For is absent, since the hops on the left are set by the clients.
+func ClientIP(fctx *fasthttp.RequestCtx) string {
+	remote := fctx.RemoteIP()
+	addr, ok := netip.AddrFromSlice(remote)
+	if !ok || !isTrustedProxy(addr.Unmap()) {
+		return remote.String()
+	}
+	if xff := fctx.Request.Header.Peek(fasthttp.HeaderXForwardedFor); len(xff) != 0 {
+		ip := addr.Unmap()
+		hops := strings.Split(string(xff), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// The invalid hop is not trusted, the nearest valid one is used
+				break
+			}
+			ip = hop.Unmap()
+			if !isTrustedProxy(ip) {
+				break
+			}
+		}
+		return ip.String()
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(string(fctx.Request.Header.Peek(headerXRealIP)))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return remote.String()
+}
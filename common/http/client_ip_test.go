@@ -0,0 +1,63 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+)
+
+func TestSetTrustedProxies(t *testing.T) {
+	defer func() { _ = http.SetTrustedProxies(nil) }()
+	assert.Nil(t, http.SetTrustedProxies([]string{"10.0.0.0/8", " 192.168.1.1", "2001:db8::/32"}))
+	assert.NotNil(t, http.SetTrustedProxies([]string{"10.0.0.0/33"}))
+	assert.NotNil(t, http.SetTrustedProxies([]string{"10.0.0.256"}))
+}
+
+func TestClientIP(t *testing.T) {
+	defer func() { _ = http.SetTrustedProxies(nil) }()
+	newCtx := func(remote string, headers ...string) *fasthttp.RequestCtx {
+		fctx := &fasthttp.RequestCtx{}
+		fctx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP(remote), Port: 1234})
+		for i := 0; i+1 < len(headers); i += 2 {
+			fctx.Request.Header.Set(headers[i], headers[i+1])
+		}
+		return fctx
+	}
+
+	// No trusted proxy, the forwarded headers are ignored
+	assert.Equal(t, "1.1.1.1", http.ClientIP(newCtx("1.1.1.1", fasthttp.HeaderXForwardedFor, "10.0.0.1")))
+	assert.Equal(t, "1.1.1.1", http.ClientIP(newCtx("1.1.1.1", "X-Real-Ip", "10.0.0.1")))
+
+	assert.Nil(t, http.SetTrustedProxies([]string{"192.168.0.0/16"}))
+	// The peer is not trusted
+	assert.Equal(t, "1.1.1.1", http.ClientIP(newCtx("1.1.1.1", fasthttp.HeaderXForwardedFor, "10.0.0.1")))
+	// The rightmost hop not trusted is used, the spoofed hops on the left are ignored
+	assert.Equal(t, "2.2.2.2", http.ClientIP(newCtx("192.168.0.1",
+		fasthttp.HeaderXForwardedFor, "10.0.0.1, 2.2.2.2, 192.168.0.2")))
+	// All the hops are trusted
+	assert.Equal(t, "192.168.0.3", http.ClientIP(newCtx("192.168.0.1",
+		fasthttp.HeaderXForwardedFor, "192.168.0.3,192.168.0.2")))
+	// The invalid hop is not used
+	assert.Equal(t, "192.168.0.2", http.ClientIP(newCtx("192.168.0.1",
+		fasthttp.HeaderXForwardedFor, "invalid, 192.168.0.2")))
+	// X-Real-Ip of the trusted proxy
+	assert.Equal(t, "2.2.2.2", http.ClientIP(newCtx("192.168.0.1", "X-Real-Ip", "2.2.2.2")))
+	assert.Equal(t, "192.168.0.1", http.ClientIP(newCtx("192.168.0.1", "X-Real-Ip", "invalid")))
+	assert.Equal(t, "192.168.0.1", http.ClientIP(newCtx("192.168.0.1")))
+}
@@ -21,7 +21,12 @@ import (
 )
 
 // GetString returns HTTP request parameters.
+// A key in the form of {name} returns the value captured by the path template route.
 func GetString(fctx *fasthttp.RequestCtx, key string) (ret string) {
+	if name, ok := PathParamName(key); ok {
+		return PathParam(fctx, name)
+	}
+
 	ret = string(fctx.QueryArgs().Peek(key))
 
 	if ret == "" {
@@ -71,3 +76,20 @@ func GetClientIP(fctx *fasthttp.RequestCtx) string {
 	}
 	return ""
 }
+
+// idempotentMethods are the HTTP methods that are safe to send again
+var idempotentMethods = map[string]struct{}{
+	fasthttp.MethodGet:     {},
+	fasthttp.MethodHead:    {},
+	fasthttp.MethodOptions: {},
+	fasthttp.MethodPut:     {},
+	fasthttp.MethodDelete:  {},
+	fasthttp.MethodTrace:   {},
+}
+
+// IsIdempotent checks if the HTTP method is idempotent, so that the request can be sent again, such as retried or
+// failed over to another upstream, after the upstream may have applied it.
+func IsIdempotent(method []byte) bool {
+	_, ok := idempotentMethods[string(method)]
+	return ok
+}
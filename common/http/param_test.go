@@ -67,3 +67,10 @@ func Test_getClientIPFromContext(t *testing.T) {
 	clientIP = http.GetClientIP(fCtx)
 	assert.Equal(t, "", clientIP)
 }
+
+func TestIsIdempotent(t *testing.T) {
+	assert.True(t, http.IsIdempotent([]byte(fasthttp.MethodGet)))
+	assert.True(t, http.IsIdempotent([]byte(fasthttp.MethodPut)))
+	assert.False(t, http.IsIdempotent([]byte(fasthttp.MethodPost)))
+	assert.False(t, http.IsIdempotent([]byte(fasthttp.MethodPatch)))
+}
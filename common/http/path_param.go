@@ -0,0 +1,80 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ContextKeyPathParams is the fasthttp user value key of the values captured by a path template route
+const ContextKeyPathParams = ContextKey("TRPC_GATEWAY_PATH_PARAMS")
+
+// WithPathParams stores the values captured by a path template route on the request.
+func WithPathParams(fctx *fasthttp.RequestCtx, params map[string]string) {
+	fctx.SetUserValue(ContextKeyPathParams, params)
+}
+
+// PathParams returns the values captured by a path template route, nil if the request did not match one.
+func PathParams(fctx *fasthttp.RequestCtx) map[string]string {
+	if params, ok := fctx.UserValue(ContextKeyPathParams).(map[string]string); ok {
+		return params
+	}
+	return nil
+}
+
+// PathParam returns the value captured by the path template segment {name}.
+func PathParam(fctx *fasthttp.RequestCtx, name string) string {
+	return PathParams(fctx)[name]
+}
+
+// PathParamName returns the capture name referenced by a placeholder key such as {uid} or {*rest}.
+func PathParamName(key string) (string, bool) {
+	if len(key) < 3 || key[0] != '{' || key[len(key)-1] != '}' {
+		return "", false
+	}
+	return strings.TrimPrefix(key[1:len(key)-1], "*"), true
+}
+
+// ExpandPathParams replaces the {name} and {*name} placeholders in s with the captured values.
+// Placeholders without a captured value are kept as they are.
+func ExpandPathParams(s string, params map[string]string) string {
+	if len(params) == 0 || !strings.Contains(s, "{") {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(s[:start])
+		name, _ := PathParamName(s[start : end+1])
+		if val, ok := params[name]; ok {
+			b.WriteString(val)
+		} else {
+			b.WriteString(s[start : end+1])
+		}
+		s = s[end+1:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
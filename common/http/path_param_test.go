@@ -0,0 +1,57 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+)
+
+func TestPathParams(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	assert.Nil(t, http.PathParams(fctx))
+	assert.Equal(t, "", http.PathParam(fctx, "uid"))
+
+	http.WithPathParams(fctx, map[string]string{"uid": "123", "rest": "a/b"})
+	assert.Equal(t, "123", http.PathParam(fctx, "uid"))
+	assert.Equal(t, "123", http.GetString(fctx, "{uid}"))
+	assert.Equal(t, "a/b", http.GetString(fctx, "{*rest}"))
+	assert.Equal(t, "", http.GetString(fctx, "{oid}"))
+}
+
+func TestPathParamName(t *testing.T) {
+	name, ok := http.PathParamName("{uid}")
+	assert.True(t, ok)
+	assert.Equal(t, "uid", name)
+	name, ok = http.PathParamName("{*rest}")
+	assert.True(t, ok)
+	assert.Equal(t, "rest", name)
+	_, ok = http.PathParamName("uid")
+	assert.False(t, ok)
+	_, ok = http.PathParamName("{}")
+	assert.False(t, ok)
+}
+
+func TestExpandPathParams(t *testing.T) {
+	params := map[string]string{"uid": "123", "rest": "a/b"}
+	assert.Equal(t, "/v2/account/123/profile", http.ExpandPathParams("/v2/account/{uid}/profile", params))
+	assert.Equal(t, "/static/a/b", http.ExpandPathParams("/static/{*rest}", params))
+	assert.Equal(t, "/static/a/b", http.ExpandPathParams("/static/{rest}", params))
+	assert.Equal(t, "/v2/{oid}/123", http.ExpandPathParams("/v2/{oid}/{uid}", params))
+	assert.Equal(t, "/v2/{uid", http.ExpandPathParams("/v2/{uid", params))
+	assert.Equal(t, "/v2/{uid}", http.ExpandPathParams("/v2/{uid}", nil))
+}
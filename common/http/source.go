@@ -0,0 +1,201 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http
+
+import (
+	"strconv"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// SourceType is the type of the request value source
+type SourceType string
+
+const (
+	// SourceDefault searches query, form, header and cookie in order, used for keys without source prefix
+	SourceDefault SourceType = ""
+	// SourceHeader is the request header, such as header:x-uid
+	SourceHeader SourceType = "header"
+	// SourceQuery is the query parameter, such as query:uid
+	SourceQuery SourceType = "query"
+	// SourceForm is the form parameter of the request body, such as form:uid
+	SourceForm SourceType = "form"
+	// SourceCookie is the request cookie, such as cookie:uid
+	SourceCookie SourceType = "cookie"
+	// SourceJSON is the field of the JSON request body, such as json:$.user.level
+	SourceJSON SourceType = "json"
+	// SourceParam is the value captured by the path template route, such as param:uid
+	SourceParam SourceType = "param"
+	// SourceIP is the client IP, written as req:ip, see ClientIP
+	SourceIP SourceType = "ip"
+	// SourcePath is the request path, written as req:path
+	SourcePath SourceType = "path"
+	// SourceMethod is the HTTP method, written as req:method
+	SourceMethod SourceType = "method"
+	// SourceHost is the request host, written as req:host
+	SourceHost SourceType = "host"
+)
+
+// requestPrefix is the prefix of the request attribute sources, such as req:ip
+const requestPrefix = "req"
+
+// namedSources are the source prefixes followed by a name, such as header:x-uid
+var namedSources = map[SourceType]struct{}{
+	SourceHeader: {},
+	SourceQuery:  {},
+	SourceForm:   {},
+	SourceCookie: {},
+	SourceJSON:   {},
+	SourceParam:  {},
+}
+
+// requestSources are the sources of the request attributes, written with the req prefix, such as req:ip
+var requestSources = map[SourceType]struct{}{
+	SourceIP:     {},
+	SourcePath:   {},
+	SourceMethod: {},
+	SourceHost:   {},
+}
+
+// Source is the parsed key of a request value, such as header:x-uid.
+// It is parsed once when the configuration is loaded and can be used concurrently.
+type Source struct {
+	// Type is the source type
+	Type SourceType
+	// Name is the name of the value in the source, such as the header name. It is the whole key for SourceDefault
+	// and empty for the request attribute sources.
+	Name string
+	// jsonPath is the parsed path of SourceJSON, the elements are field names or array indexes
+	jsonPath []interface{}
+}
+
+// ParseSource parses the key with optional source prefix.
+// Supported forms are header:name, query:name, form:name, cookie:name, json:$.path, param:name, req:ip, req:path,
+// req:method and req:host. Keys without a known prefix, including {name}, are resolved by GetString for compatibility.
+func ParseSource(key string) (*Source, error) {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil, errs.New(gerrs.ErrWrongConfig, "empty source key")
+	}
+	i := strings.IndexByte(key, ':')
+	if i < 0 {
+		return &Source{Type: SourceDefault, Name: key}, nil
+	}
+	prefix, name := key[:i], strings.TrimSpace(key[i+1:])
+	if prefix == requestPrefix {
+		if _, ok := requestSources[SourceType(name)]; !ok {
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "unknown request attribute of key:%s", key)
+		}
+		return &Source{Type: SourceType(name)}, nil
+	}
+	typ := SourceType(prefix)
+	if _, ok := namedSources[typ]; !ok {
+		return &Source{Type: SourceDefault, Name: key}, nil
+	}
+	if name == "" {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "empty source name of key:%s", key)
+	}
+	s := &Source{Type: typ, Name: name}
+	if typ == SourceJSON {
+		path, err := parseJSONPath(name)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid json path of key:%s", key)
+		}
+		s.jsonPath = path
+	}
+	return s, nil
+}
+
+// parseJSONPath parses the JSON path such as $.user.level or $.items[0].id
+func parseJSONPath(path string) ([]interface{}, error) {
+	if path[0] != '$' {
+		return nil, errs.New(gerrs.ErrWrongConfig, "json path must start with $")
+	}
+	var list []interface{}
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if j == i+1 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "empty field name at position %d", i+1)
+			}
+			list = append(list, path[i+1:j])
+			i = j
+		case '[':
+			j := strings.IndexByte(path[i:], ']')
+			if j < 0 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "missing ] for [ at position %d", i+1)
+			}
+			idx, err := strconv.Atoi(path[i+1 : i+j])
+			if err != nil || idx < 0 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid array index at position %d", i+2)
+			}
+			list = append(list, idx)
+			i += j + 1
+		default:
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "unexpected %q at position %d", path[i], i+1)
+		}
+	}
+	return list, nil
+}
+
+// Typed reports whether the key has a source prefix
+func (s *Source) Typed() bool {
+	return s.Type != SourceDefault
+}
+
+// Value returns the value of the source from the request
+func (s *Source) Value(fctx *fasthttp.RequestCtx) string {
+	switch s.Type {
+	case SourceHeader:
+		return string(fctx.Request.Header.Peek(s.Name))
+	case SourceQuery:
+		return string(fctx.QueryArgs().Peek(s.Name))
+	case SourceForm:
+		return string(fctx.PostArgs().Peek(s.Name))
+	case SourceCookie:
+		return string(fctx.Request.Header.Cookie(s.Name))
+	case SourceJSON:
+		return jsoniter.Get(fctx.Request.Body(), s.jsonPath...).ToString()
+	case SourceParam:
+		return PathParam(fctx, s.Name)
+	case SourceIP:
+		return ClientIP(fctx)
+	case SourcePath:
+		return string(fctx.Path())
+	case SourceMethod:
+		return string(fctx.Method())
+	case SourceHost:
+		return string(fctx.Host())
+	default:
+		return GetString(fctx, s.Name)
+	}
+}
+
+// GetSourceString parses the key and returns its value from the request, an invalid key returns empty string.
+// Prefer ParseSource when the key is known in advance, such as in the plugin configuration.
+func GetSourceString(fctx *fasthttp.RequestCtx, key string) string {
+	s, err := ParseSource(key)
+	if err != nil {
+		return ""
+	}
+	return s.Value(fctx)
+}
@@ -0,0 +1,116 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		key      string
+		wantType http.SourceType
+		wantName string
+	}{
+		{key: "uid", wantType: http.SourceDefault, wantName: "uid"},
+		{key: " uid ", wantType: http.SourceDefault, wantName: "uid"},
+		{key: "unknown:uid", wantType: http.SourceDefault, wantName: "unknown:uid"},
+		{key: "header:x-uid", wantType: http.SourceHeader, wantName: "x-uid"},
+		{key: "query:uid", wantType: http.SourceQuery, wantName: "uid"},
+		{key: "form:uid", wantType: http.SourceForm, wantName: "uid"},
+		{key: "cookie:uid", wantType: http.SourceCookie, wantName: "uid"},
+		{key: "json:$.user.level", wantType: http.SourceJSON, wantName: "$.user.level"},
+		{key: "param:uid", wantType: http.SourceParam, wantName: "uid"},
+		{key: "{uid}", wantType: http.SourceDefault, wantName: "{uid}"},
+		{key: "ip", wantType: http.SourceDefault, wantName: "ip"},
+		{key: "host", wantType: http.SourceDefault, wantName: "host"},
+		{key: "req:ip", wantType: http.SourceIP},
+		{key: "req:path", wantType: http.SourcePath},
+		{key: "req:method", wantType: http.SourceMethod},
+		{key: "req: host", wantType: http.SourceHost},
+	}
+	for _, tt := range tests {
+		src, err := http.ParseSource(tt.key)
+		assert.Nil(t, err, tt.key)
+		assert.Equal(t, tt.wantType, src.Type, tt.key)
+		assert.Equal(t, tt.wantName, src.Name, tt.key)
+		assert.Equal(t, tt.wantType != http.SourceDefault, src.Typed(), tt.key)
+	}
+
+	for _, key := range []string{"", " ", "header:", "json:user", "json:$.", "json:$.a..b", "json:$.a[x]",
+		"json:$.a[-1]", "json:$.a[0", "json:$a", "req:", "req:uid"} {
+		_, err := http.ParseSource(key)
+		assert.NotNil(t, err, key)
+	}
+}
+
+func TestSource_Value(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("http://r.inews.qq.com/users/1?uid=query&ip=query")
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	fctx.Request.Header.Set("x-uid", "header")
+	fctx.Request.Header.Set("uid", "header")
+	fctx.Request.Header.SetCookie("uid", "cookie")
+	fctx.Request.SetBodyString(`{"user":{"level":3,"name":"tom","tags":["a","b"]}}`)
+	fctx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234})
+	http.WithPathParams(fctx, map[string]string{"uid": "param"})
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "uid", want: "query"},
+		{key: "header:uid", want: "header"},
+		{key: "header:X-Uid", want: "header"},
+		{key: "query:uid", want: "query"},
+		{key: "query:x-uid", want: ""},
+		{key: "cookie:uid", want: "cookie"},
+		{key: "json:$.user.level", want: "3"},
+		{key: "json:$.user.name", want: "tom"},
+		{key: "json:$.user.tags[1]", want: "b"},
+		{key: "json:$.user.none", want: ""},
+		{key: "param:uid", want: "param"},
+		{key: "{uid}", want: "param"},
+		{key: "ip", want: "query"},
+		{key: "path", want: ""},
+		{key: "req:ip", want: "10.0.0.1"},
+		{key: "req:path", want: "/users/1"},
+		{key: "req:method", want: fasthttp.MethodPost},
+		{key: "req:host", want: "r.inews.qq.com"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, http.GetSourceString(fctx, tt.key), tt.key)
+	}
+	assert.Equal(t, "", http.GetSourceString(fctx, "json:user"))
+
+	// Client IP from header of the trusted proxy only
+	fctx.Request.Header.Set(fasthttp.HeaderXForwardedFor, "10.0.0.2")
+	assert.Equal(t, "10.0.0.1", http.GetSourceString(fctx, "req:ip"))
+	assert.Nil(t, http.SetTrustedProxies([]string{"10.0.0.1"}))
+	defer func() { _ = http.SetTrustedProxies(nil) }()
+	assert.Equal(t, "10.0.0.2", http.GetSourceString(fctx, "req:ip"))
+
+	// Form parameters
+	fctx = &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	fctx.Request.Header.SetContentType("application/x-www-form-urlencoded")
+	fctx.Request.SetBodyString("uid=form")
+	assert.Equal(t, "form", http.GetSourceString(fctx, "form:uid"))
+	assert.Equal(t, "", http.GetSourceString(fctx, "query:uid"))
+}
@@ -17,4 +17,6 @@ package plugin
 const (
 	// DefaultType refers to the default type of plugin.
 	DefaultType = "gateway"
+	// DefaultPriority refers to the priority of the plugins not declaring one.
+	DefaultPriority = 0
 )
@@ -26,6 +26,7 @@ import (
 	"go.uber.org/automaxprocs/maxprocs"
 	"gopkg.in/yaml.v3"
 	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
 	"trpc.group/trpc-go/trpc-gateway/internal/util"
 	trpc "trpc.group/trpc-go/trpc-go"
 	"trpc.group/trpc-go/trpc-go/log"
@@ -44,6 +45,12 @@ func init() {
 type Config struct {
 	Global struct {
 		ConfProvider string `yaml:"conf_provider"` // Routing configuration provider, file, etcd etc.
+		// ConfProviders are the ordered layers of the routing configuration, such as [file, etcd], the later layers
+		// override the earlier ones. ConfProvider is ignored if it is set.
+		ConfProviders []string `yaml:"conf_providers"`
+		// TrustedProxies are the CIDRs of the trusted proxies in front of the gateway, the client IP is only taken from
+		// X-Forwarded-For or X-Real-Ip of the requests from them, otherwise the remote IP of the connection is used.
+		TrustedProxies []string `yaml:"trusted_proxies"`
 	}
 	Server struct {
 		Service []*ServiceConfig // Configuration of a single service
@@ -155,12 +162,25 @@ var loadConf = func(configPath string) (*Config, error) {
 		return nil, gerrs.Wrap(err, "read_config_err")
 	}
 	// parse environment variables.
-	buf = []byte(util.ExpandEnv(string(buf)))
+	expanded, err := util.ExpandEnv(string(buf))
+	if err != nil {
+		return nil, gerrs.Wrap(err, "expand_config_env_err")
+	}
+	buf = []byte(expanded)
 
 	if err := yaml.Unmarshal(buf, cfg); err != nil {
 		return nil, gerrs.Wrap(err, "unmarshal_cfg_err")
 	}
 
+	if err := http.SetTrustedProxies(cfg.Global.TrustedProxies); err != nil {
+		return nil, gerrs.Wrap(err, "set_trusted_proxies_err")
+	}
+
+	// the layered provider loads the configured layers
+	if len(cfg.Global.ConfProviders) > 0 {
+		confProviders = cfg.Global.ConfProviders
+		cfg.Global.ConfProvider = LayeredProvider
+	}
 	// set the default config provider
 	if cfg.Global.ConfProvider == "" {
 		cfg.Global.ConfProvider = "file"
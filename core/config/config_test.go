@@ -16,9 +16,12 @@ package config
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
 	trpc "trpc.group/trpc-go/trpc-go"
 	"trpc.group/trpc-go/trpc-go/client"
 )
@@ -105,3 +108,44 @@ func TestNewServer(t *testing.T) {
 		s = NewServer()
 	}()
 }
+
+func Test_loadConf_confProviders(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "trpc_go.yaml")
+	err := os.WriteFile(f, []byte("global:\n  conf_providers: [file, etcd]\n"), 0644)
+	assert.Nil(t, err)
+	defer func() { confProviders = nil }()
+	cfg, err := loadConf(f)
+	assert.Nil(t, err)
+	assert.Equal(t, LayeredProvider, cfg.Global.ConfProvider)
+	assert.Equal(t, []string{"file", "etcd"}, ConfProviders())
+}
+
+func Test_loadConf_trustedProxies(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "trpc_go.yaml")
+	err := os.WriteFile(f, []byte("global:\n  trusted_proxies: [10.0.0.0/8, 192.168.1.1]\n"), 0644)
+	assert.Nil(t, err)
+	defer func() { _ = http.SetTrustedProxies(nil) }()
+	cfg, err := loadConf(f)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.1"}, cfg.Global.TrustedProxies)
+
+	err = os.WriteFile(f, []byte("global:\n  trusted_proxies: [10.0.0.0/33]\n"), 0644)
+	assert.Nil(t, err)
+	_, err = loadConf(f)
+	assert.NotNil(t, err)
+}
+
+func Test_loadConf_expandEnv(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "trpc_go.yaml")
+	err := os.WriteFile(f, []byte("global:\n  conf_provider: ${GW_CONF_PROVIDER:-etcd}\n"), 0644)
+	assert.Nil(t, err)
+	cfg, err := loadConf(f)
+	assert.Nil(t, err)
+	assert.Equal(t, "etcd", cfg.Global.ConfProvider)
+
+	err = os.WriteFile(f, []byte("global:\n  conf_provider: ${GW_CONF_PROVIDER:?conf provider required}\n"), 0644)
+	assert.Nil(t, err)
+	_, err = loadConf(f)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "conf provider required")
+}
@@ -18,9 +18,15 @@ import (
 	"sync"
 )
 
+// LayeredProvider is the routing configuration provider used when global.conf_providers is set, which merges the
+// configuration of the providers
+const LayeredProvider = "layered"
+
 var (
 	loaders   = make(map[string]Loader)
 	muxLoader sync.RWMutex
+	// confProviders are the providers of global.conf_providers
+	confProviders []string
 )
 
 // RegisterConfLoader register a router config loader
@@ -38,6 +44,11 @@ func GetConfLoader(provider string) Loader {
 	return l
 }
 
+// ConfProviders returns the ordered providers of global.conf_providers, which are the layers of the layered provider
+func ConfProviders() []string {
+	return confProviders
+}
+
 // Loader is the interface for configuration loaders.
 //
 //go:generate mockgen -destination=./configmock/loader_mock.go -package=configmock . Loader
@@ -15,6 +15,8 @@
 package entity
 
 import (
+	"regexp"
+
 	"trpc.group/trpc-go/trpc-go/client"
 	"trpc.group/trpc-go/trpc-go/filter"
 )
@@ -24,6 +26,43 @@ type ProxyConfig struct {
 	Router  []*RouterItem    `yaml:"router,omitempty" json:"router,omitempty"`
 	Client  []*BackendConfig `yaml:"client,omitempty" json:"client,omitempty"`
 	Plugins []*Plugin        `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+	// DefaultRoute is the catch-all router used when no router matches the path, method is not required.
+	DefaultRoute *RouterItem `yaml:"default_route,omitempty" json:"default_route,omitempty"`
+	// NotFound is the response when no router matches the path and there is no default route.
+	NotFound *NotFoundConfig `yaml:"not_found,omitempty" json:"not_found,omitempty"`
+	// Groups are the router groups, which are expanded into the routers before validation.
+	Groups []*RouterGroup `yaml:"groups,omitempty" json:"groups,omitempty"`
+	// Templates are the named router templates referenced by the routers and the groups with extends.
+	Templates map[string]*RouterItem `yaml:"templates,omitempty" json:"templates,omitempty"`
+}
+
+// RouterGroup is a group of routers sharing fields such as host, target_service, plugins, strip_path and rule. The
+// routers inherit the fields of the group that they do not set, and the plugins are merged by name.
+type RouterGroup struct {
+	// RouterItem holds the fields shared by the routers, method is not allowed.
+	RouterItem `yaml:",inline"`
+	// Routes are the routers of the group.
+	Routes []*RouterItem `yaml:"routes,omitempty" json:"routes,omitempty"`
+}
+
+// NotFoundConfig is the configuration of the response when no router matches the path.
+type NotFoundConfig struct {
+	// Status is the HTTP status, default is 404.
+	Status int `yaml:"status,omitempty" json:"status,omitempty"`
+	// ContentType is the content type of the body.
+	ContentType string `yaml:"content_type,omitempty" json:"content_type,omitempty"`
+	// Body is the text/template of the body, such as {"path":{{json .Path}}}, the fields are Method, Host, Path and
+	// Query. The body of the HTML content type is parsed by html/template, which escapes the fields.
+	Body string `yaml:"body,omitempty" json:"body,omitempty"`
+	// GlobalPlugins runs the global plugins for the requests not found, such as cors and accesslog.
+	GlobalPlugins bool `yaml:"global_plugins,omitempty" json:"global_plugins,omitempty"`
+	// Plugins are the plugins for the requests not found, which are merged with the global plugins like the router
+	// plugins.
+	Plugins []*Plugin `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+	// Template is the parsed Body.
+	Template interface{} `yaml:"-" json:"-"`
+	// Target holds the plugins and filters of the requests not found, which has no upstream service.
+	Target *TargetService `yaml:"-" json:"-"`
 }
 
 // Condition is a condition for routing rule.
@@ -31,6 +70,8 @@ type Condition struct {
 	Key  string `yaml:"key,omitempty" json:"key,omitempty"`
 	Val  string `yaml:"val,omitempty" json:"val,omitempty"`
 	Oper string `yaml:"oper,omitempty" json:"oper,omitempty"`
+	// ParsedKey is the parsed source of Key, such as header:x-uid.
+	ParsedKey interface{} `yaml:"-" json:"-"`
 	// ParsedVal is the parsed value of Val.
 	ParsedVal interface{} `yaml:"-" json:"-"`
 }
@@ -41,10 +82,8 @@ type RuleItem struct {
 	Conditions []*Condition `yaml:"conditions,omitempty" json:"conditions,omitempty"`
 	// Expression is the expression for routing rule.
 	Expression string `yaml:"expression,omitempty" json:"expression,omitempty"`
-	// ConditionIdxList are the indexes of conditions for routing rule,parsed from Expression.
-	ConditionIdxList []int `yaml:"-" json:"-"`
-	// OptList are the options for routing rule,parsed from Expression, like || && etc.
-	OptList []string `yaml:"-" json:"-"`
+	// ParsedExpression is the compiled Expression, used for matching during requests.
+	ParsedExpression interface{} `yaml:"-" json:"-"`
 }
 
 // TargetService is upstream service config.
@@ -55,11 +94,30 @@ type TargetService struct {
 	BackendConfig *client.BackendConfig `yaml:"-" json:"-"`
 	// Weight is the weight of upstream service.
 	Weight int `yaml:"weight,omitempty" json:"weight,omitempty"`
+	// Priority is the failover group of upstream service, the default 0 is the primary group. The target services of
+	// a larger priority are used only when all target services of smaller priorities fail or are skipped.
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
+	// Health is the consecutive failures of upstream service, used to skip it during the cool-down.
+	Health interface{} `yaml:"-" json:"-"`
+	// FailoverGroups are the target services of the router grouped by priority, shared by the target services.
+	FailoverGroups interface{} `yaml:"-" json:"-"`
 	// ReWrite is the rewrite method for upstream service.
 	ReWrite string `yaml:"rewrite,omitempty"`
 	// StripPath define whether to strip the path prefix.
 	// for example: if a request matches the route '/api/' with StripPath set to true, then forward it to '/user/info'
 	StripPath bool `yaml:"strip_path,omitempty"`
+	// Timeout is the upstream timeout in milliseconds, which overrides the timeout of the router and the client.
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Retry is the retry policy of the upstream service, which overrides the retry of the router.
+	Retry *RetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// CircuitBreaker is the circuit breaker of the upstream service, which overrides the circuit breaker of the router.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+	// Breaker is the circuit breaker built from CircuitBreaker.
+	Breaker interface{} `yaml:"-" json:"-"`
+	// Shadow is the traffic shadowing of the router, shared by the target services.
+	Shadow *ShadowConfig `yaml:"-" json:"-"`
+	// NotFound is set if the target service is used to respond to the requests not found.
+	NotFound *NotFoundConfig `yaml:"-" json:"-"`
 	// Plugins include all plugin at the global, service, and router levels.
 	Plugins []*Plugin `yaml:"-" json:"-"`
 	// Filters include all filter function at the global, service, and router levels.
@@ -76,26 +134,61 @@ type Plugin struct {
 	Props interface{} `yaml:"props,omitempty" json:"props,omitempty"`
 	// 是否禁用
 	Disable bool `yaml:"disable,omitempty" json:"disable,omitempty"`
+	// Order 插件执行顺序，覆盖插件声明的默认优先级，值越大越先执行
+	Order *int `yaml:"order,omitempty" json:"order,omitempty"`
+	// When 插件执行条件，格式同路由的 rule，不满足时跳过插件
+	When *RuleItem `yaml:"when,omitempty" json:"when,omitempty"`
 }
 
 // RouterItem is router config.
 type RouterItem struct {
 	// ID is the unique id of router.
 	ID string `yaml:"id,omitempty" json:"id,omitempty"`
+	// Extends is the name of the template inherited by the router, the fields set by the router take precedence.
+	Extends string `yaml:"extends,omitempty" json:"extends,omitempty"`
 	// Method is the request path to match.
 	Method string `yaml:"method,omitempty" json:"method,omitempty"`
 	// Host is the request host list to match.
 	Host []string `yaml:"host,omitempty" json:"host,omitempty"`
 	// HostMap is parsed from Host, and used to match the request host.
 	HostMap map[string]struct{} `yaml:"-" json:"-"`
+	// HostWildcards are the suffixes parsed from the wildcard hosts, such as .example.com for *.example.com.
+	HostWildcards []string `yaml:"-" json:"-"`
+	// HostRegexps are parsed from the regex hosts, such as ~^tenant-[0-9]+\.example\.com$.
+	HostRegexps []*regexp.Regexp `yaml:"-" json:"-"`
+	// HTTPMethods is the request HTTP method list to match, such as GET, POST. If empty, matches all methods.
+	HTTPMethods []string `yaml:"http_methods,omitempty" json:"http_methods,omitempty"`
+	// HTTPMethodMap is parsed from HTTPMethods, and used to match the request HTTP method.
+	HTTPMethodMap map[string]struct{} `yaml:"-" json:"-"`
 	// IsRegexp defines whether the method is a regular expression.
 	IsRegexp bool `yaml:"is_regexp,omitempty" json:"is_regexp,omitempty"`
+	// Regexp is the compiled method of the regular expression route, whose submatches are referenced as $1 or
+	// ${name} in rewrite.
+	Regexp *regexp.Regexp `yaml:"-" json:"-"`
+	// Priority is the matching priority, a larger value is matched first. Router items with the same priority are
+	// matched in the order of configuration.
+	Priority int `yaml:"priority,omitempty" json:"priority,omitempty"`
 	// Rule define the matching rules witch is used to match the request params
 	Rule *RuleItem `yaml:"rule,omitempty" json:"rule,omitempty"`
 	// TargetService is the target service list.
 	TargetService []*TargetService `yaml:"target_service,omitempty" json:"targetService,omitempty"`
 	// HashKey enables stateful gray-scale forwarding, such as devid, etc., and is optional.
 	HashKey string `yaml:"hash_key,omitempty" json:"hash_key,omitempty"`
+	// ParsedHashKey is the parsed source of HashKey, such as header:x-uid.
+	ParsedHashKey interface{} `yaml:"-" json:"-"`
+	// HashMode is the mode of mapping the HashKey to the target services, optional values are ketama and rendezvous.
+	// The default is to map the hash onto the cumulative weights, which reshuffles almost every key when the weights
+	// change, while the consistent hash modes only move the keys of the changed weights.
+	HashMode string `yaml:"hash_mode,omitempty" json:"hash_mode,omitempty"`
+	// HashSelector is the consistent hash of the target services built by HashMode.
+	HashSelector interface{} `yaml:"-" json:"-"`
+	// Sticky keeps a client on the same target service by a signed cookie issued by the gateway, it can not be used
+	// with HashKey.
+	Sticky *StickyConfig `yaml:"sticky,omitempty" json:"sticky,omitempty"`
+	// Failover configures skipping the target services that fail consecutively.
+	Failover *FailoverConfig `yaml:"failover,omitempty" json:"failover,omitempty"`
+	// FailoverGroups are the target services grouped by priority, it is nil if there is neither priority nor failover.
+	FailoverGroups interface{} `yaml:"-" json:"-"`
 	// ReWrite redefines the interface path.
 	ReWrite string `yaml:"rewrite,omitempty" json:"rewrite,omitempty"`
 	// StripPath with true, the prefix is remove from the path
@@ -106,10 +199,137 @@ type RouterItem struct {
 	// This is done to prevent explosion of monitoring dimensions in the called interface,
 	// especially for interfaces like /a/{article_id}.
 	ReportMethod bool `yaml:"report_method,omitempty" json:"report_method,omitempty"`
+	// Timeout is the upstream timeout in milliseconds, which overrides the timeout of the client. It is the total
+	// timeout of all attempts when retry is enabled.
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Retry is the retry policy of the upstream services.
+	Retry *RetryConfig `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// CircuitBreaker is the circuit breaker of the upstream services.
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker,omitempty" json:"circuit_breaker,omitempty"`
+	// Shadow copies a sampled percentage of requests to another upstream service.
+	Shadow *ShadowConfig `yaml:"shadow,omitempty" json:"shadow,omitempty"`
 	// Plugins List of plugins
 	Plugins []*Plugin `yaml:"plugins,omitempty" json:"plugins,omitempty"`
 }
 
+// StickyConfig is the configuration of sticky target selection. On the first selection, the gateway sets a signed
+// cookie naming the selected target service, and later requests honor the cookie while the target service still
+// exists and has non-zero weight.
+type StickyConfig struct {
+	// CookieName is the name of the cookie, default is gw_sticky.
+	CookieName string `yaml:"cookie_name,omitempty" json:"cookie_name,omitempty"`
+	// TTL is the max age of the cookie in seconds, the cookie is a session cookie if it is zero.
+	TTL int `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+	// SignKey is the HMAC-SHA256 key used to sign the cookie, required.
+	SignKey string `yaml:"sign_key,omitempty" json:"sign_key,omitempty"`
+}
+
+// RetryConfig is the configuration of retrying the upstream request. Retries are sent to a node that has not been
+// tried by the selector of the upstream service if possible.
+type RetryConfig struct {
+	// Attempts is the max number of attempts including the first one, the request is not retried if it is less than 2.
+	Attempts int `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	// PerTryTimeout is the timeout of each attempt in milliseconds, the default is the remaining time of the timeout.
+	PerTryTimeout int `yaml:"per_try_timeout,omitempty" json:"per_try_timeout,omitempty"`
+	// RetryOn are the conditions to retry, optional values are connect_error, timeout and the upstream HTTP status
+	// codes such as 502. The default is connect_error, 502, 503 and 504.
+	RetryOn []string `yaml:"retry_on,omitempty" json:"retry_on,omitempty"`
+	// RetriableCodes are the tRPC error codes to retry, such as 141.
+	RetriableCodes []int `yaml:"retriable_codes,omitempty" json:"retriable_codes,omitempty"`
+	// NonIdempotent allows retrying the non-idempotent HTTP methods, such as POST and PATCH. Only GET, HEAD, OPTIONS,
+	// PUT, DELETE and TRACE are retried by default.
+	NonIdempotent bool `yaml:"non_idempotent,omitempty" json:"non_idempotent,omitempty"`
+	// BaseInterval is the base interval of the exponential backoff in milliseconds, the default is 25ms. The actual
+	// interval is randomized between zero and the backoff.
+	BaseInterval int `yaml:"base_interval,omitempty" json:"base_interval,omitempty"`
+	// MaxInterval is the max interval of the backoff in milliseconds, the default is 10 times the BaseInterval.
+	MaxInterval int `yaml:"max_interval,omitempty" json:"max_interval,omitempty"`
+	// Policy is the retry policy parsed from the configuration.
+	Policy interface{} `yaml:"-" json:"-"`
+}
+
+// CircuitBreakerConfig is the configuration of the circuit breaker of the target service. The circuit breaker opens
+// when the error ratio or the slow call ratio over the rolling window exceeds the threshold, rejects the requests
+// with the fallback while open, and lets a few probing requests through after the open duration to decide whether to
+// close.
+type CircuitBreakerConfig struct {
+	// Scope is the key of the circuit breaker, optional values are service and router. The default service shares
+	// the circuit breaker between the routers of the same upstream service and configuration, and router uses a
+	// circuit breaker for each router.
+	Scope string `yaml:"scope,omitempty" json:"scope,omitempty"`
+	// Window is the seconds of the rolling window, default is 10.
+	Window int `yaml:"window,omitempty" json:"window,omitempty"`
+	// MinRequests is the minimum number of requests in the window to calculate the ratios, default is 20.
+	MinRequests int `yaml:"min_requests,omitempty" json:"min_requests,omitempty"`
+	// ErrorRatio is the ratio of errors in the window to open the circuit breaker, such as 0.5, 0 means disabled.
+	ErrorRatio float64 `yaml:"error_ratio,omitempty" json:"error_ratio,omitempty"`
+	// SlowCallDuration is the duration in milliseconds above which the request is counted as a slow call.
+	SlowCallDuration int `yaml:"slow_call_duration,omitempty" json:"slow_call_duration,omitempty"`
+	// SlowCallRatio is the ratio of slow calls in the window to open the circuit breaker, 0 means disabled.
+	SlowCallRatio float64 `yaml:"slow_call_ratio,omitempty" json:"slow_call_ratio,omitempty"`
+	// OpenDuration is the seconds for which the circuit breaker stays open before half-open, default is 30.
+	OpenDuration int `yaml:"open_duration,omitempty" json:"open_duration,omitempty"`
+	// HalfOpenRequests is the number of probing requests in the half-open state, the circuit breaker closes if all
+	// succeed and opens again if any fails, default is 5.
+	HalfOpenRequests int `yaml:"half_open_requests,omitempty" json:"half_open_requests,omitempty"`
+	// Fallback is the response while the circuit breaker is open.
+	Fallback *CircuitBreakerFallback `yaml:"fallback,omitempty" json:"fallback,omitempty"`
+}
+
+// CircuitBreakerFallback is the response while the circuit breaker is open. The request fails over to another target
+// service if Failover is enabled and there is one, otherwise the static body is returned if configured, otherwise
+// the error code is returned.
+type CircuitBreakerFallback struct {
+	// Failover forwards the request to the target service of the next priority.
+	Failover bool `yaml:"failover,omitempty" json:"failover,omitempty"`
+	// Body is the static response body.
+	Body string `yaml:"body,omitempty" json:"body,omitempty"`
+	// ContentType is the content type of the static response body.
+	ContentType string `yaml:"content_type,omitempty" json:"content_type,omitempty"`
+	// Status is the HTTP status of the static response body, default is 200.
+	Status int `yaml:"status,omitempty" json:"status,omitempty"`
+	// Code is the error code returned if there is no static response body, default is 1014, which is mapped to the
+	// HTTP status 503.
+	Code int `yaml:"code,omitempty" json:"code,omitempty"`
+}
+
+// FailoverConfig is the configuration of skipping the failed target services. Connect errors, timeouts and overload
+// errors are counted as failures.
+type FailoverConfig struct {
+	// MaxFailures is the number of consecutive failures after which the target service is skipped, 0 means never
+	// skipped.
+	MaxFailures int `yaml:"max_failures,omitempty" json:"max_failures,omitempty"`
+	// CoolDown is the seconds for which the target service is skipped, default is 30.
+	CoolDown int `yaml:"cool_down,omitempty" json:"cool_down,omitempty"`
+	// NonIdempotent allows failing over the non-idempotent HTTP methods, such as POST and PATCH, after timeouts,
+	// network errors and overload errors, which may have been applied by the upstream. By default they only fail over
+	// on the connect errors and the route errors, where the request was never sent.
+	NonIdempotent bool `yaml:"non_idempotent,omitempty" json:"non_idempotent,omitempty"`
+}
+
+// ShadowConfig is the configuration of the traffic shadowing. The sampled requests are copied to the shadow service
+// asynchronously after the primary response, and the shadow responses are discarded after being compared with the
+// primary responses.
+type ShadowConfig struct {
+	// Service is the name of the shadow service in the client configuration.
+	Service string `yaml:"service,omitempty" json:"service,omitempty"`
+	// Percent is the percentage of the shadowed requests, such as 0.5 for 0.5%.
+	Percent float64 `yaml:"percent,omitempty" json:"percent,omitempty"`
+	// Timeout is the timeout in milliseconds of the shadow requests, 0 means the timeout of the client.
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// Compare enables comparing the shadow responses with the primary responses.
+	Compare bool `yaml:"compare,omitempty" json:"compare,omitempty"`
+	// IgnorePaths are the paths of the JSON fields ignored in the comparison, such as data.timestamp, * matches any
+	// key or array index.
+	IgnorePaths []string `yaml:"ignore_paths,omitempty" json:"ignore_paths,omitempty"`
+	// MaxDiffs is the maximum number of differences logged for each mismatch, default is 5.
+	MaxDiffs int `yaml:"max_diffs,omitempty" json:"max_diffs,omitempty"`
+	// Target is the shadow service parsed from Service.
+	Target *TargetService `yaml:"-" json:"-"`
+	// Ignore is the parsed IgnorePaths.
+	Ignore interface{} `yaml:"-" json:"-"`
+}
+
 // BackendConfig refers to the configuration of the upstream service.
 type BackendConfig struct {
 	// BackendConfig is used to configure the upstream service in trpc.
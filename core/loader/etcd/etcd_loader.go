@@ -16,19 +16,17 @@ package etcd
 
 import (
 	"context"
-	"fmt"
+	"sync"
 
-	"gopkg.in/yaml.v3"
 	etcd "trpc.group/trpc-go/trpc-config-etcd"
 	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
 	"trpc.group/trpc-go/trpc-gateway/core/config"
-	"trpc.group/trpc-go/trpc-gateway/core/entity"
-	"trpc.group/trpc-go/trpc-gateway/core/router"
-	"trpc.group/trpc-go/trpc-gateway/internal/util"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/prefix"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
 	tconfig "trpc.group/trpc-go/trpc-go/config"
 	"trpc.group/trpc-go/trpc-go/errs"
 	"trpc.group/trpc-go/trpc-go/log"
-	"trpc.group/trpc-go/trpc-go/metrics"
 )
 
 const (
@@ -38,35 +36,37 @@ const (
 	routerConfKey = "router_conf"
 )
 
+// defaultLoader is the registered etcd loader
+var defaultLoader = &ConfLoader{}
+
 func init() {
-	config.RegisterConfLoader(etdRouter, &ConfLoader{})
+	config.RegisterConfLoader(etdRouter, defaultLoader)
+}
+
+// Revisions returns the revisions of the keys of the registered etcd loader in the prefix mode, for auditing
+func Revisions() []*prefix.Revision {
+	return defaultLoader.Revisions()
 }
 
-// ConfLoader is the router configuration loader with etcd.
+// ConfLoader is the router configuration loader with etcd. The configuration is stored in the router_conf key, or in
+// the keys under DefaultPrefix in the prefix mode.
 type ConfLoader struct {
+	mu     sync.Mutex
+	prefix *prefixWatcher
 }
 
-// LoadConf loads the configuration from etcd.
+// LoadConf loads the configuration from etcd. The gateway boots from the snapshot if etcd is unreachable or the
+// configuration is invalid.
 func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) (err error) {
-	conf, err := tconfig.GetString(routerConfKey)
-	if err != nil {
-		return gerrs.Wrap(err, "get router from etcd err")
-	}
-
-	log.Infof("router config:%s", conf)
-	if len(conf) == 0 {
-		// No configuration obtained, return
-		return errs.New(gerrs.ErrWrongConfig, "get no router config")
+	if DefaultPrefix != "" {
+		return l.loadPrefix(ctx, protocol, DefaultPrefix)
 	}
-	conf = util.ExpandEnv(conf)
-	var proxyConfig entity.ProxyConfig
-	err = yaml.Unmarshal([]byte(conf), &proxyConfig)
-	if err != nil {
-		return gerrs.Wrap(err, "unmarshal_router_conf_err")
-	}
-	err = router.GetRouter(protocol).InitRouterConfig(ctx, &proxyConfig)
-	if err != nil {
-		return gerrs.Wrap(err, "load proxy config err")
+	if err := l.load(ctx, protocol); err != nil {
+		log.ErrorContextf(ctx, "load router conf from etcd err:%s", err)
+		if rerr := snapshot.RestoreRaw(ctx, snapshot.File(protocol), protocol); rerr != nil {
+			return gerrs.Wrapf(err, "restore snapshot err:%s", rerr)
+		}
+		l.reportErr(err)
 	}
 
 	// Watch for remote configuration changes
@@ -77,8 +77,7 @@ func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) (err error)
 	go func() {
 		for r := range c {
 			log.Infof("event: %d, value: %s", r.Event(), r.Value())
-			buf := []byte(util.ExpandEnv(r.Value()))
-			if err := l.parseAndInit(buf, protocol); err != nil {
+			if err := l.parseAndInit([]byte(r.Value()), protocol); err != nil {
 				log.Errorf("reload router conf failed: %s", err)
 				l.reportErr(err)
 			}
@@ -88,39 +87,73 @@ func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) (err error)
 	return
 }
 
-// reportErr reports errors for monitoring and alerting purposes
-func (l *ConfLoader) reportErr(err error) {
-	if err == nil {
-		return
+// loadPrefix loads the configuration from the keys under the prefix, and watches them for changes
+func (l *ConfLoader) loadPrefix(ctx context.Context, protocol, pfx string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.prefix != nil {
+		return nil
 	}
-	// 失败了上报metric，配置监控报警
-	dims := []*metrics.Dimension{
-		{
-			Name:  "err_code",
-			Value: fmt.Sprint(errs.Code(err)),
-		},
-		{
-			Name:  "err_msg",
-			Value: err.Error(),
-		},
+	cli, err := newClient()
+	if err != nil {
+		return gerrs.Wrap(err, "create etcd client err")
+	}
+	w := newPrefixWatcher(cli, pfx, protocol, l.reportErr)
+	rev, err := w.sync(ctx)
+	if err != nil {
+		log.ErrorContextf(ctx, "load router conf from etcd prefix %s err:%s", pfx, err)
+		if rerr := w.restore(ctx); rerr != nil {
+			return gerrs.Wrapf(err, "restore snapshot err:%s", rerr)
+		}
+		l.reportErr(err)
 	}
-	indices := []*metrics.Metrics{
-		metrics.NewMetrics("reload_router_err_count", float64(1), metrics.PolicySUM),
+	l.prefix = w
+	go w.run(context.Background(), rev)
+	return nil
+}
+
+// Revisions returns the revisions of the keys in the prefix mode, which tell the accepted revision and the rejected
+// change of each key. It returns nil in the single key mode.
+func (l *ConfLoader) Revisions() []*prefix.Revision {
+	l.mu.Lock()
+	w := l.prefix
+	l.mu.Unlock()
+	if w == nil {
+		return nil
 	}
-	err = metrics.Report(metrics.NewMultiDimensionMetricsX(gerrs.GatewayERRKey, dims, indices))
+	return w.revisions()
+}
+
+// load loads the configuration from etcd
+func (l *ConfLoader) load(ctx context.Context, protocol string) error {
+	conf, err := tconfig.GetString(routerConfKey)
 	if err != nil {
-		log.Errorf("report reload err count failed:%s", err)
+		return gerrs.Wrap(err, "get router from etcd err")
+	}
+
+	log.Infof("router config:%s", conf)
+	if len(conf) == 0 {
+		// No configuration obtained, return
+		return errs.New(gerrs.ErrWrongConfig, "get no router config")
+	}
+	// Save the accepted configuration to the snapshot before expanding the env, so that the secrets are not persisted
+	if err := snapshot.InitRaw(ctx, snapshot.File(protocol), protocol, []byte(conf)); err != nil {
+		return gerrs.Wrap(err, "load proxy config err")
 	}
+	return nil
 }
 
-// parseAndInit parses and initializes the configuration
-func (l *ConfLoader) parseAndInit(buf []byte, protocol string) error {
-	var proxyConfig entity.ProxyConfig
-	if err := yaml.Unmarshal(buf, &proxyConfig); err != nil {
-		return gerrs.Wrap(err, "unmarshal proxy config err")
+// reportErr reports errors for monitoring and alerting purposes
+func (l *ConfLoader) reportErr(err error) {
+	if err == nil {
+		return
 	}
+	loader.DefaultReportReload(etdRouter, err)
+}
 
-	if err := router.GetRouter(protocol).InitRouterConfig(context.Background(), &proxyConfig); err != nil {
+// parseAndInit expands the env, parses and initializes the configuration
+func (l *ConfLoader) parseAndInit(buf []byte, protocol string) error {
+	if err := snapshot.InitRaw(context.Background(), snapshot.File(protocol), protocol, buf); err != nil {
 		return gerrs.Wrap(err, "init router err")
 	}
 	return nil
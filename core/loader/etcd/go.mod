@@ -3,10 +3,15 @@ module trpc.group/trpc-go/trpc-gateway/core/loader/etcd
 go 1.18
 
 require (
+	github.com/golang/mock v1.6.0
+	github.com/stretchr/testify v1.8.2
+	github.com/valyala/fasthttp v1.45.0
+	go.etcd.io/etcd/api/v3 v3.5.9
+	go.etcd.io/etcd/client/v3 v3.5.9
 	gopkg.in/yaml.v3 v3.0.1
 	trpc.group/trpc-go/trpc-config-etcd v0.0.0-20230829073930-07f202f52c32
 	trpc.group/trpc-go/trpc-gateway v1.0.0
-	trpc.group/trpc-go/trpc-go v0.0.0-20231008070952-27a655b3e79c
+	trpc.group/trpc-go/trpc-go v1.0.3
 )
 
 require (
@@ -16,6 +21,7 @@ require (
 	github.com/armon/go-radix v1.0.0 // indirect
 	github.com/coreos/go-semver v0.3.0 // indirect
 	github.com/coreos/go-systemd/v22 v22.3.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
@@ -30,23 +36,23 @@ require (
 	github.com/modern-go/reflect2 v1.0.2 // indirect
 	github.com/panjf2000/ants/v2 v2.4.7 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/fasthttp v1.45.0 // indirect
-	go.etcd.io/etcd/api/v3 v3.5.9 // indirect
 	go.etcd.io/etcd/client/pkg/v3 v3.5.9 // indirect
-	go.etcd.io/etcd/client/v3 v3.5.9 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/automaxprocs v1.3.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
 	go.uber.org/zap v1.24.0 // indirect
-	golang.org/x/net v0.8.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/genproto v0.0.0-20211118181313-81c1377c94b1 // indirect
 	google.golang.org/grpc v1.41.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
-	trpc.group/trpc-go/tnet v0.0.0-20230810071536-9d05338021cf // indirect
-	trpc.group/trpc/trpc-protocol/pb/go/trpc v0.0.0-20230803031059-de4168eb5952 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+	trpc.group/trpc-go/tnet v1.0.1 // indirect
+	trpc.group/trpc/trpc-protocol/pb/go/trpc v1.0.0 // indirect
 )
+
+replace trpc.group/trpc-go/trpc-gateway => ../../..
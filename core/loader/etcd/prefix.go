@@ -0,0 +1,268 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package etcd
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/prefix"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-gateway/internal/util"
+	trpc "trpc.group/trpc-go/trpc-go"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+const (
+	// etcdPluginType and etcdPluginName locate the etcd configuration in trpc_go.yaml
+	etcdPluginType = "config"
+	etcdPluginName = "etcd"
+
+	// resyncInterval is the interval of retrying to get the keys when etcd is unreachable
+	resyncInterval = 5 * time.Second
+)
+
+// DefaultPrefix enables the prefix mode if it is not empty, in which the routes, the clients and the global plugins
+// are stored in their own keys under the prefix, such as /gateway/routes/<id>
+var DefaultPrefix = ""
+
+func init() {
+	flag.StringVar(&DefaultPrefix, "router_etcd_prefix", DefaultPrefix, "etcd key prefix of the router conf items")
+}
+
+// kv is the etcd client used by the prefix mode
+type kv interface {
+	Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error)
+	Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan
+}
+
+// newClient creates the etcd client with the configuration of plugins.config.etcd
+func newClient() (*clientv3.Client, error) {
+	node, ok := trpc.GlobalConfig().Plugins[etcdPluginType][etcdPluginName]
+	if !ok {
+		return nil, errs.New(gerrs.ErrWrongConfig, "no etcd config found, configure plugins.config.etcd")
+	}
+	cfg := clientv3.Config{}
+	if err := node.Decode(&cfg); err != nil {
+		return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "decode etcd config err")
+	}
+	cli, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, gerrs.Wrap(err, "new etcd client err")
+	}
+	return cli, nil
+}
+
+// prefixWatcher loads the router configuration from the keys under the prefix, and watches them for changes
+type prefixWatcher struct {
+	prefix   string
+	protocol string
+	cli      kv
+	report   func(err error)
+
+	mu    sync.Mutex
+	store *prefix.Store
+	// dirty means the accepted items have not been applied to the router, which is true before the first load
+	dirty bool
+}
+
+// newPrefixWatcher creates a watcher of the prefix
+func newPrefixWatcher(cli kv, pfx, protocol string, report func(err error)) *prefixWatcher {
+	return &prefixWatcher{
+		prefix:   pfx,
+		protocol: protocol,
+		cli:      cli,
+		report:   report,
+		store:    prefix.NewStore(nil),
+		dirty:    true,
+	}
+}
+
+// newChange creates the change of the value with the env expanded, the change is rejected if the expansion fails.
+// The value before expansion is kept as the raw value for the snapshot.
+func newChange(key string, value []byte, revision int64) *prefix.Change {
+	expanded, err := util.ExpandRemoteEnv(string(value))
+	if err != nil {
+		return &prefix.Change{Key: key, Value: value, Revision: revision, Err: err}
+	}
+	return &prefix.Change{Key: key, Value: []byte(expanded), Raw: value, Revision: revision}
+}
+
+// sync gets all the keys under the prefix and applies them, the keys not found are deleted. It returns the revision
+// of etcd to watch from.
+func (w *prefixWatcher) sync(ctx context.Context) (int64, error) {
+	rsp, err := w.cli.Get(ctx, w.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, gerrs.Wrap(err, "get router conf keys from etcd err")
+	}
+	found := make(map[string]struct{}, len(rsp.Kvs))
+	changes := make([]*prefix.Change, 0, len(rsp.Kvs))
+	for _, kv := range rsp.Kvs {
+		key := strings.TrimPrefix(string(kv.Key), w.prefix)
+		found[key] = struct{}{}
+		changes = append(changes, newChange(key, kv.Value, kv.ModRevision))
+	}
+	w.mu.Lock()
+	for _, r := range w.store.Revisions() {
+		if _, ok := found[r.Key]; !ok && !r.Deleted {
+			changes = append(changes, &prefix.Change{Key: r.Key, Revision: rsp.Header.Revision, Deleted: true})
+		}
+	}
+	w.mu.Unlock()
+	if err := w.apply(ctx, changes); err != nil {
+		return 0, err
+	}
+	return rsp.Header.Revision, nil
+}
+
+// apply applies the changes, and initializes the router with the accepted items if they change. The rejected keys
+// are only reported, while the accepted ones take effect. The router is not initialized without any router item, so
+// that the gateway keeps the last configuration.
+func (w *prefixWatcher) apply(ctx context.Context, changes []*prefix.Change) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.store.Apply(ctx, changes...) {
+		w.dirty = true
+	}
+	if err := w.store.Err(); err != nil {
+		w.report(err)
+	}
+	if !w.dirty {
+		return nil
+	}
+	rf, err := w.store.Config()
+	if err != nil {
+		return gerrs.Wrap(err, "assemble router conf err")
+	}
+	if len(rf.Router) == 0 {
+		return errs.Newf(gerrs.ErrWrongConfig, "get no router config under etcd prefix %s", w.prefix)
+	}
+	// The raw values of the keys are saved to the snapshot, so that the secrets from the env are not persisted
+	buf, err := yaml.Marshal(w.store.RawValues())
+	if err != nil {
+		log.ErrorContextf(ctx, "marshal router conf snapshot err:%s", err)
+	}
+	if err := snapshot.InitWith(ctx, snapshot.File(w.protocol), w.protocol, rf, buf); err != nil {
+		return gerrs.Wrap(err, "init router err")
+	}
+	w.dirty = false
+	log.InfoContextf(ctx, "router conf reloaded from etcd prefix %s", w.prefix)
+	return nil
+}
+
+// restore initializes the router with the snapshot of the raw values of the keys, which are expanded and validated
+// again like the values from etcd
+func (w *prefixWatcher) restore(ctx context.Context) error {
+	file := snapshot.File(w.protocol)
+	buf, err := snapshot.Read(file)
+	if err != nil {
+		return gerrs.Wrap(err, "load router conf snapshot err")
+	}
+	var values map[string]string
+	if err := yaml.Unmarshal(buf, &values); err != nil {
+		return errs.Wrapf(err, gerrs.ErrWrongConfig, "unmarshal snapshot %s err", file)
+	}
+	changes := make([]*prefix.Change, 0, len(values))
+	for key, value := range values {
+		changes = append(changes, newChange(key, []byte(value), 0))
+	}
+	store := prefix.NewStore(nil)
+	store.Apply(ctx, changes...)
+	rf, err := store.Config()
+	if err != nil {
+		return gerrs.Wrap(err, "assemble router conf snapshot err")
+	}
+	if len(rf.Router) == 0 {
+		return errs.Newf(gerrs.ErrWrongConfig, "get no router config from snapshot %s", file)
+	}
+	if err := router.GetRouter(w.protocol).InitRouterConfig(ctx, rf); err != nil {
+		return gerrs.Wrap(err, "init router from snapshot err")
+	}
+	log.InfoContextf(ctx, "router conf restored from snapshot:%s", file)
+	return nil
+}
+
+// run watches the prefix from the revision, a zero revision means the keys have not been synced
+func (w *prefixWatcher) run(ctx context.Context, rev int64) {
+	for ctx.Err() == nil {
+		if rev == 0 {
+			r, err := w.sync(ctx)
+			if err != nil {
+				log.ErrorContextf(ctx, "sync router conf from etcd prefix %s err:%s", w.prefix, err)
+				w.report(err)
+				select {
+				case <-ctx.Done():
+				case <-time.After(resyncInterval):
+				}
+				continue
+			}
+			rev = r
+		}
+		rev = w.watch(ctx, rev)
+		select {
+		case <-ctx.Done():
+		case <-time.After(resyncInterval):
+		}
+	}
+}
+
+// watch watches the prefix from the revision until the watch fails or is closed, and returns the revision to watch from, which is
+// zero if the revision has been compacted
+func (w *prefixWatcher) watch(ctx context.Context, rev int64) int64 {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := w.cli.Watch(clientv3.WithRequireLeader(wctx), w.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+	for rsp := range c {
+		if rsp.CompactRevision != 0 {
+			log.WarnContextf(ctx, "etcd revision %d compacted, sync router conf again", rev)
+			return 0
+		}
+		if err := rsp.Err(); err != nil {
+			log.ErrorContextf(ctx, "watch router conf from etcd prefix %s err:%s", w.prefix, err)
+			return rev
+		}
+		changes := make([]*prefix.Change, 0, len(rsp.Events))
+		for _, ev := range rsp.Events {
+			key := strings.TrimPrefix(string(ev.Kv.Key), w.prefix)
+			change := &prefix.Change{Key: key, Revision: ev.Kv.ModRevision, Deleted: true}
+			if ev.Type != clientv3.EventTypeDelete {
+				change = newChange(key, ev.Kv.Value, ev.Kv.ModRevision)
+			}
+			log.Infof("router conf key %s changed, revision: %d, deleted: %t", change.Key, change.Revision,
+				change.Deleted)
+			changes = append(changes, change)
+		}
+		if err := w.apply(ctx, changes); err != nil {
+			log.ErrorContextf(ctx, "reload router conf err:%s", err)
+			w.report(err)
+		}
+		rev = rsp.Header.Revision
+	}
+	return rev
+}
+
+// revisions returns the revisions of the keys
+func (w *prefixWatcher) revisions() []*prefix.Revision {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.store.Revisions()
+}
@@ -0,0 +1,171 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package etcd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+)
+
+const testPrefix = "/gateway/"
+
+type fakeKV struct {
+	kvs   []*mvccpb.KeyValue
+	rev   int64
+	watch chan clientv3.WatchResponse
+}
+
+func (f *fakeKV) Get(context.Context, string, ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	return &clientv3.GetResponse{Header: &etcdserverpb.ResponseHeader{Revision: f.rev}, Kvs: f.kvs}, nil
+}
+
+func (f *fakeKV) Watch(context.Context, string, ...clientv3.OpOption) clientv3.WatchChan {
+	return f.watch
+}
+
+func keyValue(key, value string, rev int64) *mvccpb.KeyValue {
+	return &mvccpb.KeyValue{Key: []byte(testPrefix + key), Value: []byte(value), ModRevision: rev}
+}
+
+func Test_prefixWatcher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	r := router.NewFastHTTPRouter()
+	router.RegisterRouter("etcd_test", r)
+
+	f := &fakeKV{rev: 3, watch: make(chan clientv3.WatchResponse)}
+	var reported []error
+	w := newPrefixWatcher(f, testPrefix, "etcd_test", func(err error) { reported = append(reported, err) })
+
+	// No router is accepted
+	_, err := w.sync(context.Background())
+	assert.NotNil(t, err)
+
+	f.kvs = []*mvccpb.KeyValue{
+		keyValue("clients/foo", "target: ip://127.0.0.1:8080\nnetwork: tcp\nprotocol: fasthttp", 1),
+		keyValue("routes/foo", "method: /foo\ntarget_service:\n  - service: foo", 2),
+		keyValue("routes/bar", "method: /bar\ntarget_service:\n  - service: bar", 3),
+	}
+	rev, err := w.sync(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, int64(3), rev)
+	assert.Len(t, reported, 1)
+	revisions := w.revisions()
+	require.Len(t, revisions, 3)
+	assert.Equal(t, int64(2), revisions[2].Accepted)
+	assert.NotEmpty(t, revisions[1].Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.run(ctx, rev)
+		close(done)
+	}()
+	f.watch <- clientv3.WatchResponse{
+		Header: etcdserverpb.ResponseHeader{Revision: 5},
+		Events: []*clientv3.Event{
+			{Type: clientv3.EventTypeDelete, Kv: keyValue("routes/bar", "", 4)},
+			{Type: clientv3.EventTypePut, Kv: keyValue("routes/baz", "method: /baz\ntarget_service:\n  - service: foo", 5)},
+		},
+	}
+	cancel()
+	close(f.watch)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watcher not stopped")
+	}
+	revisions = w.revisions()
+	require.Len(t, revisions, 3)
+	assert.Equal(t, "routes/baz", revisions[1].Key)
+	assert.Equal(t, int64(5), revisions[1].Accepted)
+}
+
+func Test_newChange(t *testing.T) {
+	t.Setenv("GW_TARGET", "ip://127.0.0.1:8080")
+	change := newChange("clients/foo", []byte("target: ${GW_TARGET}"), 1)
+	assert.Nil(t, change.Err)
+	assert.Equal(t, "target: ip://127.0.0.1:8080", string(change.Value))
+
+	assert.Equal(t, "target: ${GW_TARGET}", string(change.Raw))
+
+	change = newChange("clients/foo", []byte("target: ${GW_MISSING:?target required}"), 2)
+	assert.ErrorContains(t, change.Err, "target required")
+	assert.Equal(t, int64(2), change.Revision)
+
+	// The values from etcd can not read the local files
+	change = newChange("clients/foo", []byte("target: ${file:/etc/hostname}"), 3)
+	assert.ErrorContains(t, change.Err, "only allowed in the local configuration")
+}
+
+func Test_prefixWatcher_snapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	r := router.NewFastHTTPRouter()
+	router.RegisterRouter("etcd_snapshot_test", r)
+	file := filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	snapshot.SetFile("etcd_snapshot_test", file)
+	defer snapshot.SetFile("etcd_snapshot_test", "")
+	t.Setenv("GW_TARGET", "ip://127.0.0.1:8080")
+
+	f := &fakeKV{rev: 2, kvs: []*mvccpb.KeyValue{
+		keyValue("clients/foo", "target: ${GW_TARGET}\nnetwork: tcp\nprotocol: fasthttp", 1),
+		keyValue("routes/foo", "method: /foo\ntarget_service:\n  - service: foo", 2),
+	}}
+	w := newPrefixWatcher(f, testPrefix, "etcd_snapshot_test", func(error) {})
+	_, err := w.sync(context.Background())
+	require.Nil(t, err)
+
+	// The snapshot keeps the env references of the values
+	buf, err := os.ReadFile(file)
+	require.Nil(t, err)
+	assert.NotContains(t, string(buf), "127.0.0.1")
+	assert.Contains(t, string(buf), "${GW_TARGET}")
+
+	// The values are expanded again when restored
+	w = newPrefixWatcher(f, testPrefix, "etcd_snapshot_test", func(error) {})
+	r = router.NewFastHTTPRouter()
+	router.RegisterRouter("etcd_snapshot_test", r)
+	require.Nil(t, w.restore(context.Background()))
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/foo")
+	ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+	svr, err := r.GetMatchRouter(http.WithRequestContext(ctx, fctx))
+	require.Nil(t, err)
+	assert.Equal(t, "ip://127.0.0.1:8080", svr.BackendConfig.Target)
+
+	assert.Nil(t, os.WriteFile(file, []byte("router: ["), 0600))
+	assert.NotNil(t, w.restore(context.Background()))
+	assert.Nil(t, os.WriteFile(file, []byte("{}"), 0600))
+	assert.NotNil(t, w.restore(context.Background()))
+	snapshot.SetFile("etcd_snapshot_test", "")
+	assert.NotNil(t, w.restore(context.Background()))
+}
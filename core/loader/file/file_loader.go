@@ -18,6 +18,9 @@ import (
 	"context"
 	"flag"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 	"trpc.group/trpc-go/trpc-gateway/common/errs"
@@ -35,40 +38,74 @@ var (
 	// DefaultRouterConfDir is the default router configuration directory, multiple files can be stored based on types,
 	// if available, this directory is loaded first, not required
 	DefaultRouterConfDir = "../conf/router.d/"
+	// DefaultRouterConfWatch enables reloading the configuration when the configuration files change, disabled by
+	// default
+	DefaultRouterConfWatch = false
+	// DefaultRouterConfDebounce is the quiet period after the last change of the configuration files before reloading
+	DefaultRouterConfDebounce = time.Second
 )
 
 func init() {
 	config.RegisterConfLoader(fileConfProvider, &ConfLoader{})
 
 	flag.StringVar(&DefaultRouterConfFile, "router", DefaultRouterConfFile, "router conf file")
+	flag.BoolVar(&DefaultRouterConfWatch, "router_watch", DefaultRouterConfWatch, "reload router conf on changes")
 }
 
 // ConfLoader is a file configuration loader
 type ConfLoader struct {
+	mu      sync.Mutex
+	watcher *watcher
 }
 
-// LoadConf loads the configuration
+// LoadConf loads the configuration, and watches the configuration files to reload if enabled
 func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) error {
+	file, dir := DefaultRouterConfFile, DefaultRouterConfDir
+	if err := loadConf(ctx, protocol, file, dir); err != nil {
+		return err
+	}
+	if !DefaultRouterConfWatch {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.watcher != nil {
+		return nil
+	}
+	w, err := newWatcher(file, dir, DefaultRouterConfDebounce, func() error {
+		// The configuration is swapped atomically by the router only if it is valid
+		return loadConf(context.Background(), protocol, file, dir)
+	})
+	if err != nil {
+		return errs.Wrap(err, "watch router conf err")
+	}
+	l.watcher = w
+	return nil
+}
+
+// loadConf loads the configuration directory and the main configuration file, and initializes the router
+func loadConf(ctx context.Context, protocol, file, dir string) error {
 	var rf entity.ProxyConfig
 	// If there are configurations in the directory, try to read scattered configurations first
-	files, err := os.ReadDir(DefaultRouterConfDir)
+	files, err := os.ReadDir(dir)
 	if err != nil && !os.IsNotExist(err) {
 		return errs.Wrap(err, "read dir err")
 	}
 	for _, f := range files {
-		if f.IsDir() {
+		// Skip the hidden files, such as the ..data symlink of a Kubernetes configmap
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
 			continue
 		}
 
 		// If configured, ensure accuracy
-		if err := loadAndAppend(DefaultRouterConfDir+f.Name(), &rf); err != nil {
-			return errs.Wrapf(err, "load %s config err", DefaultRouterConfDir+f.Name())
+		if err := loadAndAppend(dir+f.Name(), &rf); err != nil {
+			return errs.Wrapf(err, "load %s config err", dir+f.Name())
 		}
 	}
 
 	// Load the main configuration
-	if err := loadAndAppend(DefaultRouterConfFile, &rf); err != nil {
-		return errs.Wrapf(err, "load %s config err", DefaultRouterConfFile)
+	if err := loadAndAppend(file, &rf); err != nil {
+		return errs.Wrapf(err, "load %s config err", file)
 	}
 
 	if err := router.GetRouter(protocol).InitRouterConfig(ctx, &rf); err != nil {
@@ -86,6 +123,21 @@ func loadAndAppend(filename string, config *entity.ProxyConfig) error {
 	config.Router = append(config.Router, cfg.Router...)
 	config.Client = append(config.Client, cfg.Client...)
 	config.Plugins = append(config.Plugins, cfg.Plugins...)
+	config.Groups = append(config.Groups, cfg.Groups...)
+	// Templates are shared by all files, the later loaded one overrides the template with the same name
+	for name, tpl := range cfg.Templates {
+		if config.Templates == nil {
+			config.Templates = make(map[string]*entity.RouterItem)
+		}
+		config.Templates[name] = tpl
+	}
+	// The main configuration is loaded last, so it overrides the default route and the not found response
+	if cfg.DefaultRoute != nil {
+		config.DefaultRoute = cfg.DefaultRoute
+	}
+	if cfg.NotFound != nil {
+		config.NotFound = cfg.NotFound
+	}
 	return nil
 }
 
@@ -97,8 +149,11 @@ func getConfigFromFile(fileName string) (*entity.ProxyConfig, error) {
 	}
 
 	var cfg entity.ProxyConfig
-	buf = []byte(util.ExpandEnv(string(buf)))
-	if err := yaml.Unmarshal(buf, &cfg); err != nil {
+	expanded, err := util.ExpandEnv(string(buf))
+	if err != nil {
+		return nil, errs.Wrapf(err, "expand env of file [%s] failed", fileName)
+	}
+	if err := yaml.Unmarshal([]byte(expanded), &cfg); err != nil {
 		return nil, errs.Wrapf(err, "unmarshal filer %s", fileName)
 	}
 
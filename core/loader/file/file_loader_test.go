@@ -15,12 +15,16 @@ package file
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	"trpc.group/trpc-go/trpc-gateway/core/router"
 	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	gwplugin "trpc.group/trpc-go/trpc-gateway/plugin"
 )
 
 const configPathInvalid = "../../../testdata/trpc_go_error.yaml"
@@ -52,6 +56,13 @@ func Test_LoadConf(t *testing.T) {
 	assert.NotNil(t, err)
 	_, err = getConfigFromFile(configPath)
 	assert.Nil(t, err)
+
+	// A missing required env fails the load
+	f := filepath.Join(t.TempDir(), "router.yaml")
+	assert.Nil(t, os.WriteFile(f, []byte("client:\n  - name: foo\n    target: ${GW_TARGET:?target required}\n"), 0644))
+	_, err = getConfigFromFile(f)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "target required")
 }
 
 func Test_getConfigFromFile(t *testing.T) {
@@ -61,4 +72,66 @@ func Test_getConfigFromFile(t *testing.T) {
 	assert.NotNil(t, err)
 	_, err = getConfigFromFile(configPath)
 	assert.Nil(t, err)
+
+	// A missing required env fails the load
+	f := filepath.Join(t.TempDir(), "router.yaml")
+	assert.Nil(t, os.WriteFile(f, []byte("client:\n  - name: foo\n    target: ${GW_TARGET:?target required}\n"), 0644))
+	_, err = getConfigFromFile(f)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "target required")
+
+	// The content of a referenced file is not expanded again, even if it contains ${
+	t.Setenv("GW_SIGN_KEY", "secret")
+	key := filepath.Join(t.TempDir(), "sign_key")
+	assert.Nil(t, os.WriteFile(key, []byte("a${GW_SIGN_KEY}b\n"), 0644))
+	assert.Nil(t, os.WriteFile(f, []byte("plugins:\n  - name: sign\n    props:\n      key: ${file:"+key+"}\n"), 0644))
+	rf, err := getConfigFromFile(f)
+	assert.Nil(t, err)
+	decoder := &gwplugin.PropsDecoder{Props: rf.Plugins[0].Props}
+	p := &struct {
+		Key string `yaml:"key"`
+	}{}
+	assert.Nil(t, decoder.Decode(p))
+	assert.Equal(t, "a${GW_SIGN_KEY}b", p.Key)
+}
+
+func Test_loadAndAppend(t *testing.T) {
+	dir := t.TempDir()
+	sub, main := filepath.Join(dir, "sub.yaml"), filepath.Join(dir, "main.yaml")
+	assert.Nil(t, os.WriteFile(sub, []byte(`
+router:
+  - method: /a
+default_route:
+  target_service:
+    - service: legacy
+not_found:
+  status: 404
+templates:
+  base:
+    host: [a.example.com]
+  api:
+    strip_path: true
+groups:
+  - host: [g.example.com]
+    routes:
+      - method: /g
+`), 0644))
+	assert.Nil(t, os.WriteFile(main, []byte(`
+router:
+  - method: /b
+not_found:
+  status: 410
+templates:
+  base:
+    host: [b.example.com]
+`), 0644))
+	var rf entity.ProxyConfig
+	assert.Nil(t, loadAndAppend(sub, &rf))
+	assert.Nil(t, loadAndAppend(main, &rf))
+	assert.Len(t, rf.Router, 2)
+	assert.Equal(t, "legacy", rf.DefaultRoute.TargetService[0].Service)
+	assert.Equal(t, 410, rf.NotFound.Status)
+	assert.Len(t, rf.Groups, 1)
+	assert.Len(t, rf.Templates, 2)
+	assert.Equal(t, []string{"b.example.com"}, rf.Templates["base"].Host)
 }
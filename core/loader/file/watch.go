@@ -0,0 +1,145 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// watcher reloads the router configuration when the configuration files change. The directories are watched instead
+// of the files, so that the files replaced by rename, such as the symlink swaps of Kubernetes configmaps, are handled.
+type watcher struct {
+	// file and dir are the main configuration file and the configuration directory
+	file, dir string
+	// realFile is the main configuration file with the symlinks resolved, which changes on the symlink swaps
+	realFile string
+	// debounce is the quiet period after the last change before reloading
+	debounce time.Duration
+	// reload loads the configuration files and initializes the router
+	reload func() error
+	fw     *fsnotify.Watcher
+	done   chan struct{}
+	// exited is closed when the watching goroutine exits
+	exited chan struct{}
+}
+
+// newWatcher watches the directory of the main configuration file and the configuration directory if it exists
+func newWatcher(file, dir string, debounce time.Duration, reload func() error) (*watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "new fsnotify watcher err")
+	}
+	w := &watcher{
+		file:     filepath.Clean(file),
+		debounce: debounce,
+		reload:   reload,
+		fw:       fw,
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	w.realFile, _ = filepath.EvalSymlinks(w.file)
+	if err := fw.Add(filepath.Dir(w.file)); err != nil {
+		fw.Close()
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "watch %s err", filepath.Dir(w.file))
+	}
+	if dir != "" {
+		if _, err := os.Stat(dir); err == nil {
+			w.dir = filepath.Clean(dir)
+			if err := fw.Add(w.dir); err != nil {
+				fw.Close()
+				return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "watch %s err", w.dir)
+			}
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// run debounces the changes and reloads the configuration, a failed reload keeps the last good configuration
+func (w *watcher) run() {
+	defer close(w.exited)
+	var timer *time.Timer
+	var reload <-chan time.Time
+	for {
+		select {
+		case <-w.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case event, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if !w.changed(event) {
+				continue
+			}
+			log.Debugf("router conf changed, event:%s", event)
+			// Reload after the burst of changes, such as writing several files
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.NewTimer(w.debounce)
+			reload = timer.C
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("watch router conf err:%s", err)
+		case <-reload:
+			reload = nil
+			err := w.reload()
+			if err != nil {
+				log.Errorf("reload router conf failed: %s", err)
+			} else {
+				log.Infof("reload router conf success, file:%s", w.file)
+			}
+			loader.DefaultReportReload(fileConfProvider, err)
+		}
+	}
+}
+
+// changed checks if the event changes the configuration files. All files in the configuration directory are loaded,
+// while the other files in the directory of the main configuration file are ignored unless the main configuration
+// file resolves to another file, such as the ..data symlink of a configmap being swapped.
+func (w *watcher) changed(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if name == w.file || (w.dir != "" && filepath.Dir(name) == w.dir) {
+		return true
+	}
+	realFile, err := filepath.EvalSymlinks(w.file)
+	if err != nil || realFile == w.realFile {
+		return false
+	}
+	w.realFile = realFile
+	return true
+}
+
+// stop stops watching, and waits for the watching goroutine to exit
+func (w *watcher) stop() {
+	close(w.done)
+	w.fw.Close()
+	<-w.exited
+}
@@ -0,0 +1,144 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+)
+
+const testDebounce = 50 * time.Millisecond
+
+// newTestWatcher watches the files and counts the reloads
+func newTestWatcher(t *testing.T, file, dir string) (*watcher, *int32) {
+	var reloads int32
+	w, err := newWatcher(file, dir, testDebounce, func() error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	})
+	assert.Nil(t, err)
+	t.Cleanup(w.stop)
+	return w, &reloads
+}
+
+// waitReloads waits for the debounce and returns the count of reloads
+func waitReloads(reloads *int32) int32 {
+	time.Sleep(4 * testDebounce)
+	return atomic.LoadInt32(reloads)
+}
+
+func Test_watcher(t *testing.T) {
+	root := t.TempDir()
+	file, dir := filepath.Join(root, "router.yaml"), filepath.Join(root, "router.d")
+	assert.Nil(t, os.WriteFile(file, []byte("router:\n"), 0644))
+	assert.Nil(t, os.Mkdir(dir, 0755))
+	_, reloads := newTestWatcher(t, file, dir+"/")
+
+	// The burst of changes is reloaded once
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, os.WriteFile(file, []byte("router:\n"), 0644))
+	}
+	assert.Equal(t, int32(1), waitReloads(reloads))
+
+	// The files in the configuration directory are loaded
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("router:\n"), 0644))
+	assert.Equal(t, int32(2), waitReloads(reloads))
+
+	// The other files in the directory of the main configuration file are ignored
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "trpc_go.yaml"), []byte("server:\n"), 0644))
+	assert.Equal(t, int32(2), waitReloads(reloads))
+
+	// The file replaced by rename
+	tmp := filepath.Join(root, "router.yaml.tmp")
+	assert.Nil(t, os.WriteFile(tmp, []byte("router:\n"), 0644))
+	assert.Nil(t, os.Rename(tmp, file))
+	assert.Equal(t, int32(3), waitReloads(reloads))
+}
+
+func Test_watcher_configmap(t *testing.T) {
+	// The layout of a Kubernetes configmap volume
+	root := t.TempDir()
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "..v1"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "..v1", "router.yaml"), []byte("router:\n"), 0644))
+	assert.Nil(t, os.Symlink("..v1", filepath.Join(root, "..data")))
+	file := filepath.Join(root, "router.yaml")
+	assert.Nil(t, os.Symlink(filepath.Join("..data", "router.yaml"), file))
+	_, reloads := newTestWatcher(t, file, "")
+
+	// Swap the ..data symlink
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "..v2"), 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(root, "..v2", "router.yaml"), []byte("router:\n"), 0644))
+	assert.Nil(t, os.Symlink("..v2", filepath.Join(root, "..data_tmp")))
+	assert.Nil(t, os.Rename(filepath.Join(root, "..data_tmp"), filepath.Join(root, "..data")))
+	assert.Nil(t, os.RemoveAll(filepath.Join(root, "..v1")))
+	assert.Equal(t, int32(1), waitReloads(reloads))
+}
+
+func TestConfLoader_LoadConf_watch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	root := t.TempDir()
+	file := filepath.Join(root, "router.yaml")
+	assert.Nil(t, os.WriteFile(file, []byte("router:\n  - method: /a\n"), 0644))
+	oldFile, oldDir, oldDebounce, oldReport := DefaultRouterConfFile, DefaultRouterConfDir, DefaultRouterConfDebounce,
+		loader.DefaultReportReload
+	defer func() {
+		DefaultRouterConfFile, DefaultRouterConfDir, DefaultRouterConfDebounce, loader.DefaultReportReload = oldFile, oldDir,
+			oldDebounce, oldReport
+		DefaultRouterConfWatch = false
+	}()
+	DefaultRouterConfWatch = true
+	DefaultRouterConfFile, DefaultRouterConfDir, DefaultRouterConfDebounce = file, "", testDebounce
+	reports := make(chan error, 2)
+	loader.DefaultReportReload = func(_ string, err error) {
+		reports <- err
+	}
+
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("fasthttp", mockRouter)
+	gomock.InOrder(
+		mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil).Times(3),
+		mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid")),
+	)
+	l := &ConfLoader{}
+	assert.Nil(t, l.LoadConf(context.Background(), "fasthttp"))
+	defer l.watcher.stop()
+	w := l.watcher
+	// Watch once
+	assert.Nil(t, l.LoadConf(context.Background(), "fasthttp"))
+	assert.Same(t, w, l.watcher)
+
+	// Reload successfully
+	assert.Nil(t, os.WriteFile(file, []byte("router:\n  - method: /b\n"), 0644))
+	assert.Nil(t, <-reports)
+
+	// Failed to reload
+	assert.Nil(t, os.WriteFile(file, []byte("router:\n  - method: /c\n"), 0644))
+	assert.NotNil(t, <-reports)
+
+	// Failed to parse, the router is not initialized
+	assert.Nil(t, os.WriteFile(file, []byte("router: ["), 0644))
+	assert.NotNil(t, <-reports)
+}
@@ -0,0 +1,220 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package http provides a router config loader polling an HTTP endpoint.
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	stdhttp "net/http"
+	"sync"
+	"time"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/config"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+const (
+	httpConfProvider = "http_router"
+	pluginType       = "config"
+	pluginName       = "http_router"
+
+	defaultInterval = 10000
+	defaultTimeout  = 3000
+	// maxConfSize is the max size of the router configuration
+	maxConfSize = 64 << 20
+)
+
+func init() {
+	config.RegisterConfLoader(httpConfProvider, &ConfLoader{})
+	plugin.Register(pluginName, &Plugin{})
+}
+
+// Options is the configuration of the HTTP loader, configured in plugins.config.http_router of trpc_go.yaml
+type Options struct {
+	// URL is the address of the router configuration, required
+	URL string `yaml:"url"`
+	// Interval is the polling interval in milliseconds, default is 10000
+	Interval int `yaml:"interval"`
+	// Timeout is the timeout of a request in milliseconds, default is 3000
+	Timeout int `yaml:"timeout"`
+	// Headers are the headers of the requests, such as Authorization
+	Headers map[string]string `yaml:"headers"`
+}
+
+// DefaultOptions is the configuration of the HTTP loader, set up by the plugin
+var DefaultOptions = &Options{}
+
+// Plugin sets up the configuration of the HTTP loader
+type Plugin struct{}
+
+// Type returns the plugin type
+func (p *Plugin) Type() string {
+	return pluginType
+}
+
+// Setup parses the configuration of the HTTP loader
+func (p *Plugin) Setup(_ string, decoder plugin.Decoder) error {
+	opts := &Options{}
+	if err := decoder.Decode(opts); err != nil {
+		return gerrs.Wrap(err, "decode http router loader config err")
+	}
+	if opts.URL == "" {
+		return errs.New(gerrs.ErrWrongConfig, "empty http router loader url")
+	}
+	if opts.Interval < 0 || opts.Timeout < 0 {
+		return errs.New(gerrs.ErrWrongConfig, "http router loader interval and timeout can not be negative")
+	}
+	if opts.Interval == 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = defaultTimeout
+	}
+	DefaultOptions = opts
+	return nil
+}
+
+// ConfLoader is the router configuration loader polling an HTTP endpoint. The requests carry If-None-Match with the
+// ETag of the last accepted configuration, and a response of 304 or the same body is not reloaded.
+type ConfLoader struct {
+	mu     sync.Mutex
+	poller *poller
+}
+
+// LoadConf loads the configuration from the HTTP endpoint, and polls it for changes. The gateway boots from the
+// snapshot if the endpoint is unreachable or the configuration is invalid.
+func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.poller != nil {
+		return nil
+	}
+	opts := DefaultOptions
+	if opts.URL == "" {
+		return errs.New(gerrs.ErrWrongConfig, "empty http router loader url, configure plugins.config.http_router")
+	}
+	p := &poller{
+		opts:     opts,
+		protocol: protocol,
+		client:   &stdhttp.Client{Timeout: time.Duration(opts.Timeout) * time.Millisecond},
+		done:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	if _, err := p.poll(ctx); err != nil {
+		log.ErrorContextf(ctx, "load router conf from %s err:%s", opts.URL, err)
+		if rerr := snapshot.RestoreRaw(ctx, snapshot.File(protocol), protocol); rerr != nil {
+			return gerrs.Wrapf(err, "load router conf from %s err, restore snapshot err:%s", opts.URL, rerr)
+		}
+		loader.DefaultReportReload(httpConfProvider, err)
+	}
+	go p.run()
+	l.poller = p
+	return nil
+}
+
+// poller polls the router configuration
+type poller struct {
+	opts     *Options
+	protocol string
+	client   *stdhttp.Client
+	// etag and digest are of the last accepted configuration
+	etag   string
+	digest [sha256.Size]byte
+	done   chan struct{}
+	exited chan struct{}
+}
+
+// run polls the configuration at the interval until stopped, a failed reload keeps the last good configuration
+func (p *poller) run() {
+	defer close(p.exited)
+	ticker := time.NewTicker(time.Duration(p.opts.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			changed, err := p.poll(context.Background())
+			if err != nil {
+				log.Errorf("reload router conf from %s failed: %s", p.opts.URL, err)
+				loader.DefaultReportReload(httpConfProvider, err)
+				continue
+			}
+			if changed {
+				log.Infof("reload router conf success, url:%s", p.opts.URL)
+				loader.DefaultReportReload(httpConfProvider, nil)
+			}
+		}
+	}
+}
+
+// poll requests the configuration, and initializes the router if it changes
+func (p *poller) poll(ctx context.Context) (bool, error) {
+	req, err := stdhttp.NewRequestWithContext(ctx, stdhttp.MethodGet, p.opts.URL, nil)
+	if err != nil {
+		return false, errs.Wrap(err, gerrs.ErrWrongConfig, "new request err")
+	}
+	for k, v := range p.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	rsp, err := p.client.Do(req)
+	if err != nil {
+		return false, gerrs.Wrap(err, "request router conf err")
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == stdhttp.StatusNotModified {
+		return false, nil
+	}
+	if rsp.StatusCode != stdhttp.StatusOK {
+		return false, errs.Newf(gerrs.ErrUpstreamRspErr, "unexpected router conf status:%d", rsp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxConfSize+1))
+	if err != nil {
+		return false, gerrs.Wrap(err, "read router conf err")
+	}
+	if len(body) > maxConfSize {
+		return false, errs.Newf(gerrs.ErrWrongConfig, "router conf exceeds %d bytes", maxConfSize)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return false, errs.New(gerrs.ErrWrongConfig, "get no router config")
+	}
+	// The endpoints without ETag return the same body
+	digest := sha256.Sum256(body)
+	if digest == p.digest {
+		return false, nil
+	}
+	// The body is saved to the snapshot before expanding the env, so that the secrets are not persisted
+	if err := snapshot.InitRaw(ctx, snapshot.File(p.protocol), p.protocol, body); err != nil {
+		return false, gerrs.Wrap(err, "init router conf err")
+	}
+	p.etag, p.digest = rsp.Header.Get("ETag"), digest
+	return true, nil
+}
+
+// stop stops polling, and waits for the polling goroutine to exit
+func (p *poller) stop() {
+	close(p.done)
+	<-p.exited
+}
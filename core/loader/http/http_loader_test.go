@@ -0,0 +1,247 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package http
+
+import (
+	"context"
+	"errors"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	gwplugin "trpc.group/trpc-go/trpc-gateway/plugin"
+)
+
+func TestPlugin_Setup(t *testing.T) {
+	defer func(opts *Options) { DefaultOptions = opts }(DefaultOptions)
+	p := &Plugin{}
+	assert.Equal(t, "config", p.Type())
+	assert.Nil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{
+		"url":     "http://127.0.0.1/router.yaml",
+		"headers": map[string]interface{}{"Authorization": "token"},
+	}}))
+	assert.Equal(t, &Options{
+		URL:      "http://127.0.0.1/router.yaml",
+		Interval: defaultInterval,
+		Timeout:  defaultTimeout,
+		Headers:  map[string]string{"Authorization": "token"},
+	}, DefaultOptions)
+
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{}))
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{
+		"url":      "http://127.0.0.1/router.yaml",
+		"interval": -1,
+	}}))
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: []string{}}))
+}
+
+// confServer serves the router configuration with ETag
+type confServer struct {
+	mu     sync.Mutex
+	status int
+	body   string
+	etag   string
+	// ifNoneMatch is the If-None-Match of the last request
+	ifNoneMatch string
+}
+
+func (s *confServer) set(status int, body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.body, s.etag = status, body, etag
+}
+
+func (s *confServer) ServeHTTP(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ifNoneMatch = r.Header.Get("If-None-Match")
+	if r.Header.Get("Authorization") != "token" {
+		w.WriteHeader(stdhttp.StatusUnauthorized)
+		return
+	}
+	if s.etag != "" && s.ifNoneMatch == s.etag {
+		w.WriteHeader(stdhttp.StatusNotModified)
+		return
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	w.WriteHeader(s.status)
+	_, _ = w.Write([]byte(s.body))
+}
+
+func TestConfLoader_LoadConf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("fasthttp", mockRouter)
+	s := &confServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer func(opts *Options, file string, report loader.ReportReloadFunc) {
+		DefaultOptions, snapshot.DefaultFile, loader.DefaultReportReload = opts, file, report
+	}(DefaultOptions, snapshot.DefaultFile, loader.DefaultReportReload)
+	DefaultOptions = &Options{
+		URL:      server.URL,
+		Interval: 20,
+		Timeout:  1000,
+		Headers:  map[string]string{"Authorization": "token"},
+	}
+	snapshot.DefaultFile = filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	reports := make(chan error, 10)
+	loader.DefaultReportReload = func(_ string, err error) {
+		reports <- err
+	}
+
+	// Boot from the endpoint
+	s.set(stdhttp.StatusOK, "router:\n  - method: /a\n", `"v1"`)
+	inits := make(chan *entity.ProxyConfig, 10)
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			inits <- rf
+			if rf.Router[0].Method == "/invalid" {
+				return errors.New("invalid")
+			}
+			return nil
+		}).AnyTimes()
+	l := &ConfLoader{}
+	assert.Nil(t, l.LoadConf(context.Background(), "fasthttp"))
+	defer l.poller.stop()
+	assert.Equal(t, "/a", (<-inits).Router[0].Method)
+	// Poll once
+	assert.Nil(t, l.LoadConf(context.Background(), "fasthttp"))
+
+	// Not modified
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, inits, 0)
+	s.mu.Lock()
+	assert.Equal(t, `"v1"`, s.ifNoneMatch)
+	s.mu.Unlock()
+
+	// Reload successfully
+	s.set(stdhttp.StatusOK, "router:\n  - method: /b\n", `"v2"`)
+	assert.Equal(t, "/b", (<-inits).Router[0].Method)
+	assert.Nil(t, <-reports)
+
+	// The same body without ETag is not reloaded
+	s.set(stdhttp.StatusOK, "router:\n  - method: /b\n", "")
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, inits, 0)
+
+	// Failed to reload, the snapshot keeps the last good configuration
+	s.set(stdhttp.StatusOK, "router:\n  - method: /invalid\n", `"v3"`)
+	assert.Equal(t, "/invalid", (<-inits).Router[0].Method)
+	assert.NotNil(t, <-reports)
+	rf, err := snapshot.Load(snapshot.DefaultFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "/b", rf.Router[0].Method)
+
+	s.set(stdhttp.StatusInternalServerError, "", "")
+	assert.NotNil(t, <-reports)
+	s.set(stdhttp.StatusOK, "", "")
+	assert.NotNil(t, <-reports)
+	s.set(stdhttp.StatusOK, "router: [", "")
+	assert.NotNil(t, <-reports)
+}
+
+func TestConfLoader_LoadConf_snapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("fasthttp", mockRouter)
+	defer func(opts *Options, file string, report loader.ReportReloadFunc) {
+		DefaultOptions, snapshot.DefaultFile, loader.DefaultReportReload = opts, file, report
+	}(DefaultOptions, snapshot.DefaultFile, loader.DefaultReportReload)
+	loader.DefaultReportReload = func(_ string, err error) {}
+
+	// No url
+	DefaultOptions = &Options{}
+	assert.NotNil(t, (&ConfLoader{}).LoadConf(context.Background(), "fasthttp"))
+
+	// The endpoint is unreachable without the snapshot
+	server := httptest.NewServer(stdhttp.NotFoundHandler())
+	server.Close()
+	DefaultOptions = &Options{URL: server.URL, Interval: 60000, Timeout: 100}
+	snapshot.DefaultFile = ""
+	assert.NotNil(t, (&ConfLoader{}).LoadConf(context.Background(), "fasthttp"))
+
+	// Boot from the snapshot
+	snapshot.DefaultFile = filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	assert.Nil(t, snapshot.Save(snapshot.DefaultFile, &entity.ProxyConfig{
+		Router: []*entity.RouterItem{{Method: "/snapshot"}},
+	}))
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			assert.Equal(t, "/snapshot", rf.Router[0].Method)
+			return nil
+		})
+	l := &ConfLoader{}
+	assert.Nil(t, l.LoadConf(context.Background(), "fasthttp"))
+	l.poller.stop()
+}
+
+func TestPoller_poll_env(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("fasthttp", mockRouter)
+	s := &confServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+	t.Setenv("GW_SIGN_KEY", "secret")
+	file := filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	defer func(f string) { snapshot.DefaultFile = f }(snapshot.DefaultFile)
+	snapshot.DefaultFile = file
+	p := &poller{
+		opts:     &Options{URL: server.URL, Headers: map[string]string{"Authorization": "token"}},
+		protocol: "fasthttp",
+		client:   &stdhttp.Client{},
+	}
+
+	// The env is expanded for the router, while the snapshot keeps the reference
+	body := "router:\n  - method: /a\n    plugins:\n      - name: auth\n        props:\n          key: ${GW_SIGN_KEY}\n"
+	s.set(stdhttp.StatusOK, body, "")
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			assert.Equal(t, "secret", rf.Router[0].Plugins[0].Props.(map[string]interface{})["key"])
+			return nil
+		})
+	changed, err := p.poll(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	buf, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.Equal(t, body, string(buf))
+	rf, err := snapshot.LoadRaw(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", rf.Router[0].Plugins[0].Props.(map[string]interface{})["key"])
+
+	// The remote configuration can not read the local files
+	s.set(stdhttp.StatusOK, "router:\n  - method: /b\n    plugins:\n      - name: auth\n        props:\n"+
+		"          key: ${file:"+file+"}\n", "")
+	changed, err = p.poll(context.Background())
+	assert.NotNil(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,437 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+	gwinformers "sigs.k8s.io/gateway-api/pkg/client/informers/externalversions"
+	gwlisters "sigs.k8s.io/gateway-api/pkg/client/listers/apis/v1"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+const (
+	// eventComponent is the source component of the events of the Ingresses
+	eventComponent = "trpc-gateway"
+	// acceptedMessage is the message of the accepted resources
+	acceptedMessage = "accepted by the gateway"
+)
+
+// controller watches the resources with the informers, and initializes the router with the accepted resources
+type controller struct {
+	opts          *Options
+	protocol      string
+	translator    *translator
+	kube          kubernetes.Interface
+	gw            versioned.Interface
+	kubeInformers informers.SharedInformerFactory
+	gwInformers   gwinformers.SharedInformerFactory
+	// ingresses is nil if the Ingresses are not watched
+	ingresses networkinglisters.IngressLister
+	// routes is nil if the HTTPRoutes are not watched
+	routes  gwlisters.HTTPRouteLister
+	synced  []cache.InformerSynced
+	trigger chan struct{}
+	done    chan struct{}
+	// last is the last initialized configuration
+	last []byte
+	// reported is the last reported result of the resources, used to skip the duplicated events and status updates
+	reported map[types.UID]string
+}
+
+// resource is a watched resource
+type resource struct {
+	// key is the kind, the namespace and the name of the resource, which sorts the resources
+	key string
+	// translate translates the resource into a new configuration each time, as the check modifies it
+	translate func() (*entity.ProxyConfig, error)
+	// report reports the result of the resource
+	report func(ctx context.Context, err error)
+}
+
+// newController creates the controller of the options, the informers are started by start
+func newController(opts *Options, protocol string, kube kubernetes.Interface, gw versioned.Interface) *controller {
+	c := &controller{
+		opts:       opts,
+		protocol:   protocol,
+		translator: &translator{opts: opts},
+		kube:       kube,
+		gw:         gw,
+		kubeInformers: informers.NewSharedInformerFactoryWithOptions(kube, 0,
+			informers.WithNamespace(opts.Namespace)),
+		gwInformers: gwinformers.NewSharedInformerFactoryWithOptions(gw, 0,
+			gwinformers.WithNamespace(opts.Namespace)),
+		trigger:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		reported: map[types.UID]string{},
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: func(interface{}) { c.enqueue() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if specChanged(oldObj, newObj) {
+				c.enqueue()
+			}
+		},
+		DeleteFunc: func(interface{}) { c.enqueue() },
+	}
+	if !opts.DisableIngress {
+		informer := c.kubeInformers.Networking().V1().Ingresses()
+		_, _ = informer.Informer().AddEventHandler(handler)
+		c.ingresses = informer.Lister()
+		c.synced = append(c.synced, informer.Informer().HasSynced)
+	}
+	if len(opts.Gateways) != 0 {
+		informer := c.gwInformers.Gateway().V1().HTTPRoutes()
+		_, _ = informer.Informer().AddEventHandler(handler)
+		c.routes = informer.Lister()
+		c.synced = append(c.synced, informer.Informer().HasSynced)
+	}
+	return c
+}
+
+// specChanged checks if the resource changes other than the status, the generation changes with the spec
+func specChanged(oldObj, newObj interface{}) bool {
+	o, ok1 := oldObj.(metav1.Object)
+	n, ok2 := newObj.(metav1.Object)
+	if !ok1 || !ok2 {
+		return true
+	}
+	return o.GetGeneration() != n.GetGeneration() || !reflect.DeepEqual(o.GetAnnotations(), n.GetAnnotations())
+}
+
+// enqueue triggers a sync, the triggers during a sync are merged
+func (c *controller) enqueue() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// start starts the informers, and waits for the caches to sync until the context is done
+func (c *controller) start(ctx context.Context) error {
+	c.kubeInformers.Start(c.done)
+	c.gwInformers.Start(c.done)
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced...) {
+		return errs.New(gerrs.ErrWrongConfig, "wait for k8s informer caches to sync timeout")
+	}
+	return nil
+}
+
+// stop stops the informers and the sync loop
+func (c *controller) stop() {
+	close(c.done)
+	c.kubeInformers.Shutdown()
+	c.gwInformers.Shutdown()
+}
+
+// run syncs the resources on the changes until stopped, the changes within the debounce interval are merged into a
+// reload. A failed reload keeps the last good configuration.
+func (c *controller) run() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.trigger:
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(time.Duration(c.opts.Debounce) * time.Millisecond):
+		}
+		// The changes during the debounce interval are synced now
+		select {
+		case <-c.trigger:
+		default:
+		}
+		changed, err := c.sync(context.Background())
+		if err != nil {
+			log.Errorf("reload router conf from k8s failed: %s", err)
+			loader.DefaultReportReload(k8sConfProvider, err)
+			continue
+		}
+		if changed {
+			log.Info("reload router conf from k8s success")
+			loader.DefaultReportReload(k8sConfProvider, nil)
+		}
+	}
+}
+
+// sync validates each resource on its own, and initializes the router with the accepted ones if the configuration
+// changes. The rejected resources are skipped, and the result of each resource is reported to its status.
+func (c *controller) sync(ctx context.Context) (bool, error) {
+	resources, err := c.list()
+	if err != nil {
+		return false, err
+	}
+	rf := &entity.ProxyConfig{}
+	var accepted []*resource
+	for _, r := range resources {
+		conf, err := r.translate()
+		if err == nil {
+			err = loader.DefaultCheck(ctx, conf)
+		}
+		if err != nil {
+			log.ErrorContextf(ctx, "k8s resource %s rejected: %s", r.key, err)
+			r.report(ctx, err)
+			continue
+		}
+		// The checked configuration has been initialized, so it is translated again
+		conf, _ = r.translate()
+		merge(rf, conf)
+		accepted = append(accepted, r)
+	}
+	changed, err := c.init(ctx, rf)
+	for _, r := range accepted {
+		r.report(ctx, err)
+	}
+	return changed, err
+}
+
+// init initializes the router with the configuration if it changes
+func (c *controller) init(ctx context.Context, rf *entity.ProxyConfig) (bool, error) {
+	if len(rf.Router) == 0 {
+		return false, errs.New(gerrs.ErrWrongConfig, "no router accepted from k8s resources")
+	}
+	buf, err := yaml.Marshal(rf)
+	if err != nil {
+		return false, errs.Wrap(err, gerrs.ErrWrongConfig, "marshal router conf err")
+	}
+	if bytes.Equal(buf, c.last) {
+		return false, nil
+	}
+	if err := snapshot.Init(ctx, snapshot.File(c.protocol), c.protocol, rf); err != nil {
+		return false, gerrs.Wrap(err, "init router conf err")
+	}
+	c.last = buf
+	return true, nil
+}
+
+// merge merges the configuration of a resource, the clients of the same Service port are the same
+func merge(rf, conf *entity.ProxyConfig) {
+	rf.Router = append(rf.Router, conf.Router...)
+	names := make(map[string]struct{}, len(rf.Client))
+	for _, cli := range rf.Client {
+		names[cli.ServiceName] = struct{}{}
+	}
+	for _, cli := range conf.Client {
+		if _, ok := names[cli.ServiceName]; ok {
+			continue
+		}
+		names[cli.ServiceName] = struct{}{}
+		rf.Client = append(rf.Client, cli)
+	}
+}
+
+// list lists the watched resources sorted by the keys
+func (c *controller) list() ([]*resource, error) {
+	var resources []*resource
+	seen := make(map[types.UID]struct{})
+	if c.ingresses != nil {
+		ingresses, err := c.ingresses.List(labels.Everything())
+		if err != nil {
+			return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "list ingresses err")
+		}
+		for _, ing := range ingresses {
+			if !c.matchIngressClass(ing) {
+				continue
+			}
+			ing := ing
+			seen[ing.UID] = struct{}{}
+			resources = append(resources, &resource{
+				key:       fmt.Sprintf("ingress/%s/%s", ing.Namespace, ing.Name),
+				translate: func() (*entity.ProxyConfig, error) { return c.translator.ingress(ing) },
+				report:    func(ctx context.Context, err error) { c.reportIngress(ctx, ing, err) },
+			})
+		}
+	}
+	if c.routes != nil {
+		routes, err := c.routes.List(labels.Everything())
+		if err != nil {
+			return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "list httproutes err")
+		}
+		for _, r := range routes {
+			refs := c.parentRefs(r)
+			if len(refs) == 0 {
+				continue
+			}
+			r := r
+			seen[r.UID] = struct{}{}
+			resources = append(resources, &resource{
+				key:       fmt.Sprintf("httproute/%s/%s", r.Namespace, r.Name),
+				translate: func() (*entity.ProxyConfig, error) { return c.translator.httpRoute(r) },
+				report:    func(ctx context.Context, err error) { c.reportHTTPRoute(ctx, r, refs, err) },
+			})
+		}
+	}
+	// The deleted resources are not reported any more
+	for uid := range c.reported {
+		if _, ok := seen[uid]; !ok {
+			delete(c.reported, uid)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return resources[i].key < resources[j].key })
+	return resources, nil
+}
+
+// matchIngressClass checks if the Ingress is of the watched class
+func (c *controller) matchIngressClass(ing *networkingv1.Ingress) bool {
+	if ing.Spec.IngressClassName != nil {
+		return *ing.Spec.IngressClassName == c.opts.IngressClass
+	}
+	return ing.Annotations[ingressClassAnnotation] == c.opts.IngressClass
+}
+
+// parentRefs returns the parent refs of the HTTPRoute referencing the watched Gateways
+func (c *controller) parentRefs(r *gatewayv1.HTTPRoute) []gatewayv1.ParentReference {
+	var refs []gatewayv1.ParentReference
+	for _, ref := range r.Spec.ParentRefs {
+		if ref.Group != nil && *ref.Group != gatewayv1.GroupName {
+			continue
+		}
+		if ref.Kind != nil && *ref.Kind != "Gateway" {
+			continue
+		}
+		ns := r.Namespace
+		if ref.Namespace != nil {
+			ns = string(*ref.Namespace)
+		}
+		for _, gw := range c.opts.Gateways {
+			gwNamespace, gwName, err := splitGateway(gw, r.Namespace)
+			if err == nil && gwNamespace == ns && gwName == string(ref.Name) {
+				refs = append(refs, ref)
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// reportHTTPRoute sets the Accepted condition of the parent refs in the status of the HTTPRoute, the status is
+// updated only if it changes. The same result of a generation is reported once, as the cached status may be stale.
+func (c *controller) reportHTTPRoute(ctx context.Context, r *gatewayv1.HTTPRoute, refs []gatewayv1.ParentReference,
+	err error) {
+	cond := metav1.Condition{
+		Type:               string(gatewayv1.RouteConditionAccepted),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayv1.RouteReasonAccepted),
+		Message:            acceptedMessage,
+		ObservedGeneration: r.Generation,
+	}
+	if err != nil {
+		cond.Status, cond.Reason, cond.Message = metav1.ConditionFalse, string(gatewayv1.RouteReasonUnsupportedValue),
+			err.Error()
+	}
+	result := fmt.Sprintf("%d/%s/%s", r.Generation, cond.Reason, cond.Message)
+	if c.reported[r.UID] == result {
+		return
+	}
+	route := r.DeepCopy()
+	changed := false
+	for _, ref := range refs {
+		status := c.parentStatus(route, ref)
+		old := meta.FindStatusCondition(status.Conditions, cond.Type)
+		if old != nil && old.Status == cond.Status && old.Reason == cond.Reason && old.Message == cond.Message &&
+			old.ObservedGeneration == cond.ObservedGeneration {
+			continue
+		}
+		meta.SetStatusCondition(&status.Conditions, cond)
+		changed = true
+	}
+	if changed {
+		_, uerr := c.gw.GatewayV1().HTTPRoutes(route.Namespace).UpdateStatus(ctx, route, metav1.UpdateOptions{})
+		if uerr != nil {
+			log.ErrorContextf(ctx, "update status of httproute %s/%s err:%s", route.Namespace, route.Name, uerr)
+			return
+		}
+	}
+	c.reported[r.UID] = result
+}
+
+// parentStatus returns the status of the parent ref set by the controller, which is added if not found
+func (c *controller) parentStatus(r *gatewayv1.HTTPRoute, ref gatewayv1.ParentReference) *gatewayv1.RouteParentStatus {
+	for i := range r.Status.Parents {
+		status := &r.Status.Parents[i]
+		if string(status.ControllerName) == c.opts.ControllerName && reflect.DeepEqual(status.ParentRef, ref) {
+			return status
+		}
+	}
+	r.Status.Parents = append(r.Status.Parents, gatewayv1.RouteParentStatus{
+		ParentRef:      ref,
+		ControllerName: gatewayv1.GatewayController(c.opts.ControllerName),
+	})
+	return &r.Status.Parents[len(r.Status.Parents)-1]
+}
+
+// reportIngress creates an event of the result of the Ingress, the same result of a generation is reported once
+func (c *controller) reportIngress(ctx context.Context, ing *networkingv1.Ingress, err error) {
+	eventType, reason, message := corev1.EventTypeNormal, "Accepted", acceptedMessage
+	if err != nil {
+		eventType, reason, message = corev1.EventTypeWarning, "Rejected", err.Error()
+	}
+	result := fmt.Sprintf("%d/%s/%s", ing.Generation, reason, message)
+	if c.reported[ing.UID] == result {
+		return
+	}
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ing.Name + ".",
+			Namespace:    ing.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:            "Ingress",
+			APIVersion:      networkingv1.SchemeGroupVersion.String(),
+			Namespace:       ing.Namespace,
+			Name:            ing.Name,
+			UID:             ing.UID,
+			ResourceVersion: ing.ResourceVersion,
+		},
+		Type:                eventType,
+		Reason:              reason,
+		Message:             message,
+		Source:              corev1.EventSource{Component: eventComponent},
+		ReportingController: c.opts.ControllerName,
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+	}
+	if _, cerr := c.kube.CoreV1().Events(ing.Namespace).Create(ctx, event, metav1.CreateOptions{}); cerr != nil {
+		log.ErrorContextf(ctx, "create event of ingress %s/%s err:%s", ing.Namespace, ing.Name, cerr)
+		return
+	}
+	c.reported[ing.UID] = result
+}
@@ -0,0 +1,289 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gwfake "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/fake"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+)
+
+const testProtocol = "k8s_test"
+
+func newTestIngress(name, class, path string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name), Generation: 1},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &class,
+			Rules: []networkingv1.IngressRule{{
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{{
+						Path:     path,
+						PathType: ptr(networkingv1.PathTypePrefix),
+						Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+							Name: "api", Port: networkingv1.ServiceBackendPort{Number: 8080},
+						}},
+					}},
+				}},
+			}},
+		},
+	}
+}
+
+func newTestRoute(name, gateway, path string, filters ...gatewayv1.HTTPRouteFilter) *gatewayv1.HTTPRoute {
+	r := newHTTPRoute(gatewayv1.HTTPRouteRule{
+		Matches: []gatewayv1.HTTPRouteMatch{{
+			Path: &gatewayv1.HTTPPathMatch{Type: ptr(gatewayv1.PathMatchExact), Value: ptr(path)},
+		}},
+		Filters:     filters,
+		BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+	})
+	r.Name, r.UID = name, types.UID("uid-"+name)
+	r.Spec.ParentRefs[0].Name = gatewayv1.ObjectName(gateway)
+	return r
+}
+
+func newTestController(t *testing.T, objects ...interface{}) (*controller, *kubefake.Clientset, *gwfake.Clientset,
+	*mock_router.MockRouter) {
+	ctrl := gomock.NewController(t)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter(testProtocol, mockRouter)
+
+	kube, gw := kubefake.NewSimpleClientset(), gwfake.NewSimpleClientset()
+	ctx := context.Background()
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *networkingv1.Ingress:
+			_, err := kube.NetworkingV1().Ingresses(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+			require.Nil(t, err)
+		case *gatewayv1.HTTPRoute:
+			_, err := gw.GatewayV1().HTTPRoutes(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+			require.Nil(t, err)
+		}
+	}
+	opts := defaultOptions()
+	opts.Gateways = []string{"gw", "infra/shared"}
+	opts.Debounce = 10
+	c := newController(opts, testProtocol, kube, gw)
+	t.Cleanup(c.stop)
+	require.Nil(t, c.start(ctx))
+	return c, kube, gw, mockRouter
+}
+
+func acceptedCondition(t *testing.T, gw *gwfake.Clientset, name string) *metav1.Condition {
+	r, err := gw.GatewayV1().HTTPRoutes("default").Get(context.Background(), name, metav1.GetOptions{})
+	require.Nil(t, err)
+	require.Len(t, r.Status.Parents, 1)
+	assert.Equal(t, gatewayv1.GatewayController(defaultControllerName), r.Status.Parents[0].ControllerName)
+	require.Len(t, r.Status.Parents[0].Conditions, 1)
+	return &r.Status.Parents[0].Conditions[0]
+}
+
+func countActions(gw *gwfake.Clientset, verb string) int {
+	n := 0
+	for _, a := range gw.Actions() {
+		if a.GetVerb() == verb {
+			n++
+		}
+	}
+	return n
+}
+
+func TestController_sync(t *testing.T) {
+	ctx := context.Background()
+	c, kube, gw, mockRouter := newTestController(t,
+		newTestIngress("web", defaultIngressClass, "/web"),
+		newTestIngress("other", "nginx", "/other"),
+		newTestRoute("good", "gw", "/good"),
+		// The plugins of the filters are not registered, so the route is rejected by the router
+		newTestRoute("bad", "gw", "/bad", gatewayv1.HTTPRouteFilter{
+			Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+			RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+				Set: []gatewayv1.HTTPHeader{{Name: "x-env", Value: "test"}},
+			},
+		}),
+		newTestRoute("unsupported", "gw", "/unsupported", gatewayv1.HTTPRouteFilter{
+			Type: gatewayv1.HTTPRouteFilterExtensionRef, ExtensionRef: &gatewayv1.LocalObjectReference{Name: "x"},
+		}),
+		newTestRoute("ignored", "another", "/ignored"),
+	)
+
+	var rf *entity.ProxyConfig
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, conf *entity.ProxyConfig) error {
+			rf = conf
+			return nil
+		})
+	changed, err := c.sync(ctx)
+	require.Nil(t, err)
+	assert.True(t, changed)
+	require.NotNil(t, rf)
+	assert.Equal(t, []string{"/good", "/web", "/web/"}, methods(rf.Router))
+	assert.Equal(t, "httproute/default/good/0/0", rf.Router[0].ID)
+	assert.Len(t, rf.Client, 1)
+
+	// The status reports the acceptance and the rejection errors
+	cond := acceptedCondition(t, gw, "good")
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, string(gatewayv1.RouteReasonAccepted), cond.Reason)
+	assert.Equal(t, int64(1), cond.ObservedGeneration)
+	cond = acceptedCondition(t, gw, "bad")
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Equal(t, string(gatewayv1.RouteReasonUnsupportedValue), cond.Reason)
+	assert.Contains(t, cond.Message, "request_transformer")
+	cond = acceptedCondition(t, gw, "unsupported")
+	assert.Equal(t, metav1.ConditionFalse, cond.Status)
+	assert.Contains(t, cond.Message, "unsupported filter type")
+	r, err := gw.GatewayV1().HTTPRoutes("default").Get(ctx, "ignored", metav1.GetOptions{})
+	require.Nil(t, err)
+	assert.Empty(t, r.Status.Parents)
+
+	events, err := kube.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	require.Nil(t, err)
+	require.Len(t, events.Items, 1)
+	assert.Equal(t, corev1.EventTypeNormal, events.Items[0].Type)
+	assert.Equal(t, "Accepted", events.Items[0].Reason)
+	assert.Equal(t, "web", events.Items[0].InvolvedObject.Name)
+
+	// The same configuration is not initialized again, and the same results are not reported again
+	updates := countActions(gw, "update")
+	changed, err = c.sync(ctx)
+	require.Nil(t, err)
+	assert.False(t, changed)
+	assert.Equal(t, updates, countActions(gw, "update"))
+	events, err = kube.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	require.Nil(t, err)
+	assert.Len(t, events.Items, 1)
+}
+
+func TestController_syncErr(t *testing.T) {
+	ctx := context.Background()
+	c, kube, _, mockRouter := newTestController(t, newTestIngress("web", defaultIngressClass, "/web"))
+
+	// The accepted resources are reported with the error of the initialization
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(assert.AnError)
+	_, err := c.sync(ctx)
+	assert.NotNil(t, err)
+	events, err := kube.CoreV1().Events("default").List(ctx, metav1.ListOptions{})
+	require.Nil(t, err)
+	require.Len(t, events.Items, 1)
+	assert.Equal(t, corev1.EventTypeWarning, events.Items[0].Type)
+	assert.Equal(t, "Rejected", events.Items[0].Reason)
+
+	// No router is accepted
+	require.Nil(t, kube.NetworkingV1().Ingresses("default").Delete(ctx, "web", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		_, err := c.sync(ctx)
+		return err != nil && len(c.reported) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestController_run(t *testing.T) {
+	ctx := context.Background()
+	c, _, gw, mockRouter := newTestController(t, newTestRoute("good", "gw", "/good"))
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	_, err := c.sync(ctx)
+	require.Nil(t, err)
+
+	initialized := make(chan []string, 1)
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, conf *entity.ProxyConfig) error {
+			initialized <- methods(conf.Router)
+			return nil
+		})
+	reports := make(chan error, 10)
+	defer func(report loader.ReportReloadFunc) { loader.DefaultReportReload = report }(loader.DefaultReportReload)
+	loader.DefaultReportReload = func(_ string, err error) { reports <- err }
+	go c.run()
+
+	// The status updates do not trigger a reload, and the spec changes do
+	r, err := gw.GatewayV1().HTTPRoutes("default").Get(ctx, "good", metav1.GetOptions{})
+	require.Nil(t, err)
+	r.Spec.Rules[0].Matches[0].Path.Value = ptr("/better")
+	r.Generation++
+	_, err = gw.GatewayV1().HTTPRoutes("default").Update(ctx, r, metav1.UpdateOptions{})
+	require.Nil(t, err)
+	select {
+	case ms := <-initialized:
+		assert.Equal(t, []string{"/better"}, ms)
+	case <-time.After(5 * time.Second):
+		t.Fatal("router not reloaded")
+	}
+	select {
+	case err := <-reports:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload not reported")
+	}
+}
+
+func TestController_parentRefs(t *testing.T) {
+	c := &controller{opts: &Options{Gateways: []string{"gw", "infra/shared"}}}
+	r := newHTTPRoute()
+	r.Spec.ParentRefs = []gatewayv1.ParentReference{
+		{Name: "gw"},
+		{Name: "shared", Namespace: ptr(gatewayv1.Namespace("infra"))},
+		{Name: "shared"},
+		{Name: "gw", Kind: ptr(gatewayv1.Kind("Service"))},
+		{Name: "gw", Group: ptr(gatewayv1.Group("example.com"))},
+	}
+	assert.Equal(t, r.Spec.ParentRefs[:2], c.parentRefs(r))
+}
+
+func TestSpecChanged(t *testing.T) {
+	old := newTestIngress("web", defaultIngressClass, "/web")
+	updated := old.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "127.0.0.1"}}
+	assert.False(t, specChanged(old, updated))
+	updated.Annotations = map[string]string{ingressClassAnnotation: "nginx"}
+	assert.True(t, specChanged(old, updated))
+	updated = old.DeepCopy()
+	updated.Generation++
+	assert.True(t, specChanged(old, updated))
+	assert.True(t, specChanged(nil, updated))
+}
+
+func TestController_init(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter(testProtocol, mockRouter)
+	defer func(file string) { snapshot.DefaultFile = file }(snapshot.DefaultFile)
+	snapshot.DefaultFile = ""
+	c := &controller{protocol: testProtocol}
+	_, err := c.init(context.Background(), &entity.ProxyConfig{})
+	assert.NotNil(t, err)
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	changed, err := c.init(context.Background(), &entity.ProxyConfig{Router: []*entity.RouterItem{{Method: "/"}}})
+	assert.Nil(t, err)
+	assert.True(t, changed)
+}
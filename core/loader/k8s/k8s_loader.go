@@ -0,0 +1,200 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package k8s provides a router config loader translating the Kubernetes Ingress and Gateway API HTTPRoute resources.
+package k8s
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/gateway-api/pkg/client/clientset/versioned"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/config"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+const (
+	k8sConfProvider = "k8s_router"
+	pluginType      = "config"
+	pluginName      = "k8s_router"
+
+	defaultIngressClass   = "trpc-gateway"
+	defaultControllerName = "trpc.group/trpc-gateway"
+	defaultClusterDomain  = "cluster.local"
+	defaultDebounce       = 1000
+	// syncTimeout is the timeout of waiting for the informer caches to sync
+	syncTimeout = 30 * time.Second
+)
+
+func init() {
+	config.RegisterConfLoader(k8sConfProvider, &ConfLoader{})
+	plugin.Register(pluginName, &Plugin{})
+}
+
+// Options is the configuration of the Kubernetes loader, configured in plugins.config.k8s_router of trpc_go.yaml
+type Options struct {
+	// Kubeconfig is the path of the kubeconfig file, the in-cluster configuration is used if empty
+	Kubeconfig string `yaml:"kubeconfig"`
+	// Namespace is the watched namespace, all namespaces are watched if empty
+	Namespace string `yaml:"namespace"`
+	// IngressClass is the class of the watched Ingresses, default is trpc-gateway. It is matched with
+	// spec.ingressClassName or the kubernetes.io/ingress.class annotation.
+	IngressClass string `yaml:"ingress_class"`
+	// DisableIngress disables watching the Ingresses
+	DisableIngress bool `yaml:"disable_ingress"`
+	// Gateways are the Gateways served by the gateway, such as default/web or web in the namespace of the
+	// HTTPRoute. The HTTPRoutes are watched only if it is set.
+	Gateways []string `yaml:"gateways"`
+	// ControllerName is the controller name in the status of the HTTPRoutes, default is trpc.group/trpc-gateway
+	ControllerName string `yaml:"controller_name"`
+	// ClusterDomain is the domain of the cluster in the targets of the Services, default is cluster.local
+	ClusterDomain string `yaml:"cluster_domain"`
+	// Debounce is the interval in milliseconds of merging the changes into a reload, default is 1000
+	Debounce int `yaml:"debounce"`
+}
+
+// DefaultOptions is the configuration of the Kubernetes loader, set up by the plugin
+var DefaultOptions = defaultOptions()
+
+// defaultOptions returns the options with the defaults
+func defaultOptions() *Options {
+	return &Options{
+		IngressClass:   defaultIngressClass,
+		ControllerName: defaultControllerName,
+		ClusterDomain:  defaultClusterDomain,
+		Debounce:       defaultDebounce,
+	}
+}
+
+// Plugin sets up the configuration of the Kubernetes loader
+type Plugin struct{}
+
+// Type returns the plugin type
+func (p *Plugin) Type() string {
+	return pluginType
+}
+
+// Setup parses the configuration of the Kubernetes loader
+func (p *Plugin) Setup(_ string, decoder plugin.Decoder) error {
+	opts := defaultOptions()
+	if err := decoder.Decode(opts); err != nil {
+		return gerrs.Wrap(err, "decode k8s router loader config err")
+	}
+	if opts.Debounce < 0 {
+		return errs.New(gerrs.ErrWrongConfig, "k8s router loader debounce can not be negative")
+	}
+	if opts.DisableIngress && len(opts.Gateways) == 0 {
+		return errs.New(gerrs.ErrWrongConfig, "k8s router loader watches neither ingresses nor gateways")
+	}
+	for _, gw := range opts.Gateways {
+		if _, _, err := splitGateway(gw, ""); err != nil {
+			return err
+		}
+	}
+	DefaultOptions = opts
+	return nil
+}
+
+// splitGateway splits the gateway into the namespace and the name, the namespace defaults to the given one
+func splitGateway(gw, namespace string) (string, string, error) {
+	ns, name, ok := strings.Cut(gw, "/")
+	if !ok {
+		ns, name = namespace, gw
+	}
+	if name == "" || strings.Contains(name, "/") || (ok && ns == "") {
+		return "", "", errs.Newf(gerrs.ErrWrongConfig, "invalid k8s router loader gateway:%s", gw)
+	}
+	return ns, name, nil
+}
+
+// ConfLoader is the router configuration loader translating the Ingresses and the HTTPRoutes watched by the
+// informers. The status of the resources reports if they are accepted.
+type ConfLoader struct {
+	mu         sync.Mutex
+	controller *controller
+}
+
+// LoadConf loads the configuration from the Kubernetes resources, and watches them for changes. The gateway boots
+// from the snapshot if the API server is unreachable or no resource is accepted.
+func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.controller != nil {
+		return nil
+	}
+	opts := DefaultOptions
+	restConf, err := restConfig(opts.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	kube, err := kubernetes.NewForConfig(restConf)
+	if err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "new k8s client err")
+	}
+	gw, err := versioned.NewForConfig(restConf)
+	if err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "new gateway api client err")
+	}
+	c, err := l.start(ctx, newController(opts, protocol, kube, gw))
+	if err != nil {
+		return err
+	}
+	l.controller = c
+	return nil
+}
+
+// start starts the informers and initializes the router with the resources, then watches them for changes
+func (l *ConfLoader) start(ctx context.Context, c *controller) (*controller, error) {
+	syncCtx, cancel := context.WithTimeout(ctx, syncTimeout)
+	defer cancel()
+	err := c.start(syncCtx)
+	if err == nil {
+		_, err = c.sync(ctx)
+	}
+	if err != nil {
+		log.ErrorContextf(ctx, "load router conf from k8s err:%s", err)
+		if rerr := snapshot.Restore(ctx, snapshot.File(c.protocol), c.protocol); rerr != nil {
+			c.stop()
+			return nil, gerrs.Wrapf(err, "load router conf from k8s err, restore snapshot err:%s", rerr)
+		}
+		loader.DefaultReportReload(k8sConfProvider, err)
+	}
+	go c.run()
+	return c, nil
+}
+
+// restConfig returns the configuration of the API server from the kubeconfig file, or the in-cluster configuration
+func restConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig == "" {
+		conf, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "load k8s in-cluster config err")
+		}
+		return conf, nil
+	}
+	conf, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "load kubeconfig %s err", kubeconfig)
+	}
+	return conf, nil
+}
@@ -0,0 +1,120 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package k8s
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	gwfake "sigs.k8s.io/gateway-api/pkg/client/clientset/versioned/fake"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	gwplugin "trpc.group/trpc-go/trpc-gateway/plugin"
+)
+
+func TestPlugin_Setup(t *testing.T) {
+	defer func(opts *Options) { DefaultOptions = opts }(DefaultOptions)
+	p := &Plugin{}
+	assert.Equal(t, "config", p.Type())
+	assert.Nil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{
+		"namespace": "web",
+		"gateways":  []string{"gw", "infra/shared"},
+	}}))
+	assert.Equal(t, &Options{
+		Namespace:      "web",
+		IngressClass:   defaultIngressClass,
+		Gateways:       []string{"gw", "infra/shared"},
+		ControllerName: defaultControllerName,
+		ClusterDomain:  defaultClusterDomain,
+		Debounce:       defaultDebounce,
+	}, DefaultOptions)
+
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{"debounce": -1}}))
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{
+		"disable_ingress": true,
+	}}))
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: map[string]interface{}{
+		"gateways": []string{"/gw"},
+	}}))
+	assert.NotNil(t, p.Setup(pluginName, &gwplugin.PropsDecoder{Props: []string{}}))
+}
+
+func TestSplitGateway(t *testing.T) {
+	ns, name, err := splitGateway("gw", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", ns)
+	assert.Equal(t, "gw", name)
+	ns, name, err = splitGateway("infra/shared", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, "infra", ns)
+	assert.Equal(t, "shared", name)
+	for _, gw := range []string{"", "infra/", "/gw", "a/b/c"} {
+		_, _, err = splitGateway(gw, "default")
+		assert.NotNil(t, err, gw)
+	}
+}
+
+func TestConfLoader_start(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter(testProtocol, mockRouter)
+	defer func(file string, report loader.ReportReloadFunc) {
+		snapshot.DefaultFile, loader.DefaultReportReload = file, report
+	}(snapshot.DefaultFile, loader.DefaultReportReload)
+	var reported []error
+	loader.DefaultReportReload = func(_ string, err error) { reported = append(reported, err) }
+	ctx := context.Background()
+	l := &ConfLoader{}
+
+	// No router is accepted and no snapshot
+	snapshot.DefaultFile = ""
+	c := newController(defaultOptions(), testProtocol, kubefake.NewSimpleClientset(), gwfake.NewSimpleClientset())
+	_, err := l.start(ctx, c)
+	assert.NotNil(t, err)
+
+	// The gateway boots from the snapshot
+	snapshot.DefaultFile = filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	require.Nil(t, snapshot.Save(snapshot.DefaultFile, &entity.ProxyConfig{
+		Router: []*entity.RouterItem{{Method: "/"}},
+	}))
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	c = newController(defaultOptions(), testProtocol, kubefake.NewSimpleClientset(), gwfake.NewSimpleClientset())
+	c, err = l.start(ctx, c)
+	require.Nil(t, err)
+	defer c.stop()
+	require.Len(t, reported, 1)
+	assert.NotNil(t, reported[0])
+}
+
+func TestConfLoader_LoadConf(t *testing.T) {
+	defer func(opts *Options) { DefaultOptions = opts }(DefaultOptions)
+	DefaultOptions = defaultOptions()
+	DefaultOptions.Kubeconfig = filepath.Join(t.TempDir(), "missing")
+	assert.NotNil(t, (&ConfLoader{}).LoadConf(context.Background(), testProtocol))
+}
+
+func TestRestConfig(t *testing.T) {
+	// Not running in a cluster
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err := restConfig("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,529 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package k8s
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+const (
+	// ingressClassAnnotation is the deprecated annotation of the ingress class
+	ingressClassAnnotation = "kubernetes.io/ingress.class"
+	// catchAllPriority is the priority of the routers matching all paths, which are matched after the other regexp
+	// routers
+	catchAllPriority = -1
+	// catchAll is the method matching all paths, the rest of the path is captured for the prefix rewrite
+	catchAll = "^/(.*)"
+
+	requestTransformer  = "request_transformer"
+	responseTransformer = "response_transformer"
+	redirect            = "redirect"
+)
+
+// translator translates the Kubernetes resources into the router configuration
+type translator struct {
+	opts *Options
+}
+
+// pathMatch is a path match translated into the method of the router item
+type pathMatch struct {
+	method   string
+	isRegexp bool
+	priority int
+	// prefix is the matched prefix of a prefix match, empty for the others
+	prefix string
+}
+
+// ingress translates the Ingress into the routers and the clients of its backends. The Exact paths are matched
+// exactly, and the Prefix and ImplementationSpecific paths are matched by path elements.
+func (t *translator) ingress(ing *networkingv1.Ingress) (*entity.ProxyConfig, error) {
+	rf := &entity.ProxyConfig{}
+	id := fmt.Sprintf("ingress/%s/%s", ing.Namespace, ing.Name)
+	if b := ing.Spec.DefaultBackend; b != nil {
+		service, err := t.ingressBackend(rf, ing.Namespace, b)
+		if err != nil {
+			return nil, gerrs.Wrap(err, "invalid default backend")
+		}
+		rf.Router = append(rf.Router, &entity.RouterItem{
+			ID:            id + "/default",
+			Method:        catchAll,
+			IsRegexp:      true,
+			Priority:      catchAllPriority,
+			TargetService: []*entity.TargetService{{Service: service, Weight: 1}},
+		})
+	}
+	for i, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		var hosts []string
+		if rule.Host != "" {
+			hosts = []string{rule.Host}
+		}
+		for j, p := range rule.HTTP.Paths {
+			service, err := t.ingressBackend(rf, ing.Namespace, &p.Backend)
+			if err != nil {
+				return nil, gerrs.Wrapf(err, "invalid backend of rule %d path %d", i, j)
+			}
+			exact := p.PathType != nil && *p.PathType == networkingv1.PathTypeExact
+			matches, err := paths(p.Path, exact)
+			if err != nil {
+				return nil, gerrs.Wrapf(err, "invalid path of rule %d path %d", i, j)
+			}
+			for _, m := range matches {
+				rf.Router = append(rf.Router, &entity.RouterItem{
+					ID:            fmt.Sprintf("%s/%d/%d", id, i, j),
+					Method:        m.method,
+					IsRegexp:      m.isRegexp,
+					Priority:      m.priority,
+					Host:          hosts,
+					TargetService: []*entity.TargetService{{Service: service, Weight: 1}},
+				})
+			}
+		}
+	}
+	return rf, nil
+}
+
+// ingressBackend adds the client of the service backend, and returns the client name
+func (t *translator) ingressBackend(rf *entity.ProxyConfig, namespace string,
+	b *networkingv1.IngressBackend) (string, error) {
+	if b.Service == nil {
+		return "", errs.New(gerrs.ErrWrongConfig, "only service backends are supported")
+	}
+	if b.Service.Port.Number == 0 {
+		return "", errs.Newf(gerrs.ErrWrongConfig, "port number of service %s is required, port names are not supported",
+			b.Service.Name)
+	}
+	return t.client(rf, namespace, b.Service.Name, b.Service.Port.Number), nil
+}
+
+// httpRoute translates the HTTPRoute into the routers and the clients of its backends. Each match of a rule is
+// translated into the routers of its path, the header and query param matches are translated into the rule
+// conditions, and the filters are translated into the gateway plugins.
+func (t *translator) httpRoute(r *gatewayv1.HTTPRoute) (*entity.ProxyConfig, error) {
+	rf := &entity.ProxyConfig{}
+	hosts := make([]string, 0, len(r.Spec.Hostnames))
+	for _, h := range r.Spec.Hostnames {
+		hosts = append(hosts, string(h))
+	}
+	for i, rule := range r.Spec.Rules {
+		targets, err := t.backendRefs(rf, r.Namespace, rule.BackendRefs)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid backend refs of rule %d", i)
+		}
+		timeout, err := requestTimeout(rule.Timeouts)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid timeouts of rule %d", i)
+		}
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []gatewayv1.HTTPRouteMatch{{}}
+		}
+		for j, match := range matches {
+			items, err := t.httpRouteMatch(rf, r.Namespace, &match, rule.Filters)
+			if err != nil {
+				return nil, gerrs.Wrapf(err, "invalid rule %d match %d", i, j)
+			}
+			for _, item := range items {
+				item.ID = fmt.Sprintf("httproute/%s/%s/%d/%d", r.Namespace, r.Name, i, j)
+				item.Host = hosts
+				item.Timeout = timeout
+				// Each router item has its own target services, which are initialized by the router
+				for _, ts := range targets {
+					item.TargetService = append(item.TargetService, &entity.TargetService{
+						Service: ts.Service,
+						Weight:  ts.Weight,
+					})
+				}
+			}
+			rf.Router = append(rf.Router, items...)
+		}
+	}
+	return rf, nil
+}
+
+// httpRouteMatch translates the match and the filters of a rule into the router items
+func (t *translator) httpRouteMatch(rf *entity.ProxyConfig, namespace string, match *gatewayv1.HTTPRouteMatch,
+	filters []gatewayv1.HTTPRouteFilter) ([]*entity.RouterItem, error) {
+	path, pathType := "/", gatewayv1.PathMatchPathPrefix
+	if match.Path != nil {
+		if match.Path.Value != nil {
+			path = *match.Path.Value
+		}
+		if match.Path.Type != nil {
+			pathType = *match.Path.Type
+		}
+	}
+	var matches []*pathMatch
+	switch pathType {
+	case gatewayv1.PathMatchExact, gatewayv1.PathMatchPathPrefix:
+		m, err := paths(path, pathType == gatewayv1.PathMatchExact)
+		if err != nil {
+			return nil, err
+		}
+		matches = m
+	case gatewayv1.PathMatchRegularExpression:
+		matches = []*pathMatch{{method: "^(?:" + path + ")$", isRegexp: true}}
+	default:
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "unsupported path match type:%s", pathType)
+	}
+	ruleItem, err := conditions(match)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*entity.RouterItem, 0, len(matches))
+	for _, m := range matches {
+		item := &entity.RouterItem{
+			Method:   m.method,
+			IsRegexp: m.isRegexp,
+			Priority: m.priority,
+		}
+		if match.Method != nil {
+			item.HTTPMethods = []string{string(*match.Method)}
+		}
+		if ruleItem != nil {
+			// Each router item has its own rule, which is parsed by the router
+			item.Rule = &entity.RuleItem{Conditions: cloneConditions(ruleItem.Conditions),
+				Expression: ruleItem.Expression}
+		}
+		if err := t.filters(rf, namespace, item, m, filters); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// paths translates the path into the path matches. An exact path is matched exactly, and a prefix is matched by path
+// elements, that is, /foo matches /foo and /foo/bar but not /foobar.
+func paths(path string, exact bool) ([]*pathMatch, error) {
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "path %s does not start with /", path)
+	}
+	if exact {
+		return []*pathMatch{{method: path}}, nil
+	}
+	prefix := strings.TrimRight(path, "/")
+	if prefix == "" {
+		return []*pathMatch{{method: catchAll, isRegexp: true, priority: catchAllPriority, prefix: "/"}}, nil
+	}
+	return []*pathMatch{
+		{method: prefix, prefix: prefix},
+		{method: prefix + "/", prefix: prefix},
+	}, nil
+}
+
+// conditions translates the header and query param matches into the rule, which requires all of them
+func conditions(match *gatewayv1.HTTPRouteMatch) (*entity.RuleItem, error) {
+	var conds []*entity.Condition
+	for _, h := range match.Headers {
+		oper, err := matchOper(h.Type == nil || *h.Type == gatewayv1.HeaderMatchExact,
+			h.Type != nil && *h.Type == gatewayv1.HeaderMatchRegularExpression)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid match of header %s", h.Name)
+		}
+		conds = append(conds, &entity.Condition{Key: "header:" + string(h.Name), Val: h.Value, Oper: oper})
+	}
+	for _, q := range match.QueryParams {
+		oper, err := matchOper(q.Type == nil || *q.Type == gatewayv1.QueryParamMatchExact,
+			q.Type != nil && *q.Type == gatewayv1.QueryParamMatchRegularExpression)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid match of query param %s", q.Name)
+		}
+		conds = append(conds, &entity.Condition{Key: "query:" + string(q.Name), Val: q.Value, Oper: oper})
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	indexes := make([]string, 0, len(conds))
+	for i := range conds {
+		indexes = append(indexes, fmt.Sprint(i))
+	}
+	return &entity.RuleItem{Conditions: conds, Expression: strings.Join(indexes, "&&")}, nil
+}
+
+// matchOper returns the operator of the exact or regular expression match
+func matchOper(exact, regexp bool) (string, error) {
+	switch {
+	case exact:
+		return "==", nil
+	case regexp:
+		return "regexp", nil
+	default:
+		return "", errs.New(gerrs.ErrWrongConfig, "unsupported match type")
+	}
+}
+
+// cloneConditions copies the conditions
+func cloneConditions(conds []*entity.Condition) []*entity.Condition {
+	cloned := make([]*entity.Condition, 0, len(conds))
+	for _, c := range conds {
+		cloned = append(cloned, &entity.Condition{Key: c.Key, Val: c.Val, Oper: c.Oper})
+	}
+	return cloned
+}
+
+// filters translates the filters into the rewrite, the shadow and the plugins of the router item
+func (t *translator) filters(rf *entity.ProxyConfig, namespace string, item *entity.RouterItem, m *pathMatch,
+	filters []gatewayv1.HTTPRouteFilter) error {
+	request := map[string]interface{}{}
+	response := map[string]interface{}{}
+	for _, f := range filters {
+		switch f.Type {
+		case gatewayv1.HTTPRouteFilterRequestHeaderModifier:
+			if f.RequestHeaderModifier == nil {
+				return errs.New(gerrs.ErrWrongConfig, "empty request header modifier")
+			}
+			if err := setHeaders(request, f.RequestHeaderModifier, func(kv string) interface{} { return kv },
+				func(names []string) interface{} { return names }); err != nil {
+				return err
+			}
+		case gatewayv1.HTTPRouteFilterResponseHeaderModifier:
+			if f.ResponseHeaderModifier == nil {
+				return errs.New(gerrs.ErrWrongConfig, "empty response header modifier")
+			}
+			// The response transformer takes the keys of each status codes
+			if err := setHeaders(response, f.ResponseHeaderModifier, func(kv string) interface{} {
+				return map[string]interface{}{"keys": []string{kv}}
+			}, func(names []string) interface{} {
+				return []interface{}{map[string]interface{}{"keys": names}}
+			}); err != nil {
+				return err
+			}
+		case gatewayv1.HTTPRouteFilterURLRewrite:
+			if f.URLRewrite == nil {
+				return errs.New(gerrs.ErrWrongConfig, "empty url rewrite")
+			}
+			if f.URLRewrite.Hostname != nil {
+				request["rewrite_host"] = string(*f.URLRewrite.Hostname)
+			}
+			if err := rewrite(item, m, f.URLRewrite.Path); err != nil {
+				return err
+			}
+		case gatewayv1.HTTPRouteFilterRequestRedirect:
+			props, err := redirectProps(f.RequestRedirect)
+			if err != nil {
+				return err
+			}
+			item.Plugins = append(item.Plugins, &entity.Plugin{Name: redirect, Props: props})
+		case gatewayv1.HTTPRouteFilterRequestMirror:
+			if f.RequestMirror == nil {
+				return errs.New(gerrs.ErrWrongConfig, "empty request mirror")
+			}
+			service, err := t.service(rf, namespace, &f.RequestMirror.BackendRef)
+			if err != nil {
+				return gerrs.Wrap(err, "invalid request mirror backend")
+			}
+			item.Shadow = &entity.ShadowConfig{Service: service, Percent: 100}
+		default:
+			return errs.Newf(gerrs.ErrWrongConfig, "unsupported filter type:%s", f.Type)
+		}
+	}
+	if len(request) != 0 {
+		item.Plugins = append(item.Plugins, &entity.Plugin{Name: requestTransformer, Props: request})
+	}
+	if len(response) != 0 {
+		item.Plugins = append(item.Plugins, &entity.Plugin{Name: responseTransformer, Props: response})
+	}
+	return nil
+}
+
+// setHeaders sets the headers to add and to remove to the props of the transformer, the headers to set are added.
+// The transformers split the headers by colons, so the values with colons are not supported.
+func setHeaders(props map[string]interface{}, f *gatewayv1.HTTPHeaderFilter, add func(kv string) interface{},
+	remove func(names []string) interface{}) error {
+	var adds []interface{}
+	if v, ok := props["add_headers"].([]interface{}); ok {
+		adds = v
+	}
+	for _, h := range append(append([]gatewayv1.HTTPHeader{}, f.Set...), f.Add...) {
+		if strings.Contains(h.Value, ":") {
+			return errs.Newf(gerrs.ErrWrongConfig, "value of header %s with colons is not supported", h.Name)
+		}
+		adds = append(adds, add(string(h.Name)+":"+h.Value))
+	}
+	if len(adds) != 0 {
+		props["add_headers"] = adds
+	}
+	if len(f.Remove) != 0 {
+		props["remove_headers"] = remove(f.Remove)
+	}
+	return nil
+}
+
+// rewrite translates the path modifier into the rewrite of the router item
+func rewrite(item *entity.RouterItem, m *pathMatch, p *gatewayv1.HTTPPathModifier) error {
+	if p == nil {
+		return nil
+	}
+	switch p.Type {
+	case gatewayv1.FullPathHTTPPathModifier:
+		if p.ReplaceFullPath == nil {
+			return errs.New(gerrs.ErrWrongConfig, "empty replace full path")
+		}
+		item.ReWrite = *p.ReplaceFullPath
+	case gatewayv1.PrefixMatchHTTPPathModifier:
+		if p.ReplacePrefixMatch == nil || m.prefix == "" {
+			return errs.New(gerrs.ErrWrongConfig, "replace prefix match requires a path prefix match")
+		}
+		replaced := strings.TrimRight(*p.ReplacePrefixMatch, "/")
+		switch {
+		case item.IsRegexp:
+			// The rest of the path is captured by the catch-all method
+			item.ReWrite = replaced + "/$1"
+		case item.Method == m.prefix:
+			item.ReWrite = replaced
+			if replaced == "" {
+				item.ReWrite = "/"
+			}
+		default:
+			item.ReWrite, item.StripPath = replaced+"/", true
+		}
+	default:
+		return errs.Newf(gerrs.ErrWrongConfig, "unsupported path modifier type:%s", p.Type)
+	}
+	return nil
+}
+
+// redirectProps translates the request redirect into the props of the redirect plugin, the path is kept if it is not
+// replaced
+func redirectProps(r *gatewayv1.HTTPRequestRedirectFilter) (map[string]interface{}, error) {
+	if r == nil {
+		return nil, errs.New(gerrs.ErrWrongConfig, "empty request redirect")
+	}
+	code := http.StatusFound
+	if r.StatusCode != nil {
+		code = *r.StatusCode
+	}
+	scheme := ""
+	if r.Scheme != nil {
+		scheme = *r.Scheme
+	}
+	if r.Hostname == nil && r.Path == nil && r.Port == nil {
+		if scheme != "https" {
+			return nil, errs.New(gerrs.ErrWrongConfig, "redirect without hostname and path only supports https")
+		}
+		return map[string]interface{}{"http_to_https": true}, nil
+	}
+	if r.Path != nil && r.Path.Type != gatewayv1.FullPathHTTPPathModifier {
+		return nil, errs.New(gerrs.ErrWrongConfig, "redirect only supports replacing the full path")
+	}
+	if r.Hostname == nil && (scheme != "" || r.Port != nil) {
+		return nil, errs.New(gerrs.ErrWrongConfig, "redirect hostname is required with scheme or port")
+	}
+	origin := ""
+	if r.Hostname != nil {
+		if scheme == "" {
+			scheme = "http"
+		}
+		origin = scheme + "://" + string(*r.Hostname)
+		if r.Port != nil {
+			origin += fmt.Sprintf(":%d", *r.Port)
+		}
+	}
+	props := map[string]interface{}{"ret_code": code}
+	if r.Path != nil && r.Path.ReplaceFullPath != nil {
+		props["uri"] = origin + *r.Path.ReplaceFullPath
+		return props, nil
+	}
+	props["regex_uri"] = []string{"^(.*)$", origin + "$1"}
+	return props, nil
+}
+
+// requestTimeout returns the request timeout in milliseconds
+func requestTimeout(timeouts *gatewayv1.HTTPRouteTimeouts) (int, error) {
+	if timeouts == nil || timeouts.Request == nil {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(string(*timeouts.Request))
+	if err != nil {
+		return 0, errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid request timeout %s", *timeouts.Request)
+	}
+	return int(d / time.Millisecond), nil
+}
+
+// backendRefs adds the clients of the backends, and returns the target services weighted by the backend weights. The
+// backends of zero weight are skipped.
+func (t *translator) backendRefs(rf *entity.ProxyConfig, namespace string,
+	refs []gatewayv1.HTTPBackendRef) ([]*entity.TargetService, error) {
+	var targets []*entity.TargetService
+	for i, ref := range refs {
+		if len(ref.Filters) != 0 {
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "filters of backend ref %d are not supported", i)
+		}
+		service, err := t.service(rf, namespace, &ref.BackendObjectReference)
+		if err != nil {
+			return nil, gerrs.Wrapf(err, "invalid backend ref %d", i)
+		}
+		weight := 1
+		if ref.Weight != nil {
+			weight = int(*ref.Weight)
+		}
+		if weight == 0 {
+			continue
+		}
+		targets = append(targets, &entity.TargetService{Service: service, Weight: weight})
+	}
+	if len(targets) == 0 {
+		return nil, errs.New(gerrs.ErrWrongConfig, "no backend ref of non-zero weight")
+	}
+	return targets, nil
+}
+
+// service adds the client of the Service backend, and returns the client name. Only the Services in the same
+// namespace are supported.
+func (t *translator) service(rf *entity.ProxyConfig, namespace string,
+	ref *gatewayv1.BackendObjectReference) (string, error) {
+	if (ref.Group != nil && *ref.Group != "") || (ref.Kind != nil && *ref.Kind != "Service") {
+		return "", errs.Newf(gerrs.ErrWrongConfig, "backend %s is not a Service", ref.Name)
+	}
+	if ref.Namespace != nil && string(*ref.Namespace) != namespace {
+		return "", errs.Newf(gerrs.ErrWrongConfig, "backend %s in another namespace is not permitted", ref.Name)
+	}
+	if ref.Port == nil {
+		return "", errs.Newf(gerrs.ErrWrongConfig, "port of backend %s is required", ref.Name)
+	}
+	return t.client(rf, namespace, string(ref.Name), int32(*ref.Port)), nil
+}
+
+// client adds the client of the Service port if not added, and returns the client name
+func (t *translator) client(rf *entity.ProxyConfig, namespace, service string, port int32) string {
+	name := fmt.Sprintf("k8s.%s.%s.%d", namespace, service, port)
+	for _, c := range rf.Client {
+		if c.ServiceName == name {
+			return name
+		}
+	}
+	c := &entity.BackendConfig{}
+	c.ServiceName = name
+	c.Target = fmt.Sprintf("ip://%s.%s.svc.%s:%d", service, namespace, t.opts.ClusterDomain, port)
+	c.Network = "tcp"
+	c.Protocol = "fasthttp"
+	rf.Client = append(rf.Client, c)
+	return name
+}
@@ -0,0 +1,343 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func newTestTranslator() *translator {
+	return &translator{opts: defaultOptions()}
+}
+
+func newHTTPRoute(rules ...gatewayv1.HTTPRouteRule) *gatewayv1.HTTPRoute {
+	return &gatewayv1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Generation: 1},
+		Spec: gatewayv1.HTTPRouteSpec{
+			CommonRouteSpec: gatewayv1.CommonRouteSpec{
+				ParentRefs: []gatewayv1.ParentReference{{Name: "gw"}},
+			},
+			Hostnames: []gatewayv1.Hostname{"example.com"},
+			Rules:     rules,
+		},
+	}
+}
+
+func backendRef(name string, port int32, weight *int32) gatewayv1.HTTPBackendRef {
+	return gatewayv1.HTTPBackendRef{BackendRef: gatewayv1.BackendRef{
+		BackendObjectReference: gatewayv1.BackendObjectReference{
+			Name: gatewayv1.ObjectName(name),
+			Port: ptr(gatewayv1.PortNumber(port)),
+		},
+		Weight: weight,
+	}}
+}
+
+func methods(items []*entity.RouterItem) []string {
+	var ms []string
+	for _, item := range items {
+		ms = append(ms, item.Method)
+	}
+	return ms
+}
+
+func TestTranslator_ingress(t *testing.T) {
+	tr := newTestTranslator()
+	ing := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec: networkingv1.IngressSpec{
+			DefaultBackend: &networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+				Name: "fallback", Port: networkingv1.ServiceBackendPort{Number: 80},
+			}},
+			Rules: []networkingv1.IngressRule{{
+				Host: "example.com",
+				IngressRuleValue: networkingv1.IngressRuleValue{HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     "/exact",
+							PathType: ptr(networkingv1.PathTypeExact),
+							Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+								Name: "api", Port: networkingv1.ServiceBackendPort{Number: 8080},
+							}},
+						},
+						{
+							Path:     "/api/",
+							PathType: ptr(networkingv1.PathTypePrefix),
+							Backend: networkingv1.IngressBackend{Service: &networkingv1.IngressServiceBackend{
+								Name: "api", Port: networkingv1.ServiceBackendPort{Number: 8080},
+							}},
+						},
+					},
+				}},
+			}},
+		},
+	}
+	rf, err := tr.ingress(ing)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"^/(.*)", "/exact", "/api", "/api/"}, methods(rf.Router))
+	assert.Equal(t, "ingress/default/web/default", rf.Router[0].ID)
+	assert.True(t, rf.Router[0].IsRegexp)
+	assert.Equal(t, catchAllPriority, rf.Router[0].Priority)
+	assert.Nil(t, rf.Router[0].Host)
+	assert.Equal(t, "ingress/default/web/0/1", rf.Router[2].ID)
+	assert.Equal(t, []string{"example.com"}, rf.Router[2].Host)
+	assert.Equal(t, "k8s.default.api.8080", rf.Router[2].TargetService[0].Service)
+	assert.Equal(t, 1, rf.Router[2].TargetService[0].Weight)
+	require.Len(t, rf.Client, 2)
+	assert.Equal(t, "k8s.default.fallback.80", rf.Client[0].ServiceName)
+	assert.Equal(t, "ip://api.default.svc.cluster.local:8080", rf.Client[1].Target)
+	assert.Equal(t, "tcp", rf.Client[1].Network)
+	assert.Equal(t, "fasthttp", rf.Client[1].Protocol)
+
+	// Named ports are not supported
+	ing.Spec.DefaultBackend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+	_, err = tr.ingress(ing)
+	assert.NotNil(t, err)
+	// Resource backends are not supported
+	ing.Spec.DefaultBackend = &networkingv1.IngressBackend{}
+	_, err = tr.ingress(ing)
+	assert.NotNil(t, err)
+}
+
+func TestTranslator_httpRoute(t *testing.T) {
+	tr := newTestTranslator()
+	r := newHTTPRoute(gatewayv1.HTTPRouteRule{
+		Matches: []gatewayv1.HTTPRouteMatch{{
+			Path: &gatewayv1.HTTPPathMatch{Type: ptr(gatewayv1.PathMatchPathPrefix), Value: ptr("/api")},
+			Headers: []gatewayv1.HTTPHeaderMatch{
+				{Name: "x-env", Value: "test"},
+				{Type: ptr(gatewayv1.HeaderMatchRegularExpression), Name: "x-user", Value: "^vip"},
+			},
+			QueryParams: []gatewayv1.HTTPQueryParamMatch{{Name: "debug", Value: "1"}},
+			Method:      ptr(gatewayv1.HTTPMethodGet),
+		}},
+		BackendRefs: []gatewayv1.HTTPBackendRef{
+			backendRef("api", 8080, ptr(int32(90))),
+			backendRef("canary", 8080, ptr(int32(10))),
+			backendRef("off", 8080, ptr(int32(0))),
+		},
+		Timeouts: &gatewayv1.HTTPRouteTimeouts{Request: ptr(gatewayv1.Duration("1500ms"))},
+	}, gatewayv1.HTTPRouteRule{
+		Matches: []gatewayv1.HTTPRouteMatch{{
+			Path: &gatewayv1.HTTPPathMatch{Type: ptr(gatewayv1.PathMatchRegularExpression),
+				Value: ptr("/user/[0-9]+")},
+		}},
+		BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+	})
+	rf, err := tr.httpRoute(r)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"/api", "/api/", "^(?:/user/[0-9]+)$"}, methods(rf.Router))
+	item := rf.Router[1]
+	assert.Equal(t, "httproute/default/web/0/0", item.ID)
+	assert.Equal(t, []string{"example.com"}, item.Host)
+	assert.Equal(t, []string{"GET"}, item.HTTPMethods)
+	assert.Equal(t, 1500, item.Timeout)
+	require.Len(t, item.TargetService, 2)
+	assert.Equal(t, 90, item.TargetService[0].Weight)
+	assert.Equal(t, "k8s.default.canary.8080", item.TargetService[1].Service)
+	require.NotNil(t, item.Rule)
+	assert.Equal(t, "0&&1&&2", item.Rule.Expression)
+	assert.Equal(t, &entity.Condition{Key: "header:x-user", Val: "^vip", Oper: "regexp"}, item.Rule.Conditions[1])
+	assert.Equal(t, &entity.Condition{Key: "query:debug", Val: "1", Oper: "=="}, item.Rule.Conditions[2])
+	// The router items do not share the rules and the target services
+	assert.NotSame(t, rf.Router[0].Rule, item.Rule)
+	assert.NotSame(t, rf.Router[0].TargetService[0], item.TargetService[0])
+	assert.True(t, rf.Router[2].IsRegexp)
+	assert.Equal(t, "httproute/default/web/1/0", rf.Router[2].ID)
+	assert.Len(t, rf.Client, 3)
+
+	// The route without matches matches all paths
+	rf, err = tr.httpRoute(newHTTPRoute(gatewayv1.HTTPRouteRule{
+		BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+	}))
+	require.Nil(t, err)
+	assert.Equal(t, []string{"^/(.*)"}, methods(rf.Router))
+
+	// The backends of zero weight are rejected
+	_, err = tr.httpRoute(newHTTPRoute(gatewayv1.HTTPRouteRule{
+		BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, ptr(int32(0)))},
+	}))
+	assert.NotNil(t, err)
+}
+
+func TestTranslator_httpRouteInvalid(t *testing.T) {
+	tr := newTestTranslator()
+	otherNamespace := backendRef("api", 8080, nil)
+	otherNamespace.Namespace = ptr(gatewayv1.Namespace("other"))
+	notService := backendRef("api", 8080, nil)
+	notService.Kind = ptr(gatewayv1.Kind("Bucket"))
+	noPort := backendRef("api", 8080, nil)
+	noPort.Port = nil
+	withFilters := backendRef("api", 8080, nil)
+	withFilters.Filters = []gatewayv1.HTTPRouteFilter{{Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier}}
+	rules := []gatewayv1.HTTPRouteRule{
+		{BackendRefs: []gatewayv1.HTTPBackendRef{otherNamespace}},
+		{BackendRefs: []gatewayv1.HTTPBackendRef{notService}},
+		{BackendRefs: []gatewayv1.HTTPBackendRef{noPort}},
+		{BackendRefs: []gatewayv1.HTTPBackendRef{withFilters}},
+		{
+			BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+			Filters: []gatewayv1.HTTPRouteFilter{{Type: gatewayv1.HTTPRouteFilterExtensionRef,
+				ExtensionRef: &gatewayv1.LocalObjectReference{Name: "x"}}},
+		},
+		{
+			BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+			Timeouts:    &gatewayv1.HTTPRouteTimeouts{Request: ptr(gatewayv1.Duration("1x"))},
+		},
+		{
+			Matches: []gatewayv1.HTTPRouteMatch{{
+				Path: &gatewayv1.HTTPPathMatch{Type: ptr(gatewayv1.PathMatchExact), Value: ptr("api")},
+			}},
+			BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+		},
+		{
+			Matches: []gatewayv1.HTTPRouteMatch{{
+				Headers: []gatewayv1.HTTPHeaderMatch{{Type: ptr(gatewayv1.HeaderMatchType("Prefix")),
+					Name: "x", Value: "y"}},
+			}},
+			BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+		},
+	}
+	for i, rule := range rules {
+		_, err := tr.httpRoute(newHTTPRoute(rule))
+		assert.NotNil(t, err, "rule %d", i)
+	}
+}
+
+func TestTranslator_filters(t *testing.T) {
+	tr := newTestTranslator()
+	r := newHTTPRoute(gatewayv1.HTTPRouteRule{
+		Matches: []gatewayv1.HTTPRouteMatch{{
+			Path: &gatewayv1.HTTPPathMatch{Value: ptr("/api")},
+		}},
+		Filters: []gatewayv1.HTTPRouteFilter{
+			{
+				Type: gatewayv1.HTTPRouteFilterRequestHeaderModifier,
+				RequestHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+					Set:    []gatewayv1.HTTPHeader{{Name: "x-set", Value: "1"}},
+					Add:    []gatewayv1.HTTPHeader{{Name: "x-add", Value: "2"}},
+					Remove: []string{"x-remove"},
+				},
+			},
+			{
+				Type: gatewayv1.HTTPRouteFilterResponseHeaderModifier,
+				ResponseHeaderModifier: &gatewayv1.HTTPHeaderFilter{
+					Add:    []gatewayv1.HTTPHeader{{Name: "x-rsp", Value: "3"}},
+					Remove: []string{"server"},
+				},
+			},
+			{
+				Type: gatewayv1.HTTPRouteFilterURLRewrite,
+				URLRewrite: &gatewayv1.HTTPURLRewriteFilter{
+					Hostname: ptr(gatewayv1.PreciseHostname("backend.local")),
+					Path: &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier,
+						ReplacePrefixMatch: ptr("/v2")},
+				},
+			},
+			{
+				Type: gatewayv1.HTTPRouteFilterRequestMirror,
+				RequestMirror: &gatewayv1.HTTPRequestMirrorFilter{
+					BackendRef: backendRef("mirror", 9090, nil).BackendObjectReference,
+				},
+			},
+		},
+		BackendRefs: []gatewayv1.HTTPBackendRef{backendRef("api", 8080, nil)},
+	})
+	rf, err := tr.httpRoute(r)
+	require.Nil(t, err)
+	require.Len(t, rf.Router, 2)
+	exact, prefix := rf.Router[0], rf.Router[1]
+	assert.Equal(t, "/v2", exact.ReWrite)
+	assert.False(t, exact.StripPath)
+	assert.Equal(t, "/v2/", prefix.ReWrite)
+	assert.True(t, prefix.StripPath)
+	require.Len(t, prefix.Plugins, 2)
+	assert.Equal(t, &entity.Plugin{Name: requestTransformer, Props: map[string]interface{}{
+		"add_headers":    []interface{}{"x-set:1", "x-add:2"},
+		"remove_headers": []string{"x-remove"},
+		"rewrite_host":   "backend.local",
+	}}, prefix.Plugins[0])
+	assert.Equal(t, &entity.Plugin{Name: responseTransformer, Props: map[string]interface{}{
+		"add_headers":    []interface{}{map[string]interface{}{"keys": []string{"x-rsp:3"}}},
+		"remove_headers": []interface{}{map[string]interface{}{"keys": []string{"server"}}},
+	}}, prefix.Plugins[1])
+	require.NotNil(t, prefix.Shadow)
+	assert.Equal(t, "k8s.default.mirror.9090", prefix.Shadow.Service)
+	assert.Equal(t, float64(100), prefix.Shadow.Percent)
+	assert.Len(t, rf.Client, 2)
+
+	// The prefix of all paths is rewritten with the captured path
+	m, err := paths("/", false)
+	require.Nil(t, err)
+	item := &entity.RouterItem{Method: m[0].method, IsRegexp: m[0].isRegexp}
+	require.Nil(t, rewrite(item, m[0], &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier,
+		ReplacePrefixMatch: ptr("/v2/")}))
+	assert.Equal(t, "/v2/$1", item.ReWrite)
+	// The full path is replaced
+	require.Nil(t, rewrite(item, m[0], &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier,
+		ReplaceFullPath: ptr("/index")}))
+	assert.Equal(t, "/index", item.ReWrite)
+	// The prefix can not be replaced without a prefix match
+	assert.NotNil(t, rewrite(item, &pathMatch{method: "/exact"}, &gatewayv1.HTTPPathModifier{
+		Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr("/v2")}))
+
+	// The header values with colons are not supported
+	r.Spec.Rules[0].Filters[0].RequestHeaderModifier.Set[0].Value = "a:b"
+	_, err = tr.httpRoute(r)
+	assert.NotNil(t, err)
+}
+
+func TestRedirectProps(t *testing.T) {
+	props, err := redirectProps(&gatewayv1.HTTPRequestRedirectFilter{Scheme: ptr("https")})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"http_to_https": true}, props)
+
+	props, err = redirectProps(&gatewayv1.HTTPRequestRedirectFilter{
+		Hostname:   ptr(gatewayv1.PreciseHostname("example.com")),
+		Port:       ptr(gatewayv1.PortNumber(8443)),
+		Scheme:     ptr("https"),
+		StatusCode: ptr(301),
+	})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"ret_code": 301,
+		"regex_uri": []string{"^(.*)$", "https://example.com:8443$1"}}, props)
+
+	props, err = redirectProps(&gatewayv1.HTTPRequestRedirectFilter{
+		Path: &gatewayv1.HTTPPathModifier{Type: gatewayv1.FullPathHTTPPathModifier, ReplaceFullPath: ptr("/new")},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"ret_code": 302, "uri": "/new"}, props)
+
+	_, err = redirectProps(nil)
+	assert.NotNil(t, err)
+	_, err = redirectProps(&gatewayv1.HTTPRequestRedirectFilter{})
+	assert.NotNil(t, err)
+	_, err = redirectProps(&gatewayv1.HTTPRequestRedirectFilter{Port: ptr(gatewayv1.PortNumber(80))})
+	assert.NotNil(t, err)
+	_, err = redirectProps(&gatewayv1.HTTPRequestRedirectFilter{
+		Path: &gatewayv1.HTTPPathModifier{Type: gatewayv1.PrefixMatchHTTPPathModifier, ReplacePrefixMatch: ptr("/")},
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,244 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package layered provides a router config loader merging the configuration of several providers, such as the routes
+// in the image files overridden by the routes in etcd.
+package layered
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/config"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// loaderSuffix is the suffix of the registered loaders, which is the config module of the router
+const loaderSuffix = "_router"
+
+func init() {
+	config.RegisterConfLoader(config.LayeredProvider+loaderSuffix, &ConfLoader{})
+}
+
+// ConfLoader is the router configuration loader merging the layers of global.conf_providers. Each provider loads its
+// layer into a layer router of the protocol instead of the router, and the merged configuration is initialized
+// whenever any layer changes.
+type ConfLoader struct {
+	mu      sync.Mutex
+	mergers map[string]*merger
+}
+
+// LoadConf loads the layers in order, and initializes the router with the merged configuration
+func (l *ConfLoader) LoadConf(ctx context.Context, protocol string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.mergers[protocol]; ok {
+		return nil
+	}
+	providers := config.ConfProviders()
+	if len(providers) == 0 {
+		return errs.New(gerrs.ErrWrongConfig, "empty conf providers, configure global.conf_providers")
+	}
+	m, err := load(ctx, protocol, providers)
+	if err != nil {
+		return err
+	}
+	if l.mergers == nil {
+		l.mergers = map[string]*merger{}
+	}
+	l.mergers[protocol] = m
+	return nil
+}
+
+// load loads the layers of the providers, the merged configuration is initialized after all the layers are loaded.
+// Each layer has its own snapshot file suffixed with the provider, and the snapshots of the layers loaded during
+// booting are only saved after the merged configuration is accepted.
+func load(ctx context.Context, protocol string, providers []string) (m *merger, err error) {
+	m = &merger{
+		protocol: protocol,
+		names:    providers,
+		layers:   make([][]byte, len(providers)),
+		booting:  true,
+	}
+	layerProtocols := make([]string, 0, len(providers))
+	defer func() {
+		for _, layerProtocol := range layerProtocols {
+			if err != nil {
+				snapshot.Drop(layerProtocol)
+				continue
+			}
+			if ferr := snapshot.Flush(layerProtocol); ferr != nil {
+				log.ErrorContextf(ctx, "save router conf snapshot of %s err:%s", layerProtocol, ferr)
+			}
+		}
+	}()
+	seen := make(map[string]struct{}, len(providers))
+	for i, provider := range providers {
+		if _, ok := seen[provider]; ok {
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "duplicate conf provider:%s", provider)
+		}
+		seen[provider] = struct{}{}
+		loader := config.GetConfLoader(provider + loaderSuffix)
+		if loader == nil || provider == config.LayeredProvider {
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid conf provider:%s", provider)
+		}
+		layerProtocol := fmt.Sprintf("%s/layer/%s", protocol, provider)
+		router.RegisterRouter(layerProtocol, &layer{merger: m, index: i})
+		if file := snapshot.File(protocol); file != "" {
+			snapshot.SetFile(layerProtocol, file+"."+provider)
+		}
+		snapshot.Hold(layerProtocol)
+		layerProtocols = append(layerProtocols, layerProtocol)
+		if err := loader.LoadConf(ctx, layerProtocol); err != nil {
+			return nil, gerrs.Wrapf(err, "load layer %s err", provider)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.booting = false
+	if err := m.init(ctx); err != nil {
+		return nil, gerrs.Wrap(err, "init merged router conf err")
+	}
+	return m, nil
+}
+
+// merger holds the layers of a protocol
+type merger struct {
+	protocol string
+	names    []string
+
+	mu sync.Mutex
+	// layers are the marshaled configuration of the layers, nil if not loaded
+	layers [][]byte
+	// booting defers the initialization until all the layers are loaded
+	booting bool
+}
+
+// update updates the layer, and initializes the router with the merged configuration. The layer is reverted if the
+// merged configuration is invalid, so that the loader of the layer keeps its last good configuration.
+func (m *merger) update(ctx context.Context, index int, rf *entity.ProxyConfig) error {
+	// Marshaled before the initialization, which modifies the configuration
+	buf, err := yaml.Marshal(rf)
+	if err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "marshal layer conf err")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.layers[index]
+	m.layers[index] = buf
+	if m.booting {
+		return nil
+	}
+	if err := m.init(ctx); err != nil {
+		m.layers[index] = prev
+		return gerrs.Wrapf(err, "init router conf with layer %s err", m.names[index])
+	}
+	log.InfoContextf(ctx, "router conf reloaded with layer %s", m.names[index])
+	return nil
+}
+
+// init initializes the router with the merged configuration of the layers
+func (m *merger) init(ctx context.Context) error {
+	layers := make([]*entity.ProxyConfig, 0, len(m.layers))
+	for i, buf := range m.layers {
+		if buf == nil {
+			continue
+		}
+		// Unmarshaled again, since the router modifies the configuration during initialization
+		rf := &entity.ProxyConfig{}
+		if err := yaml.Unmarshal(buf, rf); err != nil {
+			return errs.Wrapf(err, gerrs.ErrWrongConfig, "unmarshal layer %s err", m.names[i])
+		}
+		layers = append(layers, rf)
+	}
+	return router.GetRouter(m.protocol).InitRouterConfig(ctx, Merge(layers...))
+}
+
+// layer is the router of a layer registered for the provider, which passes the configuration to the merger
+type layer struct {
+	merger *merger
+	index  int
+}
+
+// LoadRouterConf is not supported, the layers are loaded by the layered loader
+func (l *layer) LoadRouterConf(string) error {
+	return errs.New(gerrs.ErrWrongConfig, "layer router conf is loaded by the layered loader")
+}
+
+// InitRouterConfig updates the layer and initializes the router with the merged configuration
+func (l *layer) InitRouterConfig(ctx context.Context, rf *entity.ProxyConfig) error {
+	return l.merger.update(ctx, l.index, rf)
+}
+
+// GetMatchRouter matches the route with the router of the protocol
+func (l *layer) GetMatchRouter(ctx context.Context) (*entity.TargetService, error) {
+	return router.GetRouter(l.merger.protocol).GetMatchRouter(ctx)
+}
+
+// Merge merges the layers in order. The later layers replace the routers with the same id, the clients with the same
+// name and the global plugins with the same name in place, and the others are appended. The default route, the not
+// found response and the templates of the later layers take precedence, and the groups are appended.
+func Merge(layers ...*entity.ProxyConfig) *entity.ProxyConfig {
+	rf := &entity.ProxyConfig{}
+	routers := map[string]int{}
+	clients := map[string]int{}
+	plugins := map[string]int{}
+	for _, l := range layers {
+		for _, r := range l.Router {
+			if i, ok := routers[r.ID]; ok && r.ID != "" {
+				rf.Router[i] = r
+				continue
+			}
+			routers[r.ID] = len(rf.Router)
+			rf.Router = append(rf.Router, r)
+		}
+		for _, c := range l.Client {
+			if i, ok := clients[c.ServiceName]; ok {
+				rf.Client[i] = c
+				continue
+			}
+			clients[c.ServiceName] = len(rf.Client)
+			rf.Client = append(rf.Client, c)
+		}
+		for _, p := range l.Plugins {
+			if i, ok := plugins[p.Name]; ok {
+				rf.Plugins[i] = p
+				continue
+			}
+			plugins[p.Name] = len(rf.Plugins)
+			rf.Plugins = append(rf.Plugins, p)
+		}
+		if l.DefaultRoute != nil {
+			rf.DefaultRoute = l.DefaultRoute
+		}
+		if l.NotFound != nil {
+			rf.NotFound = l.NotFound
+		}
+		rf.Groups = append(rf.Groups, l.Groups...)
+		for name, t := range l.Templates {
+			if rf.Templates == nil {
+				rf.Templates = map[string]*entity.RouterItem{}
+			}
+			rf.Templates[name] = t
+		}
+	}
+	return rf
+}
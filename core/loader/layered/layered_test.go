@@ -0,0 +1,209 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package layered
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"trpc.group/trpc-go/trpc-gateway/core/config"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader/snapshot"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	"trpc.group/trpc-go/trpc-go/client"
+)
+
+// fakeLoader loads the configuration into the router of the protocol like the real loaders
+type fakeLoader struct {
+	rf       *entity.ProxyConfig
+	protocol string
+	err      error
+}
+
+func (f *fakeLoader) LoadConf(ctx context.Context, protocol string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.protocol = protocol
+	return snapshot.Init(ctx, snapshot.File(protocol), protocol, f.rf)
+}
+
+func backend(name, target string) *entity.BackendConfig {
+	return &entity.BackendConfig{BackendConfig: client.BackendConfig{ServiceName: name, Target: target}}
+}
+
+func TestConfLoader_LoadConf(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	r := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("layered_test", r)
+
+	base := &fakeLoader{rf: &entity.ProxyConfig{
+		Router: []*entity.RouterItem{{ID: "user", Method: "/user"}, {ID: "order", Method: "/order"}},
+		Client: []*entity.BackendConfig{backend("user", "ip://127.0.0.1:8080")},
+	}}
+	override := &fakeLoader{rf: &entity.ProxyConfig{
+		Router: []*entity.RouterItem{{ID: "user", Method: "/v2/user"}},
+	}}
+	config.RegisterConfLoader("base_router", base)
+	config.RegisterConfLoader("override_router", override)
+
+	// The merged configuration is initialized once after all the layers are loaded
+	var merged *entity.ProxyConfig
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			merged = rf
+			return nil
+		})
+	m, err := load(context.Background(), "layered_test", []string{"base", "override"})
+	require.Nil(t, err)
+	require.Len(t, merged.Router, 2)
+	assert.Equal(t, "/v2/user", merged.Router[0].Method)
+	assert.Equal(t, "/order", merged.Router[1].Method)
+	assert.Len(t, merged.Client, 1)
+	assert.Equal(t, "layered_test/layer/base", base.protocol)
+
+	// A change of a layer initializes the merged configuration again
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			merged = rf
+			return nil
+		})
+	err = router.GetRouter(override.protocol).InitRouterConfig(context.Background(), &entity.ProxyConfig{
+		Client: []*entity.BackendConfig{backend("user", "ip://127.0.0.1:8081")},
+	})
+	require.Nil(t, err)
+	require.Len(t, merged.Router, 2)
+	assert.Equal(t, "/user", merged.Router[0].Method)
+	assert.Equal(t, "ip://127.0.0.1:8081", merged.Client[0].Target)
+
+	// An invalid change is reverted
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid"))
+	err = router.GetRouter(override.protocol).InitRouterConfig(context.Background(), &entity.ProxyConfig{})
+	assert.NotNil(t, err)
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			merged = rf
+			return nil
+		})
+	require.Nil(t, m.init(context.Background()))
+	assert.Equal(t, "ip://127.0.0.1:8081", merged.Client[0].Target)
+
+	// The layer router only receives the configuration
+	assert.NotNil(t, router.GetRouter(base.protocol).LoadRouterConf("base"))
+	r.EXPECT().GetMatchRouter(gomock.Any()).Return(&entity.TargetService{Service: "user"}, nil)
+	ts, err := router.GetRouter(base.protocol).GetMatchRouter(context.Background())
+	require.Nil(t, err)
+	assert.Equal(t, "user", ts.Service)
+
+	// Invalid providers
+	_, err = load(context.Background(), "layered_test", []string{"base", "base"})
+	assert.NotNil(t, err)
+	_, err = load(context.Background(), "layered_test", []string{"unknown"})
+	assert.NotNil(t, err)
+	_, err = load(context.Background(), "layered_test", []string{config.LayeredProvider})
+	assert.NotNil(t, err)
+	config.RegisterConfLoader("failed_router", &fakeLoader{err: errors.New("failed")})
+	_, err = load(context.Background(), "layered_test", []string{"base", "failed"})
+	assert.NotNil(t, err)
+
+	// No providers configured
+	assert.NotNil(t, (&ConfLoader{}).LoadConf(context.Background(), "layered_test"))
+}
+
+func TestConfLoader_LoadConf_snapshot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	r := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("layered_snapshot", r)
+	defer func(file string) { snapshot.DefaultFile = file }(snapshot.DefaultFile)
+	snapshot.DefaultFile = filepath.Join(t.TempDir(), "router.snapshot.yaml")
+
+	base := &fakeLoader{rf: &entity.ProxyConfig{Router: []*entity.RouterItem{{ID: "user", Method: "/user"}}}}
+	override := &fakeLoader{rf: &entity.ProxyConfig{Router: []*entity.RouterItem{{ID: "user", Method: "/v2/user"}}}}
+	config.RegisterConfLoader("snapbase_router", base)
+	config.RegisterConfLoader("snapoverride_router", override)
+	providers := []string{"snapbase", "snapoverride"}
+
+	// The snapshots of the layers are not saved if the merged configuration is rejected during booting
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid"))
+	_, err := load(context.Background(), "layered_snapshot", providers)
+	assert.NotNil(t, err)
+	_, err = os.Stat(snapshot.DefaultFile + ".snapbase")
+	assert.True(t, os.IsNotExist(err))
+
+	// Each layer is saved to its own snapshot after the merged configuration is accepted
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	_, err = load(context.Background(), "layered_snapshot", providers)
+	require.Nil(t, err)
+	assert.Equal(t, snapshot.DefaultFile+".snapbase", snapshot.File(base.protocol))
+	rf, err := snapshot.Load(snapshot.File(base.protocol))
+	require.Nil(t, err)
+	assert.Equal(t, "/user", rf.Router[0].Method)
+	rf, err = snapshot.Load(snapshot.File(override.protocol))
+	require.Nil(t, err)
+	assert.Equal(t, "/v2/user", rf.Router[0].Method)
+	_, err = os.Stat(snapshot.DefaultFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// The changes of the layers are saved once the merged configuration is accepted
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid"))
+	err = snapshot.Init(context.Background(), snapshot.File(override.protocol), override.protocol,
+		&entity.ProxyConfig{Router: []*entity.RouterItem{{ID: "user", Method: "/v3/user"}}})
+	assert.NotNil(t, err)
+	r.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	err = snapshot.Init(context.Background(), snapshot.File(override.protocol), override.protocol,
+		&entity.ProxyConfig{Router: []*entity.RouterItem{{ID: "user", Method: "/v4/user"}}})
+	require.Nil(t, err)
+	rf, err = snapshot.Load(snapshot.File(override.protocol))
+	require.Nil(t, err)
+	assert.Equal(t, "/v4/user", rf.Router[0].Method)
+}
+
+func TestMerge(t *testing.T) {
+	one := 1
+	rf := Merge(&entity.ProxyConfig{
+		Router:       []*entity.RouterItem{{ID: "a", Method: "/a"}, {Method: "/noid"}, {ID: "b", Method: "/b"}},
+		Client:       []*entity.BackendConfig{backend("a", "ip://a"), backend("b", "ip://b")},
+		Plugins:      []*entity.Plugin{{Name: "cors"}, {Name: "accesslog"}},
+		DefaultRoute: &entity.RouterItem{ID: "default"},
+		Groups:       []*entity.RouterGroup{{RouterItem: entity.RouterItem{ID: "g1"}}},
+		Templates:    map[string]*entity.RouterItem{"t": {ReWrite: "/one"}},
+	}, &entity.ProxyConfig{
+		Router:    []*entity.RouterItem{{Method: "/noid"}, {ID: "b", Method: "/b2"}, {ID: "c", Method: "/c"}},
+		Client:    []*entity.BackendConfig{backend("b", "ip://b2")},
+		Plugins:   []*entity.Plugin{{Name: "cors", Order: &one}},
+		NotFound:  &entity.NotFoundConfig{Status: 403},
+		Groups:    []*entity.RouterGroup{{RouterItem: entity.RouterItem{ID: "g2"}}},
+		Templates: map[string]*entity.RouterItem{"t": {ReWrite: "/two"}},
+	})
+	var methods []string
+	for _, r := range rf.Router {
+		methods = append(methods, r.Method)
+	}
+	assert.Equal(t, []string{"/a", "/noid", "/b2", "/noid", "/c"}, methods)
+	require.Len(t, rf.Client, 2)
+	assert.Equal(t, "ip://b2", rf.Client[1].Target)
+	require.Len(t, rf.Plugins, 2)
+	assert.Equal(t, &one, rf.Plugins[0].Order)
+	assert.Equal(t, "default", rf.DefaultRoute.ID)
+	assert.Equal(t, 403, rf.NotFound.Status)
+	assert.Len(t, rf.Groups, 2)
+	assert.Equal(t, "/two", rf.Templates["t"].ReWrite)
+}
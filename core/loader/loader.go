@@ -0,0 +1,68 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package loader provides the functions shared by the router config loaders, such as reporting the results of
+// reloading and validating the configuration without applying it.
+package loader
+
+import (
+	"context"
+	"fmt"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+	"trpc.group/trpc-go/trpc-go/metrics"
+)
+
+// ReportReloadFunc is a function type used for reporting the results of reloading the router configuration of the
+// provider, such as file_router.
+type ReportReloadFunc func(provider string, err error)
+
+// DefaultReportReload is the default function of reporting the results of reloading the router configuration. The
+// successes are reported as reload_router_count and the failures as reload_router_err_count with the error code.
+// It can be overridden by the user.
+var DefaultReportReload ReportReloadFunc = func(provider string, err error) {
+	if err == nil {
+		reportMetrics(provider, "reload_router_count", nil)
+		return
+	}
+	reportMetrics(provider, "reload_router_err_count", []*metrics.Dimension{
+		{
+			Name:  "err_code",
+			Value: fmt.Sprint(errs.Code(err)),
+		},
+	})
+}
+
+// reportMetrics reports the count of reloading with the dimensions
+func reportMetrics(provider, name string, dims []*metrics.Dimension) {
+	dims = append(dims, &metrics.Dimension{Name: "provider", Value: provider})
+	indices := []*metrics.Metrics{
+		metrics.NewMetrics(name, float64(1), metrics.PolicySUM),
+	}
+	if err := metrics.Report(metrics.NewMultiDimensionMetricsX(gerrs.GatewayERRKey, dims, indices)); err != nil {
+		log.Errorf("report reload count failed:%s", err)
+	}
+}
+
+// CheckFunc validates the router configuration without applying it
+type CheckFunc func(ctx context.Context, rf *entity.ProxyConfig) error
+
+// DefaultCheck validates the configuration with a new router, which can be overridden by the user
+var DefaultCheck CheckFunc = func(ctx context.Context, rf *entity.ProxyConfig) error {
+	_, err := router.NewFastHTTPRouter().CheckAndInit(ctx, rf)
+	return err
+}
@@ -0,0 +1,32 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package loader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func TestDefaultReportReload(t *testing.T) {
+	DefaultReportReload("file_router", nil)
+	DefaultReportReload("file_router", errors.New("invalid"))
+}
+
+func TestDefaultCheck(t *testing.T) {
+	assert.NotNil(t, DefaultCheck(context.Background(), &entity.ProxyConfig{}))
+}
@@ -0,0 +1,394 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package prefix assembles the router configuration from the items stored in their own keys under a prefix, such as
+// routes/<id>, clients/<name> and plugins/<name>. Each changed item is validated on its own, and a rejected item does
+// not discard the accepted ones.
+package prefix
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/loader"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// Directories of the items under the prefix
+const (
+	// RoutesDir holds a router item in each key, the id defaults to the last segment of the key
+	RoutesDir = "routes/"
+	// ClientsDir holds an upstream service in each key, the name defaults to the last segment of the key
+	ClientsDir = "clients/"
+	// PluginsDir holds a global plugin in each key, the name defaults to the last segment of the key
+	PluginsDir = "plugins/"
+)
+
+// kinds are the directories in the order of validation, the routes depend on the clients and the plugins
+var kinds = []string{ClientsDir, PluginsDir, RoutesDir}
+
+// Change is a change of a key under the prefix
+type Change struct {
+	// Key is the key relative to the prefix, such as routes/foo
+	Key string
+	// Value is the new value, ignored if the key is deleted
+	Value []byte
+	// Raw is the value before expanding the env, which is returned by RawValues instead of the value, so that the
+	// secrets from the env are not persisted. The value is used if it is nil.
+	Raw []byte
+	// Revision is the revision of the change, such as the mod revision of etcd
+	Revision int64
+	// Deleted means the key is deleted
+	Deleted bool
+	// Err is the error of reading the value, such as expanding the env, the change is rejected with it
+	Err error
+}
+
+// Revision is the revision of a key, exposed for auditing
+type Revision struct {
+	// Key is the key relative to the prefix
+	Key string `json:"key"`
+	// Revision is the revision of the latest change
+	Revision int64 `json:"revision"`
+	// Deleted means the latest change deletes the key
+	Deleted bool `json:"deleted,omitempty"`
+	// Accepted is the revision of the accepted value, 0 if no value is accepted
+	Accepted int64 `json:"accepted"`
+	// Err is the reason why the latest change is rejected
+	Err string `json:"err,omitempty"`
+}
+
+// entry is the state of a key
+type entry struct {
+	kind     string
+	name     string
+	value    []byte
+	raw      []byte
+	revision int64
+	deleted  bool
+	// accepted is the accepted value, nil if no value is accepted
+	accepted         []byte
+	acceptedRaw      []byte
+	acceptedRevision int64
+	err              error
+	// readErr is the error of reading the latest value
+	readErr error
+}
+
+// pending checks if the latest change is not accepted yet
+func (e *entry) pending() bool {
+	if e.deleted {
+		return e.accepted != nil
+	}
+	return e.accepted == nil || !bytes.Equal(e.value, e.accepted) || e.revision != e.acceptedRevision
+}
+
+// Store holds the items under the prefix, it is not safe for concurrent use
+type Store struct {
+	check   loader.CheckFunc
+	entries map[string]*entry
+}
+
+// NewStore creates a store validating the items with the check function, loader.DefaultCheck is used if it is nil
+func NewStore(check loader.CheckFunc) *Store {
+	if check == nil {
+		check = loader.DefaultCheck
+	}
+	return &Store{
+		check:   check,
+		entries: map[string]*entry{},
+	}
+}
+
+// Apply applies the changes, and returns true if the accepted items change. Besides the changes, the items rejected
+// before are validated again, so that a router is accepted once the upstream service it depends on is added. The keys
+// out of the directories are ignored.
+func (s *Store) Apply(ctx context.Context, changes ...*Change) bool {
+	for _, c := range changes {
+		kind, name := split(c.Key)
+		if kind == "" {
+			log.WarnContextf(ctx, "ignore unknown router conf key:%s", c.Key)
+			continue
+		}
+		e, ok := s.entries[c.Key]
+		if !ok {
+			e = &entry{kind: kind, name: name}
+			s.entries[c.Key] = e
+		}
+		e.value, e.revision, e.deleted, e.err, e.readErr = c.Value, c.Revision, c.Deleted, nil, c.Err
+		e.raw = c.Raw
+		if e.raw == nil {
+			e.raw = c.Value
+		}
+		if e.deleted && e.accepted == nil {
+			delete(s.entries, c.Key)
+		}
+	}
+
+	var changed bool
+	// Validate until no more item is accepted, an item may depend on another one accepted in the same round
+	for progress := true; progress; {
+		progress = false
+		for _, key := range s.pendingKeys() {
+			e := s.entries[key]
+			if err := s.validate(ctx, e); err != nil {
+				e.err = err
+				continue
+			}
+			s.accept(key, e)
+			changed, progress = true, true
+		}
+	}
+	for _, key := range s.pendingKeys() {
+		e := s.entries[key]
+		log.ErrorContextf(ctx, "router conf key %s of revision %d is rejected, keep the revision %d: %s",
+			key, e.revision, e.acceptedRevision, e.err)
+	}
+	return changed
+}
+
+// accept accepts the latest change of the key
+func (s *Store) accept(key string, e *entry) {
+	e.err = nil
+	if e.deleted {
+		delete(s.entries, key)
+		return
+	}
+	e.accepted, e.acceptedRaw, e.acceptedRevision = e.value, e.raw, e.revision
+}
+
+// Err returns the errors of the rejected keys, nil if all the changes are accepted
+func (s *Store) Err() error {
+	var msgs []string
+	for _, key := range s.pendingKeys() {
+		if err := s.entries[key].err; err != nil {
+			msgs = append(msgs, key+": "+err.Error())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errs.Newf(gerrs.ErrWrongConfig, "rejected router conf keys: %s", strings.Join(msgs, "; "))
+}
+
+// Revisions returns the revisions of the keys sorted by key
+func (s *Store) Revisions() []*Revision {
+	revisions := make([]*Revision, 0, len(s.entries))
+	for _, key := range s.keys() {
+		e := s.entries[key]
+		r := &Revision{
+			Key:      key,
+			Revision: e.revision,
+			Deleted:  e.deleted,
+			Accepted: e.acceptedRevision,
+		}
+		if e.err != nil {
+			r.Err = e.err.Error()
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions
+}
+
+// Config assembles the accepted items into a new configuration, the routers are sorted by key
+func (s *Store) Config() (*entity.ProxyConfig, error) {
+	return s.assemble(nil, nil)
+}
+
+// RawValues returns the raw values of the accepted items by key, which restore the items through Apply
+func (s *Store) RawValues() map[string]string {
+	values := make(map[string]string, len(s.entries))
+	for key, e := range s.entries {
+		if e.accepted != nil {
+			values[key] = string(e.acceptedRaw)
+		}
+	}
+	return values
+}
+
+// validate validates the latest change of the entry with the accepted items. A router is validated on its own, and
+// an upstream service or a plugin is validated with the accepted routers depending on it, so a change breaking
+// these routers is rejected, including the deletion.
+func (s *Store) validate(ctx context.Context, e *entry) error {
+	var item interface{}
+	if !e.deleted {
+		if e.readErr != nil {
+			return e.readErr
+		}
+		v, err := parse(e.kind, e.name, e.value)
+		if err != nil {
+			return err
+		}
+		item = v
+	}
+	rf, err := s.assemble(e, item)
+	if err != nil {
+		return err
+	}
+	if e.kind != RoutesDir {
+		rf.Router, err = s.dependents(e, item, rf.Router)
+		if err != nil {
+			return err
+		}
+	} else {
+		rf.Router = nil
+		if item != nil {
+			rf.Router = []*entity.RouterItem{item.(*entity.RouterItem)}
+		}
+	}
+	if len(rf.Router) == 0 {
+		return nil
+	}
+	if err := s.check(ctx, rf); err != nil {
+		return gerrs.Wrap(err, "check router conf err")
+	}
+	return nil
+}
+
+// dependents returns the routers depending on the upstream service or the plugin of the entry, all the routers
+// depend on a global plugin
+func (s *Store) dependents(e *entry, item interface{}, routers []*entity.RouterItem) ([]*entity.RouterItem, error) {
+	if e.kind == PluginsDir {
+		return routers, nil
+	}
+	names := map[string]struct{}{}
+	if cli, ok := item.(*entity.BackendConfig); ok {
+		names[cli.ServiceName] = struct{}{}
+	}
+	if e.accepted != nil {
+		cli, err := parse(e.kind, e.name, e.accepted)
+		if err != nil {
+			return nil, err
+		}
+		names[cli.(*entity.BackendConfig).ServiceName] = struct{}{}
+	}
+	var dependents []*entity.RouterItem
+	for _, r := range routers {
+		if dependsOn(r, names) {
+			dependents = append(dependents, r)
+		}
+	}
+	return dependents, nil
+}
+
+// dependsOn checks if the router uses any of the upstream services
+func dependsOn(r *entity.RouterItem, names map[string]struct{}) bool {
+	for _, t := range r.TargetService {
+		if _, ok := names[t.Service]; ok {
+			return true
+		}
+	}
+	if r.Shadow != nil {
+		if _, ok := names[r.Shadow.Service]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// assemble assembles the accepted items into a new configuration, the item of the entry is replaced with the given
+// one, which is removed if nil
+func (s *Store) assemble(replaced *entry, item interface{}) (*entity.ProxyConfig, error) {
+	rf := &entity.ProxyConfig{}
+	for _, key := range s.keys() {
+		e := s.entries[key]
+		v := item
+		if e != replaced {
+			if e.accepted == nil {
+				continue
+			}
+			var err error
+			// Parsed again, since the router modifies the configuration during initialization
+			if v, err = parse(e.kind, e.name, e.accepted); err != nil {
+				return nil, err
+			}
+		}
+		switch v := v.(type) {
+		case *entity.RouterItem:
+			rf.Router = append(rf.Router, v)
+		case *entity.BackendConfig:
+			rf.Client = append(rf.Client, v)
+		case *entity.Plugin:
+			rf.Plugins = append(rf.Plugins, v)
+		}
+	}
+	return rf, nil
+}
+
+// pendingKeys returns the keys whose latest changes are not accepted, sorted by kind and key
+func (s *Store) pendingKeys() []string {
+	var keys []string
+	for _, kind := range kinds {
+		for _, key := range s.keys() {
+			if e := s.entries[key]; e.kind == kind && e.pending() {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// keys returns the sorted keys
+func (s *Store) keys() []string {
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// split returns the directory and the name of the key, the directory is empty if the key is unknown
+func split(key string) (string, string) {
+	for _, kind := range kinds {
+		if name := strings.TrimPrefix(key, kind); name != key && name != "" && !strings.Contains(name, "/") {
+			return kind, name
+		}
+	}
+	return "", ""
+}
+
+// parse parses the value of the key, the id or the name defaults to the name of the key and must be the same if set
+func parse(kind, name string, value []byte) (interface{}, error) {
+	var (
+		item interface{}
+		id   *string
+	)
+	switch kind {
+	case RoutesDir:
+		r := &entity.RouterItem{}
+		item, id = r, &r.ID
+	case ClientsDir:
+		c := &entity.BackendConfig{}
+		item, id = c, &c.ServiceName
+	default:
+		p := &entity.Plugin{}
+		item, id = p, &p.Name
+	}
+	if err := yaml.Unmarshal(value, item); err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "unmarshal %s%s err", kind, name)
+	}
+	if *id == "" {
+		*id = name
+	}
+	if *id != name {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "name %s of %s%s is not the same as the key", *id, kind, name)
+	}
+	return item, nil
+}
@@ -0,0 +1,216 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package prefix
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+)
+
+const (
+	clientFoo = `
+name: foo
+target: ip://127.0.0.1:8080
+network: tcp
+protocol: fasthttp
+`
+	clientBar = `
+target: ip://127.0.0.1:8081
+network: tcp
+protocol: fasthttp
+`
+	routeFoo = `
+method: /foo
+target_service:
+  - service: foo
+`
+	routeBar = `
+id: bar
+method: /bar
+target_service:
+  - service: bar
+`
+)
+
+func newTestStore(t *testing.T) *Store {
+	ctrl := gomock.NewController(t)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	return NewStore(nil)
+}
+
+func put(key, value string, revision int64) *Change {
+	return &Change{Key: key, Value: []byte(value), Revision: revision}
+}
+
+func del(key string, revision int64) *Change {
+	return &Change{Key: key, Revision: revision, Deleted: true}
+}
+
+func TestStore_Apply(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	// The route depending on a missing client is rejected, and the others are accepted
+	changed := s.Apply(ctx, put("clients/foo", clientFoo, 1), put("routes/foo", routeFoo, 2),
+		put("routes/bar", routeBar, 3), put("unknown/key", "x", 4))
+	assert.True(t, changed)
+	assert.NotNil(t, s.Err())
+	rf, err := s.Config()
+	require.Nil(t, err)
+	require.Len(t, rf.Router, 1)
+	assert.Equal(t, "foo", rf.Router[0].ID)
+	require.Len(t, rf.Client, 1)
+	assert.Equal(t, []*Revision{
+		{Key: "clients/foo", Revision: 1, Accepted: 1},
+		{Key: "routes/bar", Revision: 3, Err: s.Revisions()[1].Err},
+		{Key: "routes/foo", Revision: 2, Accepted: 2},
+	}, s.Revisions())
+	assert.NotEmpty(t, s.Revisions()[1].Err)
+
+	// The rejected route is accepted once the client is added
+	changed = s.Apply(ctx, put("clients/bar", clientBar, 5))
+	assert.True(t, changed)
+	assert.Nil(t, s.Err())
+	rf, err = s.Config()
+	require.Nil(t, err)
+	assert.Len(t, rf.Router, 2)
+	assert.Len(t, rf.Client, 2)
+
+	// An invalid change keeps the accepted revision
+	changed = s.Apply(ctx, put("routes/foo", "method: [", 6))
+	assert.False(t, changed)
+	assert.NotNil(t, s.Err())
+	r := s.Revisions()[3]
+	assert.Equal(t, int64(6), r.Revision)
+	assert.Equal(t, int64(2), r.Accepted)
+	rf, err = s.Config()
+	require.Nil(t, err)
+	assert.Len(t, rf.Router, 2)
+
+	// A client change breaking the depending routes is rejected
+	changed = s.Apply(ctx, put("clients/foo", "name: foo\nprotocol: fasthttp\n", 7))
+	assert.False(t, changed)
+	changed = s.Apply(ctx, del("clients/foo", 8))
+	assert.False(t, changed)
+	r = s.Revisions()[1]
+	assert.True(t, r.Deleted)
+	assert.Equal(t, int64(1), r.Accepted)
+	assert.NotEmpty(t, r.Err)
+
+	// The client is deleted after the depending route is deleted
+	changed = s.Apply(ctx, del("routes/foo", 9))
+	assert.True(t, changed)
+	assert.Nil(t, s.Err())
+	rf, err = s.Config()
+	require.Nil(t, err)
+	require.Len(t, rf.Router, 1)
+	require.Len(t, rf.Client, 1)
+	assert.Equal(t, "bar", rf.Client[0].ServiceName)
+	assert.Len(t, s.Revisions(), 2)
+}
+
+func TestStore_Apply_plugin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	// A plugin is not validated without routers
+	assert.True(t, s.Apply(ctx, put("plugins/unknown", "type: gateway", 1)))
+	// The route fails with the unknown global plugin
+	assert.True(t, s.Apply(ctx, put("clients/foo", clientFoo, 2), put("routes/foo", routeFoo, 3)))
+	assert.Contains(t, s.Err().Error(), "routes/foo")
+	// The route is accepted after the plugin is deleted
+	assert.True(t, s.Apply(ctx, del("plugins/unknown", 4)))
+	assert.Nil(t, s.Err())
+	// The plugin breaking the accepted routes is rejected
+	assert.False(t, s.Apply(ctx, put("plugins/unknown", "type: gateway", 5)))
+	assert.NotNil(t, s.Err())
+	rf, err := s.Config()
+	require.Nil(t, err)
+	assert.Len(t, rf.Router, 1)
+	assert.Empty(t, rf.Plugins)
+}
+
+func Test_parse(t *testing.T) {
+	v, err := parse(RoutesDir, "foo", []byte(routeFoo))
+	require.Nil(t, err)
+	assert.Equal(t, "foo", v.(*entity.RouterItem).ID)
+	_, err = parse(RoutesDir, "foo", []byte(routeBar))
+	assert.NotNil(t, err)
+	_, err = parse(ClientsDir, "bar", []byte(clientFoo))
+	assert.NotNil(t, err)
+	v, err = parse(PluginsDir, "cors", []byte("props: {}"))
+	require.Nil(t, err)
+	assert.Equal(t, "cors", v.(*entity.Plugin).Name)
+}
+
+func Test_split(t *testing.T) {
+	kind, name := split("routes/foo")
+	assert.Equal(t, RoutesDir, kind)
+	assert.Equal(t, "foo", name)
+	for _, key := range []string{"routes/", "routes/foo/bar", "router_conf", "foo/bar"} {
+		kind, _ = split(key)
+		assert.Empty(t, kind, key)
+	}
+}
+
+func TestStore_Apply_readErr(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	s.Apply(ctx, put("clients/foo", clientFoo, 1))
+	require.Nil(t, s.Err())
+
+	// The change failed to read is rejected, and the accepted value is kept
+	change := put("clients/foo", "target: ${GW_TARGET:?}", 2)
+	change.Err = assert.AnError
+	assert.False(t, s.Apply(ctx, change))
+	assert.ErrorContains(t, s.Err(), assert.AnError.Error())
+	rf, err := s.Config()
+	require.Nil(t, err)
+	require.Len(t, rf.Client, 1)
+	assert.Equal(t, "ip://127.0.0.1:8080", rf.Client[0].Target)
+}
+
+func TestStore_Err(t *testing.T) {
+	s := newTestStore(t)
+	s.Apply(context.Background(), put("plugins/cors", "name: foo", 1))
+	assert.Contains(t, s.Err().Error(), "plugins/cors")
+	s.Apply(context.Background(), put("plugins/cors", "name: cors", 2))
+	assert.Nil(t, s.Err())
+}
+
+func TestStore_RawValues(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+	change := put("clients/foo", clientFoo, 1)
+	change.Raw = []byte("target: ${GW_TARGET}")
+	s.Apply(ctx, change, put("routes/foo", routeFoo, 2), put("routes/bar", routeBar, 3))
+	// The raw values of the accepted items, the value is used without the raw one
+	assert.Equal(t, map[string]string{
+		"clients/foo": "target: ${GW_TARGET}",
+		"routes/foo":  routeFoo,
+	}, s.RawValues())
+
+	// The rejected change keeps the accepted raw value
+	change = put("clients/foo", "name: bar", 4)
+	change.Raw = []byte("name: ${GW_NAME}")
+	s.Apply(ctx, change)
+	assert.Equal(t, "target: ${GW_TARGET}", s.RawValues()["clients/foo"])
+}
@@ -0,0 +1,256 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package snapshot persists the last accepted router configuration of the loaders to a local file, so that the gateway
+// boots from it when the remote source is unreachable.
+package snapshot
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-gateway/internal/util"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// DefaultFile is the snapshot file of the router configuration, the snapshot is disabled if it is empty
+var DefaultFile = ""
+
+func init() {
+	flag.StringVar(&DefaultFile, "router_snapshot", DefaultFile, "router conf snapshot file")
+}
+
+var (
+	mu sync.Mutex
+	// files are the snapshot files set for the protocols, the other protocols use DefaultFile
+	files = map[string]string{}
+	// held are the snapshots held for the protocols, the value is nil until a snapshot is held
+	held = map[string]*heldSnapshot{}
+)
+
+// heldSnapshot is the snapshot held in memory
+type heldSnapshot struct {
+	file string
+	buf  []byte
+}
+
+// SetFile sets the snapshot file of the protocol, such as the file of a layer of the layered loader, so that the
+// protocols do not overwrite the snapshots of each other. An empty file disables the snapshot of the protocol.
+func SetFile(protocol, file string) {
+	mu.Lock()
+	defer mu.Unlock()
+	files[protocol] = file
+}
+
+// File returns the snapshot file of the protocol, which is DefaultFile unless it is set by SetFile
+func File(protocol string) string {
+	mu.Lock()
+	defer mu.Unlock()
+	if file, ok := files[protocol]; ok {
+		return file
+	}
+	return DefaultFile
+}
+
+// Hold holds the snapshots accepted by Init for the protocol in memory until Flush or Drop is called. It is used when
+// the configuration accepted by the router of the protocol is only validated later, such as a layer of the layered
+// loader during booting, which is validated after all the layers are loaded.
+func Hold(protocol string) {
+	mu.Lock()
+	defer mu.Unlock()
+	held[protocol] = nil
+}
+
+// Flush saves the last snapshot held for the protocol, and stops holding
+func Flush(protocol string) error {
+	mu.Lock()
+	h := held[protocol]
+	delete(held, protocol)
+	mu.Unlock()
+	if h == nil {
+		return nil
+	}
+	return write(h.file, h.buf)
+}
+
+// Drop discards the snapshot held for the protocol, and stops holding
+func Drop(protocol string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(held, protocol)
+}
+
+// hold holds the snapshot if the protocol is held
+func hold(protocol, file string, buf []byte) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := held[protocol]; !ok {
+		return false
+	}
+	held[protocol] = &heldSnapshot{file: file, buf: buf}
+	return true
+}
+
+// Init initializes the router of the protocol with the configuration, and saves the configuration to the snapshot file
+// if it is accepted. The configuration is marshaled before the initialization, which modifies the configuration. The
+// snapshot is skipped if the file is empty, held if the protocol is held, and a failure of saving is only logged.
+func Init(ctx context.Context, file, protocol string, rf *entity.ProxyConfig) error {
+	var buf []byte
+	if file != "" {
+		b, err := yaml.Marshal(rf)
+		if err != nil {
+			log.ErrorContextf(ctx, "marshal router conf snapshot err:%s", err)
+		}
+		buf = b
+	}
+	return InitWith(ctx, file, protocol, rf, buf)
+}
+
+// InitWith initializes the router of the protocol with the configuration like Init, but saves buf to the snapshot
+// file instead of the marshaled configuration, such as the values before expanding the env
+func InitWith(ctx context.Context, file, protocol string, rf *entity.ProxyConfig, buf []byte) error {
+	if err := router.GetRouter(protocol).InitRouterConfig(ctx, rf); err != nil {
+		return gerrs.Wrap(err, "init router err")
+	}
+	if file == "" || buf == nil || hold(protocol, file, buf) {
+		return nil
+	}
+	if err := write(file, buf); err != nil {
+		log.ErrorContextf(ctx, "save router conf snapshot err:%s", err)
+	}
+	return nil
+}
+
+// InitRaw initializes the router of the protocol with the raw configuration of a remote source, whose env references
+// are expanded by util.ExpandRemoteEnv. The raw configuration is saved instead of the expanded one, so that the
+// secrets from the env are not persisted in the snapshot, and RestoreRaw expands them again.
+func InitRaw(ctx context.Context, file, protocol string, raw []byte) error {
+	rf, err := parseRaw(raw)
+	if err != nil {
+		return err
+	}
+	return InitWith(ctx, file, protocol, rf, raw)
+}
+
+// Restore initializes the router of the protocol with the snapshot file, which is used when the remote source is
+// unreachable
+func Restore(ctx context.Context, file, protocol string) error {
+	return restore(ctx, file, protocol, Load)
+}
+
+// RestoreRaw is like Restore for the snapshot file saved by InitRaw, whose env references are expanded
+func RestoreRaw(ctx context.Context, file, protocol string) error {
+	return restore(ctx, file, protocol, LoadRaw)
+}
+
+// restore initializes the router of the protocol with the snapshot file loaded by the load function
+func restore(ctx context.Context, file, protocol string, load func(file string) (*entity.ProxyConfig, error)) error {
+	rf, err := load(file)
+	if err != nil {
+		return gerrs.Wrap(err, "load router conf snapshot err")
+	}
+	if err := router.GetRouter(protocol).InitRouterConfig(ctx, rf); err != nil {
+		return gerrs.Wrap(err, "init router from snapshot err")
+	}
+	log.InfoContextf(ctx, "router conf restored from snapshot:%s", file)
+	return nil
+}
+
+// Save saves the configuration to the snapshot file, the configuration should not have been initialized by the router
+func Save(file string, rf *entity.ProxyConfig) error {
+	buf, err := yaml.Marshal(rf)
+	if err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "marshal router conf err")
+	}
+	return write(file, buf)
+}
+
+// Load loads the configuration from the snapshot file
+func Load(file string) (*entity.ProxyConfig, error) {
+	buf, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	rf := &entity.ProxyConfig{}
+	if err := yaml.Unmarshal(buf, rf); err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "unmarshal snapshot %s err", file)
+	}
+	return rf, nil
+}
+
+// LoadRaw loads the configuration from the snapshot file saved by InitRaw, and expands the env references
+func LoadRaw(file string) (*entity.ProxyConfig, error) {
+	buf, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	rf, err := parseRaw(buf)
+	if err != nil {
+		return nil, gerrs.Wrapf(err, "parse snapshot %s err", file)
+	}
+	return rf, nil
+}
+
+// Read reads the snapshot file, which is used to restore the snapshot saved by InitWith
+func Read(file string) ([]byte, error) {
+	if file == "" {
+		return nil, errs.New(gerrs.ErrWrongConfig, "snapshot is disabled")
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "read snapshot %s err", file)
+	}
+	return buf, nil
+}
+
+// parseRaw expands the env references of the raw configuration from a remote source, and unmarshals it
+func parseRaw(raw []byte) (*entity.ProxyConfig, error) {
+	expanded, err := util.ExpandRemoteEnv(string(raw))
+	if err != nil {
+		return nil, gerrs.Wrap(err, "expand router conf env err")
+	}
+	rf := &entity.ProxyConfig{}
+	if err := yaml.Unmarshal([]byte(expanded), rf); err != nil {
+		return nil, errs.Wrap(err, gerrs.ErrWrongConfig, "unmarshal router conf err")
+	}
+	return rf, nil
+}
+
+// write writes the snapshot file atomically by renaming a temporary file in the same directory, so that a crash never
+// leaves a partial snapshot. The file is only readable by the owner, since the configuration may contain secrets.
+func write(file string, buf []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "create snapshot err")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "write snapshot err")
+	}
+	if err := tmp.Close(); err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "close snapshot err")
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return errs.Wrap(err, gerrs.ErrWrongConfig, "rename snapshot err")
+	}
+	return nil
+}
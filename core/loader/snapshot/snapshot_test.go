@@ -0,0 +1,185 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	mock_router "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+)
+
+func newConfig() *entity.ProxyConfig {
+	return &entity.ProxyConfig{
+		Router: []*entity.RouterItem{
+			{
+				Method:        "/user/info",
+				TargetService: []*entity.TargetService{{Service: "user"}},
+				Plugins:       []*entity.Plugin{{Name: "demo", Props: map[string]interface{}{"suid_name": "suid"}}},
+			},
+		},
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	assert.Nil(t, Save(file, newConfig()))
+	info, err := os.Stat(file)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	rf, err := Load(file)
+	assert.Nil(t, err)
+	assert.Equal(t, newConfig(), rf)
+
+	// Overwrite the snapshot without leaving the temporary files
+	assert.Nil(t, Save(file, &entity.ProxyConfig{}))
+	files, err := os.ReadDir(filepath.Dir(file))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+
+	_, err = Load("")
+	assert.NotNil(t, err)
+	_, err = Load(filepath.Join(t.TempDir(), "none.yaml"))
+	assert.NotNil(t, err)
+	assert.Nil(t, os.WriteFile(file, []byte("router: ["), 0600))
+	_, err = Load(file)
+	assert.NotNil(t, err)
+	assert.NotNil(t, Save(filepath.Join(t.TempDir(), "none", "router.yaml"), newConfig()))
+}
+
+func TestInitRestore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("snapshot", mockRouter)
+	file := filepath.Join(t.TempDir(), "router.snapshot.yaml")
+
+	// The rejected configuration is not saved
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid"))
+	assert.NotNil(t, Init(context.Background(), file, "snapshot", newConfig()))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	assert.NotNil(t, Restore(context.Background(), file, "snapshot"))
+
+	// The configuration is saved before it is modified by the router
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, rf *entity.ProxyConfig) error {
+			rf.Router[0].Plugins[0].Props = "parsed"
+			return nil
+		})
+	assert.Nil(t, Init(context.Background(), file, "snapshot", newConfig()))
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), newConfig()).Return(nil)
+	assert.Nil(t, Restore(context.Background(), file, "snapshot"))
+
+	// The snapshot is disabled
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	assert.Nil(t, Init(context.Background(), "", "snapshot", newConfig()))
+	assert.NotNil(t, Restore(context.Background(), "", "snapshot"))
+
+	// Failed to save the snapshot
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil)
+	assert.Nil(t, Init(context.Background(), filepath.Join(t.TempDir(), "none", "router.yaml"), "snapshot",
+		newConfig()))
+
+	// The snapshot is rejected
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(errors.New("invalid"))
+	assert.NotNil(t, Restore(context.Background(), file, "snapshot"))
+}
+
+func TestInitRawRestoreRaw(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("snapshot_raw", mockRouter)
+	file := filepath.Join(t.TempDir(), "router.snapshot.yaml")
+	t.Setenv("GW_SIGN_KEY", "secret")
+	raw := []byte("router:\n  - method: /user/info\n    plugins:\n      - name: demo\n        props:\n" +
+		"          key: ${GW_SIGN_KEY}\n")
+	expanded := &entity.ProxyConfig{Router: []*entity.RouterItem{{
+		Method:  "/user/info",
+		Plugins: []*entity.Plugin{{Name: "demo", Props: map[string]interface{}{"key": "secret"}}},
+	}}}
+
+	// The router gets the expanded configuration, while the snapshot keeps the raw one
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), expanded).Return(nil)
+	assert.Nil(t, InitRaw(context.Background(), file, "snapshot_raw", raw))
+	buf, err := Read(file)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, buf)
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), expanded).Return(nil)
+	assert.Nil(t, RestoreRaw(context.Background(), file, "snapshot_raw"))
+
+	// The remote configuration can not read the local files
+	assert.NotNil(t, InitRaw(context.Background(), file, "snapshot_raw", []byte("key: ${file:"+file+"}")))
+	assert.NotNil(t, InitRaw(context.Background(), file, "snapshot_raw", []byte("router: [")))
+	assert.Nil(t, os.WriteFile(file, []byte("router: ["), 0600))
+	assert.NotNil(t, RestoreRaw(context.Background(), file, "snapshot_raw"))
+	assert.NotNil(t, RestoreRaw(context.Background(), "", "snapshot_raw"))
+
+	// The given buffer is saved
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), newConfig()).Return(nil)
+	assert.Nil(t, InitWith(context.Background(), file, "snapshot_raw", newConfig(), []byte("raw")))
+	buf, err = Read(file)
+	assert.Nil(t, err)
+	assert.Equal(t, "raw", string(buf))
+}
+
+func TestHold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockRouter := mock_router.NewMockRouter(ctrl)
+	router.RegisterRouter("snapshot_hold", mockRouter)
+	mockRouter.EXPECT().InitRouterConfig(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	dir := t.TempDir()
+
+	// The file of the protocol
+	defer func(file string) { DefaultFile = file }(DefaultFile)
+	DefaultFile = filepath.Join(dir, "router.yaml")
+	assert.Equal(t, DefaultFile, File("snapshot_hold"))
+	SetFile("snapshot_hold", filepath.Join(dir, "router.yaml.layer"))
+	assert.Equal(t, filepath.Join(dir, "router.yaml.layer"), File("snapshot_hold"))
+	file := File("snapshot_hold")
+
+	// The held snapshot is saved by Flush
+	Hold("snapshot_hold")
+	assert.Nil(t, Init(context.Background(), file, "snapshot_hold", newConfig()))
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, Flush("snapshot_hold"))
+	rf, err := Load(file)
+	assert.Nil(t, err)
+	assert.Equal(t, newConfig(), rf)
+	assert.Nil(t, Flush("snapshot_hold"))
+
+	// The held snapshot is discarded by Drop
+	assert.Nil(t, os.Remove(file))
+	Hold("snapshot_hold")
+	assert.Nil(t, Init(context.Background(), file, "snapshot_hold", newConfig()))
+	Drop("snapshot_hold")
+	assert.Nil(t, Flush("snapshot_hold"))
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	// Saved directly after holding is stopped
+	assert.Nil(t, Init(context.Background(), file, "snapshot_hold", newConfig()))
+	_, err = os.Stat(file)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,55 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/breaker"
+)
+
+// initCircuitBreaker builds the circuit breakers of the target services, the circuit breaker of the router is
+// inherited by the target services that do not configure their own. The circuit breakers of the service scope are
+// shared by the routers of a configuration load, and the circuit breakers of the last load are reused through state.
+func initCircuitBreaker(item *entity.RouterItem, state *upstreamState) error {
+	for _, svr := range item.TargetService {
+		if svr.CircuitBreaker == nil {
+			svr.CircuitBreaker = item.CircuitBreaker
+		}
+		if svr.CircuitBreaker == nil {
+			continue
+		}
+		opts, err := breaker.NewOptions(svr.CircuitBreaker)
+		if err != nil {
+			return gerrs.Wrapf(err, "invalid circuit breaker of service:%s", svr.Service)
+		}
+		if svr.CircuitBreaker.Scope == breaker.ScopeRouter {
+			name := routerName(item)
+			key := breakerKey{router: name, service: svr.Service, opts: opts}
+			svr.Breaker = state.ownBreaker(key, name+"/"+svr.Service)
+			continue
+		}
+		svr.Breaker = state.sharedBreaker(breakerKey{service: svr.Service, opts: opts}, svr.Service)
+	}
+	return nil
+}
+
+// GetBreaker returns the circuit breaker of the target service, nil if not configured
+func GetBreaker(svr *entity.TargetService) *breaker.Breaker {
+	if svr == nil {
+		return nil
+	}
+	cb, _ := svr.Breaker.(*breaker.Breaker)
+	return cb
+}
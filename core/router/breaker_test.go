@@ -0,0 +1,165 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/breaker"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_initCircuitBreaker(t *testing.T) {
+	state := newUpstreamState(nil)
+	conf := &entity.CircuitBreakerConfig{ErrorRatio: 0.5}
+	item1 := &entity.RouterItem{
+		Method:         "/a",
+		CircuitBreaker: conf,
+		TargetService: []*entity.TargetService{
+			{Service: "a"},
+			{Service: "b", CircuitBreaker: &entity.CircuitBreakerConfig{Scope: "router", ErrorRatio: 0.5}},
+			{Service: "c", CircuitBreaker: &entity.CircuitBreakerConfig{ErrorRatio: 0.8}},
+		},
+	}
+	item2 := &entity.RouterItem{
+		ID:             "r2",
+		CircuitBreaker: &entity.CircuitBreakerConfig{ErrorRatio: 0.5},
+		TargetService: []*entity.TargetService{
+			{Service: "a"},
+			{Service: "b", CircuitBreaker: &entity.CircuitBreakerConfig{Scope: "router", ErrorRatio: 0.5}},
+			{Service: "c", CircuitBreaker: &entity.CircuitBreakerConfig{ErrorRatio: 0.5}},
+		},
+	}
+	assert.Nil(t, initCircuitBreaker(item1, state))
+	assert.Nil(t, initCircuitBreaker(item2, state))
+	// The circuit breaker of the router is inherited
+	assert.Equal(t, conf, item1.TargetService[0].CircuitBreaker)
+	// Shared by the same service and options
+	assert.Same(t, GetBreaker(item1.TargetService[0]), GetBreaker(item2.TargetService[0]))
+	assert.Equal(t, "a", GetBreaker(item1.TargetService[0]).Name())
+	assert.NotSame(t, GetBreaker(item1.TargetService[2]), GetBreaker(item2.TargetService[2]))
+	// A circuit breaker for each router
+	assert.NotSame(t, GetBreaker(item1.TargetService[1]), GetBreaker(item2.TargetService[1]))
+	assert.Equal(t, "/a/b", GetBreaker(item1.TargetService[1]).Name())
+	assert.Equal(t, "r2/b", GetBreaker(item2.TargetService[1]).Name())
+
+	item := &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "a"}}}
+	assert.Nil(t, initCircuitBreaker(item, state))
+	assert.Nil(t, GetBreaker(item.TargetService[0]))
+	assert.Nil(t, GetBreaker(nil))
+
+	item = &entity.RouterItem{
+		CircuitBreaker: &entity.CircuitBreakerConfig{},
+		TargetService:  []*entity.TargetService{{Service: "a"}},
+	}
+	assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(initCircuitBreaker(item, state)))
+}
+
+func TestFastHTTPRouter_InitRouterConfig_keepBreakers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	newConfig := func(ratio float64) *entity.ProxyConfig {
+		return &entity.ProxyConfig{
+			Router: []*entity.RouterItem{{
+				ID:             "r1",
+				Method:         "/user/",
+				CircuitBreaker: &entity.CircuitBreakerConfig{ErrorRatio: ratio, MinRequests: 1},
+				TargetService: []*entity.TargetService{
+					{Service: "primary"},
+					{
+						Service:        "backup",
+						Priority:       1,
+						CircuitBreaker: &entity.CircuitBreakerConfig{Scope: "router", ErrorRatio: 0.5, MinRequests: 1},
+					},
+				},
+			}},
+			Client: []*entity.BackendConfig{newFailoverClient("primary"), newFailoverClient("backup")},
+		}
+	}
+	trip := func(cb *breaker.Breaker) {
+		generation, ok := cb.Allow()
+		assert.True(t, ok)
+		cb.Report(generation, true, 0)
+		assert.Equal(t, breaker.StateOpen, cb.State())
+	}
+	r := NewFastHTTPRouter()
+	assert.Nil(t, r.InitRouterConfig(context.Background(), newConfig(0.5)))
+	svrs := r.getOpts().RadixTree.ToMap()["/user/"].([]*entity.RouterItem)[0].TargetService
+	primary, backup := GetBreaker(svrs[0]), GetBreaker(svrs[1])
+	trip(primary)
+	trip(backup)
+	health := svrs[0].Health.(*targetHealth)
+	health.failures.Store(2)
+
+	// The open circuit breakers and the failures survive the reload of the same configuration
+	assert.Nil(t, r.InitRouterConfig(context.Background(), newConfig(0.5)))
+	svrs = r.getOpts().RadixTree.ToMap()["/user/"].([]*entity.RouterItem)[0].TargetService
+	assert.Same(t, primary, GetBreaker(svrs[0]))
+	assert.Same(t, backup, GetBreaker(svrs[1]))
+	assert.Equal(t, breaker.StateOpen, GetBreaker(svrs[0]).State())
+	assert.Equal(t, breaker.StateOpen, GetBreaker(svrs[1]).State())
+	assert.Same(t, health, svrs[0].Health)
+	assert.Equal(t, int32(2), health.failures.Load())
+	assert.Nil(t, r.getOpts().upstream.prev)
+
+	// A new circuit breaker is built when the options change
+	assert.Nil(t, r.InitRouterConfig(context.Background(), newConfig(0.8)))
+	svrs = r.getOpts().RadixTree.ToMap()["/user/"].([]*entity.RouterItem)[0].TargetService
+	assert.NotSame(t, primary, GetBreaker(svrs[0]))
+	assert.Equal(t, breaker.StateClosed, GetBreaker(svrs[0]).State())
+	assert.Same(t, backup, GetBreaker(svrs[1]))
+
+	// The failed load keeps the state of the current configuration
+	assert.NotNil(t, r.InitRouterConfig(context.Background(), &entity.ProxyConfig{}))
+	svrs = r.getOpts().RadixTree.ToMap()["/user/"].([]*entity.RouterItem)[0].TargetService
+	assert.Same(t, backup, GetBreaker(svrs[1]))
+}
+
+func Test_upstreamState(t *testing.T) {
+	opts := breaker.Options{Window: 1, MinRequests: 1, ErrorRatio: 0.5}
+	key := breakerKey{router: "/a", service: "a", opts: opts}
+	// Always new without the state
+	var state *upstreamState
+	assert.NotSame(t, state.sharedBreaker(key, "a"), state.sharedBreaker(key, "a"))
+	assert.NotSame(t, state.ownBreaker(key, "a"), state.ownBreaker(key, "a"))
+	item := &entity.RouterItem{Method: "/a"}
+	svr := &entity.TargetService{Service: "a"}
+	assert.NotSame(t, state.targetHealth(item, svr), state.targetHealth(item, svr))
+
+	// The routers of the same name do not share their own state in a load
+	last := newUpstreamState(nil)
+	own, health := last.ownBreaker(key, "/a/a"), last.targetHealth(item, svr)
+	assert.NotSame(t, own, last.ownBreaker(key, "/a/a"))
+	assert.NotSame(t, health, last.targetHealth(item, svr))
+	shared := last.sharedBreaker(key, "a")
+	assert.Same(t, shared, last.sharedBreaker(key, "a"))
+
+	// Reused once in the next load
+	state = newUpstreamState(last)
+	assert.Same(t, own, state.ownBreaker(key, "/a/a"))
+	assert.NotSame(t, own, state.ownBreaker(key, "/a/a"))
+	assert.Same(t, health, state.targetHealth(item, svr))
+	assert.NotSame(t, health, state.targetHealth(item, svr))
+	assert.Same(t, shared, state.sharedBreaker(key, "a"))
+	assert.Same(t, shared, state.sharedBreaker(key, "a"))
+}
@@ -0,0 +1,88 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"encoding/json"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// initDefaultRoute validates and parses the catch-all router, which matches all requests not found, so the matching
+// conditions are not allowed
+func (r *FastHTTPRouter) initDefaultRoute(rf *entity.ProxyConfig, options *Options) error {
+	item := rf.DefaultRoute
+	if item.Method != "" || item.IsRegexp || len(item.Host) != 0 || len(item.HTTPMethods) != 0 || item.Rule != nil {
+		return errs.New(gerrs.ErrWrongConfig, "default route can not have method, host, http methods or rule")
+	}
+	return r.initRouterItem(item, rf, options)
+}
+
+// notFoundFuncs are the functions of the not found body template
+var notFoundFuncs = template.FuncMap{
+	// json encodes the value as a JSON string, such as {"path":{{json .Path}}}
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// initNotFound validates the not found response, parses the body template, and assembles the plugins
+func (r *FastHTTPRouter) initNotFound(rf *entity.ProxyConfig) error {
+	conf := rf.NotFound
+	if conf.Status == 0 {
+		conf.Status = fasthttp.StatusNotFound
+	}
+	if conf.Status < 100 || conf.Status > 599 {
+		return errs.Newf(gerrs.ErrWrongConfig, "invalid not found status:%d", conf.Status)
+	}
+	if conf.Body != "" {
+		tmpl, err := parseNotFoundBody(conf)
+		if err != nil {
+			return errs.Wrapf(err, gerrs.ErrWrongConfig, "parse not found body error")
+		}
+		conf.Template = tmpl
+	}
+	var globalPlugins []*entity.Plugin
+	if conf.GlobalPlugins {
+		globalPlugins = rf.Plugins
+	}
+	conf.Target = &entity.TargetService{NotFound: conf}
+	if err := r.initFilters(conf.Target, r.mergePlugins(conf.Plugins, nil, globalPlugins)); err != nil {
+		return gerrs.Wrap(err, "init not found plugins error")
+	}
+	return nil
+}
+
+// parseNotFoundBody parses the body template. The HTML body is parsed by html/template, so that the request fields,
+// such as the path, are escaped and can not inject markup.
+func parseNotFoundBody(conf *entity.NotFoundConfig) (interface{}, error) {
+	if isHTMLContentType(conf.ContentType) {
+		return htmltemplate.New("not_found").Funcs(htmltemplate.FuncMap(notFoundFuncs)).Parse(conf.Body)
+	}
+	return template.New("not_found").Funcs(notFoundFuncs).Parse(conf.Body)
+}
+
+// isHTMLContentType reports whether the content type is rendered as HTML by browsers, such as text/html; charset=utf-8
+func isHTMLContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
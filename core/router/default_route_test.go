@@ -0,0 +1,169 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	mockplugin "trpc.group/trpc-go/trpc-gateway/plugin/mock"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+func TestFastHTTPRouter_GetMatchRouter_defaultRoute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	mockGWPlugin := mockplugin.NewMockGatewayPlugin(ctrl)
+	mockGWPlugin.EXPECT().Type().Return("gateway").AnyTimes()
+	mockGWPlugin.EXPECT().CheckConfig(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	plugin.Register("notfoundcors", mockGWPlugin)
+	filter.Register("notfoundcors", func(ctx context.Context, req interface{},
+		next filter.ServerHandleFunc) (interface{}, error) {
+		return next(ctx, req)
+	}, nil)
+
+	newConfig := func() *entity.ProxyConfig {
+		return &entity.ProxyConfig{
+			Router: []*entity.RouterItem{
+				{
+					Method:        "/user/info",
+					HTTPMethods:   []string{"GET"},
+					TargetService: []*entity.TargetService{{Service: "user"}},
+				},
+			},
+			Client: []*entity.BackendConfig{
+				{BackendConfig: client.BackendConfig{
+					ServiceName: "user", Network: "tcp", Target: "ip://127.0.0.1:8000", Protocol: "fasthttp"}},
+				{BackendConfig: client.BackendConfig{
+					ServiceName: "legacy", Network: "tcp", Target: "ip://127.0.0.1:8001", Protocol: "fasthttp"}},
+			},
+			Plugins: []*entity.Plugin{{Name: "notfoundcors"}},
+		}
+	}
+	match := func(r *FastHTTPRouter, method, uri string) (*entity.TargetService, *fasthttp.RequestCtx, error) {
+		ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.Header.SetMethod(method)
+		fctx.Request.SetRequestURI(uri)
+		ctx = http.WithRequestContext(ctx, fctx)
+		svr, err := r.GetMatchRouter(ctx)
+		return svr, fctx, err
+	}
+
+	// Not found without the default route
+	r := NewFastHTTPRouter()
+	assert.Nil(t, r.InitRouterConfig(context.Background(), newConfig()))
+	_, _, err := match(r, "GET", "/legacy/page")
+	assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err))
+
+	// Forward to the default route
+	rf := newConfig()
+	rf.DefaultRoute = &entity.RouterItem{
+		TargetService: []*entity.TargetService{{Service: "legacy", ReWrite: "/old?"}},
+	}
+	rf.NotFound = &entity.NotFoundConfig{}
+	assert.Nil(t, r.InitRouterConfig(context.Background(), rf))
+	svr, fctx, err := match(r, "GET", "/legacy/page?a=1")
+	assert.Nil(t, err)
+	assert.Equal(t, "legacy", svr.Service)
+	assert.Equal(t, "/old", string(fctx.Path()))
+	assert.Equal(t, "", string(fctx.URI().QueryString()))
+	// The method not allowed is not forwarded
+	_, _, err = match(r, "POST", "/user/info")
+	assert.Equal(t, gerrs.ErrMethodNotAllowed, errs.Code(err))
+	svr, _, err = match(r, "GET", "/user/info")
+	assert.Nil(t, err)
+	assert.Equal(t, "user", svr.Service)
+
+	// Respond with the not found response
+	rf = newConfig()
+	rf.NotFound = &entity.NotFoundConfig{
+		ContentType:   "application/json",
+		Body:          `{"path":{{json .Path}}}`,
+		GlobalPlugins: true,
+	}
+	assert.Nil(t, r.InitRouterConfig(context.Background(), rf))
+	svr, _, err = match(r, "GET", "/legacy/page")
+	assert.Nil(t, err)
+	assert.Equal(t, rf.NotFound, svr.NotFound)
+	assert.Equal(t, fasthttp.StatusNotFound, svr.NotFound.Status)
+	assert.IsType(t, &template.Template{}, svr.NotFound.Template)
+	assert.Len(t, svr.Filters, 1)
+
+	// The HTML body escapes the request fields
+	rf = newConfig()
+	rf.NotFound = &entity.NotFoundConfig{
+		ContentType: "text/html; charset=utf-8",
+		Body:        `<p>{{.Path}} not found</p>`,
+	}
+	assert.Nil(t, r.InitRouterConfig(context.Background(), rf))
+	tmpl, ok := rf.NotFound.Template.(*htmltemplate.Template)
+	assert.True(t, ok)
+	var body strings.Builder
+	assert.Nil(t, tmpl.Execute(&body, map[string]string{"Path": "/<script>alert(1)</script>"}))
+	assert.Equal(t, "<p>/&lt;script&gt;alert(1)&lt;/script&gt; not found</p>", body.String())
+
+	// Invalid configurations
+	for _, modify := range []func(rf *entity.ProxyConfig){
+		func(rf *entity.ProxyConfig) {
+			rf.DefaultRoute = &entity.RouterItem{
+				Method:        "/legacy",
+				TargetService: []*entity.TargetService{{Service: "legacy"}},
+			}
+		},
+		func(rf *entity.ProxyConfig) {
+			rf.DefaultRoute = &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "unknown"}}}
+		},
+		func(rf *entity.ProxyConfig) {
+			rf.NotFound = &entity.NotFoundConfig{Status: 1000}
+		},
+		func(rf *entity.ProxyConfig) {
+			rf.NotFound = &entity.NotFoundConfig{Body: "{{.Path"}
+		},
+		func(rf *entity.ProxyConfig) {
+			rf.NotFound = &entity.NotFoundConfig{ContentType: "text/html", Body: "{{.Path"}
+		},
+		func(rf *entity.ProxyConfig) {
+			rf.NotFound = &entity.NotFoundConfig{Plugins: []*entity.Plugin{{Name: "unknown_plugin"}}}
+		},
+	} {
+		rf := newConfig()
+		modify(rf)
+		assert.NotNil(t, r.InitRouterConfig(context.Background(), rf))
+	}
+}
+
+func Test_isHTMLContentType(t *testing.T) {
+	assert.True(t, isHTMLContentType("text/html"))
+	assert.True(t, isHTMLContentType(" Text/HTML ; charset=utf-8"))
+	assert.True(t, isHTMLContentType("application/xhtml+xml"))
+	assert.False(t, isHTMLContentType("application/json"))
+	assert.False(t, isHTMLContentType(""))
+}
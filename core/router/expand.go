@@ -0,0 +1,172 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// expandRouters expands the router groups and the templates into the routers before they are validated, so the
+// expanded routers are validated as the others. The fields set by a router take precedence over its template, then
+// over its group and the template of the group.
+func expandRouters(rf *entity.ProxyConfig) error {
+	e := &expander{
+		templates: rf.Templates,
+		resolved:  make(map[string]*entity.RouterItem),
+		resolving: make(map[string]bool),
+	}
+	routers := make([]*entity.RouterItem, 0, len(rf.Router))
+	for _, item := range rf.Router {
+		expanded, err := e.extend(item)
+		if err != nil {
+			return gerrs.Wrapf(err, "expand router err, method:%s", item.Method)
+		}
+		routers = append(routers, expanded)
+	}
+	for i, group := range rf.Groups {
+		if group.Method != "" {
+			return errs.Newf(gerrs.ErrWrongConfig, "router group can not have method, group:%d", i)
+		}
+		parent, err := e.extend(&group.RouterItem)
+		if err != nil {
+			return gerrs.Wrapf(err, "expand router group err, group:%d", i)
+		}
+		for _, item := range group.Routes {
+			child, err := e.extend(item)
+			if err != nil {
+				return gerrs.Wrapf(err, "expand router err, group:%d, method:%s", i, item.Method)
+			}
+			if child, err = inherit(child, parent); err != nil {
+				return gerrs.Wrapf(err, "expand router err, group:%d, method:%s", i, item.Method)
+			}
+			routers = append(routers, child)
+		}
+	}
+	if rf.DefaultRoute != nil {
+		defaultRoute, err := e.extend(rf.DefaultRoute)
+		if err != nil {
+			return gerrs.Wrap(err, "expand default route err")
+		}
+		rf.DefaultRoute = defaultRoute
+	}
+	// Clear the groups and the templates, so that the expansion is idempotent
+	rf.Router, rf.Groups, rf.Templates = routers, nil, nil
+	return nil
+}
+
+// expander resolves the templates referenced by extends
+type expander struct {
+	templates map[string]*entity.RouterItem
+	// resolved are the templates whose extends have been applied
+	resolved map[string]*entity.RouterItem
+	// resolving are the templates being resolved, used to detect the cycles
+	resolving map[string]bool
+}
+
+// extend applies the template referenced by the router, the router is returned as it is if it extends nothing
+func (e *expander) extend(item *entity.RouterItem) (*entity.RouterItem, error) {
+	if item.Extends == "" {
+		return item, nil
+	}
+	tpl, err := e.resolve(item.Extends)
+	if err != nil {
+		return nil, err
+	}
+	return inherit(item, tpl)
+}
+
+// resolve returns the template of the name with its own extends applied
+func (e *expander) resolve(name string) (*entity.RouterItem, error) {
+	if tpl, ok := e.resolved[name]; ok {
+		return tpl, nil
+	}
+	if e.resolving[name] {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "circular router template extends, name:%s", name)
+	}
+	tpl, ok := e.templates[name]
+	if !ok || tpl == nil {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "no such router template, name:%s", name)
+	}
+	e.resolving[name] = true
+	resolved, err := e.extend(tpl)
+	if err != nil {
+		return nil, gerrs.Wrapf(err, "resolve router template err, name:%s", name)
+	}
+	e.resolved[name] = resolved
+	return resolved, nil
+}
+
+// inherit returns a router copied from the parent and overridden by the fields set by the child. The ID is never
+// inherited, and the plugins are merged by name with the child taking precedence. Since an unset bool can not be
+// told from false, a bool field enabled by the parent can not be disabled by the child.
+func inherit(child, parent *entity.RouterItem) (*entity.RouterItem, error) {
+	// The parent is deep copied, as the target services and the plugins are modified during initialization
+	item, err := copyRouterItem(parent)
+	if err != nil {
+		return nil, err
+	}
+	item.ID, item.Extends = child.ID, ""
+	dst, src := reflect.ValueOf(item).Elem(), reflect.ValueOf(child).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		name := strings.Split(src.Type().Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" || name == "id" || name == "extends" || name == "plugins" ||
+			src.Field(i).IsZero() {
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+	item.Plugins = inheritPlugins(child.Plugins, item.Plugins)
+	return item, nil
+}
+
+// copyRouterItem deep copies the configured fields of the router
+func copyRouterItem(item *entity.RouterItem) (*entity.RouterItem, error) {
+	b, err := yaml.Marshal(item)
+	if err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "marshal router err")
+	}
+	c := &entity.RouterItem{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "unmarshal router err")
+	}
+	return c, nil
+}
+
+// inheritPlugins merges the plugins by name, the plugin of the child replaces the one of the parent with the same
+// name in place, and the others are appended
+func inheritPlugins(child, parent []*entity.Plugin) []*entity.Plugin {
+	if len(parent) == 0 {
+		return child
+	}
+	plugins := make([]*entity.Plugin, 0, len(parent)+len(child))
+	index := make(map[string]int, len(parent))
+	for _, p := range parent {
+		index[p.Name] = len(plugins)
+		plugins = append(plugins, p)
+	}
+	for _, p := range child {
+		if i, ok := index[p.Name]; ok {
+			plugins[i] = p
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins
+}
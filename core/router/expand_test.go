@@ -0,0 +1,217 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_expandRouters(t *testing.T) {
+	conf := `
+templates:
+  base:
+    host: [api.example.com]
+    timeout: 1000
+    plugins:
+      - name: auth
+        props:
+          key: base
+  user:
+    extends: base
+    target_service:
+      - service: user
+router:
+  - method: /plain
+    target_service:
+      - service: plain
+  - method: /extended
+    extends: user
+    timeout: 200
+groups:
+  - extends: base
+    strip_path: true
+    target_service:
+      - service: order
+    rule:
+      conditions:
+        - key: query.v
+          val: "1"
+          oper: "=="
+    plugins:
+      - name: cors
+    routes:
+      - id: order_list
+        method: /order/list
+      - method: /order/detail
+        host: [detail.example.com]
+        target_service:
+          - service: detail
+        plugins:
+          - name: auth
+            props:
+              key: detail
+      - method: /order/user
+        extends: user
+`
+	rf := &entity.ProxyConfig{}
+	assert.Nil(t, yaml.Unmarshal([]byte(conf), rf))
+	assert.Nil(t, expandRouters(rf))
+	assert.Nil(t, rf.Groups)
+	assert.Nil(t, rf.Templates)
+	assert.Len(t, rf.Router, 5)
+
+	plain := rf.Router[0]
+	assert.Equal(t, "plain", plain.TargetService[0].Service)
+	assert.Nil(t, plain.Host)
+
+	extended := rf.Router[1]
+	assert.Equal(t, []string{"api.example.com"}, extended.Host)
+	assert.Equal(t, 200, extended.Timeout)
+	assert.Equal(t, "user", extended.TargetService[0].Service)
+	assert.Equal(t, "", extended.Extends)
+
+	list := rf.Router[2]
+	assert.Equal(t, "order_list", list.ID)
+	assert.Equal(t, []string{"api.example.com"}, list.Host)
+	assert.True(t, list.StripPath)
+	assert.Equal(t, 1000, list.Timeout)
+	assert.Equal(t, "order", list.TargetService[0].Service)
+	assert.Equal(t, "query.v", list.Rule.Conditions[0].Key)
+	assert.Len(t, list.Plugins, 2)
+	assert.Equal(t, "auth", list.Plugins[0].Name)
+	assert.Equal(t, "cors", list.Plugins[1].Name)
+
+	detail := rf.Router[3]
+	assert.Equal(t, "", detail.ID)
+	assert.Equal(t, []string{"detail.example.com"}, detail.Host)
+	assert.Equal(t, "detail", detail.TargetService[0].Service)
+	assert.Len(t, detail.Plugins, 2)
+	assert.Equal(t, map[string]interface{}{"key": "detail"}, detail.Plugins[0].Props)
+
+	// The router template takes precedence over the group
+	user := rf.Router[4]
+	assert.Equal(t, "user", user.TargetService[0].Service)
+	assert.True(t, user.StripPath)
+
+	// The routers of the group do not share the target services and the plugins
+	assert.NotSame(t, list.TargetService[0], rf.Router[3].TargetService[0])
+	list.TargetService[0].Service = "changed"
+	list.Plugins[1].Name = "changed"
+	assert.Equal(t, "cors", detail.Plugins[1].Name)
+
+	// Expansion is idempotent
+	assert.Nil(t, expandRouters(rf))
+	assert.Len(t, rf.Router, 5)
+}
+
+func Test_expandRouters_err(t *testing.T) {
+	for name, conf := range map[string]string{
+		"unknown template": `
+router:
+  - method: /a
+    extends: none
+`,
+		"circular template": `
+templates:
+  a:
+    extends: b
+  b:
+    extends: a
+router:
+  - method: /a
+    extends: a
+`,
+		"group method": `
+groups:
+  - method: /a
+    routes:
+      - method: /a/b
+`,
+		"unknown group template": `
+groups:
+  - extends: none
+    routes:
+      - method: /a/b
+`,
+		"unknown route template": `
+groups:
+  - routes:
+      - method: /a/b
+        extends: none
+`,
+		"unknown default route template": `
+default_route:
+  extends: none
+`,
+	} {
+		rf := &entity.ProxyConfig{}
+		assert.Nil(t, yaml.Unmarshal([]byte(conf), rf), name)
+		err := expandRouters(rf)
+		assert.NotNil(t, err, name)
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err), name)
+	}
+}
+
+func TestFastHTTPRouter_InitRouterConfig_groups(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	newConfig := func(method string) *entity.ProxyConfig {
+		return &entity.ProxyConfig{
+			Groups: []*entity.RouterGroup{
+				{
+					RouterItem: entity.RouterItem{
+						Host:          []string{"api.example.com"},
+						TargetService: []*entity.TargetService{{Service: "user"}},
+						StripPath:     true,
+					},
+					Routes: []*entity.RouterItem{{Method: method}},
+				},
+			},
+			Client: []*entity.BackendConfig{
+				{BackendConfig: client.BackendConfig{
+					ServiceName: "user", Network: "tcp", Target: "ip://127.0.0.1:8000", Protocol: "fasthttp"}},
+			},
+		}
+	}
+
+	r := NewFastHTTPRouter()
+	assert.Nil(t, r.InitRouterConfig(context.Background(), newConfig("/user/")))
+	ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("http://api.example.com/user/info")
+	ctx = http.WithRequestContext(ctx, fctx)
+	svr, err := r.GetMatchRouter(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", svr.Service)
+	assert.Equal(t, "/info", string(fctx.Path()))
+
+	// The expanded routers are validated as the others
+	err = NewFastHTTPRouter().InitRouterConfig(context.Background(), newConfig(""))
+	assert.NotNil(t, err)
+}
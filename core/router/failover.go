@@ -0,0 +1,341 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/convert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// defaultCoolDown is the default duration for which the failed target service is skipped
+const defaultCoolDown = 30 * time.Second
+
+// contextKeyOriginURI is the fasthttp user value key of the path and query string of the request before rewriting
+const contextKeyOriginURI = http.ContextKey("TRPC_GATEWAY_ORIGIN_URI")
+
+// failoverGroups are the target services of the router grouped by priority
+type failoverGroups struct {
+	// item is the router item, used to rewrite the request for the target service to fail over to
+	item *entity.RouterItem
+	// groups are sorted by priority in ascending order
+	groups      []*targetGroup
+	maxFailures int32
+	coolDown    time.Duration
+	// nonIdempotent allows failing over the non-idempotent HTTP methods after the request may have been sent
+	nonIdempotent bool
+}
+
+// targetGroup is the target services of the same priority
+type targetGroup struct {
+	priority int
+	svrs     []*entity.TargetService
+	// selector is the consistent hash of the group if the hash mode is configured
+	selector hashSelector
+}
+
+// targetHealth is the health of the target service
+type targetHealth struct {
+	// failures is the number of consecutive failures
+	failures atomic.Int32
+	// skipUntil is the unix nano time until which the target service is skipped
+	skipUntil atomic.Int64
+}
+
+// originURI is the path and query string of the request before rewriting
+type originURI struct {
+	path  []byte
+	query []byte
+}
+
+// initFailover validates the priorities and groups the target services by priority. The groups are not built if
+// there is neither priority nor failover configuration, so that the routes without failover are not affected.
+// The plugins of the target services must be the same, since the plugins of the matched target service have been
+// executed when the request fails over to another one. The health of the last load is reused through state.
+func initFailover(item *entity.RouterItem, state *upstreamState) error {
+	conf := item.Failover
+	grouped := conf != nil
+	for _, svr := range item.TargetService {
+		if svr.Priority < 0 {
+			return errs.Newf(gerrs.ErrWrongConfig, "invalid priority %d of service:%s", svr.Priority, svr.Service)
+		}
+		grouped = grouped || svr.Priority > 0
+	}
+	if !grouped {
+		return nil
+	}
+	for _, svr := range item.TargetService[1:] {
+		if !samePlugins(item.TargetService[0].Plugins, svr.Plugins) {
+			return errs.Newf(gerrs.ErrWrongConfig, "plugins of failover service:%s differ from service:%s",
+				svr.Service, item.TargetService[0].Service)
+		}
+	}
+	fg := &failoverGroups{item: item, coolDown: defaultCoolDown}
+	if conf != nil {
+		if conf.MaxFailures < 0 || conf.CoolDown < 0 {
+			return errs.New(gerrs.ErrWrongConfig, "max failures and cool down of failover can not be negative")
+		}
+		fg.maxFailures = int32(conf.MaxFailures)
+		fg.nonIdempotent = conf.NonIdempotent
+		if conf.CoolDown > 0 {
+			fg.coolDown = time.Duration(conf.CoolDown) * time.Second
+		}
+	}
+	svrs := make([]*entity.TargetService, len(item.TargetService))
+	copy(svrs, item.TargetService)
+	sort.SliceStable(svrs, func(i, j int) bool {
+		return svrs[i].Priority < svrs[j].Priority
+	})
+	for _, svr := range svrs {
+		n := len(fg.groups)
+		if n == 0 || fg.groups[n-1].priority != svr.Priority {
+			fg.groups = append(fg.groups, &targetGroup{priority: svr.Priority})
+			n++
+		}
+		fg.groups[n-1].svrs = append(fg.groups[n-1].svrs, svr)
+		svr.Health = state.targetHealth(item, svr)
+		svr.FailoverGroups = fg
+	}
+	for _, g := range fg.groups {
+		if item.HashMode == "" || len(g.svrs) <= 1 {
+			continue
+		}
+		selector, err := newHashSelector(item.HashMode, g.svrs)
+		if err != nil {
+			return gerrs.Wrap(err, "new hash selector error")
+		}
+		g.selector = selector
+	}
+	item.FailoverGroups = fg
+	return nil
+}
+
+// samePlugins checks if the merged plugins of two target services are the same
+func samePlugins(a, b []*entity.Plugin) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && convert.ToJSONStr(a[i]) != convert.ToJSONStr(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// activeTargets returns the available target services of the group of the smallest priority that has any available,
+// and the consistent hash of the group if all its target services are available. If all target services are
+// skipped, the primary group is used.
+func (fg *failoverGroups) activeTargets(now int64) ([]*entity.TargetService, hashSelector) {
+	for _, g := range fg.groups {
+		svrs := g.available(now)
+		if len(svrs) == len(g.svrs) {
+			return svrs, g.selector
+		}
+		if len(svrs) != 0 {
+			return svrs, nil
+		}
+	}
+	return fg.groups[0].svrs, fg.groups[0].selector
+}
+
+// isActive checks if the target service is available and belongs to the active group
+func (fg *failoverGroups) isActive(svr *entity.TargetService, now int64) bool {
+	svrs, _ := fg.activeTargets(now)
+	for _, s := range svrs {
+		if s == svr {
+			return true
+		}
+	}
+	return false
+}
+
+// isActiveTarget checks if the target service can be selected, which is always true for the routers without
+// failover groups
+func isActiveTarget(item *entity.RouterItem, svr *entity.TargetService) bool {
+	fg, ok := item.FailoverGroups.(*failoverGroups)
+	return !ok || fg.isActive(svr, time.Now().UnixNano())
+}
+
+// next selects an available target service by weight from the groups of larger priorities than the priority,
+// nil is returned if there is none
+func (fg *failoverGroups) next(priority int, now int64) *entity.TargetService {
+	for _, g := range fg.groups {
+		if g.priority <= priority {
+			continue
+		}
+		if svrs := g.available(now); len(svrs) != 0 {
+			return selectByWeight(svrs)
+		}
+	}
+	return nil
+}
+
+// available returns the target services that are not skipped, the original slice is returned if all are available
+func (g *targetGroup) available(now int64) []*entity.TargetService {
+	for i, svr := range g.svrs {
+		if !isSkipped(svr, now) {
+			continue
+		}
+		svrs := make([]*entity.TargetService, 0, len(g.svrs)-1)
+		svrs = append(svrs, g.svrs[:i]...)
+		for _, s := range g.svrs[i+1:] {
+			if !isSkipped(s, now) {
+				svrs = append(svrs, s)
+			}
+		}
+		return svrs
+	}
+	return g.svrs
+}
+
+// isSkipped checks if the target service is in the cool-down after consecutive failures
+func isSkipped(svr *entity.TargetService, now int64) bool {
+	health, ok := svr.Health.(*targetHealth)
+	return ok && health.skipUntil.Load() > now
+}
+
+// selectByWeight selects a target service randomly by weight, the first one is selected if all weights are zero
+func selectByWeight(svrs []*entity.TargetService) *entity.TargetService {
+	sumWeight := 0
+	for _, svr := range svrs {
+		sumWeight += svr.Weight
+	}
+	if sumWeight == 0 {
+		return svrs[0]
+	}
+	rad := rand.Intn(sumWeight)
+	total := 0
+	for _, svr := range svrs {
+		total += svr.Weight
+		if rad < total {
+			return svr
+		}
+	}
+	return svrs[0]
+}
+
+// NextFailoverTarget returns the target service to fail over to after the target service fails, which is selected by
+// weight from the available target services of the next priority. Nil is returned if there is none.
+func NextFailoverTarget(svr *entity.TargetService) *entity.TargetService {
+	if svr == nil {
+		return nil
+	}
+	fg, ok := svr.FailoverGroups.(*failoverGroups)
+	if !ok {
+		return nil
+	}
+	return fg.next(svr.Priority, time.Now().UnixNano())
+}
+
+// saveOriginURI keeps the path and query string of the request before rewriting
+func saveOriginURI(fctx *fasthttp.RequestCtx) {
+	uri := fctx.Request.URI()
+	fctx.SetUserValue(contextKeyOriginURI, &originURI{
+		path:  append([]byte(nil), uri.PathOriginal()...),
+		query: append([]byte(nil), uri.QueryString()...),
+	})
+}
+
+// RewriteFailoverTarget rewrites the request for the target service to fail over to. The rewrite of the failed
+// target service is discarded, and the original path and query string are rewritten again with the rewrite of the
+// target service, and so is the reported backend interface.
+func RewriteFailoverTarget(ctx context.Context, svr *entity.TargetService) {
+	fctx := http.RequestContext(ctx)
+	if fctx == nil || svr == nil {
+		return
+	}
+	fg, ok := svr.FailoverGroups.(*failoverGroups)
+	if !ok {
+		return
+	}
+	origin, ok := fctx.UserValue(contextKeyOriginURI).(*originURI)
+	if !ok {
+		return
+	}
+	uri := fctx.Request.URI()
+	uri.SetPathBytes(origin.path)
+	uri.SetQueryStringBytes(origin.query)
+	rewriteRequest(ctx, fctx, fg.item, svr)
+}
+
+// IsFailoverErr checks if the error of the upstream request is a connect error, timeout or overload error, which is
+// counted as a failure of the target service and triggers the failover
+func IsFailoverErr(ctx context.Context, fctx *fasthttp.RequestCtx, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	switch errs.Code(err) {
+	case errs.RetClientConnectFail, errs.RetClientNetErr, errs.RetClientRouteErr, errs.RetClientTimeout,
+		errs.RetServerOverload, errs.RetClientOverload:
+		return true
+	case gerrs.ErrUpstreamRspErr:
+		return fctx != nil && fctx.Response.StatusCode() == fasthttp.StatusServiceUnavailable
+	}
+	return false
+}
+
+// CanFailover checks if the request failed with the failover error can be sent to another target service. The
+// requests of non-idempotent HTTP methods, such as POST, may have been applied by the upstream after timeouts,
+// network errors or overload errors, so they only fail over on the connect errors and the route errors, where the
+// request was never sent, unless failover.non_idempotent is set.
+func CanFailover(svr *entity.TargetService, fctx *fasthttp.RequestCtx, err error) bool {
+	if fctx == nil || http.IsIdempotent(fctx.Method()) {
+		return true
+	}
+	if fg, ok := svr.FailoverGroups.(*failoverGroups); ok && fg.nonIdempotent {
+		return true
+	}
+	switch errs.Code(err) {
+	case errs.RetClientConnectFail, errs.RetClientRouteErr:
+		return true
+	}
+	return false
+}
+
+// ReportTarget reports the result of the request to the target service. The target service is skipped for the
+// cool-down after the max consecutive failures, and any other result resets the failures.
+func ReportTarget(svr *entity.TargetService, failed bool) {
+	if svr == nil {
+		return
+	}
+	health, ok := svr.Health.(*targetHealth)
+	if !ok {
+		return
+	}
+	if !failed {
+		if health.failures.Load() != 0 {
+			health.failures.Store(0)
+		}
+		return
+	}
+	fg, ok := svr.FailoverGroups.(*failoverGroups)
+	if !ok || fg.maxFailures == 0 {
+		return
+	}
+	if health.failures.Add(1) < fg.maxFailures {
+		return
+	}
+	health.failures.Store(0)
+	health.skipUntil.Store(time.Now().Add(fg.coolDown).UnixNano())
+}
@@ -0,0 +1,271 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func newFailoverItem(conf *entity.FailoverConfig) *entity.RouterItem {
+	return &entity.RouterItem{
+		Failover: conf,
+		TargetService: []*entity.TargetService{
+			{Service: "backup", Priority: 1},
+			{Service: "primary.a", Weight: 1},
+			{Service: "primary.b", Weight: 1},
+			{Service: "dr", Priority: 2},
+		},
+	}
+}
+
+func Test_initFailover(t *testing.T) {
+	// No failover groups without priority and failover configuration
+	item := &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "a"}, {Service: "b"}}}
+	assert.Nil(t, initFailover(item, nil))
+	assert.Nil(t, item.FailoverGroups)
+	assert.Nil(t, item.TargetService[0].Health)
+
+	item = newFailoverItem(nil)
+	assert.Nil(t, initFailover(item, nil))
+	fg, ok := item.FailoverGroups.(*failoverGroups)
+	assert.True(t, ok)
+	assert.Equal(t, 3, len(fg.groups))
+	assert.Equal(t, []*entity.TargetService{item.TargetService[1], item.TargetService[2]}, fg.groups[0].svrs)
+	assert.Equal(t, []*entity.TargetService{item.TargetService[0]}, fg.groups[1].svrs)
+	assert.Equal(t, []*entity.TargetService{item.TargetService[3]}, fg.groups[2].svrs)
+	assert.Equal(t, defaultCoolDown, fg.coolDown)
+	assert.Zero(t, fg.maxFailures)
+	for _, svr := range item.TargetService {
+		assert.Equal(t, fg, svr.FailoverGroups)
+		assert.NotNil(t, svr.Health)
+	}
+
+	// The same plugins of different target services
+	item = newFailoverItem(nil)
+	for _, svr := range item.TargetService {
+		svr.Plugins = []*entity.Plugin{{Name: "auth", Props: map[string]string{"key": "value"}}}
+	}
+	assert.Nil(t, initFailover(item, nil))
+
+	// The consistent hash is built for each group
+	item = newFailoverItem(&entity.FailoverConfig{MaxFailures: 3, CoolDown: 10})
+	item.HashMode = HashModeKetama
+	assert.Nil(t, initFailover(item, nil))
+	fg = item.FailoverGroups.(*failoverGroups)
+	assert.NotNil(t, fg.groups[0].selector)
+	assert.Nil(t, fg.groups[1].selector)
+	assert.Equal(t, int32(3), fg.maxFailures)
+	assert.Equal(t, 10*time.Second, fg.coolDown)
+
+	for _, item := range []*entity.RouterItem{
+		{TargetService: []*entity.TargetService{{Service: "a", Priority: -1}}},
+		{Failover: &entity.FailoverConfig{MaxFailures: -1}, TargetService: []*entity.TargetService{{Service: "a"}}},
+		{Failover: &entity.FailoverConfig{CoolDown: -1}, TargetService: []*entity.TargetService{{Service: "a"}}},
+		// The plugins of the target services differ
+		{TargetService: []*entity.TargetService{
+			{Service: "a", Plugins: []*entity.Plugin{{Name: "auth"}}},
+			{Service: "b", Priority: 1},
+		}},
+	} {
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(initFailover(item, nil)))
+	}
+}
+
+func Test_failoverGroups(t *testing.T) {
+	item := newFailoverItem(&entity.FailoverConfig{MaxFailures: 2})
+	assert.Nil(t, initFailover(item, nil))
+	fg := item.FailoverGroups.(*failoverGroups)
+	backup, primaryA, primaryB, dr := item.TargetService[0], item.TargetService[1], item.TargetService[2],
+		item.TargetService[3]
+	now := time.Now().UnixNano()
+
+	svrs, _ := fg.activeTargets(now)
+	assert.Equal(t, []*entity.TargetService{primaryA, primaryB}, svrs)
+	assert.Equal(t, backup, NextFailoverTarget(primaryA))
+	assert.Equal(t, dr, NextFailoverTarget(backup))
+	assert.Nil(t, NextFailoverTarget(dr))
+	assert.Nil(t, NextFailoverTarget(nil))
+	assert.Nil(t, NextFailoverTarget(&entity.TargetService{}))
+
+	// Skipped after the max consecutive failures
+	ReportTarget(primaryA, true)
+	ReportTarget(primaryA, false)
+	ReportTarget(primaryA, true)
+	assert.False(t, isSkipped(primaryA, now))
+	ReportTarget(primaryA, true)
+	assert.True(t, isSkipped(primaryA, now))
+	svrs, _ = fg.activeTargets(now)
+	assert.Equal(t, []*entity.TargetService{primaryB}, svrs)
+	assert.True(t, isActiveTarget(item, primaryB))
+	assert.False(t, isActiveTarget(item, primaryA))
+	assert.False(t, isActiveTarget(item, backup))
+
+	// The next group is used when all target services of the primary group are skipped
+	ReportTarget(primaryB, true)
+	ReportTarget(primaryB, true)
+	svrs, _ = fg.activeTargets(now)
+	assert.Equal(t, []*entity.TargetService{backup}, svrs)
+	assert.True(t, isActiveTarget(item, backup))
+
+	// The primary group is used when all target services are skipped
+	ReportTarget(backup, true)
+	ReportTarget(backup, true)
+	ReportTarget(dr, true)
+	ReportTarget(dr, true)
+	svrs, _ = fg.activeTargets(now)
+	assert.Equal(t, []*entity.TargetService{primaryA, primaryB}, svrs)
+	assert.Nil(t, NextFailoverTarget(primaryA))
+
+	// Restored after the cool-down
+	svrs, _ = fg.activeTargets(time.Now().Add(defaultCoolDown + time.Second).UnixNano())
+	assert.Equal(t, []*entity.TargetService{primaryA, primaryB}, svrs)
+	assert.Equal(t, backup, fg.next(0, time.Now().Add(defaultCoolDown+time.Second).UnixNano()))
+
+	// Never skipped without max failures
+	item = newFailoverItem(nil)
+	assert.Nil(t, initFailover(item, nil))
+	for i := 0; i < 10; i++ {
+		ReportTarget(item.TargetService[1], true)
+	}
+	assert.False(t, isSkipped(item.TargetService[1], time.Now().UnixNano()))
+	ReportTarget(nil, true)
+	ReportTarget(&entity.TargetService{}, true)
+}
+
+func Test_selectByWeight(t *testing.T) {
+	a, b := &entity.TargetService{Service: "a"}, &entity.TargetService{Service: "b"}
+	assert.Equal(t, a, selectByWeight([]*entity.TargetService{a, b}))
+	b.Weight = 1
+	assert.Equal(t, b, selectByWeight([]*entity.TargetService{a, b}))
+}
+
+func TestIsFailoverErr(t *testing.T) {
+	ctx := context.Background()
+	fctx := &fasthttp.RequestCtx{}
+	assert.False(t, IsFailoverErr(ctx, fctx, nil))
+	assert.False(t, IsFailoverErr(ctx, fctx, errors.New("err")))
+	assert.False(t, IsFailoverErr(ctx, fctx, errs.New(10001, "business err")))
+	for _, code := range []int{int(errs.RetClientConnectFail), int(errs.RetClientNetErr), int(errs.RetClientRouteErr),
+		int(errs.RetClientTimeout), int(errs.RetServerOverload), int(errs.RetClientOverload)} {
+		assert.True(t, IsFailoverErr(ctx, fctx, errs.NewFrameError(code, "err")), code)
+	}
+	fctx.Response.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	assert.True(t, IsFailoverErr(ctx, fctx, errs.New(gerrs.ErrUpstreamRspErr, "503")))
+	fctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
+	assert.False(t, IsFailoverErr(ctx, fctx, errs.New(gerrs.ErrUpstreamRspErr, "500")))
+
+	// The request is canceled
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, IsFailoverErr(cancelCtx, fctx, errs.NewFrameError(errs.RetClientTimeout, "err")))
+}
+
+func TestCanFailover(t *testing.T) {
+	item := &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "a"}, {Service: "b", Priority: 1}}}
+	assert.Nil(t, initFailover(item, nil))
+	svr := item.TargetService[0]
+	timeout := errs.NewFrameError(errs.RetClientTimeout, "timeout")
+	fctx := &fasthttp.RequestCtx{}
+	assert.True(t, CanFailover(svr, fctx, timeout))
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	assert.False(t, CanFailover(svr, fctx, timeout))
+	assert.False(t, CanFailover(svr, fctx, errs.NewFrameError(errs.RetClientNetErr, "reset")))
+	assert.True(t, CanFailover(svr, fctx, errs.NewFrameError(errs.RetClientConnectFail, "dial")))
+	assert.True(t, CanFailover(svr, fctx, errs.NewFrameError(errs.RetClientRouteErr, "no instance")))
+
+	// Opted in
+	item.Failover = &entity.FailoverConfig{NonIdempotent: true}
+	assert.Nil(t, initFailover(item, nil))
+	assert.True(t, CanFailover(svr, fctx, timeout))
+}
+
+func TestFastHTTPRouter_getGreyServiceName_failover(t *testing.T) {
+	item := newFailoverItem(&entity.FailoverConfig{MaxFailures: 1})
+	assert.Nil(t, initFailover(item, nil))
+	r := &FastHTTPRouter{}
+	fctx := &fasthttp.RequestCtx{}
+	for i := 0; i < 10; i++ {
+		svr, err := r.getGreyServiceName(fctx, item)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, svr.Priority)
+	}
+	ReportTarget(item.TargetService[1], true)
+	ReportTarget(item.TargetService[2], true)
+	svr, err := r.getGreyServiceName(fctx, item)
+	assert.Nil(t, err)
+	assert.Equal(t, "backup", svr.Service)
+}
+
+func newFailoverClient(name string) *entity.BackendConfig {
+	return &entity.BackendConfig{BackendConfig: client.BackendConfig{
+		ServiceName: name,
+		Network:     "tcp",
+		Target:      "ip://127.0.0.1:8080",
+		Protocol:    "fasthttp",
+	}}
+}
+
+func TestRewriteFailoverTarget(t *testing.T) {
+	item := &entity.RouterItem{
+		Method: "/user/",
+		TargetService: []*entity.TargetService{
+			{Service: "primary", ReWrite: "/v1/", StripPath: true},
+			{Service: "backup", ReWrite: "/v2/?from=backup", StripPath: true, Priority: 1},
+		},
+	}
+	r := NewFastHTTPRouter()
+	err := r.InitRouterConfig(context.Background(), &entity.ProxyConfig{
+		Router: []*entity.RouterItem{item},
+		Client: []*entity.BackendConfig{newFailoverClient("primary"), newFailoverClient("backup")},
+	})
+	assert.Nil(t, err)
+
+	ctx, gMsg := gwmsg.WithNewGWMessage(context.Background())
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/user/info?id=1")
+	ctx = http.WithRequestContext(ctx, fctx)
+	svr, err := r.GetMatchRouter(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "primary", svr.Service)
+	assert.Equal(t, "/v1/info", string(fctx.Path()))
+	assert.Equal(t, "id=1", string(fctx.QueryArgs().QueryString()))
+	assert.Equal(t, "/v1/info", gMsg.UpstreamMethod())
+
+	// The original path is rewritten with the rewrite of the backup
+	next := NextFailoverTarget(svr)
+	assert.Equal(t, "backup", next.Service)
+	RewriteFailoverTarget(ctx, next)
+	assert.Equal(t, "/v2/info", string(fctx.Path()))
+	assert.Equal(t, "from=backup&id=1", string(fctx.QueryArgs().QueryString()))
+	assert.Equal(t, "/v2/info", gMsg.UpstreamMethod())
+
+	// Not rewritten without the original path
+	fctx.Request.SetRequestURI("/user/info")
+	fctx.SetUserValue(contextKeyOriginURI, nil)
+	RewriteFailoverTarget(ctx, next)
+	assert.Equal(t, "/user/info", string(fctx.Path()))
+	RewriteFailoverTarget(context.Background(), next)
+}
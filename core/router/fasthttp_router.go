@@ -20,7 +20,7 @@ import (
 	"runtime/debug"
 	"sort"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	radix "github.com/armon/go-radix"
@@ -58,29 +58,29 @@ func init() {
 
 // FastHTTPRouter is the FastHTTP router
 type FastHTTPRouter struct {
-	opts         *Options // proxy configuration
-	sync.RWMutex          // read-write lock for updating configuration
+	opts atomic.Pointer[Options] // proxy configuration, swapped atomically when the configuration is updated
 }
 
 // NewFastHTTPRouter creates a new FastHTTP router
 func NewFastHTTPRouter() *FastHTTPRouter {
-	return &FastHTTPRouter{opts: &Options{}}
+	r := &FastHTTPRouter{}
+	r.opts.Store(&Options{})
+	return r
 }
 
 // getOpts gets the proxy configuration.
-// Use this method to access the configuration to avoid race conditions when directly reading opts
-// during configuration updates.
+// The options and the compiled routing table are immutable after being built, so a request loads the pointer once
+// and uses the same configuration during matching.
 func (r *FastHTTPRouter) getOpts() *Options {
-	r.RLock()
-	defer r.RUnlock()
-	return r.opts
+	if opts := r.opts.Load(); opts != nil {
+		return opts
+	}
+	return &Options{}
 }
 
 // setOpts sets the proxy configuration
 func (r *FastHTTPRouter) setOpts(opts *Options) {
-	r.Lock()
-	defer r.Unlock()
-	r.opts = opts
+	r.opts.Store(opts)
 }
 
 // LoadRouterConf loads the router configuration
@@ -102,6 +102,7 @@ func (r *FastHTTPRouter) LoadRouterConf(provider string) (err error) {
 // 2. Initialize the regular expression matching, which is a list
 // 3. Upstream service configuration
 // 4. Plugin configuration
+// 5. Compile the routing table, which is swapped atomically with the options
 func (r *FastHTTPRouter) InitRouterConfig(ctx context.Context, rf *entity.ProxyConfig) error {
 	options, err := r.CheckAndInit(ctx, rf)
 	if err != nil {
@@ -114,10 +115,12 @@ func (r *FastHTTPRouter) InitRouterConfig(ctx context.Context, rf *entity.ProxyC
 }
 
 // CheckAndInit validates and initializes the configuration
-func (r *FastHTTPRouter) CheckAndInit(ctx context.Context, rf *entity.ProxyConfig) (*Options, error) {
+func (r *FastHTTPRouter) CheckAndInit(ctx context.Context, rf *entity.ProxyConfig) (_ *Options, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.ErrorContextf(ctx, "check and init router config panic: %s, stack: %s", r, string(debug.Stack()))
+			// Return an error, so that the last good configuration is kept
+			err = errs.Newf(gerrs.ErrWrongConfig, "check and init router config panic: %v", r)
 		}
 	}()
 	// Proxy configuration
@@ -125,6 +128,8 @@ func (r *FastHTTPRouter) CheckAndInit(ctx context.Context, rf *entity.ProxyConfi
 		RadixTree:     radix.New(),
 		RegRouterList: []*RegRouter{},
 		Clients:       map[string]*entity.BackendConfig{},
+		// Carry over the circuit breakers and the failover health of the current configuration
+		upstream: newUpstreamState(r.getOpts().upstream),
 	}
 	// Load upstream service configuration
 	opts := r.getTargetServiceOpts(ctx, rf)
@@ -132,7 +137,10 @@ func (r *FastHTTPRouter) CheckAndInit(ctx context.Context, rf *entity.ProxyConfi
 		o(options)
 	}
 
-	// Load router configuration
+	// Expand the router groups and templates, then load router configuration
+	if err := expandRouters(rf); err != nil {
+		return nil, gerrs.Wrap(err, "expand routers err")
+	}
 	routerOpts, err := r.getRouterOpts(ctx, rf, options)
 	if err != nil {
 		return nil, gerrs.Wrap(err, "get router opts err")
@@ -140,6 +148,14 @@ func (r *FastHTTPRouter) CheckAndInit(ctx context.Context, rf *entity.ProxyConfi
 	for _, o := range routerOpts {
 		o(options)
 	}
+	sortRouters(options)
+	for _, overlap := range overlappingRegRouters(options.RegRouterList) {
+		log.WarnContextf(ctx, "overlapping regexp routers: %s", overlap)
+	}
+	// Compile the routing table after the router items are sorted
+	options.table = newRouteTable(options)
+	// The state of the last load is not needed any more
+	options.upstream.prev = nil
 	return options, nil
 }
 
@@ -156,6 +172,70 @@ func (r *FastHTTPRouter) getTargetServiceOpts(ctx context.Context, rf *entity.Pr
 	return opts
 }
 
+// initRouterItem validates and parses the router item and its target services
+func (r *FastHTTPRouter) initRouterItem(routerItem *entity.RouterItem, rf *entity.ProxyConfig,
+	options *Options) error {
+	// Initialize the upstream service configuration
+	if err := r.initTargetService(routerItem.TargetService, options.Clients, routerItem.Plugins, rf.Plugins); err != nil {
+		return gerrs.Wrapf(err, "init target service error")
+	}
+	// Parse the upstream timeouts and retry policies
+	if err := initRetry(routerItem); err != nil {
+		return gerrs.Wrap(err, "init retry error")
+	}
+	// Build the circuit breakers of the upstream services
+	if err := initCircuitBreaker(routerItem, options.upstream); err != nil {
+		return gerrs.Wrap(err, "init circuit breaker error")
+	}
+	// Resolve the shadow service
+	if err := r.initShadow(routerItem, options.Clients); err != nil {
+		return gerrs.Wrap(err, "init shadow error")
+	}
+	// Validate and parse the condition expression
+	if routerItem.Rule != nil && routerItem.Rule.Expression != "" {
+		if err := rule.FormatRule(routerItem.Rule); err != nil {
+			return gerrs.Wrap(err, "format rule error")
+		}
+	}
+	// Parse the source of the hash key, such as header:x-uid
+	if routerItem.HashKey != "" {
+		src, err := http.ParseSource(routerItem.HashKey)
+		if err != nil {
+			return gerrs.Wrap(err, "parse hash key error")
+		}
+		routerItem.ParsedHashKey = src
+	}
+	// Validate the sticky target selection
+	if err := checkSticky(routerItem); err != nil {
+		return gerrs.Wrap(err, "check sticky error")
+	}
+	// Build the consistent hash of the target services once
+	if routerItem.HashMode != "" {
+		if routerItem.HashKey == "" {
+			return errs.Newf(gerrs.ErrWrongConfig, "hash mode %s requires hash key", routerItem.HashMode)
+		}
+		selector, err := newHashSelector(routerItem.HashMode, routerItem.TargetService)
+		if err != nil {
+			return gerrs.Wrap(err, "new hash selector error")
+		}
+		routerItem.HashSelector = selector
+	}
+	// Group the target services by priority for failover
+	if err := initFailover(routerItem, options.upstream); err != nil {
+		return gerrs.Wrap(err, "init failover error")
+	}
+	// Parse the exact, wildcard and regex hosts
+	if err := parseHosts(routerItem); err != nil {
+		return gerrs.Wrap(err, "parse host error")
+	}
+	// HTTP methods are case-sensitive, but the configuration is normalized to upper case
+	for i, m := range routerItem.HTTPMethods {
+		routerItem.HTTPMethods[i] = strings.ToUpper(strings.TrimSpace(m))
+	}
+	routerItem.HTTPMethodMap = convert.StrSlice2Map(routerItem.HTTPMethods)
+	return nil
+}
+
 // getRouterOpts retrieves the router configuration
 func (r *FastHTTPRouter) getRouterOpts(ctx context.Context, rf *entity.ProxyConfig, options *Options) ([]Option, error) {
 	var opts []Option
@@ -166,32 +246,49 @@ func (r *FastHTTPRouter) getRouterOpts(ctx context.Context, rf *entity.ProxyConf
 		return opts, errs.New(gerrs.ErrWrongConfig, "empty router configuration")
 	}
 	for _, routerItem := range rf.Router {
-		// Initialize the upstream service configuration
-		if err := r.initTargetService(routerItem.TargetService, options.Clients, routerItem.Plugins, rf.Plugins); err != nil {
-			return nil, gerrs.Wrapf(err, "init target service error")
-		}
 		// Method cannot be empty or "/"
 		if routerItem.Method == "" || routerItem.Method == "/" {
 			return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid method configuration: %s", convert.ToJSONStr(routerItem))
 		}
-		// Validate and parse the condition expression
-		if routerItem.Rule != nil && routerItem.Rule.Expression != "" {
-			if err := rule.FormatRule(routerItem.Rule); err != nil {
-				return nil, gerrs.Wrap(err, "format rule error")
-			}
+		if err := r.initRouterItem(routerItem, rf, options); err != nil {
+			return nil, err
 		}
-		// Convert to a map
-		routerItem.HostMap = convert.StrSlice2Map(routerItem.Host)
 
 		// Check if it is a regular expression router
 		if routerItem.IsRegexp {
+			if err := compileRegexpRouter(routerItem); err != nil {
+				return nil, gerrs.Wrap(err, "compile regexp router error")
+			}
 			opts = append(opts, WithRegRouter(routerItem))
 			continue
 		}
+		// Check if it is a path template router, such as /users/{uid}
+		if isPathTemplate(routerItem.Method) {
+			reg, err := compilePathTemplate(routerItem.Method)
+			if err != nil {
+				return nil, gerrs.Wrap(err, "compile path template error")
+			}
+			opts = append(opts, WithTemplateRouter(routerItem, reg))
+			continue
+		}
 		// If it is not a regular expression router, it is either an exact match or a prefix match,
 		// and it is added to the trie tree
 		opts = append(opts, WithRadixTreeRouter(routerItem))
 	}
+	// The catch-all router used when no router matches the path
+	if rf.DefaultRoute != nil {
+		if err := r.initDefaultRoute(rf, options); err != nil {
+			return nil, gerrs.Wrap(err, "init default route error")
+		}
+		opts = append(opts, WithDefaultRoute(rf.DefaultRoute))
+	}
+	// The response of the requests not found
+	if rf.NotFound != nil {
+		if err := r.initNotFound(rf); err != nil {
+			return nil, gerrs.Wrap(err, "init not found error")
+		}
+		opts = append(opts, WithNotFound(rf.NotFound))
+	}
 	return opts, nil
 }
 
@@ -201,41 +298,75 @@ func (r *FastHTTPRouter) initTargetService(targetServiceList []*entity.TargetSer
 	if len(targetServiceList) == 0 {
 		return errs.New(gerrs.ErrWrongConfig, "empty target service")
 	}
-	var totalWeight int
+	// Weights and numbers of the target services of each priority
+	totalWeight, count := make(map[int]int), make(map[int]int)
 	for _, s := range targetServiceList {
 		// Accumulate weights
-		totalWeight += s.Weight
+		totalWeight[s.Priority] += s.Weight
+		count[s.Priority]++
 		service, err := r.checkService(clientMap, s.Service)
 		if err != nil {
 			return gerrs.Wrap(err, "check service error")
 		}
 		s.BackendConfig = &service.BackendConfig
 		// Merge gateway plugins at global, service, and router levels
-		s.Plugins = r.mergePlugins(routerPlugins, service.Plugins, globalPlugins)
-		// Iterate through all plugins and parse their configurations
-		var pluginsNameList []string
-		for _, pluginConfig := range s.Plugins {
-			parsedConfig, perr := r.parsePluginConfig(pluginConfig)
-			if perr != nil {
-				return gerrs.Wrapf(perr, "parse plugin config error")
-			}
-			pluginConfig.Props = parsedConfig
-			pluginsNameList = append(pluginsNameList, pluginConfig.Name)
-		}
-		// Assemble all filters, with trpc filters first and deduplicated
-		for _, name := range util.Deduplicate(trpc.GlobalConfig().Server.Filter, pluginsNameList) {
-			log.Debugf("plugin_name:%s", name)
-			filterFunc := filter.GetServer(name)
-			if filterFunc == nil {
-				return gerrs.Wrapf(err, "no such filter, name:%s", name)
+		if err := r.initFilters(s, r.mergePlugins(routerPlugins, service.Plugins, globalPlugins)); err != nil {
+			return err
+		}
+	}
+	// If there are multiple target services of the same priority, weight cannot be empty
+	for priority, n := range count {
+		if n > 1 && totalWeight[priority] == 0 {
+			return errs.Newf(gerrs.ErrWrongConfig, "invalid target service configuration: %s",
+				convert.ToJSONStr(targetServiceList))
+		}
+	}
+	return nil
+}
+
+// initFilters parses the configurations of the merged plugins, and assembles the filters of the target service
+func (r *FastHTTPRouter) initFilters(s *entity.TargetService, plugins []*entity.Plugin) error {
+	s.Plugins = plugins
+	// Iterate through all plugins and parse their configurations
+	var pluginsNameList []string
+	for _, pluginConfig := range s.Plugins {
+		parsedConfig, err := r.parsePluginConfig(pluginConfig)
+		if err != nil {
+			return gerrs.Wrapf(err, "parse plugin config error")
+		}
+		pluginConfig.Props = parsedConfig
+		if pluginConfig.When != nil {
+			if err := rule.FormatRule(pluginConfig.When); err != nil {
+				return gerrs.Wrapf(err, "format plugin when error, name:%s", pluginConfig.Name)
 			}
-			s.Filters = append(s.Filters, filterFunc)
 		}
 	}
-	// If there are multiple target services, weight cannot be empty
-	if len(targetServiceList) > 1 && totalWeight == 0 {
-		return errs.Newf(gerrs.ErrWrongConfig, "invalid target service configuration: %s",
-			convert.ToJSONStr(targetServiceList))
+	// Sort the plugins by priority, and check the dependencies
+	if err := sortPlugins(s.Plugins); err != nil {
+		return gerrs.Wrap(err, "sort plugins error")
+	}
+	when := make(map[string]*entity.RuleItem)
+	for _, pluginConfig := range s.Plugins {
+		pluginsNameList = append(pluginsNameList, pluginConfig.Name)
+		if pluginConfig.When != nil {
+			when[pluginConfig.Name] = pluginConfig.When
+		}
+	}
+	// The trpc filters always run
+	for _, name := range trpc.GlobalConfig().Server.Filter {
+		delete(when, name)
+	}
+	// Assemble all filters, with trpc filters first and deduplicated
+	for _, name := range util.Deduplicate(trpc.GlobalConfig().Server.Filter, pluginsNameList) {
+		log.Debugf("plugin_name:%s", name)
+		filterFunc := filter.GetServer(name)
+		if filterFunc == nil {
+			return errs.Newf(gerrs.ErrWrongConfig, "no such filter, name:%s", name)
+		}
+		if w, ok := when[name]; ok {
+			filterFunc = whenFilter(w, filterFunc)
+		}
+		s.Filters = append(s.Filters, filterFunc)
 	}
 	return nil
 }
@@ -287,21 +418,20 @@ func (r *FastHTTPRouter) parsePluginConfig(pluginConfig *entity.Plugin) (interfa
 }
 
 // mergePlugins retrieves the plugin list
-// Plugin execution order: global plugins first, then service plugins, and finally router plugins
+// Plugin execution order: global plugins first, then service plugins, and finally router plugins, which is adjusted
+// by the priorities of the plugins in initFilters
 // Configuration priority: router plugin configuration > service plugin configuration > global plugin configuration
 func (r *FastHTTPRouter) mergePlugins(routerPlugins, servicePlugins,
 	globalPlugins []*entity.Plugin) []*entity.Plugin {
-	// Put the plugins in the array in the order of router plugin configuration, service plugin configuration,
-	// and global plugin configuration
-	var plugins []*entity.Plugin
+	// Put the plugins in the array in the order of global plugin configuration, service plugin configuration,
+	// and router plugin configuration
+	plugins := make([]*entity.Plugin, 0, len(routerPlugins)+len(servicePlugins)+len(globalPlugins))
 	plugins = append(plugins, globalPlugins...)
 	plugins = append(plugins, servicePlugins...)
 	plugins = append(plugins, routerPlugins...)
 
 	// Reverse the order for deduplication, keeping the plugins with the smallest scope
-	sort.SliceStable(plugins, func(i, j int) bool {
-		return true
-	})
+	reversePlugins(plugins)
 
 	// Final list of effective plugins
 	resultPlugins := make([]*entity.Plugin, 0, len(plugins))
@@ -319,32 +449,43 @@ func (r *FastHTTPRouter) mergePlugins(routerPlugins, servicePlugins,
 	}
 
 	// Reverse the order again to adjust the execution order
-	sort.SliceStable(resultPlugins, func(i, j int) bool {
-		return true
-	})
+	reversePlugins(resultPlugins)
 	return resultPlugins
 }
 
+// reversePlugins reverses the plugins in place
+func reversePlugins(plugins []*entity.Plugin) {
+	for i, j := 0, len(plugins)-1; i < j; i, j = i+1, j-1 {
+		plugins[i], plugins[j] = plugins[j], plugins[i]
+	}
+}
+
 // GetMatchRouter Match the router
 // 1. Exact match
-// 2. Longest prefix match
-// 3. Regular expression match
-// 4. Fine-grained match
-// 5. Gray calculation
+// 2. Path template match
+// 3. Longest prefix match
+// 4. Regular expression match
+// 5. Fine-grained match
+// 6. Gray calculation
 func (r *FastHTTPRouter) GetMatchRouter(ctx context.Context) (*entity.TargetService, error) {
 	fctx := http.RequestContext(ctx)
 	if fctx == nil {
 		return nil, errs.New(gerrs.ErrWrongContext, "invalid http context")
 	}
-	// Router matching: exact match, longest prefix match, regular expression match
-	routerItemList, err := r.matchRouterItem(fctx)
-	if err != nil {
-		return nil, gerrs.Wrap(err, "match_router_item_err")
-	}
-	// Fine-grained match
-	routerItem, err := r.getExactRouterItem(fctx, routerItemList)
+	routerItem, err := r.matchRouter(fctx)
 	if err != nil {
-		return nil, gerrs.Wrap(err, "get exact router err")
+		if errs.Code(err) != gerrs.ErrPathNotFound {
+			return nil, err
+		}
+		// Forward the requests not found to the default route, or respond with the not found response
+		opts := r.getOpts()
+		if opts.DefaultRoute == nil && opts.NotFound == nil {
+			return nil, err
+		}
+		if opts.DefaultRoute == nil {
+			return opts.NotFound.Target, nil
+		}
+		routerItem = opts.DefaultRoute
 	}
 
 	gwmsg.GwMessage(ctx).WithRouterID(routerItem.ID)
@@ -355,25 +496,56 @@ func (r *FastHTTPRouter) GetMatchRouter(ctx context.Context) (*entity.TargetServ
 		codec.Message(ctx).WithCalleeMethod(routerItem.Method)
 	}
 
-	// Gray calculation
-	targetService, err := r.getGreyServiceName(fctx, routerItem.HashKey, routerItem.TargetService)
+	// Gray calculation, the sticky cookie takes precedence if configured
+	targetService, err := r.getStickyServiceName(ctx, fctx, routerItem)
 	if err != nil {
 		// This has been validated during configuration initialization, so this error should not occur
 		return nil, gerrs.Wrap(err, "get_proxy_service_err")
 	}
+	// Keep the original path and query string, so that they are rewritten again for the target service to fail
+	// over to
+	if routerItem.FailoverGroups != nil {
+		saveOriginURI(fctx)
+	}
+	rewriteRequest(ctx, fctx, routerItem, targetService)
+	return targetService, nil
+}
+
+// rewriteRequest rewrites the path and the query string of the request for the target service, and sets the
+// reported backend interface
+func rewriteRequest(ctx context.Context, fctx *fasthttp.RequestCtx, routerItem *entity.RouterItem,
+	targetService *entity.TargetService) {
 	// Rewrite path
-	rewritePath := r.getRewritePath(fctx, routerItem, targetService)
+	rewritePath, query, hasQuery, dropQuery := splitRewriteQuery(getRewritePath(fctx, routerItem, targetService))
 	// Set the reported backend interface
-	gwmsg.GwMessage(ctx).WithUpstreamMethod(r.getUpstreamMethod(string(fctx.Path()), rewritePath, routerItem,
+	gwmsg.GwMessage(ctx).WithUpstreamMethod(getUpstreamMethod(string(fctx.Path()), rewritePath, routerItem,
 		targetService))
 	if rewritePath != "" {
 		fctx.Request.URI().SetPath(rewritePath)
 	}
-	return targetService, nil
+	// Rewrite the query string, such as /article?id=$1
+	if hasQuery {
+		rewriteQuery(fctx, query, dropQuery)
+	}
+}
+
+// matchRouter matches the router item of the request
+func (r *FastHTTPRouter) matchRouter(fctx *fasthttp.RequestCtx) (*entity.RouterItem, error) {
+	// Router matching: exact match, path template match, longest prefix match, regular expression match
+	node, err := r.matchRouterItem(fctx)
+	if err != nil {
+		return nil, gerrs.Wrap(err, "match_router_item_err")
+	}
+	// Fine-grained match
+	routerItem, err := r.getExactRouterItem(fctx, node)
+	if err != nil {
+		return nil, gerrs.Wrap(err, "get exact router err")
+	}
+	return routerItem, nil
 }
 
 // Get the reported backend service interface
-func (r *FastHTTPRouter) getUpstreamMethod(originPath, rewritePath string, routerItem *entity.RouterItem,
+func getUpstreamMethod(originPath, rewritePath string, routerItem *entity.RouterItem,
 	targetService *entity.TargetService) string {
 	if rewritePath != "" && !strings.HasPrefix(rewritePath, "/") {
 		rewritePath = fmt.Sprintf("/%s", rewritePath)
@@ -399,7 +571,7 @@ func (r *FastHTTPRouter) getUpstreamMethod(originPath, rewritePath string, route
 }
 
 // getRewritePath Get the rewritten path
-func (r *FastHTTPRouter) getRewritePath(fctx *fasthttp.RequestCtx, routerItem *entity.RouterItem,
+func getRewritePath(fctx *fasthttp.RequestCtx, routerItem *entity.RouterItem,
 	targetService *entity.TargetService) string {
 	if fctx == nil || routerItem == nil || targetService == nil {
 		return ""
@@ -407,19 +579,40 @@ func (r *FastHTTPRouter) getRewritePath(fctx *fasthttp.RequestCtx, routerItem *e
 	// Use the most granular rewrite configuration
 	// Rewrite target-level path
 	path := string(fctx.Path())
+	// Values captured by the path template route, referenced as {name} in rewrite
+	params := http.PathParams(fctx)
 	// Remove prefix
 	if targetService.StripPath || targetService.ReWrite != "" {
-		return r.assemblePath(path, targetService.ReWrite, routerItem.Method, targetService.StripPath)
+		return expandRewrite(path, targetService.ReWrite, params, routerItem, targetService.StripPath)
 	}
 
 	if routerItem.StripPath || routerItem.ReWrite != "" {
-		return r.assemblePath(path, routerItem.ReWrite, routerItem.Method, routerItem.StripPath)
+		return expandRewrite(path, routerItem.ReWrite, params, routerItem, routerItem.StripPath)
 	}
 	return ""
 }
 
+// expandRewrite expands the references in the rewrite and assembles the path, the query string of the rewrite is
+// kept, such as /article?id=1
+//  1. For regular expression routes, $1 and ${name} are expanded with the submatches of the path, and the result is
+//     the whole rewritten path.
+//  2. Otherwise, {name} is expanded with the values captured by the path template route, and the path is assembled
+//     by assemblePath.
+func expandRewrite(path, rewrite string, params map[string]string,
+	routerItem *entity.RouterItem, stripPath bool) string {
+	if expanded, ok := expandRegexpRewrite(routerItem, rewrite, path); ok {
+		return expanded
+	}
+	rewritePath, query, hasQuery := strings.Cut(http.ExpandPathParams(rewrite, params), "?")
+	rewritePath = assemblePath(path, rewritePath, routerItem.Method, stripPath)
+	if hasQuery {
+		return rewritePath + "?" + query
+	}
+	return rewritePath
+}
+
 // Assemble the path
-func (r *FastHTTPRouter) assemblePath(originPath, rewritePath, method string, stripPath bool) string {
+func assemblePath(originPath, rewritePath, method string, stripPath bool) string {
 	// If rewrite is an exact path, such as: /user/info, return directly
 	if rewritePath != "" && !strings.HasSuffix(rewritePath, "/") {
 		return rewritePath
@@ -439,93 +632,57 @@ func (r *FastHTTPRouter) assemblePath(originPath, rewritePath, method string, st
 	return fmt.Sprintf("%s%s", rewritePath, strings.TrimPrefix(originPath, "/"))
 }
 
-// matchRouterItem Match the router by path
-// 1. First match with exact routes
-// 2. Then match with longest prefix routes
-// 3. Iterate through all regular expression routes
-func (r *FastHTTPRouter) matchRouterItem(fctx *fasthttp.RequestCtx) ([]*entity.RouterItem, error) {
-	path := string(fctx.Path())
-	// Exact route matching
-	if item, ok := r.getOpts().RadixTree.Get(path); ok {
-		return item.([]*entity.RouterItem), nil
-	}
-
-	// Longest prefix route matching
-	longestPrefix, item, ok := r.getOpts().RadixTree.LongestPrefix(path)
-	if ok && longestPrefix != "/" && strings.HasSuffix(longestPrefix, "/") {
-		return item.([]*entity.RouterItem), nil
-	}
-
-	// Regular expression route matching
-	// Match in the order of configuration, no priority
-	// The reason for iterating through regular expressions here is:
-	// 1. Regular expression matching is very rare in route configurations, most of them are exact matches or longest
-	//    prefix matches
-	// 2. Regular expressions have been compiled, so the performance of regular expression matching is acceptable
-	for _, item := range r.getOpts().RegRouterList {
-		if item.MatchString(path) {
-			return item.ItemList, nil
-		}
-	}
-
-	return nil, errs.New(gerrs.ErrPathNotFound, "no router matched")
+// matchRouterItem Match the router by path with the compiled routing table, see routeTable.match
+func (r *FastHTTPRouter) matchRouterItem(fctx *fasthttp.RequestCtx) (*routeNode, error) {
+	return r.getOpts().table.match(fctx)
 }
 
 // getExactRouterItem After matching the route, perform fine-grained matching.
-// The input parameter routerItemList usually has only about 2 items, so there is no performance issue with two
-// iterations in the method.
+// The router items of the node are pre-filtered by host and HTTP method when the routing table is compiled, so the
+// lookup does not allocate memory.
 // Matching logic:
-//  1. First match the router item with a configured host; if no host is configured, match all router items.
-//  2. Then match the rule, return the matched router item if there is a match; if no rule is matched, return the first
-//     router item without a rule configured.
-//  3. If no match is found, return an error.
+//  1. First match the router item with a configured host, exact host > wildcard host > regex host; if no host is
+//     matched, match the router items without a configured host.
+//  2. Then match the router item with a configured HTTP method, followed by the router items without a configured
+//     HTTP method, which match all HTTP methods.
+//  3. Then match the rule, return the matched router item if there is a match; if no rule is matched, return the first
+//     router item without a rule configured. Router items are sorted by priority, then configuration.
+//  4. If no match is found, return an error.
 func (r *FastHTTPRouter) getExactRouterItem(fctx *fasthttp.RequestCtx,
-	routerItemList []*entity.RouterItem) (*entity.RouterItem, error) {
-	host := string(fctx.Host())
-	hostMatchList, err := r.getHostMatchRouterItemList(routerItemList, host)
+	node *routeNode) (*entity.RouterItem, error) {
+	hostMatchSet, err := node.matchHost(fctx.Host())
 	if err != nil {
 		return nil, gerrs.Wrap(err, "get no host match route item")
 	}
 
+	// Get the router items that match the HTTP method
+	methodMatchList, err := hostMatchSet.matchMethod(fctx)
+	if err != nil {
+		return nil, gerrs.Wrap(err, "get no http method match route item")
+	}
+
 	// Get the router item that matches the rule
-	routerItem, err := r.getRuleMatchItem(fctx, hostMatchList)
+	routerItem, err := r.getRuleMatchItem(fctx, methodMatchList)
 	if err != nil {
 		return nil, gerrs.Wrap(err, "rule match err")
 	}
 	return routerItem, nil
 }
 
-// getHostMatchRouterItemList Get the list of routes that match the host
-// Prioritize returning all router items configured with a host; if no match is found, return the router items without
-// a configured host.
-func (r *FastHTTPRouter) getHostMatchRouterItemList(routerItemList []*entity.RouterItem,
-	host string) ([]*entity.RouterItem, error) {
-	// Iterate and check the host
-	// Match in the order of configuration, no priority
-	var hostMatchList []*entity.RouterItem
-	// Router items without a configured host
-	var noHostRouterItemList []*entity.RouterItem
-	// Get the items that match the host
+// allowedHTTPMethods returns the value of the Allow header, which is the sorted HTTP methods of the router items
+func allowedHTTPMethods(routerItemList []*entity.RouterItem) string {
+	m := make(map[string]struct{})
 	for _, item := range routerItemList {
-		if len(item.HostMap) == 0 {
-			noHostRouterItemList = append(noHostRouterItemList, item)
-			continue
-		}
-		if _, ok := item.HostMap[host]; ok {
-			hostMatchList = append(hostMatchList, item)
+		for method := range item.HTTPMethodMap {
+			m[method] = struct{}{}
 		}
 	}
-
-	// Prioritize matching the rules corresponding to the host, if there are no items with a host, then match all items
-	if len(hostMatchList) != 0 {
-		return hostMatchList, nil
+	methods := make([]string, 0, len(m))
+	for method := range m {
+		methods = append(methods, method)
 	}
-	// Use the router items without a configured host as a fallback
-	if len(noHostRouterItemList) != 0 {
-		return noHostRouterItemList, nil
-	}
-
-	return nil, errs.New(gerrs.ErrPathNotFound, "no host match router item found")
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
 }
 
 // getRuleMatchItem Get the rule-matched item
@@ -533,10 +690,13 @@ func (r *FastHTTPRouter) getHostMatchRouterItemList(routerItemList []*entity.Rou
 // rule.
 func (r *FastHTTPRouter) getRuleMatchItem(fctx *fasthttp.RequestCtx,
 	secondMatchList []*entity.RouterItem) (*entity.RouterItem, error) {
-	var noRuleItemList []*entity.RouterItem
+	// The first item without a configured rule
+	var noRuleItem *entity.RouterItem
 	for _, item := range secondMatchList {
 		if item.Rule == nil || len(item.Rule.Conditions) == 0 {
-			noRuleItemList = append(noRuleItemList, item)
+			if noRuleItem == nil {
+				noRuleItem = item
+			}
 			continue
 		}
 		// Match according to the rule, return if matched
@@ -550,15 +710,20 @@ func (r *FastHTTPRouter) getRuleMatchItem(fctx *fasthttp.RequestCtx,
 		}
 	}
 	// If no rule is matched, return the item without a configured rule
-	if len(noRuleItemList) > 0 {
-		return noRuleItemList[0], nil
+	if noRuleItem != nil {
+		return noRuleItem, nil
 	}
 	return nil, errs.New(gerrs.ErrPathNotFound, "get no rule matched router item")
 }
 
 // getGreyServiceName Get the target service name through the grey strategy
 func (r *FastHTTPRouter) getGreyServiceName(fctx *fasthttp.RequestCtx,
-	hashKey string, svrs []*entity.TargetService) (*entity.TargetService, error) {
+	routerItem *entity.RouterItem) (*entity.TargetService, error) {
+	svrs, selector := routerItem.TargetService, routerItem.HashSelector
+	// Select from the available target services of the smallest priority
+	if fg, ok := routerItem.FailoverGroups.(*failoverGroups); ok {
+		svrs, selector = fg.activeTargets(time.Now().UnixNano())
+	}
 	// Target service cannot be empty
 	if len(svrs) == 0 {
 		return nil, errs.New(gerrs.ErrTargetServiceNotFound, "empty dst services")
@@ -580,8 +745,12 @@ func (r *FastHTTPRouter) getGreyServiceName(fctx *fasthttp.RequestCtx,
 	}
 	rad := rand.Intn(sumWeight)
 	// Check if there is a state-based grey strategy
-	if hashKey != "" {
-		val := DefaultGetString(fctx, hashKey)
+	if routerItem.HashKey != "" {
+		val := rule.GetValue(fctx, routerItem.HashKey, routerItem.ParsedHashKey, DefaultGetString)
+		// Consistent hash, only the keys of the changed weights are moved
+		if selector, ok := selector.(hashSelector); ok && val != "" {
+			return selector.selectTarget(val), nil
+		}
 		if val != "" {
 			rad = int(convert.Fnv32(val) % uint32(sumWeight))
 		}
@@ -17,6 +17,7 @@ import (
 	"context"
 	"errors"
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/golang/mock/gomock"
@@ -138,6 +139,55 @@ func TestFastHTTPRouter_InitRouterConfig(t *testing.T) {
 	err = r.InitRouterConfig(context.Background(), proxyConfig)
 	assert.NotNil(t, err)
 	proxyConfig.Router[0].Method = tmpRouter.Method
+
+	// Weights are only required for the target services of the same priority
+	tmpTargets := proxyConfig.Router[0].TargetService
+	proxyConfig.Router[0].TargetService = []*entity.TargetService{
+		{Service: tmpTargets[0].Service},
+		{Service: tmpTargets[0].Service, Priority: 1},
+	}
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.Nil(t, err)
+	proxyConfig.Router[0].TargetService[1].Priority = 0
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	proxyConfig.Router[0].TargetService = tmpTargets
+
+	// Invalid hash key source
+	proxyConfig.Router[0].HashKey = "json:uid"
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	proxyConfig.Router[0].HashKey = tmpRouter.HashKey
+
+	// Invalid host
+	proxyConfig.Router[0].Host = []string{"a.*.com"}
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	proxyConfig.Router[0].Host = tmpRouter.Host
+
+	// Invalid hash mode
+	proxyConfig.Router[0].HashKey = "devid"
+	proxyConfig.Router[0].HashMode = "modulo"
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	// Hash mode without hash key
+	proxyConfig.Router[0].HashKey = ""
+	proxyConfig.Router[0].HashMode = HashModeKetama
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	proxyConfig.Router[0].HashKey = "devid"
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.Nil(t, err)
+	assert.NotNil(t, proxyConfig.Router[0].HashSelector)
+	proxyConfig.Router[0].HashKey = tmpRouter.HashKey
+	proxyConfig.Router[0].HashMode = ""
+	proxyConfig.Router[0].HashSelector = nil
+
+	// Invalid sticky configuration
+	proxyConfig.Router[0].Sticky = &entity.StickyConfig{}
+	err = r.InitRouterConfig(context.Background(), proxyConfig)
+	assert.NotNil(t, err)
+	proxyConfig.Router[0].Sticky = nil
 	// Target service weight configuration error
 	tmpTargetService := proxyConfig.Router[0].TargetService
 	proxyConfig.Router[0].TargetService = []*entity.TargetService{
@@ -261,7 +311,10 @@ func TestFastHTTPRouter_GetMatchRouter(t *testing.T) {
 			TargetService: nil,
 		},
 	}
-	r.opts.RadixTree.Insert("/usr/info/ext", routerList)
+	opts := r.getOpts()
+	opts.RadixTree.Insert("/usr/info/ext", routerList)
+	// The routing table is immutable, compile it again after the routes are changed
+	opts.table = newRouteTable(opts)
 
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/usr/info/ext")
@@ -290,9 +343,7 @@ func TestFastHTTPRouter_GetMatchRouter(t *testing.T) {
 				Oper: "==",
 			},
 		},
-		Expression:       "0&&4",
-		ConditionIdxList: []int{4},
-		OptList:          nil,
+		Expression: "0&&4",
 	}
 
 	fCtx = &fasthttp.RequestCtx{}
@@ -328,23 +379,61 @@ func TestFastHTTPRouter_GetMatchRouter(t *testing.T) {
 	_, err = r.GetMatchRouter(ctx)
 	assert.Nil(t, err)
 	assert.Equal(t, "/user_prefix/", gwmsg.GwMessage(ctx).UpstreamMethod())
+
+	// Path template match with captured values
+	ctx, _ = gwmsg.WithNewGWMessage(context.Background())
+	fCtx = &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/users/u1/orders/42")
+	ctx = http.WithRequestContext(ctx, fCtx)
+	_, err = r.GetMatchRouter(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "/v2/account/u1/order/42", string(fCtx.Path()))
+	assert.Equal(t, "u1", http.PathParam(fCtx, "uid"))
+	assert.Equal(t, "42", DefaultGetString(fCtx, "{oid}"))
+
+	// HTTP method match
+	for method, routerID := range map[string]string{
+		fasthttp.MethodGet:  "/orders/query",
+		fasthttp.MethodPost: "/orders/command",
+		fasthttp.MethodPut:  "/orders/command",
+	} {
+		ctx, _ = gwmsg.WithNewGWMessage(context.Background())
+		fCtx = &fasthttp.RequestCtx{}
+		fCtx.Request.SetRequestURI("/orders")
+		fCtx.Request.Header.SetMethod(method)
+		ctx = http.WithRequestContext(ctx, fCtx)
+		_, err = r.GetMatchRouter(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, routerID, gwmsg.GwMessage(ctx).RouterID())
+	}
+
+	// HTTP method not allowed
+	ctx, _ = gwmsg.WithNewGWMessage(context.Background())
+	fCtx = &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/orders")
+	fCtx.Request.Header.SetMethod(fasthttp.MethodDelete)
+	ctx = http.WithRequestContext(ctx, fCtx)
+	_, err = r.GetMatchRouter(ctx)
+	assert.Equal(t, gerrs.ErrMethodNotAllowed, errs.Code(err))
+	assert.Equal(t, "GET, POST, PUT", string(fCtx.Response.Header.Peek(fasthttp.HeaderAllow)))
+
+	// Path template mismatch
+	ctx, _ = gwmsg.WithNewGWMessage(context.Background())
+	fCtx = &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/users/u1/orders/abc")
+	ctx = http.WithRequestContext(ctx, fCtx)
+	_, err = r.GetMatchRouter(ctx)
+	assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err))
 }
 
 func Benchmark_matchRouterItem(b *testing.B) {
-	// Load configuration
-	confBytes, err := os.ReadFile("../../testdata/routerbenchmark.yaml")
-	assert.Nil(b, err)
-	var proxyConfig entity.ProxyConfig
-	err = yaml.Unmarshal(confBytes, &proxyConfig)
-	assert.Nil(b, err)
-	r := NewFastHTTPRouter()
-	err = r.InitRouterConfig(context.Background(), &proxyConfig)
-	assert.Nil(b, err)
+	r := newBenchmarkRouter(b, "../../testdata/routerbenchmark.yaml")
+	fCtx := &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/invalid")
+	b.ReportAllocs()
+	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		// Exact match
-		fCtx := &fasthttp.RequestCtx{}
-		fCtx.Request.SetRequestURI("/invalid")
-		_, err = r.matchRouterItem(fCtx)
+		_, err := r.matchRouterItem(fCtx)
 		assert.NotNil(b, err)
 	}
 }
@@ -370,30 +459,30 @@ func TestFastHTTPRouter_matchRouterItem(t *testing.T) {
 	// Exact match
 	fCtx := &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/user/info")
-	routerItemList, err := r.matchRouterItem(fCtx)
+	node, err := r.matchRouterItem(fCtx)
 	assert.Nil(t, err)
-	assert.Greater(t, len(routerItemList), 0)
+	assert.Greater(t, len(node.items), 0)
 
 	// Longest prefix match
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/user/ext_info")
-	routerItemList, err = r.matchRouterItem(fCtx)
+	node, err = r.matchRouterItem(fCtx)
 	assert.Nil(t, err)
-	assert.Greater(t, len(routerItemList), 0)
+	assert.Greater(t, len(node.items), 0)
 
 	// Regular expression match
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/feed/flow")
-	routerItemList, err = r.matchRouterItem(fCtx)
+	node, err = r.matchRouterItem(fCtx)
 	assert.Nil(t, err)
-	assert.Greater(t, len(routerItemList), 0)
+	assert.Greater(t, len(node.items), 0)
 
 	// Match failed
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/article/info")
-	routerItemList, err = r.matchRouterItem(fCtx)
+	node, err = r.matchRouterItem(fCtx)
 	assert.Equal(t, errs.Code(err), gerrs.ErrPathNotFound)
-	assert.Nil(t, routerItemList)
+	assert.Nil(t, node)
 }
 
 func TestFastHTTPRouter_getExactRouterItem(t *testing.T) {
@@ -496,7 +585,7 @@ func TestFastHTTPRouter_getExactRouterItem(t *testing.T) {
 	fCtx := &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/user/info")
 	fCtx.Request.SetHost("r.inews.qq.com")
-	routerItem, err := r.getExactRouterItem(fCtx, routerItemList)
+	routerItem, err := r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
 	assert.Nil(t, err)
 	assert.Nil(t, routerItem.Rule)
 
@@ -505,7 +594,7 @@ func TestFastHTTPRouter_getExactRouterItem(t *testing.T) {
 	fCtx.Request.SetRequestURI("/user/info")
 	fCtx.Request.SetHost("r.inews.qq.com")
 	fCtx.Request.Header.Set("devid", "xxx")
-	routerItem, err = r.getExactRouterItem(fCtx, routerItemList)
+	routerItem, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
 	assert.Nil(t, err)
 	assert.NotNil(t, routerItem.Rule)
 	assert.Equal(t, routerItem.Rule.Conditions[0].Val, "xxx")
@@ -515,14 +604,14 @@ func TestFastHTTPRouter_getExactRouterItem(t *testing.T) {
 	fCtx.Request.SetRequestURI("/user/info")
 	fCtx.Request.SetHost("qq.com")
 	fCtx.Request.Header.Set("devid", "yyy")
-	_, err = r.getExactRouterItem(fCtx, routerItemList)
+	_, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
 	assert.Equal(t, errs.Code(err), gerrs.ErrPathNotFound)
 
 	// No matching host
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/user/info")
 	fCtx.Request.SetHost("w.inews.qq.com")
-	routerItem, err = r.getExactRouterItem(fCtx, routerItemList)
+	routerItem, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
 	assert.Nil(t, err)
 	assert.Equal(t, routerItem.Host, []string{})
 
@@ -543,8 +632,37 @@ func TestFastHTTPRouter_getExactRouterItem(t *testing.T) {
 	fCtx = &fasthttp.RequestCtx{}
 	fCtx.Request.SetRequestURI("/user/info")
 	fCtx.Request.SetHost("w.inews.qq.com")
-	_, err = r.getExactRouterItem(fCtx, routerItemList)
+	_, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
 	assert.NotNil(t, err)
+
+	// Matched by HTTP method, items without HTTP method are the fallback
+	routerItemList = []*entity.RouterItem{
+		{
+			Method:        "/user/info",
+			HTTPMethodMap: map[string]struct{}{fasthttp.MethodPost: {}},
+		},
+		{
+			Method: "/user/info",
+		},
+	}
+	fCtx = &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/user/info")
+	fCtx.Request.Header.SetMethod(fasthttp.MethodPost)
+	routerItem, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
+	assert.Nil(t, err)
+	assert.Equal(t, routerItemList[0], routerItem)
+	fCtx.Request.Header.SetMethod(fasthttp.MethodGet)
+	routerItem, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
+	assert.Nil(t, err)
+	assert.Equal(t, routerItemList[1], routerItem)
+
+	// HTTP method not allowed
+	routerItemList = routerItemList[:1]
+	fCtx = &fasthttp.RequestCtx{}
+	fCtx.Request.SetRequestURI("/user/info")
+	_, err = r.getExactRouterItem(fCtx, newRouteNode(routerItemList))
+	assert.Equal(t, gerrs.ErrMethodNotAllowed, errs.Code(err))
+	assert.Equal(t, fasthttp.MethodPost, string(fCtx.Response.Header.Peek(fasthttp.HeaderAllow)))
 }
 
 func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
@@ -552,7 +670,7 @@ func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
 	ctx := &fasthttp.RequestCtx{}
 	// Empty service
 	var svrs []*entity.TargetService
-	target, err := router.getGreyServiceName(ctx, "", svrs)
+	target, err := router.getGreyServiceName(ctx, &entity.RouterItem{TargetService: svrs})
 	assert.Equal(t, gerrs.ErrTargetServiceNotFound, errs.Code(err))
 	assert.Nil(t, target)
 
@@ -563,7 +681,7 @@ func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
 			Weight:  0,
 		},
 	}
-	target, err = router.getGreyServiceName(ctx, "", svrs)
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{TargetService: svrs})
 	assert.Nil(t, err)
 	assert.Equal(t, "target.service.a", target.Service)
 
@@ -578,7 +696,7 @@ func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
 			Weight:  0,
 		},
 	}
-	target, err = router.getGreyServiceName(ctx, "", svrs)
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{TargetService: svrs})
 	assert.Nil(t, err)
 	assert.Equal(t, "target.service.a", target.Service)
 
@@ -593,7 +711,7 @@ func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
 			Weight:  0,
 		},
 	}
-	target, err = router.getGreyServiceName(ctx, "", svrs)
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{TargetService: svrs})
 	assert.Equal(t, gerrs.ErrTargetServiceNotFound, errs.Code(err))
 	assert.Nil(t, target)
 
@@ -609,51 +727,75 @@ func TestFastHTTPRouter_getGreyServiceName(t *testing.T) {
 			Weight:  1,
 		},
 	}
-	target, err = router.getGreyServiceName(ctx, "suid", svrs)
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{HashKey: "suid", TargetService: svrs})
+	assert.Nil(t, err)
+	assert.Equal(t, "target.service.a", target.Service)
+
+	// Query parameter takes precedence over header for the key without source prefix
+	ctx.Request.SetRequestURI("/user/info?suid=2")
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{HashKey: "suid", TargetService: svrs})
+	assert.Nil(t, err)
+	assert.Equal(t, "target.service.b", target.Service)
+
+	// Hash key with source prefix only reads the header
+	src, err := http.ParseSource("header:suid")
+	assert.Nil(t, err)
+	target, err = router.getGreyServiceName(ctx, &entity.RouterItem{HashKey: "header:suid", ParsedHashKey: src,
+		TargetService: svrs})
 	assert.Nil(t, err)
 	assert.Equal(t, "target.service.a", target.Service)
+
+	// Consistent hash
+	for _, mode := range []string{HashModeKetama, HashModeRendezvous} {
+		selector, err := newHashSelector(mode, svrs)
+		assert.Nil(t, err)
+		item := &entity.RouterItem{HashKey: "header:suid", ParsedHashKey: src, HashMode: mode,
+			HashSelector: selector, TargetService: svrs}
+		target, err = router.getGreyServiceName(ctx, item)
+		assert.Nil(t, err)
+		assert.Equal(t, selector.selectTarget("12345"), target)
+	}
 }
 
-func TestFastHTTPRouter_getRewritePath(t *testing.T) {
+func Test_getRewritePath(t *testing.T) {
 	v2Path := "/v2/"
 	v1Path := "/v1/"
 	v3Path := "/v3/"
 	ctx := &fasthttp.RequestCtx{}
 	ctx.URI().SetPath("/v1/user")
-	r := &FastHTTPRouter{}
-	rewrite := r.getRewritePath(ctx, nil, nil)
+	rewrite := getRewritePath(ctx, nil, nil)
 	assert.Equal(t, "", rewrite)
 
 	routerItem := &entity.RouterItem{}
 	targetService := &entity.TargetService{}
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "", rewrite)
 
 	targetService.ReWrite = "/target_rewrite"
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/target_rewrite", rewrite)
 
 	targetService.ReWrite = v2Path
 	targetService.StripPath = true
 	routerItem.Method = v1Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/v2/user", rewrite)
 
 	targetService.ReWrite = v2Path
 	targetService.StripPath = false
 	routerItem.Method = v1Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/v2/v1/user", rewrite)
 
 	targetService.ReWrite = ""
 	targetService.StripPath = true
 	routerItem.Method = v1Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "user", rewrite)
 
 	targetService.StripPath = false
 	routerItem.ReWrite = "/router_rewrite"
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/router_rewrite", rewrite)
 	routerItem.ReWrite = ""
 
@@ -661,7 +803,7 @@ func TestFastHTTPRouter_getRewritePath(t *testing.T) {
 	routerItem.StripPath = true
 	ctx.URI().SetPath("/v2/user")
 	routerItem.Method = v2Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "user", rewrite)
 
 	ctx.URI().SetPath("/v2/user")
@@ -669,7 +811,7 @@ func TestFastHTTPRouter_getRewritePath(t *testing.T) {
 	routerItem.StripPath = true
 	routerItem.Method = v2Path
 	routerItem.ReWrite = v3Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/v3/user", rewrite)
 
 	ctx.URI().SetPath("/v2/user")
@@ -677,8 +819,21 @@ func TestFastHTTPRouter_getRewritePath(t *testing.T) {
 	routerItem.StripPath = false
 	routerItem.Method = v2Path
 	routerItem.ReWrite = v3Path
-	rewrite = r.getRewritePath(ctx, routerItem, targetService)
+	rewrite = getRewritePath(ctx, routerItem, targetService)
 	assert.Equal(t, "/v3/v2/user", rewrite)
+
+	// The query string of the rewrite is kept
+	routerItem.ReWrite = "/v3/?from=gw"
+	rewrite = getRewritePath(ctx, routerItem, targetService)
+	assert.Equal(t, "/v3/v2/user?from=gw", rewrite)
+
+	// Regular expression capture groups
+	routerItem.Method = `^/v2/(\w+)$`
+	routerItem.IsRegexp = true
+	routerItem.ReWrite = "/v3/info?name=$1"
+	assert.Nil(t, compileRegexpRouter(routerItem))
+	rewrite = getRewritePath(ctx, routerItem, targetService)
+	assert.Equal(t, "/v3/info?name=user", rewrite)
 }
 
 func TestFastHTTPRouter_mergePlugins(t *testing.T) {
@@ -718,7 +873,7 @@ func TestFastHTTPRouter_mergePlugins(t *testing.T) {
 		},
 	}
 	resultPluginsList := r.mergePlugins(routerPlugins, servicePlugins, globalPlugins)
-	assert.ElementsMatch(t, resultPluginsList, []*entity.Plugin{
+	assert.Equal(t, resultPluginsList, []*entity.Plugin{
 		{
 			Name: "e",
 		},
@@ -740,16 +895,22 @@ func TestFastHTTPRouter_mergePlugins(t *testing.T) {
 			Name: "b",
 		},
 	})
+
+	// The order is kept for more plugins
+	var many []*entity.Plugin
+	for i := 0; i < 30; i++ {
+		many = append(many, &entity.Plugin{Name: strconv.Itoa(i)})
+	}
+	assert.Equal(t, many, r.mergePlugins(nil, nil, many))
 }
 
-func TestFastHTTPRouter_getUpstreamMethod(t *testing.T) {
-	r := &FastHTTPRouter{}
+func Test_getUpstreamMethod(t *testing.T) {
 	routerItem := &entity.RouterItem{}
 	targetService := &entity.TargetService{}
 
 	// Report full path, report the rewritten interface
 	routerItem.ReportMethod = false
-	upstreamMethod := r.getUpstreamMethod("/v1/user", "v2/user", routerItem, targetService)
+	upstreamMethod := getUpstreamMethod("/v1/user", "v2/user", routerItem, targetService)
 	assert.Equal(t, "/v2/user", upstreamMethod)
 
 	// Report prefix, report the configured interface
@@ -757,6 +918,6 @@ func TestFastHTTPRouter_getUpstreamMethod(t *testing.T) {
 	routerItem.Method = "/v0"
 	routerItem.Method = "/v1"
 	targetService.ReWrite = "/v2/"
-	upstreamMethod = r.getUpstreamMethod("/v1/user", "v2/user", routerItem, targetService)
+	upstreamMethod = getUpstreamMethod("/v1/user", "v2/user", routerItem, targetService)
 	assert.Equal(t, "/v2/", upstreamMethod)
 }
@@ -0,0 +1,183 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// Consistent hash modes of the hash key
+const (
+	// HashModeKetama maps the hash key onto a ketama ring, where each target service has virtual nodes in proportion
+	// to its weight
+	HashModeKetama = "ketama"
+	// HashModeRendezvous selects the target service with the highest weighted score of the hash key
+	HashModeRendezvous = "rendezvous"
+)
+
+// ketamaPointsPerWeight is the number of virtual nodes of a unit of weight on the ketama ring
+const ketamaPointsPerWeight = 40
+
+// hashSelector selects the target service by the value of the hash key consistently
+type hashSelector interface {
+	// selectTarget returns the target service of the key
+	selectTarget(key string) *entity.TargetService
+}
+
+// newHashSelector builds the consistent hash of the target services, target services with zero weight are never
+// selected
+func newHashSelector(mode string, svrs []*entity.TargetService) (hashSelector, error) {
+	switch mode {
+	case HashModeKetama:
+		return newKetamaRing(svrs), nil
+	case HashModeRendezvous:
+		return newRendezvousHash(svrs), nil
+	default:
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid hash mode:%s, only %s and %s are supported", mode,
+			HashModeKetama, HashModeRendezvous)
+	}
+}
+
+// targetIDs returns the identities of the target services used for hashing. The service name is used, so that the
+// order of the target services does not matter, and duplicated services are numbered.
+func targetIDs(svrs []*entity.TargetService) []string {
+	ids := make([]string, 0, len(svrs))
+	count := make(map[string]int)
+	for _, svr := range svrs {
+		id := svr.Service
+		if n := count[svr.Service]; n > 0 {
+			id = fmt.Sprintf("%s#%d", svr.Service, n)
+		}
+		count[svr.Service]++
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ketamaRing is the ketama consistent hash ring. Increasing the weight of a target service only adds its virtual
+// nodes, so only the keys moved to this target service are affected.
+type ketamaRing struct {
+	// points is the sorted hash of the virtual nodes
+	points []uint64
+	// targets is the target services of the virtual nodes
+	targets []*entity.TargetService
+}
+
+// newKetamaRing builds the ketama ring of the target services
+func newKetamaRing(svrs []*entity.TargetService) *ketamaRing {
+	type point struct {
+		hash   uint64
+		target *entity.TargetService
+	}
+	var points []point
+	for i, id := range targetIDs(svrs) {
+		for j := 0; j < svrs[i].Weight*ketamaPointsPerWeight; j++ {
+			points = append(points, point{hash: hashString(fmt.Sprintf("%s-%d", id, j)), target: svrs[i]})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+	r := &ketamaRing{
+		points:  make([]uint64, len(points)),
+		targets: make([]*entity.TargetService, len(points)),
+	}
+	for i, p := range points {
+		r.points[i], r.targets[i] = p.hash, p.target
+	}
+	return r
+}
+
+// selectTarget returns the target service of the first virtual node clockwise from the hash of the key
+func (r *ketamaRing) selectTarget(key string) *entity.TargetService {
+	if len(r.points) == 0 {
+		return nil
+	}
+	h := hashString(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= h
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.targets[i]
+}
+
+// rendezvousHash is the weighted rendezvous hash. The score of each target service is -weight/ln(u), where u is
+// the uniform hash of the key and the target service in (0, 1), so increasing a weight only moves keys to it.
+type rendezvousHash struct {
+	seeds   []uint64
+	weights []float64
+	targets []*entity.TargetService
+}
+
+// newRendezvousHash builds the weighted rendezvous hash of the target services
+func newRendezvousHash(svrs []*entity.TargetService) *rendezvousHash {
+	h := &rendezvousHash{}
+	for i, id := range targetIDs(svrs) {
+		if svrs[i].Weight <= 0 {
+			continue
+		}
+		h.seeds = append(h.seeds, hashString(id))
+		h.weights = append(h.weights, float64(svrs[i].Weight))
+		h.targets = append(h.targets, svrs[i])
+	}
+	return h
+}
+
+// selectTarget returns the target service with the highest score of the key
+func (h *rendezvousHash) selectTarget(key string) *entity.TargetService {
+	keyHash := hashString(key)
+	var target *entity.TargetService
+	best := math.Inf(-1)
+	for i, seed := range h.seeds {
+		// The top 53 bits are mapped to (0, 1)
+		u := (float64(mix64(keyHash^seed)>>11) + 0.5) / (1 << 53)
+		if score := -h.weights[i] / math.Log(u); score > best {
+			best, target = score, h.targets[i]
+		}
+	}
+	return target
+}
+
+// hashString is the 64-bit FNV-1a hash of the string followed by a finalizer, so that similar strings such as the
+// virtual node names are distributed uniformly. It does not allocate memory.
+func hashString(s string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return mix64(h)
+}
+
+// mix64 is the finalizer of MurmurHash3, which makes every bit of the input affect every bit of the output
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
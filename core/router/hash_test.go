@@ -0,0 +1,120 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_newHashSelector(t *testing.T) {
+	svrs := []*entity.TargetService{{Service: "a", Weight: 1}, {Service: "b", Weight: 0}}
+	for _, mode := range []string{HashModeKetama, HashModeRendezvous} {
+		selector, err := newHashSelector(mode, svrs)
+		assert.Nil(t, err)
+		// Target services with zero weight are never selected
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, "a", selector.selectTarget(strconv.Itoa(i)).Service, mode)
+		}
+		// No target service with weight
+		selector, err = newHashSelector(mode, svrs[1:])
+		assert.Nil(t, err)
+		assert.Nil(t, selector.selectTarget("1"), mode)
+	}
+	_, err := newHashSelector("modulo", svrs)
+	assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err))
+}
+
+func Test_hashSelector_weightChange(t *testing.T) {
+	const keys = 20000
+	for _, mode := range []string{HashModeKetama, HashModeRendezvous} {
+		before, err := newHashSelector(mode, []*entity.TargetService{
+			{Service: "gray", Weight: 10}, {Service: "base", Weight: 90},
+		})
+		assert.Nil(t, err)
+		// The order of the target services does not matter
+		after, err := newHashSelector(mode, []*entity.TargetService{
+			{Service: "base", Weight: 80}, {Service: "gray", Weight: 20},
+		})
+		assert.Nil(t, err)
+		var grayBefore, grayAfter int
+		for i := 0; i < keys; i++ {
+			key := "user" + strconv.Itoa(i)
+			b, a := before.selectTarget(key).Service, after.selectTarget(key).Service
+			if b == "gray" {
+				grayBefore++
+				// The users in the gray release stay in it
+				assert.Equal(t, "gray", a, mode)
+			}
+			if a == "gray" {
+				grayAfter++
+			}
+		}
+		assert.InDelta(t, 0.1, float64(grayBefore)/keys, 0.03, mode)
+		assert.InDelta(t, 0.2, float64(grayAfter)/keys, 0.03, mode)
+	}
+}
+
+func Test_hashSelector_addTarget(t *testing.T) {
+	const keys = 20000
+	for _, mode := range []string{HashModeKetama, HashModeRendezvous} {
+		before, err := newHashSelector(mode, []*entity.TargetService{
+			{Service: "a", Weight: 10}, {Service: "b", Weight: 10},
+		})
+		assert.Nil(t, err)
+		after, err := newHashSelector(mode, []*entity.TargetService{
+			{Service: "a", Weight: 10}, {Service: "b", Weight: 10}, {Service: "c", Weight: 10},
+		})
+		assert.Nil(t, err)
+		for i := 0; i < keys; i++ {
+			key := "user" + strconv.Itoa(i)
+			// Only the keys moved to the new target service are affected
+			if a := after.selectTarget(key).Service; a != "c" {
+				assert.Equal(t, before.selectTarget(key).Service, a, mode)
+			}
+		}
+	}
+}
+
+func Test_targetIDs(t *testing.T) {
+	svrs := []*entity.TargetService{{Service: "a"}, {Service: "b"}, {Service: "a"}}
+	assert.Equal(t, []string{"a", "b", "a#1"}, targetIDs(svrs))
+}
+
+func Test_hashString(t *testing.T) {
+	assert.Equal(t, hashString("user1"), hashString("user1"))
+	assert.NotEqual(t, hashString("user1"), hashString("user2"))
+	assert.Equal(t, 0.0, testing.AllocsPerRun(100, func() {
+		_ = hashString("user1")
+	}))
+}
+
+func BenchmarkHashSelector(b *testing.B) {
+	svrs := []*entity.TargetService{{Service: "a", Weight: 10}, {Service: "b", Weight: 90}}
+	for _, mode := range []string{HashModeKetama, HashModeRendezvous} {
+		selector, err := newHashSelector(mode, svrs)
+		assert.Nil(b, err)
+		b.Run(mode, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = selector.selectTarget("user12345")
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"regexp"
+	"strings"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+const (
+	// hostWildcardPrefix is the prefix of the suffix wildcard host, such as *.example.com
+	hostWildcardPrefix = "*."
+	// hostRegexpPrefix is the prefix of the regex host, such as ~^tenant-[0-9]+\.example\.com$
+	hostRegexpPrefix = "~"
+)
+
+// Host match levels, the higher level takes precedence
+const (
+	hostMatchNone = iota
+	hostMatchRegexp
+	hostMatchWildcard
+	hostMatchExact
+)
+
+// parseHosts parses the host configuration of the router item into exact, wildcard and regex hosts.
+// Hosts are normalized by normalizeHost, so the port in the configuration is ignored.
+func parseHosts(item *entity.RouterItem) error {
+	item.HostMap = make(map[string]struct{})
+	item.HostWildcards = nil
+	item.HostRegexps = nil
+	for _, host := range item.Host {
+		host = strings.TrimSpace(host)
+		switch {
+		case host == "":
+			continue
+		case strings.HasPrefix(host, hostRegexpPrefix):
+			reg, err := regexp.Compile(host[len(hostRegexpPrefix):])
+			if err != nil {
+				return errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid regex host:%s", host)
+			}
+			item.HostRegexps = append(item.HostRegexps, reg)
+		case strings.Contains(host, "*"):
+			suffix := normalizeHost(strings.TrimPrefix(host, "*"))
+			if !strings.HasPrefix(host, hostWildcardPrefix) || strings.Contains(suffix, "*") ||
+				len(suffix) < 2 {
+				return errs.Newf(gerrs.ErrWrongConfig, "invalid wildcard host:%s, only *.domain is supported", host)
+			}
+			item.HostWildcards = append(item.HostWildcards, suffix)
+		default:
+			item.HostMap[normalizeHost(host)] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// hasHost checks if the router item is configured with host
+func hasHost(item *entity.RouterItem) bool {
+	return len(item.HostMap) != 0 || len(item.HostWildcards) != 0 || len(item.HostRegexps) != 0
+}
+
+// matchHost returns the match level of the normalized host, and the length of the matched wildcard suffix which is
+// used to prefer the longest wildcard
+func matchHost(item *entity.RouterItem, host string) (int, int) {
+	if _, ok := item.HostMap[host]; ok {
+		return hostMatchExact, 0
+	}
+	longest := 0
+	for _, suffix := range item.HostWildcards {
+		if len(host) > len(suffix) && strings.HasSuffix(host, suffix) && len(suffix) > longest {
+			longest = len(suffix)
+		}
+	}
+	if longest > 0 {
+		return hostMatchWildcard, longest
+	}
+	for _, reg := range item.HostRegexps {
+		if reg.MatchString(host) {
+			return hostMatchRegexp, 0
+		}
+	}
+	return hostMatchNone, 0
+}
+
+// normalizeHost lowercases the host, and strips the port and the trailing dot, such as Example.com.:8080 ->
+// example.com. IPv6 brackets are stripped as well, [::1]:8080 -> ::1.
+func normalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			host = host[1:i]
+		}
+	} else if i := strings.IndexByte(host, ':'); i >= 0 && strings.Count(host, ":") == 1 {
+		host = host[:i]
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
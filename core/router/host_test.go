@@ -0,0 +1,89 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func Test_parseHosts(t *testing.T) {
+	item := &entity.RouterItem{
+		Host: []string{"R.inews.qq.com:8080", "*.Example.com", "~^tenant-[0-9]+\\.qq\\.com$", " "},
+	}
+	assert.Nil(t, parseHosts(item))
+	assert.Equal(t, map[string]struct{}{"r.inews.qq.com": {}}, item.HostMap)
+	assert.Equal(t, []string{".example.com"}, item.HostWildcards)
+	assert.Equal(t, 1, len(item.HostRegexps))
+	assert.True(t, hasHost(item))
+
+	// Parse again
+	assert.Nil(t, parseHosts(item))
+	assert.Equal(t, 1, len(item.HostWildcards))
+	assert.Equal(t, 1, len(item.HostRegexps))
+
+	item = &entity.RouterItem{}
+	assert.Nil(t, parseHosts(item))
+	assert.False(t, hasHost(item))
+
+	for _, host := range []string{"*", "*.", "a.*.com", "*example.com", "*.*.com", "~(", "~[a-"} {
+		item = &entity.RouterItem{Host: []string{host}}
+		assert.NotNil(t, parseHosts(item), host)
+	}
+}
+
+func Test_matchHost(t *testing.T) {
+	item := &entity.RouterItem{
+		Host: []string{"qq.com", "*.qq.com", "*.inews.qq.com", "~^tenant-[0-9]+\\.example\\.com$"},
+	}
+	assert.Nil(t, parseHosts(item))
+	tests := []struct {
+		host      string
+		wantLevel int
+		wantLen   int
+	}{
+		{host: "qq.com", wantLevel: hostMatchExact},
+		{host: "r.qq.com", wantLevel: hostMatchWildcard, wantLen: len(".qq.com")},
+		{host: "r.inews.qq.com", wantLevel: hostMatchWildcard, wantLen: len(".inews.qq.com")},
+		{host: ".qq.com", wantLevel: hostMatchNone},
+		{host: "tenant-1.example.com", wantLevel: hostMatchRegexp},
+		{host: "tenant-x.example.com", wantLevel: hostMatchNone},
+		{host: "example.com", wantLevel: hostMatchNone},
+	}
+	for _, tt := range tests {
+		level, suffixLen := matchHost(item, tt.host)
+		assert.Equal(t, tt.wantLevel, level, tt.host)
+		assert.Equal(t, tt.wantLen, suffixLen, tt.host)
+	}
+}
+
+func Test_normalizeHost(t *testing.T) {
+	tests := map[string]string{
+		"":                   "",
+		"qq.com":             "qq.com",
+		"QQ.com:8080":        "qq.com",
+		"qq.com.":            "qq.com",
+		"qq.com.:80":         "qq.com",
+		"127.0.0.1:80":       "127.0.0.1",
+		"[::1]:8080":         "::1",
+		"[::1]":              "::1",
+		"::1":                "::1",
+		"[2001:DB8::1]:8080": "2001:db8::1",
+	}
+	for host, want := range tests {
+		assert.Equal(t, want, normalizeHost(host), host)
+	}
+}
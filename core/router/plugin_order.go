@@ -0,0 +1,76 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"sort"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	cplugin "trpc.group/trpc-go/trpc-gateway/common/plugin"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	gwplugin "trpc.group/trpc-go/trpc-gateway/plugin"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+// sortPlugins sorts the parsed plugins by priority in descending order, the plugins of the same priority keep the
+// order of global, service and router plugins. Then the plugins depended on by a plugin in the chain must run
+// earlier than it.
+func sortPlugins(plugins []*entity.Plugin) error {
+	priorities := make(map[*entity.Plugin]int, len(plugins))
+	for _, p := range plugins {
+		priorities[p] = pluginPriority(p)
+	}
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return priorities[plugins[i]] > priorities[plugins[j]]
+	})
+	return checkPluginDependencies(plugins)
+}
+
+// pluginPriority returns the order of the plugin configuration, or the priority declared by the plugin
+func pluginPriority(p *entity.Plugin) int {
+	if p.Order != nil {
+		return *p.Order
+	}
+	if prioritizer, ok := plugin.Get(p.Type, p.Name).(gwplugin.Prioritizer); ok {
+		return prioritizer.Priority()
+	}
+	return cplugin.DefaultPriority
+}
+
+// checkPluginDependencies checks that the dependencies of the plugins, named as type-name like the tRPC plugins, run
+// earlier. The dependencies not in the chain are set up by tRPC, such as config-etcd, and are ignored.
+func checkPluginDependencies(plugins []*entity.Plugin) error {
+	index := make(map[string]int, len(plugins))
+	for i, p := range plugins {
+		index[p.Type+"-"+p.Name] = i
+	}
+	for i, p := range plugins {
+		var deps []string
+		factory := plugin.Get(p.Type, p.Name)
+		if d, ok := factory.(plugin.Depender); ok {
+			deps = append(deps, d.DependsOn()...)
+		}
+		if d, ok := factory.(plugin.FlexDepender); ok {
+			deps = append(deps, d.FlexDependsOn()...)
+		}
+		for _, dep := range deps {
+			if j, ok := index[dep]; ok && j > i {
+				return errs.Newf(gerrs.ErrWrongConfig,
+					"invalid plugin order, plugin %s depends on %s which runs later", p.Name, dep)
+			}
+		}
+	}
+	return nil
+}
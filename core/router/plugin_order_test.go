@@ -0,0 +1,97 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+// orderPlugin is a gateway plugin declaring the priority and the dependencies
+type orderPlugin struct {
+	priority int
+	deps     []string
+	flexDeps []string
+}
+
+func (p *orderPlugin) Type() string {
+	return "gateway"
+}
+
+func (p *orderPlugin) Setup(string, plugin.Decoder) error {
+	return nil
+}
+
+func (p *orderPlugin) Priority() int {
+	return p.priority
+}
+
+func (p *orderPlugin) DependsOn() []string {
+	return p.deps
+}
+
+func (p *orderPlugin) FlexDependsOn() []string {
+	return p.flexDeps
+}
+
+func Test_sortPlugins(t *testing.T) {
+	plugin.Register("order_auth", &orderPlugin{priority: 100})
+	plugin.Register("order_cors", &orderPlugin{priority: 200})
+	plugin.Register("order_user", &orderPlugin{deps: []string{"gateway-order_auth", "config-etcd"}})
+	plugin.Register("order_flex", &orderPlugin{flexDeps: []string{"gateway-order_user"}})
+	newPlugin := func(name string) *entity.Plugin {
+		return &entity.Plugin{Name: name, Type: "gateway"}
+	}
+	names := func(plugins []*entity.Plugin) []string {
+		var s []string
+		for _, p := range plugins {
+			s = append(s, p.Name)
+		}
+		return s
+	}
+
+	// Sorted by priority, the plugins of the same priority keep the configured order
+	plugins := []*entity.Plugin{newPlugin("order_user"), newPlugin("order_auth"), newPlugin("order_flex"),
+		newPlugin("order_cors")}
+	assert.Nil(t, sortPlugins(plugins))
+	assert.Equal(t, []string{"order_cors", "order_auth", "order_user", "order_flex"}, names(plugins))
+
+	// The order of the configuration overrides the priority
+	order := 300
+	plugins = []*entity.Plugin{newPlugin("order_cors"), {Name: "order_auth", Type: "gateway", Order: &order}}
+	assert.Nil(t, sortPlugins(plugins))
+	assert.Equal(t, []string{"order_auth", "order_cors"}, names(plugins))
+
+	// The plugins not registered use the default priority
+	plugins = []*entity.Plugin{newPlugin("order_none"), newPlugin("order_auth")}
+	assert.Nil(t, sortPlugins(plugins))
+	assert.Equal(t, []string{"order_auth", "order_none"}, names(plugins))
+
+	// The dependency runs later
+	order = -1
+	plugins = []*entity.Plugin{newPlugin("order_user"), {Name: "order_auth", Type: "gateway", Order: &order}}
+	err := sortPlugins(plugins)
+	assert.NotNil(t, err)
+	assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err))
+
+	// The flexible dependency runs later
+	order = 1
+	plugins = []*entity.Plugin{{Name: "order_flex", Type: "gateway", Order: &order}, newPlugin("order_user")}
+	assert.NotNil(t, sortPlugins(plugins))
+}
@@ -0,0 +1,207 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+// maxRegexpSamples is the max number of sample paths generated from a regular expression
+const maxRegexpSamples = 16
+
+// sortRouters sorts the router items of the same path, the path template routes and the regular expression routes by
+// priority in descending order, the order of configuration is kept on ties
+func sortRouters(o *Options) {
+	if o.RadixTree != nil {
+		o.RadixTree.Walk(func(_ string, v interface{}) bool {
+			if list, ok := v.([]*entity.RouterItem); ok {
+				sortRouterItems(list)
+			}
+			return false
+		})
+	}
+	sortRegRouters(o.TemplateRouterList)
+	sortRegRouters(o.RegRouterList)
+}
+
+// sortRouterItems sorts the router items by priority in descending order
+func sortRouterItems(list []*entity.RouterItem) {
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Priority > list[j].Priority
+	})
+}
+
+// sortRegRouters sorts the regular expression routes by the highest priority of their router items
+func sortRegRouters(list []*RegRouter) {
+	for _, r := range list {
+		sortRouterItems(r.ItemList)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return regRouterPriority(list[i]) > regRouterPriority(list[j])
+	})
+}
+
+// regRouterPriority returns the highest priority of the router items, the items are sorted already
+func regRouterPriority(r *RegRouter) int {
+	if len(r.ItemList) == 0 {
+		return 0
+	}
+	return r.ItemList[0].Priority
+}
+
+// overlappingRegRouters checks whether two regular expression routes can match the same sample path, and returns the
+// description of the overlaps. The routes are sorted already, so the former one shadows the latter one.
+func overlappingRegRouters(list []*RegRouter) []string {
+	samples := make([][]string, len(list))
+	for i, r := range list {
+		samples[i] = regexpSamples(r.RegexpStr)
+	}
+	var overlaps []string
+	for i := range list {
+		for j := i + 1; j < len(list); j++ {
+			if sample, ok := commonSample(list[i], list[j], samples[i], samples[j]); ok {
+				overlaps = append(overlaps, fmt.Sprintf(
+					"regexp router %q (priority %d) shadows %q (priority %d), both match sample path %q",
+					list[i].RegexpStr, regRouterPriority(list[i]), list[j].RegexpStr, regRouterPriority(list[j]),
+					sample))
+			}
+		}
+	}
+	return overlaps
+}
+
+// commonSample returns a sample path matched by both routes
+func commonSample(a, b *RegRouter, samplesA, samplesB []string) (string, bool) {
+	for _, s := range samplesA {
+		if b.MatchString(s) {
+			return s, true
+		}
+	}
+	for _, s := range samplesB {
+		if a.MatchString(s) {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// regexpSamples generates sample strings matched by the regular expression, such as /user/a for ^/user/[a-z]+$.
+// Optional and repeated parts generate samples both with and without them.
+func regexpSamples(expr string) []string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	return sampleRegexp(re.Simplify())
+}
+
+// sampleRegexp generates sample strings of the regular expression syntax tree
+func sampleRegexp(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCharClass:
+		return []string{string(sampleRune(re.Rune))}
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return []string{"a"}
+	case syntax.OpCapture:
+		return sampleRegexp(re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest:
+		return appendSamples([]string{""}, sampleRegexp(re.Sub[0]))
+	case syntax.OpPlus:
+		return sampleRegexp(re.Sub[0])
+	case syntax.OpRepeat:
+		return sampleRepeat(sampleRegexp(re.Sub[0]), re.Min)
+	case syntax.OpConcat:
+		samples := []string{""}
+		for _, sub := range re.Sub {
+			samples = concatSamples(samples, sampleRegexp(sub))
+		}
+		return samples
+	case syntax.OpAlternate:
+		var samples []string
+		for _, sub := range re.Sub {
+			samples = appendSamples(samples, sampleRegexp(sub))
+		}
+		return samples
+	default:
+		// Empty width assertions such as ^ and $, and empty match
+		return []string{""}
+	}
+}
+
+// sampleRune returns a rune in the character class, lower case letters and digits are preferred
+func sampleRune(ranges []rune) rune {
+	for _, want := range []rune{'a', '0'} {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= want && want <= ranges[i+1] {
+				return want
+			}
+		}
+	}
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1] && r <= unicode.MaxASCII; r++ {
+			if unicode.IsPrint(r) {
+				return r
+			}
+		}
+	}
+	if len(ranges) > 0 {
+		return ranges[0]
+	}
+	return 'a'
+}
+
+// sampleRepeat repeats the samples min times
+func sampleRepeat(samples []string, min int) []string {
+	if min == 0 {
+		return appendSamples([]string{""}, samples)
+	}
+	ret := make([]string, 0, len(samples))
+	for _, s := range samples {
+		ret = append(ret, strings.Repeat(s, min))
+	}
+	return ret
+}
+
+// concatSamples returns the cartesian product of the samples, limited by maxRegexpSamples
+func concatSamples(prefixes, suffixes []string) []string {
+	var ret []string
+	for _, p := range prefixes {
+		for _, s := range suffixes {
+			if len(ret) == maxRegexpSamples {
+				return ret
+			}
+			ret = append(ret, p+s)
+		}
+	}
+	return ret
+}
+
+// appendSamples appends the samples, limited by maxRegexpSamples
+func appendSamples(samples, more []string) []string {
+	for _, s := range more {
+		if len(samples) == maxRegexpSamples {
+			break
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
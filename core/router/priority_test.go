@@ -0,0 +1,122 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/armon/go-radix"
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func Test_sortRouters(t *testing.T) {
+	tree := radix.New()
+	tree.Insert("/user/info", []*entity.RouterItem{
+		{ID: "a"}, {ID: "b", Priority: 10}, {ID: "c"}, {ID: "d", Priority: 10},
+	})
+	o := &Options{
+		RadixTree: tree,
+		RegRouterList: []*RegRouter{
+			{RegexpStr: "^/user/.*$", Regexp: regexp.MustCompile("^/user/.*$"),
+				ItemList: []*entity.RouterItem{{ID: "r1"}}},
+			{RegexpStr: "^/user/[0-9]+$", Regexp: regexp.MustCompile("^/user/[0-9]+$"),
+				ItemList: []*entity.RouterItem{{ID: "r2"}, {ID: "r3", Priority: 5}}},
+			{RegexpStr: "^/order/.*$", Regexp: regexp.MustCompile("^/order/.*$"),
+				ItemList: []*entity.RouterItem{{ID: "r4"}}},
+		},
+		TemplateRouterList: []*RegRouter{
+			{ItemList: []*entity.RouterItem{{ID: "t1", Priority: -1}}},
+			{ItemList: []*entity.RouterItem{{ID: "t2"}}},
+		},
+	}
+	sortRouters(o)
+
+	v, _ := tree.Get("/user/info")
+	assert.Equal(t, []string{"b", "d", "a", "c"}, routerItemIDs(v.([]*entity.RouterItem)))
+	var regIDs []string
+	for _, r := range o.RegRouterList {
+		regIDs = append(regIDs, routerItemIDs(r.ItemList)...)
+	}
+	assert.Equal(t, []string{"r3", "r2", "r1", "r4"}, regIDs)
+	assert.Equal(t, "t2", o.TemplateRouterList[0].ItemList[0].ID)
+	assert.Equal(t, "t1", o.TemplateRouterList[1].ItemList[0].ID)
+
+	// Empty options
+	sortRouters(&Options{})
+}
+
+func routerItemIDs(list []*entity.RouterItem) []string {
+	var ids []string
+	for _, item := range list {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func Test_overlappingRegRouters(t *testing.T) {
+	newRegRouter := func(expr string) *RegRouter {
+		return &RegRouter{RegexpStr: expr, Regexp: regexp.MustCompile(expr),
+			ItemList: []*entity.RouterItem{{ID: expr}}}
+	}
+	list := []*RegRouter{
+		newRegRouter("^/user/[0-9]+$"),
+		newRegRouter("^/user/.*$"),
+		newRegRouter("^/order/(list|detail)$"),
+		newRegRouter("^/order/[a-z]{3}/info$"),
+	}
+	overlaps := overlappingRegRouters(list)
+	assert.Equal(t, 1, len(overlaps))
+	assert.Contains(t, overlaps[0], `"^/user/[0-9]+$"`)
+	assert.Contains(t, overlaps[0], `"^/user/.*$"`)
+
+	assert.Empty(t, overlappingRegRouters(list[2:]))
+	assert.Empty(t, overlappingRegRouters(nil))
+}
+
+func Test_regexpSamples(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "^/user/info$", want: []string{"/user/info"}},
+		{expr: "^/user/[0-9]+$", want: []string{"/user/0"}},
+		{expr: "^/user/[A-Z]$", want: []string{"/user/A"}},
+		{expr: "^/user/.*$", want: []string{"/user/", "/user/a"}},
+		{expr: "^/user/(a|bc)?$", want: []string{"/user/", "/user/a", "/user/bc"}},
+		{expr: "^/[a-z]{2}$", want: []string{"/aa"}},
+		{expr: "^/[a-z]{0,2}$", want: []string{"/", "/a", "/aa"}},
+		{expr: "(", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			samples := regexpSamples(tt.expr)
+			assert.Equal(t, tt.want, samples)
+			for _, s := range samples {
+				assert.Regexp(t, tt.expr, s)
+			}
+		})
+	}
+	// The number of samples is limited
+	assert.LessOrEqual(t, len(regexpSamples("^(a|b|c|d)(a|b|c|d)(a|b|c|d)$")), maxRegexpSamples)
+}
+
+func Test_sampleRune(t *testing.T) {
+	assert.Equal(t, 'a', sampleRune([]rune{'a', 'z'}))
+	assert.Equal(t, '0', sampleRune([]rune{'0', '9'}))
+	assert.Equal(t, '-', sampleRune([]rune{'-', '-'}))
+	assert.Equal(t, 'a', sampleRune(nil))
+	assert.Equal(t, rune(0x4e00), sampleRune([]rune{0x4e00, 0x9fa5}))
+}
@@ -0,0 +1,49 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/retry"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// initRetry validates the timeouts and parses the retry policies, the timeout and the retry of the router are
+// inherited by the target services that do not configure their own
+func initRetry(item *entity.RouterItem) error {
+	if item.Timeout < 0 {
+		return errs.Newf(gerrs.ErrWrongConfig, "invalid router timeout:%d", item.Timeout)
+	}
+	for _, svr := range item.TargetService {
+		if svr.Timeout < 0 {
+			return errs.Newf(gerrs.ErrWrongConfig, "invalid target service timeout:%d", svr.Timeout)
+		}
+		if svr.Timeout == 0 {
+			svr.Timeout = item.Timeout
+		}
+		if svr.Retry == nil {
+			svr.Retry = item.Retry
+		}
+		if svr.Retry == nil || svr.Retry.Policy != nil {
+			continue
+		}
+		policy, err := retry.NewPolicy(svr.Retry)
+		if err != nil {
+			return gerrs.Wrapf(err, "invalid retry of service:%s", svr.Service)
+		}
+		svr.Retry.Policy = policy
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/retry"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_initRetry(t *testing.T) {
+	svrRetry := &entity.RetryConfig{Attempts: 3}
+	item := &entity.RouterItem{
+		Timeout: 1000,
+		Retry:   &entity.RetryConfig{Attempts: 2},
+		TargetService: []*entity.TargetService{
+			{Service: "a"},
+			{Service: "b", Timeout: 200, Retry: svrRetry},
+		},
+	}
+	assert.Nil(t, initRetry(item))
+	// The timeout and the retry of the router are inherited
+	assert.Equal(t, 1000, item.TargetService[0].Timeout)
+	assert.Equal(t, item.Retry, item.TargetService[0].Retry)
+	assert.IsType(t, &retry.Policy{}, item.Retry.Policy)
+	// The target service configuration takes precedence
+	assert.Equal(t, 200, item.TargetService[1].Timeout)
+	assert.Equal(t, svrRetry, item.TargetService[1].Retry)
+	assert.IsType(t, &retry.Policy{}, svrRetry.Policy)
+
+	item = &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "a"}}}
+	assert.Nil(t, initRetry(item))
+	assert.Nil(t, item.TargetService[0].Retry)
+
+	for _, item := range []*entity.RouterItem{
+		{Timeout: -1},
+		{TargetService: []*entity.TargetService{{Timeout: -1}}},
+		{TargetService: []*entity.TargetService{{Retry: &entity.RetryConfig{RetryOn: []string{"reset"}}}}},
+	} {
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(initRetry(item)))
+	}
+}
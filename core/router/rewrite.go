@@ -0,0 +1,143 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// isRegexpRewrite checks if the rewrite of the regular expression route references the capture groups, such as
+// /article?id=$1 or /article/${id}
+func isRegexpRewrite(item *entity.RouterItem, rewrite string) bool {
+	return item.IsRegexp && item.Regexp != nil && strings.Contains(rewrite, "$")
+}
+
+// expandRegexpRewrite expands the $1 and ${name} references in the rewrite with the submatches of the path
+func expandRegexpRewrite(item *entity.RouterItem, rewrite, path string) (string, bool) {
+	if !isRegexpRewrite(item, rewrite) {
+		return "", false
+	}
+	match := item.Regexp.FindStringSubmatchIndex(path)
+	if match == nil {
+		return "", false
+	}
+	return string(item.Regexp.ExpandString(nil, rewrite, path, match)), true
+}
+
+// checkRegexpRewrite checks if the capture groups referenced by the rewrite exist in the regular expression, $$ is
+// a literal $
+func checkRegexpRewrite(reg *regexp.Regexp, rewrite string) error {
+	names := make(map[string]struct{})
+	for _, name := range reg.SubexpNames() {
+		if name != "" {
+			names[name] = struct{}{}
+		}
+	}
+	for i := 0; i < len(rewrite); i++ {
+		if rewrite[i] != '$' || i+1 == len(rewrite) {
+			continue
+		}
+		i++
+		if rewrite[i] == '$' {
+			continue
+		}
+		var name string
+		if rewrite[i] == '{' {
+			end := strings.IndexByte(rewrite[i:], '}')
+			if end < 0 {
+				return errs.Newf(gerrs.ErrWrongConfig, "unclosed ${ in rewrite:%s", rewrite)
+			}
+			name = rewrite[i+1 : i+end]
+			i += end
+		} else {
+			end := i
+			for end < len(rewrite) && isRewriteNameByte(rewrite[end]) {
+				end++
+			}
+			name = rewrite[i:end]
+			i = end - 1
+		}
+		if name == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			if n > reg.NumSubexp() {
+				return errs.Newf(gerrs.ErrWrongConfig, "capture group $%d of rewrite %s not found in %s", n,
+					rewrite, reg)
+			}
+			continue
+		}
+		if _, ok := names[name]; !ok {
+			return errs.Newf(gerrs.ErrWrongConfig, "capture group ${%s} of rewrite %s not found in %s", name,
+				rewrite, reg)
+		}
+	}
+	return nil
+}
+
+// isRewriteNameByte checks if the byte can be a part of the capture group name
+func isRewriteNameByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// splitRewriteQuery splits the rewrite into the path and the query string, such as /article?id=1.
+// A trailing ? means the original query string is dropped, like the rewrite of nginx.
+func splitRewriteQuery(rewrite string) (path, query string, hasQuery, dropQuery bool) {
+	path, query, hasQuery = strings.Cut(rewrite, "?")
+	if hasQuery && strings.HasSuffix(query, "?") {
+		query, dropQuery = strings.TrimSuffix(query, "?"), true
+	} else if hasQuery && query == "" {
+		dropQuery = true
+	}
+	return path, query, hasQuery, dropQuery
+}
+
+// rewriteQuery sets the query string of the rewrite, the original query string is appended unless it is dropped
+func rewriteQuery(fctx *fasthttp.RequestCtx, query string, dropQuery bool) {
+	uri := fctx.Request.URI()
+	if origin := uri.QueryString(); !dropQuery && len(origin) != 0 {
+		if query != "" {
+			query += "&"
+		}
+		query += string(origin)
+	}
+	uri.SetQueryString(query)
+}
+
+// compileRegexpRouter compiles the method of the regular expression route, and checks the capture groups referenced
+// by the rewrites
+func compileRegexpRouter(item *entity.RouterItem) error {
+	reg, err := regexp.Compile(item.Method)
+	if err != nil {
+		return errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid regexp method:%s", item.Method)
+	}
+	item.Regexp = reg
+	rewrites := []string{item.ReWrite}
+	for _, svr := range item.TargetService {
+		rewrites = append(rewrites, svr.ReWrite)
+	}
+	for _, rewrite := range rewrites {
+		if err := checkRegexpRewrite(reg, rewrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
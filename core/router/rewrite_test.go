@@ -0,0 +1,174 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_compileRegexpRouter(t *testing.T) {
+	item := &entity.RouterItem{
+		Method:   `^/a/(\d+)/(?P<name>\w+)$`,
+		IsRegexp: true,
+		ReWrite:  "/article?id=$1&name=${name}",
+		TargetService: []*entity.TargetService{
+			{Service: "svr", ReWrite: "/b/${2}x"},
+		},
+	}
+	assert.Nil(t, compileRegexpRouter(item))
+	assert.NotNil(t, item.Regexp)
+
+	for _, item := range []*entity.RouterItem{
+		{Method: `^/a/(\d+$`},
+		{Method: `^/a/(\d+)$`, ReWrite: "/b/$2"},
+		{Method: `^/a/(\d+)$`, ReWrite: "/b/${id}"},
+		{Method: `^/a/(\d+)$`, TargetService: []*entity.TargetService{{ReWrite: "/b/${1"}}},
+	} {
+		err := compileRegexpRouter(item)
+		assert.NotNil(t, err, item.Method)
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err), item.Method)
+	}
+}
+
+func Test_checkRegexpRewrite(t *testing.T) {
+	item := &entity.RouterItem{Method: `^/a/(\d+)/(?P<name>\w+)$`}
+	assert.Nil(t, compileRegexpRouter(item))
+	for _, rewrite := range []string{"", "/b", "/b/$1", "/b/$2/${1}x", "/b/${name}", "/b/$$3", "/b/$", "/b/${}"} {
+		assert.Nil(t, checkRegexpRewrite(item.Regexp, rewrite), rewrite)
+	}
+	for _, rewrite := range []string{"/b/$3", "/b/$1x", "/b/${id}", "/b/${1"} {
+		assert.NotNil(t, checkRegexpRewrite(item.Regexp, rewrite), rewrite)
+	}
+}
+
+func Test_expandRegexpRewrite(t *testing.T) {
+	item := &entity.RouterItem{Method: `^/a/(\d+)/(?P<name>\w+)$`, IsRegexp: true}
+	assert.Nil(t, compileRegexpRouter(item))
+
+	got, ok := expandRegexpRewrite(item, "/article?id=$1&name=${name}", "/a/12/foo")
+	assert.True(t, ok)
+	assert.Equal(t, "/article?id=12&name=foo", got)
+
+	got, ok = expandRegexpRewrite(item, "/b/${2}_$1/$$", "/a/12/foo")
+	assert.True(t, ok)
+	assert.Equal(t, "/b/foo_12/$", got)
+
+	// No reference
+	_, ok = expandRegexpRewrite(item, "/b", "/a/12/foo")
+	assert.False(t, ok)
+	// Not matched
+	_, ok = expandRegexpRewrite(item, "/b/$1", "/c/12/foo")
+	assert.False(t, ok)
+	// Not a regular expression route
+	_, ok = expandRegexpRewrite(&entity.RouterItem{Method: "/a/"}, "/b/$1", "/a/12/foo")
+	assert.False(t, ok)
+}
+
+func Test_splitRewriteQuery(t *testing.T) {
+	tests := []struct {
+		rewrite   string
+		path      string
+		query     string
+		hasQuery  bool
+		dropQuery bool
+	}{
+		{rewrite: "/article", path: "/article"},
+		{rewrite: "/article?id=1", path: "/article", query: "id=1", hasQuery: true},
+		{rewrite: "/article?id=1?", path: "/article", query: "id=1", hasQuery: true, dropQuery: true},
+		{rewrite: "/article?", path: "/article", hasQuery: true, dropQuery: true},
+	}
+	for _, tt := range tests {
+		path, query, hasQuery, dropQuery := splitRewriteQuery(tt.rewrite)
+		assert.Equal(t, tt.path, path, tt.rewrite)
+		assert.Equal(t, tt.query, query, tt.rewrite)
+		assert.Equal(t, tt.hasQuery, hasQuery, tt.rewrite)
+		assert.Equal(t, tt.dropQuery, dropQuery, tt.rewrite)
+	}
+}
+
+func Test_rewriteQuery(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/a/1?from=app")
+	rewriteQuery(fctx, "id=1", false)
+	assert.Equal(t, "id=1&from=app", string(fctx.URI().QueryString()))
+
+	fctx.Request.SetRequestURI("/a/1?from=app")
+	rewriteQuery(fctx, "id=1", true)
+	assert.Equal(t, "id=1", string(fctx.URI().QueryString()))
+
+	fctx.Request.SetRequestURI("/a/1?from=app")
+	rewriteQuery(fctx, "", false)
+	assert.Equal(t, "from=app", string(fctx.URI().QueryString()))
+
+	fctx.Request.SetRequestURI("/a/1")
+	rewriteQuery(fctx, "id=1", false)
+	assert.Equal(t, "id=1", string(fctx.URI().QueryString()))
+}
+
+func TestFastHTTPRouter_GetMatchRouter_regexpRewrite(t *testing.T) {
+	items := []*entity.RouterItem{
+		{
+			ID:            "article",
+			Method:        `^/a/(\d+)$`,
+			IsRegexp:      true,
+			ReWrite:       "/article?id=$1",
+			TargetService: []*entity.TargetService{{Service: "svr", Weight: 1}},
+		},
+		{
+			ID:            "user",
+			Method:        `^/u/(?P<uid>\w+)/info$`,
+			IsRegexp:      true,
+			TargetService: []*entity.TargetService{{Service: "svr", Weight: 1, ReWrite: "/user/${uid}?"}},
+		},
+	}
+	opts := &Options{}
+	for _, item := range items {
+		assert.Nil(t, compileRegexpRouter(item))
+		WithRegRouter(item)(opts)
+	}
+	opts.table = newRouteTable(opts)
+	r := NewFastHTTPRouter()
+	r.setOpts(opts)
+
+	tests := []struct {
+		uri            string
+		path           string
+		query          string
+		upstreamMethod string
+	}{
+		{uri: "/a/12", path: "/article", query: "id=12", upstreamMethod: "/article"},
+		{uri: "/a/12?from=app", path: "/article", query: "id=12&from=app", upstreamMethod: "/article"},
+		{uri: "/u/tom/info?from=app", path: "/user/tom", query: "", upstreamMethod: "/user/tom"},
+	}
+	for _, tt := range tests {
+		ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.SetRequestURI(tt.uri)
+		ctx = http.WithRequestContext(ctx, fctx)
+		_, err := r.GetMatchRouter(ctx)
+		assert.Nil(t, err, tt.uri)
+		assert.Equal(t, tt.path, string(fctx.URI().Path()), tt.uri)
+		assert.Equal(t, tt.query, string(fctx.URI().QueryString()), tt.uri)
+		assert.Equal(t, tt.upstreamMethod, gwmsg.GwMessage(ctx).UpstreamMethod(), tt.uri)
+	}
+}
@@ -70,8 +70,18 @@ type Options struct {
 	RadixTree *radix.Tree
 	// RegRouterList is the list of regular routes
 	RegRouterList []*RegRouter
+	// TemplateRouterList is the list of path template routes, the regular expressions are compiled from the templates
+	TemplateRouterList []*RegRouter
 	// Clients is the upstream service configuration
 	Clients map[string]*entity.BackendConfig
+	// DefaultRoute is the catch-all router used when no router matches the path
+	DefaultRoute *entity.RouterItem
+	// NotFound is the response when no router matches the path and there is no default route
+	NotFound *entity.NotFoundConfig
+	// table is the routing table compiled from the routes above, used for request matching
+	table *routeTable
+	// upstream is the circuit breakers and the failover health built by the configuration load
+	upstream *upstreamState
 }
 
 // RegRouter represents a regular route, where multiple route items can match the same regular expression
@@ -129,10 +139,37 @@ func WithRegRouter(item *entity.RouterItem) Option {
 			}
 		}
 		// If it does not exist, add the route
+		reg := item.Regexp
+		if reg == nil {
+			reg = regexp.MustCompile(item.Method)
+		}
 		o.RegRouterList = append(o.RegRouterList, &RegRouter{
 			ItemList:  []*entity.RouterItem{item},
 			RegexpStr: item.Method,
-			Regexp:    regexp.MustCompile(item.Method),
+			Regexp:    reg,
+		})
+	}
+}
+
+// WithTemplateRouter configures the path template router, reg is compiled from the template of the item
+func WithTemplateRouter(item *entity.RouterItem, reg *regexp.Regexp) Option {
+	return func(o *Options) {
+		if item == nil || reg == nil {
+			return
+		}
+		// Iterate and check if the template already exists
+		for _, tmplRouter := range o.TemplateRouterList {
+			// If it already exists, append the new route
+			if tmplRouter.RegexpStr == item.Method {
+				tmplRouter.ItemList = append(tmplRouter.ItemList, item)
+				return
+			}
+		}
+		// If it does not exist, add the route
+		o.TemplateRouterList = append(o.TemplateRouterList, &RegRouter{
+			ItemList:  []*entity.RouterItem{item},
+			RegexpStr: item.Method,
+			Regexp:    reg,
 		})
 	}
 }
@@ -149,3 +186,17 @@ func WithRouterClient(item *entity.BackendConfig) Option {
 		o.Clients[item.ServiceName] = item
 	}
 }
+
+// WithDefaultRoute configures the catch-all router
+func WithDefaultRoute(item *entity.RouterItem) Option {
+	return func(o *Options) {
+		o.DefaultRoute = item
+	}
+}
+
+// WithNotFound configures the response of the requests not found
+func WithNotFound(conf *entity.NotFoundConfig) Option {
+	return func(o *Options) {
+		o.NotFound = conf
+	}
+}
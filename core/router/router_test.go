@@ -74,6 +74,30 @@ func TestWithRegRouter(t *testing.T) {
 	assert.Equal(t, len(o.RegRouterList[0].ItemList), 2)
 }
 
+func TestWithTemplateRouter(t *testing.T) {
+	o := &Options{}
+	// item is nil
+	WithTemplateRouter(nil, nil)(o)
+	assert.Equal(t, len(o.TemplateRouterList), 0)
+
+	routerItem := &entity.RouterItem{
+		Method: "/users/{uid}",
+	}
+	reg, err := compilePathTemplate(routerItem.Method)
+	assert.Nil(t, err)
+	WithTemplateRouter(routerItem, reg)(o)
+	assert.Equal(t, len(o.TemplateRouterList), 1)
+
+	// Same template
+	routerItem2 := &entity.RouterItem{
+		Method: "/users/{uid}",
+		Host:   []string{"r.inews.qq.com"},
+	}
+	WithTemplateRouter(routerItem2, reg)(o)
+	assert.Equal(t, len(o.TemplateRouterList), 1)
+	assert.Equal(t, len(o.TemplateRouterList[0].ItemList), 2)
+}
+
 func TestWithRouterClient(t *testing.T) {
 	o := &Options{}
 	// item is nil
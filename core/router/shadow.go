@@ -0,0 +1,44 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/shadow"
+)
+
+// initShadow validates the traffic shadowing of the router and resolves the shadow service, which is shared by the
+// target services of the router
+func (r *FastHTTPRouter) initShadow(item *entity.RouterItem, clientMap map[string]*entity.BackendConfig) error {
+	if item.Shadow == nil {
+		return nil
+	}
+	if err := shadow.Init(item.Shadow); err != nil {
+		return gerrs.Wrap(err, "invalid shadow")
+	}
+	service, err := r.checkService(clientMap, item.Shadow.Service)
+	if err != nil {
+		return gerrs.Wrap(err, "check shadow service error")
+	}
+	item.Shadow.Target = &entity.TargetService{
+		Service:       item.Shadow.Service,
+		BackendConfig: &service.BackendConfig,
+		Timeout:       item.Shadow.Timeout,
+	}
+	for _, svr := range item.TargetService {
+		svr.Shadow = item.Shadow
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func TestFastHTTPRouter_initShadow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	r := NewFastHTTPRouter()
+	clients := map[string]*entity.BackendConfig{
+		"shadow": {BackendConfig: client.BackendConfig{
+			ServiceName: "shadow",
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}},
+	}
+	item := &entity.RouterItem{
+		Shadow:        &entity.ShadowConfig{Service: "shadow", Percent: 10, Timeout: 100},
+		TargetService: []*entity.TargetService{{Service: "a"}, {Service: "b"}},
+	}
+	assert.Nil(t, r.initShadow(item, clients))
+	assert.Equal(t, "shadow", item.Shadow.Target.BackendConfig.ServiceName)
+	assert.Equal(t, 100, item.Shadow.Target.Timeout)
+	assert.Equal(t, item.Shadow, item.TargetService[0].Shadow)
+	assert.Equal(t, item.Shadow, item.TargetService[1].Shadow)
+
+	item = &entity.RouterItem{TargetService: []*entity.TargetService{{Service: "a"}}}
+	assert.Nil(t, r.initShadow(item, clients))
+	assert.Nil(t, item.TargetService[0].Shadow)
+
+	for _, conf := range []*entity.ShadowConfig{
+		{Service: "shadow"},
+		{Service: "unknown", Percent: 10},
+	} {
+		item := &entity.RouterItem{Shadow: conf}
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(r.initShadow(item, clients)))
+	}
+}
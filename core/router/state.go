@@ -0,0 +1,123 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/breaker"
+)
+
+// breakerKey is the key of the circuit breakers. The circuit breakers of the service scope are shared between the
+// routers of the same upstream service and options, so the router is empty.
+type breakerKey struct {
+	router  string
+	service string
+	opts    breaker.Options
+}
+
+// healthKey is the key of the failover health of the target service of a router
+type healthKey struct {
+	router   string
+	service  string
+	priority int
+}
+
+// upstreamState is the runtime state of the upstream services built by a configuration load. The state of the
+// last load is carried over when the key is unchanged, so that a reload does not close the open circuit breakers
+// or reset the failure counters. A nil state always builds new ones.
+type upstreamState struct {
+	breakers map[breakerKey]*breaker.Breaker
+	health   map[healthKey]*targetHealth
+	// prev is the state of the last load, only used during the load
+	prev *upstreamState
+}
+
+// newUpstreamState creates the state of a configuration load based on the state of the last load
+func newUpstreamState(prev *upstreamState) *upstreamState {
+	return &upstreamState{
+		breakers: make(map[breakerKey]*breaker.Breaker),
+		health:   make(map[healthKey]*targetHealth),
+		prev:     prev,
+	}
+}
+
+// sharedBreaker returns the circuit breaker shared by the key in this load, the one of the last load or a new one
+func (s *upstreamState) sharedBreaker(key breakerKey, name string) *breaker.Breaker {
+	if s == nil {
+		return breaker.New(name, key.opts)
+	}
+	if cb, ok := s.breakers[key]; ok {
+		return cb
+	}
+	cb := s.lastBreaker(key)
+	if cb == nil {
+		cb = breaker.New(name, key.opts)
+	}
+	s.breakers[key] = cb
+	return cb
+}
+
+// ownBreaker returns the circuit breaker of the last load or a new one, which is not shared in this load
+func (s *upstreamState) ownBreaker(key breakerKey, name string) *breaker.Breaker {
+	if s == nil {
+		return breaker.New(name, key.opts)
+	}
+	if _, ok := s.breakers[key]; ok {
+		// Another router of the same name has claimed it
+		return breaker.New(name, key.opts)
+	}
+	cb := s.lastBreaker(key)
+	if cb == nil {
+		cb = breaker.New(name, key.opts)
+	}
+	s.breakers[key] = cb
+	return cb
+}
+
+// lastBreaker returns the circuit breaker of the last load, nil if not found
+func (s *upstreamState) lastBreaker(key breakerKey) *breaker.Breaker {
+	if s.prev == nil {
+		return nil
+	}
+	return s.prev.breakers[key]
+}
+
+// targetHealth returns the failover health of the target service of the last load or a new one, which is not
+// shared in this load
+func (s *upstreamState) targetHealth(item *entity.RouterItem, svr *entity.TargetService) *targetHealth {
+	if s == nil {
+		return &targetHealth{}
+	}
+	key := healthKey{router: routerName(item), service: svr.Service, priority: svr.Priority}
+	if _, ok := s.health[key]; ok {
+		return &targetHealth{}
+	}
+	var health *targetHealth
+	if s.prev != nil {
+		health = s.prev.health[key]
+	}
+	if health == nil {
+		health = &targetHealth{}
+	}
+	s.health[key] = health
+	return health
+}
+
+// routerName returns the ID of the router, or the method if the ID is not configured
+func routerName(item *entity.RouterItem) string {
+	if item.ID != "" {
+		return item.ID
+	}
+	return item.Method
+}
@@ -0,0 +1,149 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// defaultStickyCookieName is the default name of the sticky target cookie
+const defaultStickyCookieName = "gw_sticky"
+
+// checkSticky validates the sticky configuration of the router item, and sets the default cookie name
+func checkSticky(item *entity.RouterItem) error {
+	sticky := item.Sticky
+	if sticky == nil {
+		return nil
+	}
+	if item.HashKey != "" {
+		return errs.New(gerrs.ErrWrongConfig, "sticky can not be used with hash key")
+	}
+	if sticky.SignKey == "" {
+		return errs.New(gerrs.ErrWrongConfig, "empty sign key of sticky")
+	}
+	if sticky.TTL < 0 {
+		return errs.Newf(gerrs.ErrWrongConfig, "invalid ttl of sticky:%d", sticky.TTL)
+	}
+	if sticky.CookieName == "" {
+		sticky.CookieName = defaultStickyCookieName
+	}
+	return nil
+}
+
+// getStickyServiceName Get the target service named by the sticky cookie; if there is no valid cookie, select the
+// target service through the grey strategy and issue the cookie naming it
+func (r *FastHTTPRouter) getStickyServiceName(ctx context.Context, fctx *fasthttp.RequestCtx,
+	routerItem *entity.RouterItem) (*entity.TargetService, error) {
+	sticky, svrs := routerItem.Sticky, routerItem.TargetService
+	// No need to be sticky if there is only one service
+	if sticky == nil || len(svrs) <= 1 {
+		return r.getGreyServiceName(fctx, routerItem)
+	}
+	if svr := stickyTarget(fctx, sticky, svrs); svr != nil && isActiveTarget(routerItem, svr) {
+		return svr, nil
+	}
+	svr, err := r.getGreyServiceName(fctx, routerItem)
+	if err != nil {
+		return nil, err
+	}
+	ids := targetIDs(svrs)
+	for i, s := range svrs {
+		if s == svr {
+			gwmsg.GwMessage(ctx).WithRspCookie(stickyCookie(sticky, ids[i]))
+			break
+		}
+	}
+	return svr, nil
+}
+
+// stickyTarget returns the target service named by the signed cookie, nil is returned if the cookie is absent or
+// invalid, or the target service no longer exists or has zero weight
+func stickyTarget(fctx *fasthttp.RequestCtx, sticky *entity.StickyConfig,
+	svrs []*entity.TargetService) *entity.TargetService {
+	value := fctx.Request.Header.Cookie(sticky.CookieName)
+	if len(value) == 0 {
+		return nil
+	}
+	id, ok := verifyStickyValue(sticky, string(value))
+	if !ok {
+		return nil
+	}
+	for i, targetID := range targetIDs(svrs) {
+		if targetID == id && svrs[i].Weight > 0 {
+			return svrs[i]
+		}
+	}
+	return nil
+}
+
+// stickyCookie returns the Set-Cookie header value naming the target service
+func stickyCookie(sticky *entity.StickyConfig, id string) string {
+	c := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(c)
+	c.SetKey(sticky.CookieName)
+	c.SetValue(signStickyValue(sticky, id))
+	c.SetPath("/")
+	c.SetHTTPOnly(true)
+	if sticky.TTL > 0 {
+		c.SetMaxAge(sticky.TTL)
+	}
+	return c.String()
+}
+
+// signStickyValue returns the cookie value, which is the encoded target service identity and its signature joined by
+// a dot
+func signStickyValue(sticky *entity.StickyConfig, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id)) + "." +
+		base64.RawURLEncoding.EncodeToString(stickySignature(sticky, id))
+}
+
+// verifyStickyValue verifies the signature of the cookie value, and returns the target service identity
+func verifyStickyValue(sticky *entity.StickyConfig, value string) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 {
+		return "", false
+	}
+	id, err := base64.RawURLEncoding.DecodeString(value[:i])
+	if err != nil {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal(sig, stickySignature(sticky, string(id))) {
+		return "", false
+	}
+	return string(id), true
+}
+
+// stickySignature signs the target service identity with the cookie name, so that the cookie can not be used as the
+// cookie of another name
+func stickySignature(sticky *entity.StickyConfig, id string) []byte {
+	mac := hmac.New(sha256.New, []byte(sticky.SignKey))
+	_, _ = mac.Write([]byte(sticky.CookieName))
+	_, _ = mac.Write([]byte{0})
+	_, _ = mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,148 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_checkSticky(t *testing.T) {
+	assert.Nil(t, checkSticky(&entity.RouterItem{}))
+
+	item := &entity.RouterItem{Sticky: &entity.StickyConfig{SignKey: "key"}}
+	assert.Nil(t, checkSticky(item))
+	assert.Equal(t, defaultStickyCookieName, item.Sticky.CookieName)
+
+	for _, item := range []*entity.RouterItem{
+		{Sticky: &entity.StickyConfig{}},
+		{Sticky: &entity.StickyConfig{SignKey: "key", TTL: -1}},
+		{Sticky: &entity.StickyConfig{SignKey: "key"}, HashKey: "devid"},
+	} {
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(checkSticky(item)))
+	}
+}
+
+func TestFastHTTPRouter_getStickyServiceName(t *testing.T) {
+	r := NewFastHTTPRouter()
+	item := &entity.RouterItem{
+		Sticky: &entity.StickyConfig{CookieName: "sticky", TTL: 60, SignKey: "key"},
+		TargetService: []*entity.TargetService{
+			{Service: "target.service.a", Weight: 1},
+			{Service: "target.service.b", Weight: 1},
+		},
+	}
+	newRequest := func(cookie string) (context.Context, *fasthttp.RequestCtx) {
+		ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+		fctx := &fasthttp.RequestCtx{}
+		if cookie != "" {
+			fctx.Request.Header.SetCookie(item.Sticky.CookieName, cookie)
+		}
+		return ctx, fctx
+	}
+
+	// The first selection issues the cookie
+	ctx, fctx := newRequest("")
+	first, err := r.getStickyServiceName(ctx, fctx, item)
+	assert.Nil(t, err)
+	cookies := gwmsg.GwMessage(ctx).RspCookies()
+	assert.Equal(t, 1, len(cookies))
+	c := &fasthttp.Cookie{}
+	assert.Nil(t, c.Parse(cookies[0]))
+	assert.Equal(t, "sticky", string(c.Key()))
+	assert.Equal(t, 60, c.MaxAge())
+	assert.True(t, c.HTTPOnly())
+	assert.Equal(t, "/", string(c.Path()))
+
+	// Later requests honor the cookie
+	for i := 0; i < 20; i++ {
+		ctx, fctx = newRequest(string(c.Value()))
+		svr, err := r.getStickyServiceName(ctx, fctx, item)
+		assert.Nil(t, err)
+		assert.Equal(t, first, svr)
+		assert.Empty(t, gwmsg.GwMessage(ctx).RspCookies())
+	}
+
+	// Re-pick if the target service has zero weight
+	first.Weight = 0
+	ctx, fctx = newRequest(string(c.Value()))
+	svr, err := r.getStickyServiceName(ctx, fctx, item)
+	assert.Nil(t, err)
+	assert.NotEqual(t, first, svr)
+	assert.Equal(t, 1, len(gwmsg.GwMessage(ctx).RspCookies()))
+	first.Weight = 1
+
+	// Tampered cookie is ignored
+	value := string(c.Value())
+	other := signStickyValue(item.Sticky, "target.service.c")
+	ctx, fctx = newRequest(value[:strings.LastIndexByte(value, '.')] + other[strings.LastIndexByte(other, '.'):])
+	_, err = r.getStickyServiceName(ctx, fctx, item)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gwmsg.GwMessage(ctx).RspCookies()))
+
+	// No cookie for a single target service
+	single := &entity.RouterItem{Sticky: item.Sticky, TargetService: item.TargetService[:1]}
+	ctx, fctx = newRequest("")
+	svr, err = r.getStickyServiceName(ctx, fctx, single)
+	assert.Nil(t, err)
+	assert.Equal(t, item.TargetService[0], svr)
+	assert.Empty(t, gwmsg.GwMessage(ctx).RspCookies())
+
+	// Invalid weights
+	invalid := &entity.RouterItem{Sticky: item.Sticky, TargetService: []*entity.TargetService{{}, {}}}
+	ctx, fctx = newRequest("")
+	_, err = r.getStickyServiceName(ctx, fctx, invalid)
+	assert.Equal(t, gerrs.ErrTargetServiceNotFound, errs.Code(err))
+}
+
+func Test_stickyTarget(t *testing.T) {
+	sticky := &entity.StickyConfig{CookieName: "sticky", SignKey: "key"}
+	svrs := []*entity.TargetService{
+		{Service: "target.service.a", Weight: 1},
+		{Service: "target.service.a", Weight: 1},
+	}
+	fctx := &fasthttp.RequestCtx{}
+	// Duplicated services are identified by their occurrence
+	fctx.Request.Header.SetCookie("sticky", signStickyValue(sticky, "target.service.a#1"))
+	assert.Equal(t, svrs[1], stickyTarget(fctx, sticky, svrs))
+	// The target service no longer exists
+	assert.Nil(t, stickyTarget(fctx, sticky, svrs[:1]))
+	// Signed by another key
+	fctx.Request.Header.SetCookie("sticky", signStickyValue(&entity.StickyConfig{CookieName: "sticky",
+		SignKey: "other"}, "target.service.a"))
+	assert.Nil(t, stickyTarget(fctx, sticky, svrs))
+	// Signed for another cookie name
+	fctx.Request.Header.SetCookie("sticky", signStickyValue(&entity.StickyConfig{CookieName: "other",
+		SignKey: "key"}, "target.service.a"))
+	assert.Nil(t, stickyTarget(fctx, sticky, svrs))
+}
+
+func Test_verifyStickyValue(t *testing.T) {
+	sticky := &entity.StickyConfig{CookieName: "sticky", SignKey: "key"}
+	id, ok := verifyStickyValue(sticky, signStickyValue(sticky, "target.service.a"))
+	assert.True(t, ok)
+	assert.Equal(t, "target.service.a", id)
+	for _, value := range []string{"", "abc", "!.abc", "YQ.!", "YQ.YQ"} {
+		_, ok = verifyStickyValue(sticky, value)
+		assert.False(t, ok, value)
+	}
+}
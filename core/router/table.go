@@ -0,0 +1,292 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+
+	"github.com/armon/go-radix"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/convert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// routeTable is the routing table compiled from the options, it is immutable after being built and is swapped
+// atomically with the options, so the lookup does not need any lock. The exact and prefix routes are looked up in a
+// map and a radix tree, while the path template and regular expression routes are checked one by one in the order of
+// priority; a regular expression is only run if the path has its literal prefix. The router items of each path are
+// grouped by host and HTTP method in advance.
+type routeTable struct {
+	// exact is the router nodes of the exact and prefix routes, indexed by path
+	exact map[string]*routeNode
+	// tree is the radix tree of the exact and prefix routes, used for the longest prefix matching
+	tree *radix.Tree
+	// templates is the path template routes, in the order of priority
+	templates []*regRouteNode
+	// regexps is the regular expression routes, in the order of priority, checked one by one
+	regexps []*regRouteNode
+}
+
+// regRouteNode is the compiled regular expression route
+type regRouteNode struct {
+	*regexp.Regexp
+	// prefix is the literal prefix of the anchored regular expression, such as /user/ for ^/user/[0-9]+$. The path
+	// without the prefix is skipped without running the regular expression.
+	prefix string
+	node   *routeNode
+}
+
+// routeNode is the router items of the same path, pre-filtered by host and HTTP method
+type routeNode struct {
+	// items is all the router items, in the order of priority
+	items []*entity.RouterItem
+	// hosts is the router items of each exact host
+	hosts map[string]*itemSet
+	// wildcards is the router items of each wildcard host suffix, such as .example.com
+	wildcards map[string]*itemSet
+	// hostRegexps is the router items configured with regex hosts
+	hostRegexps []*entity.RouterItem
+	// noHost is the router items without a configured host
+	noHost *itemSet
+	// hasHost indicates whether any router item is configured with host
+	hasHost bool
+}
+
+// itemSet is the router items pre-filtered by HTTP method
+type itemSet struct {
+	// methods is the router items of each configured HTTP method
+	methods map[string][]*entity.RouterItem
+	// anyMethod is the router items without a configured HTTP method
+	anyMethod []*entity.RouterItem
+	// allow is the value of the Allow header when no HTTP method is matched
+	allow string
+}
+
+// newRouteTable compiles the routing table from the options, the router items must be sorted already
+func newRouteTable(o *Options) *routeTable {
+	t := &routeTable{
+		exact: make(map[string]*routeNode),
+		tree:  radix.New(),
+	}
+	if o.RadixTree != nil {
+		o.RadixTree.Walk(func(path string, v interface{}) bool {
+			if list, ok := v.([]*entity.RouterItem); ok {
+				node := newRouteNode(list)
+				t.exact[path] = node
+				t.tree.Insert(path, node)
+			}
+			return false
+		})
+	}
+	for _, r := range o.TemplateRouterList {
+		t.templates = append(t.templates, &regRouteNode{Regexp: r.Regexp, node: newRouteNode(r.ItemList)})
+	}
+	for _, r := range o.RegRouterList {
+		t.regexps = append(t.regexps, &regRouteNode{
+			Regexp: r.Regexp,
+			prefix: anchoredLiteralPrefix(r.Regexp.String()),
+			node:   newRouteNode(r.ItemList),
+		})
+	}
+	return t
+}
+
+// anchoredLiteralPrefix returns the literal prefix that any string matched by the regular expression must begin
+// with, such as /user/ for ^/user/[0-9]+$. Empty is returned if the regular expression is not anchored at the
+// beginning or is case-insensitive.
+func anchoredLiteralPrefix(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	if lit := re.Sub[1]; lit.Op == syntax.OpLiteral && lit.Flags&syntax.FoldCase == 0 {
+		return string(lit.Rune)
+	}
+	return ""
+}
+
+// newRouteNode groups the router items of the same path by host and HTTP method
+func newRouteNode(list []*entity.RouterItem) *routeNode {
+	n := &routeNode{items: list}
+	hosts := make(map[string][]*entity.RouterItem)
+	wildcards := make(map[string][]*entity.RouterItem)
+	var noHost []*entity.RouterItem
+	for _, item := range list {
+		if !hasHost(item) {
+			noHost = append(noHost, item)
+			continue
+		}
+		n.hasHost = true
+		for host := range item.HostMap {
+			hosts[host] = append(hosts[host], item)
+		}
+		for _, suffix := range item.HostWildcards {
+			if l := wildcards[suffix]; len(l) == 0 || l[len(l)-1] != item {
+				wildcards[suffix] = append(l, item)
+			}
+		}
+		if len(item.HostRegexps) != 0 {
+			n.hostRegexps = append(n.hostRegexps, item)
+		}
+	}
+	n.hosts = newItemSets(hosts)
+	n.wildcards = newItemSets(wildcards)
+	if len(noHost) != 0 {
+		n.noHost = newItemSet(noHost)
+	}
+	return n
+}
+
+// newItemSets creates the item sets of the grouped router items
+func newItemSets(m map[string][]*entity.RouterItem) map[string]*itemSet {
+	if len(m) == 0 {
+		return nil
+	}
+	sets := make(map[string]*itemSet, len(m))
+	for k, list := range m {
+		sets[k] = newItemSet(list)
+	}
+	return sets
+}
+
+// newItemSet groups the router items by HTTP method
+func newItemSet(list []*entity.RouterItem) *itemSet {
+	s := &itemSet{}
+	for _, item := range list {
+		if len(item.HTTPMethodMap) == 0 {
+			s.anyMethod = append(s.anyMethod, item)
+			continue
+		}
+		if s.methods == nil {
+			s.methods = make(map[string][]*entity.RouterItem)
+		}
+		for method := range item.HTTPMethodMap {
+			s.methods[method] = append(s.methods[method], item)
+		}
+	}
+	// The router items without a configured HTTP method follow the items of each HTTP method, so that they are
+	// matched when none of the rules of the items of the HTTP method matches
+	if len(s.anyMethod) != 0 {
+		for method, items := range s.methods {
+			s.methods[method] = append(items[:len(items):len(items)], s.anyMethod...)
+		}
+	}
+	s.allow = allowedHTTPMethods(list)
+	return s
+}
+
+// match matches the router node by path
+// 1. First match with exact routes
+// 2. Then match with path template routes, the captured values are stored on the request
+// 3. Then match with longest prefix routes
+// 4. Iterate through all regular expression routes
+func (t *routeTable) match(fctx *fasthttp.RequestCtx) (*routeNode, error) {
+	if t == nil {
+		return nil, errs.New(gerrs.ErrPathNotFound, "no router configured")
+	}
+	pathBytes := fctx.Path()
+	// Exact route matching, the conversion of the map key does not allocate memory
+	if node, ok := t.exact[string(pathBytes)]; ok {
+		return node, nil
+	}
+
+	// Path template route matching, the path is copied since the captured values are kept on the request
+	if len(t.templates) != 0 {
+		path := string(pathBytes)
+		for _, r := range t.templates {
+			if params, ok := matchPathTemplate(r.Regexp, path); ok {
+				http.WithPathParams(fctx, params)
+				return r.node, nil
+			}
+		}
+	}
+
+	// Longest prefix route matching, the path is only used during the lookup, so it is not copied
+	longestPrefix, v, ok := t.tree.LongestPrefix(convert.BytesToString(pathBytes))
+	if ok && longestPrefix != "/" && strings.HasSuffix(longestPrefix, "/") {
+		return v.(*routeNode), nil
+	}
+
+	// Regular expression route matching, in the order of priority, then configuration
+	path := convert.BytesToString(pathBytes)
+	for _, r := range t.regexps {
+		if strings.HasPrefix(path, r.prefix) && r.MatchString(path) {
+			return r.node, nil
+		}
+	}
+	return nil, errs.New(gerrs.ErrPathNotFound, "no router matched")
+}
+
+// matchHost returns the router items that match the host best; if no match is found, return the router items
+// without a configured host. The precedence is: exact host > wildcard host (the longest one first) > regex host >
+// no host. The port of the request host is ignored.
+func (n *routeNode) matchHost(hostBytes []byte) (*itemSet, error) {
+	if !n.hasHost {
+		return n.noHost, nil
+	}
+	host := normalizeHost(convert.BytesToString(hostBytes))
+	if s, ok := n.hosts[host]; ok {
+		return s, nil
+	}
+	// The longest wildcard suffix is checked first, and the suffix must not be the whole host
+	if len(n.wildcards) != 0 {
+		for i := 1; i < len(host); i++ {
+			if host[i] != '.' {
+				continue
+			}
+			if s, ok := n.wildcards[host[i:]]; ok {
+				return s, nil
+			}
+		}
+	}
+	// Regex hosts are rarely used, so the matched items are grouped on demand
+	var regexpMatchList []*entity.RouterItem
+	for _, item := range n.hostRegexps {
+		if level, _ := matchHost(item, host); level == hostMatchRegexp {
+			regexpMatchList = append(regexpMatchList, item)
+		}
+	}
+	if len(regexpMatchList) != 0 {
+		return newItemSet(regexpMatchList), nil
+	}
+	// Use the router items without a configured host as a fallback
+	if n.noHost != nil {
+		return n.noHost, nil
+	}
+	return nil, errs.New(gerrs.ErrPathNotFound, "no host match router item found")
+}
+
+// matchMethod returns all router items configured with the HTTP method followed by the router items without a
+// configured HTTP method; if no match is found, return the router items without a configured HTTP method. If the
+// path matches but no HTTP method does, the Allow header is set and ErrMethodNotAllowed is returned.
+func (s *itemSet) matchMethod(fctx *fasthttp.RequestCtx) ([]*entity.RouterItem, error) {
+	if list, ok := s.methods[string(fctx.Method())]; ok {
+		return list, nil
+	}
+	// Use the router items without a configured HTTP method as a fallback
+	if len(s.anyMethod) != 0 {
+		return s.anyMethod, nil
+	}
+	fctx.Response.Header.Set(fasthttp.HeaderAllow, s.allow)
+	return nil, errs.Newf(gerrs.ErrMethodNotAllowed, "http method %s not allowed", fctx.Method())
+}
@@ -0,0 +1,395 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"gopkg.in/yaml.v3"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/rule"
+	cprotocol "trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_routeTable_match(t *testing.T) {
+	o := &Options{}
+	for _, item := range []*entity.RouterItem{
+		{ID: "exact", Method: "/user/info"},
+		{ID: "prefix", Method: "/user/"},
+		{ID: "not_prefix", Method: "/user/in"},
+	} {
+		WithRadixTreeRouter(item)(o)
+	}
+	reg, err := compilePathTemplate("/users/{uid}")
+	assert.Nil(t, err)
+	WithTemplateRouter(&entity.RouterItem{ID: "template", Method: "/users/{uid}"}, reg)(o)
+	WithRegRouter(&entity.RouterItem{ID: "regexp", Method: "^/feed/[a-z]+$", IsRegexp: true})(o)
+	WithRegRouter(&entity.RouterItem{ID: "regexp2", Method: "^/(?i)video/[0-9]+$", IsRegexp: true})(o)
+	table := newRouteTable(o)
+	assert.Equal(t, "/feed/", table.regexps[0].prefix)
+	assert.Equal(t, "/", table.regexps[1].prefix)
+
+	tests := []struct {
+		path   string
+		wantID string
+	}{
+		{path: "/user/info", wantID: "exact"},
+		{path: "/user/", wantID: "prefix"},
+		{path: "/user/ext", wantID: "prefix"},
+		{path: "/users/u1", wantID: "template"},
+		{path: "/feed/flow", wantID: "regexp"},
+		{path: "/VIDEO/1", wantID: "regexp2"},
+		// The longest prefix does not end with "/", so the shorter prefix route is not matched
+		{path: "/user/info2", wantID: ""},
+		{path: "/feed/1", wantID: ""},
+		{path: "/", wantID: ""},
+	}
+	for _, tt := range tests {
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.SetRequestURI(tt.path)
+		node, err := table.match(fctx)
+		if tt.wantID == "" {
+			assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err), tt.path)
+			continue
+		}
+		assert.Nil(t, err, tt.path)
+		assert.Equal(t, tt.wantID, node.items[0].ID, tt.path)
+	}
+
+	// Captured values of the path template
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/users/u1")
+	_, err = table.match(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "u1", http.PathParam(fctx, "uid"))
+
+	// The routing table is not compiled
+	var nilTable *routeTable
+	_, err = nilTable.match(fctx)
+	assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err))
+	_, err = NewFastHTTPRouter().matchRouterItem(fctx)
+	assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err))
+}
+
+func Test_anchoredLiteralPrefix(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "^/user/[0-9]+$", want: "/user/"},
+		{expr: "^/user/info$", want: "/user/info"},
+		{expr: "^/(user|order)/info$", want: "/"},
+		{expr: "/user/[0-9]+$", want: ""},
+		{expr: "(?i)^/user/", want: ""},
+		{expr: "^[a-z]+$", want: ""},
+		{expr: "(", want: ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, anchoredLiteralPrefix(tt.expr), tt.expr)
+	}
+}
+
+func Test_routeNode_matchHost(t *testing.T) {
+	items := []*entity.RouterItem{
+		{ID: "no_host"},
+		{ID: "regexp", Host: []string{"~^[a-z]+\\.inews\\.qq\\.com$"}},
+		{ID: "wildcard", Host: []string{"*.qq.com"}},
+		{ID: "long_wildcard", Host: []string{"*.inews.qq.com"}},
+		{ID: "exact", Host: []string{"r.inews.qq.com"}},
+		{ID: "exact2", Host: []string{"R.inews.qq.com:8080"}},
+	}
+	for _, item := range items {
+		assert.Nil(t, parseHosts(item))
+	}
+	ids := func(list []*entity.RouterItem) []string {
+		var ret []string
+		for _, item := range list {
+			ret = append(ret, item.ID)
+		}
+		return ret
+	}
+	tests := []struct {
+		host string
+		want []string
+	}{
+		{host: "r.inews.qq.com", want: []string{"exact", "exact2"}},
+		{host: "R.INEWS.QQ.COM:443", want: []string{"exact", "exact2"}},
+		{host: "w.inews.qq.com", want: []string{"long_wildcard"}},
+		{host: "w.qq.com", want: []string{"wildcard"}},
+		{host: "qq.com", want: []string{"no_host"}},
+		{host: "", want: []string{"no_host"}},
+	}
+	for _, tt := range tests {
+		set, err := newRouteNode(items).matchHost([]byte(tt.host))
+		assert.Nil(t, err, tt.host)
+		assert.Equal(t, tt.want, ids(set.anyMethod), tt.host)
+	}
+
+	// Regex host takes precedence over no host
+	set, err := newRouteNode(items[:2]).matchHost([]byte("w.inews.qq.com"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"regexp"}, ids(set.anyMethod))
+
+	// No host matched and no router item without host
+	_, err = newRouteNode(items[1:]).matchHost([]byte("qq.com"))
+	assert.Equal(t, gerrs.ErrPathNotFound, errs.Code(err))
+}
+
+func Test_itemSet_matchMethod(t *testing.T) {
+	items := []*entity.RouterItem{
+		{ID: "get", HTTPMethodMap: map[string]struct{}{fasthttp.MethodGet: {}}},
+		{ID: "get_post", HTTPMethodMap: map[string]struct{}{fasthttp.MethodGet: {}, fasthttp.MethodPost: {}}},
+	}
+	set := newItemSet(items)
+	fctx := &fasthttp.RequestCtx{}
+	list, err := set.matchMethod(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, items, list)
+
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	list, err = set.matchMethod(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, items[1:], list)
+
+	fctx.Request.Header.SetMethod(fasthttp.MethodPut)
+	_, err = set.matchMethod(fctx)
+	assert.Equal(t, gerrs.ErrMethodNotAllowed, errs.Code(err))
+	assert.Equal(t, "GET, POST", string(fctx.Response.Header.Peek(fasthttp.HeaderAllow)))
+
+	// Router items without HTTP method are the fallback
+	set = newItemSet(append(items, &entity.RouterItem{ID: "any"}))
+	list, err = set.matchMethod(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "any", list[0].ID)
+
+	// Router items without HTTP method follow the items of the HTTP method
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	list, err = set.matchMethod(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"get_post", "any"}, []string{list[0].ID, list[1].ID})
+	assert.Equal(t, 3, len(set.methods[fasthttp.MethodGet]))
+}
+
+func TestFastHTTPRouter_getExactRouterItem_anyMethod(t *testing.T) {
+	items := []*entity.RouterItem{
+		{ID: "get", Method: "/user/info", HTTPMethods: []string{fasthttp.MethodGet}, Rule: &entity.RuleItem{
+			Conditions: []*entity.Condition{{Key: "header:x-uid", Val: "1", Oper: "=="}},
+			Expression: "0",
+		}},
+		{ID: "any", Method: "/user/info"},
+	}
+	o := &Options{}
+	for _, item := range items {
+		item.HTTPMethodMap = map[string]struct{}{}
+		for _, m := range item.HTTPMethods {
+			item.HTTPMethodMap[m] = struct{}{}
+		}
+		if item.Rule != nil {
+			assert.Nil(t, rule.FormatRule(item.Rule))
+		}
+		WithRadixTreeRouter(item)(o)
+	}
+	r := NewFastHTTPRouter()
+	sortRouters(o)
+	o.table = newRouteTable(o)
+	r.setOpts(o)
+
+	// The GET request matching the rule
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/user/info")
+	fctx.Request.Header.Set("x-uid", "1")
+	item, err := r.matchRouter(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "get", item.ID)
+
+	// The GET request not matching the rule falls back to the router item without HTTP method
+	fctx = &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/user/info")
+	item, err = r.matchRouter(fctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "any", item.ID)
+}
+
+func TestFastHTTPRouter_lookupAllocs(t *testing.T) {
+	items := []*entity.RouterItem{
+		{ID: "exact", Method: "/user/info", Host: []string{"r.inews.qq.com"}, HTTPMethods: []string{"GET"}},
+		{ID: "rule", Method: "/user/info", Host: []string{"*.qq.com"}, Rule: &entity.RuleItem{
+			Conditions: []*entity.Condition{{Key: "header:x-uid", Val: "1,2", Oper: "in"}},
+			Expression: "0",
+		}},
+		{ID: "prefix", Method: "/user/"},
+		{ID: "regexp", Method: "^/feed/[a-z]+$", IsRegexp: true},
+	}
+	o := &Options{}
+	for _, item := range items {
+		assert.Nil(t, parseHosts(item))
+		item.HTTPMethodMap = map[string]struct{}{}
+		for _, m := range item.HTTPMethods {
+			item.HTTPMethodMap[m] = struct{}{}
+		}
+		if item.Rule != nil {
+			assert.Nil(t, rule.FormatRule(item.Rule))
+		}
+		if item.IsRegexp {
+			WithRegRouter(item)(o)
+			continue
+		}
+		WithRadixTreeRouter(item)(o)
+	}
+	r := NewFastHTTPRouter()
+	sortRouters(o)
+	o.table = newRouteTable(o)
+	r.setOpts(o)
+
+	tests := []struct {
+		uri    string
+		host   string
+		wantID string
+	}{
+		{uri: "/user/info", host: "r.inews.qq.com", wantID: "exact"},
+		{uri: "/user/info", host: "w.inews.qq.com:8080", wantID: "rule"},
+		{uri: "/user/ext", host: "w.inews.qq.com", wantID: "prefix"},
+		{uri: "/feed/flow", wantID: "regexp"},
+	}
+	for _, tt := range tests {
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.SetRequestURI(tt.uri)
+		fctx.Request.SetHost(tt.host)
+		fctx.Request.Header.Set("x-uid", "2")
+		item, err := lookup(r, fctx)
+		assert.Nil(t, err, tt.uri)
+		assert.Equal(t, tt.wantID, item.ID, tt.uri)
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = lookup(r, fctx)
+		})
+		assert.Equal(t, 0.0, allocs, tt.uri)
+	}
+}
+
+// lookup matches the router item by path, host, HTTP method and rule
+func lookup(r *FastHTTPRouter, fctx *fasthttp.RequestCtx) (*entity.RouterItem, error) {
+	node, err := r.matchRouterItem(fctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.getExactRouterItem(fctx, node)
+}
+
+// newBenchmarkRouter creates the router with the configuration file
+func newBenchmarkRouter(b *testing.B, file string) *FastHTTPRouter {
+	ctrl := gomock.NewController(b)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	cprotocol.RegisterCliProtocolHandler("trpc", mock.NewMockCliProtocolHandler(ctrl))
+	confBytes, err := os.ReadFile(file)
+	assert.Nil(b, err)
+	var proxyConfig entity.ProxyConfig
+	assert.Nil(b, yaml.Unmarshal(confBytes, &proxyConfig))
+	for _, item := range proxyConfig.Router {
+		// The plugins are not registered in the benchmark
+		item.Plugins = nil
+	}
+	r := NewFastHTTPRouter()
+	assert.Nil(b, r.InitRouterConfig(context.Background(), &proxyConfig))
+	return r
+}
+
+func benchmarkLookup(b *testing.B, r *FastHTTPRouter, uri, host string, wantErr bool) {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI(uri)
+	fctx.Request.SetHost(host)
+	_, err := lookup(r, fctx)
+	assert.Equal(b, wantErr, err != nil, uri)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = lookup(r, fctx)
+	}
+}
+
+func BenchmarkFastHTTPRouter_lookup(b *testing.B) {
+	r := newBenchmarkRouter(b, "../../testdata/routerbenchmark.yaml")
+	b.Run("exact", func(b *testing.B) {
+		benchmarkLookup(b, r, "/getCommentUserInfo", "", false)
+	})
+	b.Run("exact_host", func(b *testing.B) {
+		benchmarkLookup(b, r, "/v1/creation/user_ext_info", "test.shizi.qq.com", false)
+	})
+	b.Run("prefix", func(b *testing.B) {
+		benchmarkLookup(b, r, "/gw/msg/list", "", false)
+	})
+	b.Run("regexp", func(b *testing.B) {
+		benchmarkLookup(b, r, "/updateCollList", "", false)
+	})
+	b.Run("not_found", func(b *testing.B) {
+		benchmarkLookup(b, r, "/invalid", "", true)
+	})
+}
+
+func BenchmarkFastHTTPRouter_lookupRegexp(b *testing.B) {
+	r := newBenchmarkRouter(b, "../../testdata/routerbenchmarkregexp.yaml")
+	b.Run("regexp", func(b *testing.B) {
+		benchmarkLookup(b, r, "/gw/msg/list", "", false)
+	})
+	b.Run("not_found", func(b *testing.B) {
+		benchmarkLookup(b, r, "/invalid", "", true)
+	})
+}
+
+func BenchmarkFastHTTPRouter_lookupLargeTable(b *testing.B) {
+	ctrl := gomock.NewController(b)
+	cprotocol.RegisterCliProtocolHandler("fasthttp", mock.NewMockCliProtocolHandler(ctrl))
+	proxyConfig := &entity.ProxyConfig{
+		Client: []*entity.BackendConfig{
+			{BackendConfig: client.BackendConfig{ServiceName: "trpc.test.service", Network: "tcp",
+				Target: "ip://127.0.0.1:8000", Protocol: "fasthttp"}},
+		},
+	}
+	// 20000 exact routes, each with 5 hosts, and 1000 prefix routes
+	for i := 0; i < 20000; i++ {
+		proxyConfig.Router = append(proxyConfig.Router, &entity.RouterItem{
+			Method: fmt.Sprintf("/api/v1/service%d/method%d", i%1000, i),
+			Host: []string{fmt.Sprintf("a%d.example.com", i%5), fmt.Sprintf("b%d.example.com", i%5),
+				fmt.Sprintf("c%d.example.com", i%5), "*.example.org", fmt.Sprintf("d%d.example.com", i%5)},
+			TargetService: []*entity.TargetService{{Service: "trpc.test.service"}},
+		})
+	}
+	for i := 0; i < 1000; i++ {
+		proxyConfig.Router = append(proxyConfig.Router, &entity.RouterItem{
+			Method:        fmt.Sprintf("/api/v2/service%d/", i),
+			TargetService: []*entity.TargetService{{Service: "trpc.test.service"}},
+		})
+	}
+	r := NewFastHTTPRouter()
+	assert.Nil(b, r.InitRouterConfig(context.Background(), proxyConfig))
+	b.Run("exact_host", func(b *testing.B) {
+		benchmarkLookup(b, r, "/api/v1/service999/method19999", "d4.example.com", false)
+	})
+	b.Run("wildcard_host", func(b *testing.B) {
+		benchmarkLookup(b, r, "/api/v1/service999/method19999", "w.example.org", false)
+	})
+	b.Run("prefix", func(b *testing.B) {
+		benchmarkLookup(b, r, "/api/v2/service999/method", "", false)
+	})
+}
@@ -0,0 +1,134 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"regexp"
+	"strings"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+const (
+	// defaultSegmentPattern matches a single path segment for {name}
+	defaultSegmentPattern = "[^/]+"
+	// restSegmentPattern matches the remaining path for {*name}
+	restSegmentPattern = ".*"
+)
+
+// paramNameReg validates the capture name of a template segment
+var paramNameReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// isPathTemplate checks whether the method is a path template, such as /users/{uid}/orders/{oid}
+func isPathTemplate(method string) bool {
+	return strings.Contains(method, "{")
+}
+
+// compilePathTemplate compiles a path template into an anchored regular expression, the captured values are the named
+// groups of the expression.
+// Supported segments:
+//   - {name}: matches a single path segment
+//   - {name:regex}: matches the regular expression
+//   - {*name}: matches the rest of the path, must be at the end of the template
+func compilePathTemplate(tmpl string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	names := make(map[string]struct{})
+	for i := 0; i < len(tmpl); i++ {
+		switch tmpl[i] {
+		case '}':
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "unexpected } at %d in path template %s", i, tmpl)
+		case '{':
+			end := closingBrace(tmpl, i)
+			if end < 0 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "unclosed { at %d in path template %s", i, tmpl)
+			}
+			name, pattern := parseSegment(tmpl[i+1 : end])
+			if pattern == restSegmentPattern && end != len(tmpl)-1 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "{*%s} must be at the end of path template %s", name, tmpl)
+			}
+			if pattern == "" {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "empty pattern of %q in path template %s", name, tmpl)
+			}
+			if !paramNameReg.MatchString(name) {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid param name %q in path template %s", name, tmpl)
+			}
+			if _, ok := names[name]; ok {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "duplicate param name %q in path template %s", name, tmpl)
+			}
+			names[name] = struct{}{}
+			b.WriteString("(?P<" + name + ">" + pattern + ")")
+			i = end
+		default:
+			end := strings.IndexAny(tmpl[i:], "{}")
+			if end < 0 {
+				end = len(tmpl)
+			} else {
+				end += i
+			}
+			b.WriteString(regexp.QuoteMeta(tmpl[i:end]))
+			i = end - 1
+		}
+	}
+	b.WriteString("$")
+	reg, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "compile path template %s err", tmpl)
+	}
+	return reg, nil
+}
+
+// closingBrace returns the index of the } closing the { at start, braces of the segment regex are balanced
+func closingBrace(tmpl string, start int) int {
+	depth := 0
+	for i := start; i < len(tmpl); i++ {
+		switch tmpl[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseSegment parses the content of a template segment into the capture name and pattern
+func parseSegment(segment string) (string, string) {
+	if strings.HasPrefix(segment, "*") {
+		return segment[1:], restSegmentPattern
+	}
+	if idx := strings.IndexByte(segment, ':'); idx >= 0 {
+		return segment[:idx], segment[idx+1:]
+	}
+	return segment, defaultSegmentPattern
+}
+
+// matchPathTemplate matches the path with the compiled template, and returns the captured values
+func matchPathTemplate(reg *regexp.Regexp, path string) (map[string]string, bool) {
+	match := reg.FindStringSubmatch(path)
+	if match == nil {
+		return nil, false
+	}
+	params := make(map[string]string, len(match)-1)
+	for i, name := range reg.SubexpNames() {
+		if name != "" {
+			params[name] = match[i]
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,62 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_compilePathTemplate(t *testing.T) {
+	reg, err := compilePathTemplate("/users/{uid}/orders/{oid:[0-9]{1,8}}")
+	assert.Nil(t, err)
+	params, ok := matchPathTemplate(reg, "/users/u1/orders/42")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"uid": "u1", "oid": "42"}, params)
+	_, ok = matchPathTemplate(reg, "/users/u1/orders/abc")
+	assert.False(t, ok)
+	_, ok = matchPathTemplate(reg, "/users/u1/u2/orders/42")
+	assert.False(t, ok)
+
+	// Literal parts are quoted
+	reg, err = compilePathTemplate("/v1.0/{name}")
+	assert.Nil(t, err)
+	_, ok = matchPathTemplate(reg, "/v1x0/a")
+	assert.False(t, ok)
+
+	// Rest of the path
+	reg, err = compilePathTemplate("/static/{*rest}")
+	assert.Nil(t, err)
+	params, ok = matchPathTemplate(reg, "/static/js/app.js")
+	assert.True(t, ok)
+	assert.Equal(t, "js/app.js", params["rest"])
+
+	// Invalid templates
+	for _, tmpl := range []string{
+		"/users/{uid",
+		"/users/uid}",
+		"/users/{}",
+		"/users/{1uid}",
+		"/users/{uid:}",
+		"/users/{uid}/{uid}",
+		"/static/{*rest}/info",
+		"/users/{uid:[0-9}",
+	} {
+		_, err = compilePathTemplate(tmpl)
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err), tmpl)
+	}
+}
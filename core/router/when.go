@@ -0,0 +1,45 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/rule"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// whenFilter wraps the filter of the plugin, so that the filter is skipped and the next one is invoked if the request
+// does not match the when conditions of the plugin. The conditions are matched like the rule of the router, a
+// condition that fails to evaluate is not matched.
+func whenFilter(when *entity.RuleItem, f filter.ServerFilter) filter.ServerFilter {
+	return func(ctx context.Context, req interface{}, next filter.ServerHandleFunc) (interface{}, error) {
+		fctx := http.RequestContext(ctx)
+		if fctx == nil {
+			// The conditions can not be matched without the request, run the filter as usual
+			return f(ctx, req, next)
+		}
+		matched, err := rule.MatchRule(fctx, when, DefaultGetString)
+		if err != nil {
+			log.ErrorContextf(ctx, "match plugin when err:%s", err)
+		}
+		if !matched {
+			return next(ctx, req)
+		}
+		return f(ctx, req, next)
+	}
+}
@@ -0,0 +1,127 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/rule"
+	mockplugin "trpc.group/trpc-go/trpc-gateway/plugin/mock"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/plugin"
+)
+
+func Test_whenFilter(t *testing.T) {
+	when := &entity.RuleItem{
+		Conditions: []*entity.Condition{{Key: "header:x-test", Val: "1", Oper: "=="}},
+		Expression: "0",
+	}
+	assert.Nil(t, rule.FormatRule(when))
+	var called bool
+	f := whenFilter(when, func(ctx context.Context, req interface{}, next filter.ServerHandleFunc) (interface{}, error) {
+		called = true
+		return next(ctx, req)
+	})
+	next := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "rsp", nil
+	}
+	invoke := func(header string) {
+		called = false
+		ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.Header.Set("x-test", header)
+		rsp, err := f(http.WithRequestContext(ctx, fctx), nil, next)
+		assert.Nil(t, err)
+		assert.Equal(t, "rsp", rsp)
+	}
+
+	// Matched, run the filter
+	invoke("1")
+	assert.True(t, called)
+
+	// Not matched, skip the filter
+	invoke("0")
+	assert.False(t, called)
+
+	// Run the filter without the request
+	called = false
+	_, err := f(context.Background(), nil, next)
+	assert.Nil(t, err)
+	assert.True(t, called)
+}
+
+func TestFastHTTPRouter_initFilters_when(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockGWPlugin := mockplugin.NewMockGatewayPlugin(ctrl)
+	mockGWPlugin.EXPECT().Type().Return("gateway").AnyTimes()
+	mockGWPlugin.EXPECT().CheckConfig(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	plugin.Register("whenmocking", mockGWPlugin)
+	var called bool
+	filter.Register("whenmocking", func(ctx context.Context, req interface{},
+		next filter.ServerHandleFunc) (interface{}, error) {
+		called = true
+		return next(ctx, req)
+	}, nil)
+
+	r := NewFastHTTPRouter()
+	s := &entity.TargetService{}
+	assert.Nil(t, r.initFilters(s, []*entity.Plugin{
+		{
+			Name: "whenmocking",
+			When: &entity.RuleItem{
+				Conditions: []*entity.Condition{{Key: "header:x-mock", Oper: "exists"}},
+				Expression: "0",
+			},
+		},
+	}))
+	assert.Len(t, s.Filters, 1)
+	ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+	fctx := &fasthttp.RequestCtx{}
+	_, err := filter.ServerChain(s.Filters).Filter(http.WithRequestContext(ctx, fctx), nil,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	assert.Nil(t, err)
+	assert.False(t, called)
+	fctx.Request.Header.Set("x-mock", "1")
+	_, err = filter.ServerChain(s.Filters).Filter(http.WithRequestContext(ctx, fctx), nil,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	assert.Nil(t, err)
+	assert.True(t, called)
+
+	// Invalid when
+	err = r.initFilters(&entity.TargetService{}, []*entity.Plugin{
+		{
+			Name: "whenmocking",
+			When: &entity.RuleItem{
+				Conditions: []*entity.Condition{{Key: "header:x-mock", Oper: "exists"}},
+				Expression: "0&&",
+			},
+		},
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err))
+}
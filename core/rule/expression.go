@@ -0,0 +1,306 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// exprType is the node type of the compiled expression
+type exprType int
+
+const (
+	// exprCond references a condition by index
+	exprCond exprType = iota
+	// exprNot negates the operand
+	exprNot
+	// exprAnd is true if all operands are true
+	exprAnd
+	// exprOr is true if any operand is true
+	exprOr
+)
+
+// Expr is the compiled rule expression, an AST whose leaves are condition indexes.
+// It is built once by ParseRuleExpression and is safe for concurrent evaluation.
+type Expr struct {
+	typ exprType
+	// idx is the condition index of an exprCond node
+	idx int
+	// operands of exprNot, exprAnd and exprOr nodes
+	operands []*Expr
+}
+
+// String returns the fully parenthesized expression, used for debugging
+func (e *Expr) String() string {
+	switch e.typ {
+	case exprCond:
+		return strconv.Itoa(e.idx)
+	case exprNot:
+		return NotOpt + e.operands[0].String()
+	default:
+		opt := AndOpt
+		if e.typ == exprOr {
+			opt = OrOpt
+		}
+		list := make([]string, 0, len(e.operands))
+		for _, o := range e.operands {
+			list = append(list, o.String())
+		}
+		return "(" + strings.Join(list, opt) + ")"
+	}
+}
+
+// eval evaluates the expression with short-circuit, it does not allocate unless the conditions are inconsistent with
+// the compiled expression
+func (e *Expr) eval(ctx context.Context, conditions []*entity.Condition, getString GetStringFunc) (bool, error) {
+	switch e.typ {
+	case exprCond:
+		if e.idx >= len(conditions) {
+			return false, errs.New(gerrs.ErrWrongConfig, "error conditions conf")
+		}
+		return judgeCondition(ctx, conditions[e.idx], getString), nil
+	case exprNot:
+		matched, err := e.operands[0].eval(ctx, conditions, getString)
+		return !matched, err
+	case exprAnd:
+		for _, o := range e.operands {
+			if matched, err := o.eval(ctx, conditions, getString); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case exprOr:
+		for _, o := range e.operands {
+			if matched, err := o.eval(ctx, conditions, getString); err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	default:
+		return false, errs.Newf(gerrs.ErrWrongConfig, "invalid expression type:%d", e.typ)
+	}
+}
+
+// tokenType is the type of the expression token
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdx
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+// token is a lexical token of the expression, pos is the 1-based position in the expression
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+// keywordTokens are the word forms of the logical operators, case-insensitive
+var keywordTokens = map[string]tokenType{
+	"and": tokenAnd,
+	"or":  tokenOr,
+	"not": tokenNot,
+}
+
+// tokenize splits the expression into tokens
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{typ: tokenLParen, val: "(", pos: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{typ: tokenRParen, val: ")", pos: i + 1})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{typ: tokenNot, val: NotOpt, pos: i + 1})
+			i++
+		case strings.HasPrefix(expr[i:], AndOpt):
+			tokens = append(tokens, token{typ: tokenAnd, val: AndOpt, pos: i + 1})
+			i += len(AndOpt)
+		case strings.HasPrefix(expr[i:], OrOpt):
+			tokens = append(tokens, token{typ: tokenOr, val: OrOpt, pos: i + 1})
+			i += len(OrOpt)
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{typ: tokenIdx, val: expr[i:j], pos: i + 1})
+			i = j
+		case isLetter(c):
+			j := i
+			for j < len(expr) && isLetter(expr[j]) {
+				j++
+			}
+			typ, ok := keywordTokens[strings.ToLower(expr[i:j])]
+			if !ok {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid word %q at position %d", expr[i:j], i+1)
+			}
+			tokens = append(tokens, token{typ: typ, val: expr[i:j], pos: i + 1})
+			i = j
+		default:
+			return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid character %q at position %d", c, i+1)
+		}
+	}
+	return append(tokens, token{typ: tokenEOF, pos: len(expr) + 1}), nil
+}
+
+// isLetter checks whether c is an ASCII letter
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// parser is a recursive descent parser of the rule expression, the grammar is:
+//
+//	or      = and { ("||" | "or") and }
+//	and     = unary { ("&&" | "and") unary }
+//	unary   = ("!" | "not") unary | primary
+//	primary = index | "(" or ")"
+type parser struct {
+	tokens    []token
+	cur       int
+	condCount int
+}
+
+// next returns the current token and moves forward
+func (p *parser) next() token {
+	t := p.tokens[p.cur]
+	if t.typ != tokenEOF {
+		p.cur++
+	}
+	return t
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.cur]
+}
+
+// parseBinary parses the n-ary and/or expression, operands of the same operator are flattened
+func (p *parser) parseBinary(typ exprType, opt tokenType, parseOperand func() (*Expr, error)) (*Expr, error) {
+	operand, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().typ != opt {
+		return operand, nil
+	}
+	e := &Expr{typ: typ, operands: []*Expr{operand}}
+	for p.peek().typ == opt {
+		p.next()
+		operand, err = parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		e.operands = append(e.operands, operand)
+	}
+	return e, nil
+}
+
+// parseOr parses the or expression, which has the lowest precedence
+func (p *parser) parseOr() (*Expr, error) {
+	return p.parseBinary(exprOr, tokenOr, p.parseAnd)
+}
+
+// parseAnd parses the and expression
+func (p *parser) parseAnd() (*Expr, error) {
+	return p.parseBinary(exprAnd, tokenAnd, p.parseUnary)
+}
+
+// parseUnary parses the not expression
+func (p *parser) parseUnary() (*Expr, error) {
+	if p.peek().typ != tokenNot {
+		return p.parsePrimary()
+	}
+	p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{typ: exprNot, operands: []*Expr{operand}}, nil
+}
+
+// parsePrimary parses the condition index or the parenthesized expression
+func (p *parser) parsePrimary() (*Expr, error) {
+	t := p.next()
+	switch t.typ {
+	case tokenIdx:
+		idx, err := strconv.Atoi(t.val)
+		if err != nil || idx >= p.condCount {
+			return nil, errs.Newf(gerrs.ErrWrongConfig,
+				"invalid condition index %s at position %d, condition count:%d", t.val, t.pos, p.condCount)
+		}
+		return &Expr{typ: exprCond, idx: idx}, nil
+	case tokenLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if r := p.next(); r.typ != tokenRParen {
+			return nil, unexpectedToken(r, "missing ) for ( at position "+strconv.Itoa(t.pos))
+		}
+		return e, nil
+	default:
+		return nil, unexpectedToken(t, "expect condition index or (")
+	}
+}
+
+// mixesAndOr checks if && and || are used at the same parenthesis level, whose precedence differs from the
+// left-to-right evaluation of the earlier versions
+func mixesAndOr(tokens []token) bool {
+	// ops is the operators used at each parenthesis level
+	ops := []tokenType{tokenEOF}
+	for _, t := range tokens {
+		switch t.typ {
+		case tokenLParen:
+			ops = append(ops, tokenEOF)
+		case tokenRParen:
+			if len(ops) > 1 {
+				ops = ops[:len(ops)-1]
+			}
+		case tokenAnd, tokenOr:
+			level := len(ops) - 1
+			if ops[level] != tokenEOF && ops[level] != t.typ {
+				return true
+			}
+			ops[level] = t.typ
+		}
+	}
+	return false
+}
+
+// unexpectedToken returns the error of an unexpected token
+func unexpectedToken(t token, msg string) error {
+	if t.typ == tokenEOF {
+		return errs.Newf(gerrs.ErrWrongConfig, "unexpected end of expression at position %d, %s", t.pos, msg)
+	}
+	return errs.Newf(gerrs.ErrWrongConfig, "unexpected %q at position %d, %s", t.val, t.pos, msg)
+}
@@ -0,0 +1,140 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func TestParseRuleExpression_Grammar(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "0||1&&2", want: "(0||(1&&2))"},
+		{expr: "(0||1)&&2", want: "((0||1)&&2)"},
+		{expr: "(0||1)&&!2", want: "((0||1)&&!2)"},
+		{expr: "!!0", want: "!!0"},
+		{expr: "!(0&&1)", want: "!(0&&1)"},
+		{expr: "0 && 1 && 2", want: "(0&&1&&2)"},
+		{expr: "((0))", want: "0"},
+		{expr: "(0 OR 1) and NOT 2", want: "((0||1)&&!2)"},
+		{expr: "0 || 0 && 0", want: "(0||(0&&0))"},
+	}
+	for _, tt := range tests {
+		expr, err := ParseRuleExpression(tt.expr, 3)
+		assert.Nil(t, err, tt.expr)
+		assert.Equal(t, tt.want, expr.String(), tt.expr)
+	}
+}
+
+func Test_mixesAndOr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "0||1&&2", want: true},
+		{expr: "0 and 1 or 2", want: true},
+		{expr: "(0||1)&&2", want: false},
+		{expr: "0||(1&&2)", want: false},
+		{expr: "0&&1&&!2", want: false},
+		{expr: "(0||1&&2)", want: true},
+		{expr: "((0||1))&&(2||0)", want: false},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.expr)
+		assert.Nil(t, err, tt.expr)
+		assert.Equal(t, tt.want, mixesAndOr(tokens), tt.expr)
+	}
+}
+
+func TestParseRuleExpression_Err(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "0&&1||", want: "unexpected end of expression at position 7"},
+		{expr: "||0", want: `unexpected "||" at position 1`},
+		{expr: "0&&||2", want: `unexpected "||" at position 4`},
+		{expr: "0&&1&", want: "invalid character '&' at position 5"},
+		{expr: "(0||1", want: "missing ) for ( at position 1"},
+		{expr: "0||1)", want: `unexpected ")" at position 5`},
+		{expr: "()", want: `unexpected ")" at position 2`},
+		{expr: "0 xor 1", want: `invalid word "xor" at position 3`},
+		{expr: "0&&3", want: "invalid condition index 3 at position 4"},
+		{expr: "0&&99999999999999999999", want: "invalid condition index"},
+		{expr: "!", want: "unexpected end of expression at position 2"},
+		{expr: "0;", want: "invalid character ';' at position 2"},
+		{expr: "  ", want: "empty expression or condition"},
+	}
+	for _, tt := range tests {
+		_, err := ParseRuleExpression(tt.expr, 3)
+		assert.NotNil(t, err, tt.expr)
+		assert.Contains(t, err.Error(), tt.want, tt.expr)
+	}
+}
+
+func TestExpr_eval(t *testing.T) {
+	conditions := []*entity.Condition{
+		{Key: "a", Val: "666", Oper: "=="}, // true
+		{Key: "a", Val: "666", Oper: "!="}, // false
+		{Key: "a", Val: "5", Oper: ">"},    // true
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: "0", want: true},
+		{expr: "!0", want: false},
+		{expr: "0&&1", want: false},
+		{expr: "0||1", want: true},
+		{expr: "1||1&&0", want: false},
+		{expr: "1&&0||2", want: true},
+		{expr: "1&&(0||2)", want: false},
+		{expr: "!(1||!2)", want: true},
+		{expr: "1 or 0 and not 1", want: true},
+	}
+	for _, tt := range tests {
+		expr, err := ParseRuleExpression(tt.expr, len(conditions))
+		assert.Nil(t, err, tt.expr)
+		matched, err := expr.eval(context.Background(), conditions, fakeGetIntStr)
+		assert.Nil(t, err, tt.expr)
+		assert.Equal(t, tt.want, matched, tt.expr)
+	}
+
+	// Short-circuit, the invalid index on the right side is not evaluated
+	expr, err := ParseRuleExpression("0||2", 3)
+	assert.Nil(t, err)
+	matched, err := expr.eval(context.Background(), conditions[:1], fakeGetIntStr)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	expr, err = ParseRuleExpression("1&&2", 3)
+	assert.Nil(t, err)
+	matched, err = expr.eval(context.Background(), conditions[:2], fakeGetIntStr)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+
+	expr, err = ParseRuleExpression("!2", 3)
+	assert.Nil(t, err)
+	_, err = expr.eval(context.Background(), conditions[:2], fakeGetIntStr)
+	assert.NotNil(t, err)
+
+	_, err = (&Expr{typ: exprType(100)}).eval(context.Background(), conditions, fakeGetIntStr)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,158 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"net/netip"
+	"strings"
+
+	"trpc.group/trpc-go/trpc-gateway/common/convert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// hasPrefix checks if the value starts with b
+func hasPrefix(a, b string, _ interface{}) bool {
+	return strings.HasPrefix(a, b)
+}
+
+// hasSuffix checks if the value ends with b
+func hasSuffix(a, b string, _ interface{}) bool {
+	return strings.HasSuffix(a, b)
+}
+
+// contains checks if the value contains b
+func contains(a, b string, _ interface{}) bool {
+	return strings.Contains(a, b)
+}
+
+// exists checks if the value is not empty
+func exists(a, _ string, _ interface{}) bool {
+	return a != ""
+}
+
+// notExists checks if the value is empty
+func notExists(a, _ string, _ interface{}) bool {
+	return a == ""
+}
+
+// iEqual checks if the value equals b case-insensitively
+func iEqual(a, b string, _ interface{}) bool {
+	return strings.EqualFold(a, b)
+}
+
+// iPrefix checks if the value starts with b case-insensitively, parsedB is the lower case of b
+func iPrefix(a, _ string, parsedB interface{}) bool {
+	lowerB, ok := parsedB.(string)
+	if !ok {
+		log.Errorf("invalid parsedB type:%T", parsedB)
+		return false
+	}
+	return len(a) >= len(lowerB) && strings.EqualFold(a[:len(lowerB)], lowerB)
+}
+
+// iSuffix checks if the value ends with b case-insensitively, parsedB is the lower case of b
+func iSuffix(a, _ string, parsedB interface{}) bool {
+	lowerB, ok := parsedB.(string)
+	if !ok {
+		log.Errorf("invalid parsedB type:%T", parsedB)
+		return false
+	}
+	return len(a) >= len(lowerB) && strings.EqualFold(a[len(a)-len(lowerB):], lowerB)
+}
+
+// iContains checks if the value contains b case-insensitively, parsedB is the lower case of b
+func iContains(a, _ string, parsedB interface{}) bool {
+	lowerB, ok := parsedB.(string)
+	if !ok {
+		log.Errorf("invalid parsedB type:%T", parsedB)
+		return false
+	}
+	return strings.Contains(strings.ToLower(a), lowerB)
+}
+
+// iIn checks if the value is in the list case-insensitively, parsedB is the set of the lower case values
+func iIn(a, _ string, parsedB interface{}) bool {
+	return in(strings.ToLower(a), "", parsedB)
+}
+
+// cidrMatch checks if the IP is in the prefix set
+func cidrMatch(a, _ string, parsedB interface{}) bool {
+	prefixes, ok := parsedB.([]netip.Prefix)
+	if !ok {
+		log.Errorf("invalid parsedB type:%T", parsedB)
+		return false
+	}
+	addr, err := netip.ParseAddr(strings.TrimSpace(a))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitVal splits the comma separated condition value and trims spaces
+func splitVal(val string) []string {
+	list := strings.Split(val, ",")
+	for i := range list {
+		list[i] = strings.TrimSpace(list[i])
+	}
+	return list
+}
+
+// parseLowerSet parses the comma separated condition value into a set of lower case values
+func parseLowerSet(val string) map[string]struct{} {
+	return convert.StrSlice2Map(splitVal(strings.ToLower(val)))
+}
+
+// parseCIDRList parses the comma separated CIDRs into a prefix set, a single IP is treated as a full length prefix.
+// IPv4-mapped IPv6 prefixes are converted to IPv4.
+func parseCIDRList(val string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range splitVal(val) {
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid cidr:%s", s)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, errs.Wrapf(err, gerrs.ErrWrongConfig, "invalid cidr:%s", s)
+		}
+		if p.Addr().Is4In6() {
+			if p.Bits() < 96 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid cidr:%s", s)
+			}
+			p = netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	if len(prefixes) == 0 {
+		return nil, errs.New(gerrs.ErrWrongConfig, "empty cidr")
+	}
+	return prefixes, nil
+}
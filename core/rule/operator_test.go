@@ -0,0 +1,126 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+)
+
+func getStringFunc(val string) GetStringFunc {
+	return func(context.Context, string) string {
+		return val
+	}
+}
+
+func TestJudgeCondition_Operators(t *testing.T) {
+	tests := []struct {
+		oper string
+		val  string
+		a    string
+		want bool
+	}{
+		{oper: PrefixOpt, val: "/api/", a: "/api/user", want: true},
+		{oper: PrefixOpt, val: "/api/", a: "/API/user", want: false},
+		{oper: SuffixOpt, val: ".json", a: "user.json", want: true},
+		{oper: SuffixOpt, val: ".json", a: "user.xml", want: false},
+		{oper: ContainsOpt, val: "Mobile", a: "Mozilla/5.0 Mobile Safari", want: true},
+		{oper: ContainsOpt, val: "Mobile", a: "Mozilla/5.0 Safari", want: false},
+		{oper: ExistsOpt, a: "x", want: true},
+		{oper: ExistsOpt, a: "", want: false},
+		{oper: NotExistsOpt, a: "", want: true},
+		{oper: NotExistsOpt, a: "x", want: false},
+		{oper: IEqualToOpt, val: "Android", a: "ANDROID", want: true},
+		{oper: IEqualToOpt, val: "Android", a: "ios", want: false},
+		{oper: IInOpt, val: "Android, iOS", a: "IOS", want: true},
+		{oper: IInOpt, val: "Android, iOS", a: "harmony", want: false},
+		{oper: IPrefixOpt, val: "/Api/", a: "/API/user", want: true},
+		{oper: IPrefixOpt, val: "/Api/", a: "/AP", want: false},
+		{oper: ISuffixOpt, val: ".JSON", a: "user.Json", want: true},
+		{oper: ISuffixOpt, val: ".JSON", a: "json", want: false},
+		{oper: IContainsOpt, val: "mobile", a: "Mozilla/5.0 MOBILE Safari", want: true},
+		{oper: IContainsOpt, val: "mobile", a: "Mozilla/5.0 Safari", want: false},
+		{oper: CIDROpt, val: "10.0.0.0/8, 192.168.1.1", a: "10.1.2.3", want: true},
+		{oper: CIDROpt, val: "10.0.0.0/8, 192.168.1.1", a: "192.168.1.1", want: true},
+		{oper: CIDROpt, val: "10.0.0.0/8, 192.168.1.1", a: "192.168.1.2", want: false},
+		{oper: CIDROpt, val: "10.0.0.0/8", a: "::ffff:10.1.2.3", want: true},
+		{oper: CIDROpt, val: "::ffff:10.0.0.0/104", a: "10.1.2.3", want: true},
+		{oper: CIDROpt, val: "2001:db8::/32", a: "2001:db8::1", want: true},
+		{oper: CIDROpt, val: "2001:db8::/32", a: "2001:db9::1", want: false},
+		{oper: CIDROpt, val: "2001:db8::/32", a: "10.1.2.3", want: false},
+		{oper: CIDROpt, val: "10.0.0.0/8", a: "invalid", want: false},
+		{oper: CIDROpt, val: "10.0.0.0/8", a: "", want: false},
+		{oper: SemverGreaterThanOpt, val: "6.6.0", a: "6.10.0", want: true},
+		{oper: SemverGreaterThanOpt, val: "6.6.0", a: "6.6.0", want: false},
+		{oper: SemverGreaterOrEqualToOpt, val: "6.6.0", a: "v6.6", want: true},
+		{oper: SemverGreaterOrEqualToOpt, val: "6.6.0", a: "6.6.0-beta", want: false},
+		{oper: SemverLessThanOpt, val: "6.6.0", a: "6.5.99", want: true},
+		{oper: SemverLessThanOpt, val: "6.6.0", a: "", want: false},
+		{oper: SemverLessThanOrEqualToOpt, val: "6.6.0", a: "6.6.0+build.1", want: true},
+		{oper: SemverLessThanOrEqualToOpt, val: "6.6.0", a: "6.6.1", want: false},
+	}
+	for _, tt := range tests {
+		cond := &entity.Condition{Key: "a", Val: tt.val, Oper: tt.oper}
+		assert.Nil(t, parseRuleConditionVal([]*entity.Condition{cond}), tt.oper)
+		ok := judgeCondition(context.Background(), cond, getStringFunc(tt.a))
+		assert.Equal(t, tt.want, ok, "%s %s %s", tt.a, tt.oper, tt.val)
+	}
+
+	// Not parsed
+	for _, oper := range []string{IPrefixOpt, ISuffixOpt, IContainsOpt, IInOpt, CIDROpt, SemverGreaterThanOpt} {
+		cond := &entity.Condition{Key: "a", Val: "1", Oper: oper}
+		assert.False(t, judgeCondition(context.Background(), cond, getStringFunc("1")), oper)
+	}
+}
+
+func TestParseRuleConditionVal_Operators(t *testing.T) {
+	tests := []struct {
+		oper string
+		val  string
+	}{
+		{oper: CIDROpt, val: "10.0.0.0/33"},
+		{oper: CIDROpt, val: "10.0.0.256"},
+		{oper: CIDROpt, val: " , "},
+		{oper: CIDROpt, val: "::ffff:10.0.0.0/64"},
+		{oper: SemverGreaterThanOpt, val: "x.y"},
+		{oper: SemverLessThanOpt, val: ""},
+		{oper: SemverGreaterOrEqualToOpt, val: "1.2.3-"},
+		{oper: SemverLessThanOrEqualToOpt, val: "1.2.3.4.5"},
+	}
+	for _, tt := range tests {
+		cond := &entity.Condition{Key: "a", Val: tt.val, Oper: tt.oper}
+		assert.NotNil(t, parseRuleConditionVal([]*entity.Condition{cond}), "%s %s", tt.oper, tt.val)
+	}
+}
+
+func TestJudgeCondition_OperatorsAllocs(t *testing.T) {
+	conditions := []*entity.Condition{
+		{Key: "a", Val: "10.0.0.0/8,2001:db8::/32", Oper: CIDROpt},
+		{Key: "a", Val: "10.0.0.1-beta.1", Oper: SemverGreaterThanOpt},
+		{Key: "a", Val: "10.0.0", Oper: IPrefixOpt},
+	}
+	assert.Nil(t, parseRuleConditionVal(conditions))
+	getString := getStringFunc("10.0.0.1")
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, cond := range conditions {
+			if !judgeCondition(context.Background(), cond, getString) {
+				t.Fatal("judge condition failed")
+			}
+		}
+	})
+	assert.Equal(t, float64(0), allocs)
+}
@@ -17,12 +17,13 @@ package rule
 import (
 	"context"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/valyala/fasthttp"
 	"trpc.group/trpc-go/trpc-gateway/common/convert"
 	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
 	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	"trpc.group/trpc-go/trpc-go/errs"
 	"trpc.group/trpc-go/trpc-go/log"
@@ -36,6 +37,8 @@ const (
 	AndOpt = "&&"
 	// OrOpt represents the logical OR operator
 	OrOpt = "||"
+	// NotOpt represents the logical NOT operator
+	NotOpt = "!"
 
 	// GreaterThanOpt represents the greater than operator
 	GreaterThanOpt = ">"
@@ -55,12 +58,39 @@ const (
 	NotInOpt = "!in"
 	// RegexpOpt represents the regular expression matching operator
 	RegexpOpt = "regexp"
+	// PrefixOpt represents the prefix matching operator
+	PrefixOpt = "prefix"
+	// SuffixOpt represents the suffix matching operator
+	SuffixOpt = "suffix"
+	// ContainsOpt represents the substring matching operator
+	ContainsOpt = "contains"
+	// ExistsOpt represents the operator that the value is not empty
+	ExistsOpt = "exists"
+	// NotExistsOpt represents the operator that the value is empty
+	NotExistsOpt = "!exists"
+	// CIDROpt represents the IP matching operator, the value is a comma separated list of CIDRs or IPs
+	CIDROpt = "cidr"
+	// SemverGreaterThanOpt represents the greater than operator of semantic versions
+	SemverGreaterThanOpt = "semver_gt"
+	// SemverGreaterOrEqualToOpt represents the greater than or equal to operator of semantic versions
+	SemverGreaterOrEqualToOpt = "semver_ge"
+	// SemverLessThanOpt represents the less than operator of semantic versions
+	SemverLessThanOpt = "semver_lt"
+	// SemverLessThanOrEqualToOpt represents the less than or equal to operator of semantic versions
+	SemverLessThanOrEqualToOpt = "semver_le"
+	// IEqualToOpt represents the case-insensitive equal to operator
+	IEqualToOpt = "iequal"
+	// IInOpt represents the case-insensitive in operator
+	IInOpt = "iin"
+	// IPrefixOpt represents the case-insensitive prefix matching operator
+	IPrefixOpt = "iprefix"
+	// ISuffixOpt represents the case-insensitive suffix matching operator
+	ISuffixOpt = "isuffix"
+	// IContainsOpt represents the case-insensitive substring matching operator
+	IContainsOpt = "icontains"
 )
 
 var (
-	// Regular expression to extract condition index
-	idxGetReg = regexp.MustCompile(`\d+`)
-
 	compareFuncs = map[string]compareFunc{
 		GreaterThanOpt:       gt,
 		GreaterOrEqualToOpt:  ge,
@@ -71,141 +101,165 @@ var (
 		InOpt:                in,
 		NotInOpt:             notIn,
 		RegexpOpt:            regexpMatch,
+		PrefixOpt:            hasPrefix,
+		SuffixOpt:            hasSuffix,
+		ContainsOpt:          contains,
+		ExistsOpt:            exists,
+		NotExistsOpt:         notExists,
+		CIDROpt:              cidrMatch,
+
+		SemverGreaterThanOpt:       semverGt,
+		SemverGreaterOrEqualToOpt:  semverGe,
+		SemverLessThanOpt:          semverLt,
+		SemverLessThanOrEqualToOpt: semverLe,
+
+		IEqualToOpt:  iEqual,
+		IInOpt:       iIn,
+		IPrefixOpt:   iPrefix,
+		ISuffixOpt:   iSuffix,
+		IContainsOpt: iContains,
 	}
 )
 
 // GetStringFunc defines the function to retrieve parameters
-// For HTTP protocol, it can retrieve form, query, header, and cookie parameters; for RPC, it can retrieve metadata
+// For HTTP protocol, it can retrieve form, query, header, and cookie parameters; for RPC, it can retrieve metadata.
+// It is only used for keys without source prefix, see GetValue.
 type GetStringFunc func(ctx context.Context, key string) string
 
-// MatchRule performs rule matching
+// GetValue returns the value of the key, parsedKey is the result of http.ParseSource.
+// Keys with source prefix, such as header:x-uid, are resolved from the HTTP request directly, and the others are
+// resolved by getString.
+func GetValue(ctx context.Context, key string, parsedKey interface{}, getString GetStringFunc) string {
+	src, ok := parsedKey.(*http.Source)
+	if !ok || !src.Typed() {
+		return getString(ctx, key)
+	}
+	fctx, ok := ctx.(*fasthttp.RequestCtx)
+	if !ok {
+		fctx = http.RequestContext(ctx)
+	}
+	if fctx == nil {
+		return ""
+	}
+	return src.Value(fctx)
+}
+
+// MatchRule performs rule matching with the expression compiled by FormatRule
 func MatchRule(ctx context.Context, ruleItem *entity.RuleItem, getString GetStringFunc) (bool, error) {
 	if ruleItem == nil {
 		return false, nil
 	}
-	idxList, optList := ruleItem.ConditionIdxList, ruleItem.OptList
-	if len(idxList) == 0 {
+	expr, ok := ruleItem.ParsedExpression.(*Expr)
+	if !ok || expr == nil {
 		return false, nil
 	}
-	cNum := len(ruleItem.Conditions)
-	position := idxList[0]
-	if idxList[0] >= cNum {
-		return false, errs.New(gerrs.ErrWrongConfig, "error conditions conf")
-	}
-
-	flag := judgeCondition(ctx, ruleItem.Conditions[position], getString)
-
-	for i, op := range optList {
-		position = idxList[i+1]
-		if position >= cNum {
-			continue
-		}
-		rFlag := judgeCondition(ctx, ruleItem.Conditions[position], getString)
-
-		switch op {
-		case AndOpt:
-			flag = flag && rFlag
-		case OrOpt:
-			flag = flag || rFlag
-		default:
-			return false, errs.Newf(gerrs.ErrWrongConfig, "invalid option:%s", op)
-		}
-	}
-	return flag, nil
+	return expr.eval(ctx, ruleItem.Conditions, getString)
 }
 
-// FormatRule formats the rule
+// FormatRule formats the rule, the expression is compiled once here and evaluated by MatchRule
 func FormatRule(ruleItem *entity.RuleItem) error {
 	if ruleItem == nil || ruleItem.Expression == "" {
 		return errs.New(gerrs.ErrWrongConfig, "empty rule item")
 	}
-	idxList, optList, err := ParseRuleExpression(ruleItem.Expression, len(ruleItem.Conditions))
+	expr, err := ParseRuleExpression(ruleItem.Expression, len(ruleItem.Conditions))
 	if err != nil {
-		return gerrs.Wrap(err, "parse rule expression err")
+		return gerrs.Wrapf(err, "parse rule expression %q err", ruleItem.Expression)
 	}
 
-	ruleItem.ConditionIdxList = idxList
-	ruleItem.OptList = optList
+	ruleItem.ParsedExpression = expr
+	if err := parseRuleConditionKey(ruleItem.Conditions); err != nil {
+		return gerrs.Wrap(err, "parse rule condition key err")
+	}
 	if err := parseRuleConditionVal(ruleItem.Conditions); err != nil {
 		return gerrs.Wrap(err, "parse rule condition val err")
 	}
 	return nil
 }
 
+// parseRuleConditionKey parses the source of the condition keys, such as header:x-uid
+func parseRuleConditionKey(conditions []*entity.Condition) error {
+	for i, cond := range conditions {
+		if cond.Key == "" {
+			// Resolved by GetStringFunc as before
+			continue
+		}
+		src, err := http.ParseSource(cond.Key)
+		if err != nil {
+			return gerrs.Wrapf(err, "invalid key of condition %d", i)
+		}
+		cond.ParsedKey = src
+	}
+	return nil
+}
+
 // parseRuleConditionVal parses the condition matching values
 func parseRuleConditionVal(conditions []*entity.Condition) error {
 	// Iterate over conditions
 	for _, cond := range conditions {
 		switch cond.Oper {
 		case InOpt, NotInOpt:
-			condValList := strings.Split(cond.Val, ",")
-			// Trim spaces
-			for i := range condValList {
-				condValList[i] = strings.TrimSpace(condValList[i])
-			}
-			cond.ParsedVal = convert.StrSlice2Map(condValList)
+			cond.ParsedVal = convert.StrSlice2Map(splitVal(cond.Val))
 		case RegexpOpt:
 			exp, err := regexp.Compile(cond.Val)
 			if err != nil {
 				return errs.Wrap(err, gerrs.ErrWrongConfig, "compile rule regexp err")
 			}
 			cond.ParsedVal = exp
+		case CIDROpt:
+			prefixes, err := parseCIDRList(cond.Val)
+			if err != nil {
+				return gerrs.Wrap(err, "parse rule cidr err")
+			}
+			cond.ParsedVal = prefixes
+		case SemverGreaterThanOpt, SemverGreaterOrEqualToOpt, SemverLessThanOpt, SemverLessThanOrEqualToOpt:
+			v, err := parseSemverVal(cond.Val)
+			if err != nil {
+				return gerrs.Wrap(err, "parse rule semver err")
+			}
+			cond.ParsedVal = v
+		case IInOpt:
+			cond.ParsedVal = parseLowerSet(cond.Val)
+		case IPrefixOpt, ISuffixOpt, IContainsOpt:
+			cond.ParsedVal = strings.ToLower(cond.Val)
 		}
 	}
 	return nil
 }
 
-// ParseRuleExpression parses the condition expression
-// Example input: "0&&1||2"
-func ParseRuleExpression(expr string, condCount int) ([]int, []string, error) {
-	if expr == "" || condCount == 0 {
-		return nil, nil, errs.New(gerrs.ErrWrongConfig, "empty expression or condition")
+// ParseRuleExpression parses the condition expression into an AST.
+// Conditions are referenced by index, and can be combined with || (or), && (and), ! (not) and parentheses.
+// The precedence from high to low is: !, &&, ||. Example input: "(0||1)&&!2", "(0 or 1) and not 2"
+func ParseRuleExpression(expr string, condCount int) (*Expr, error) {
+	if strings.TrimSpace(expr) == "" || condCount == 0 {
+		return nil, errs.New(gerrs.ErrWrongConfig, "empty expression or condition")
 	}
-	// Get the index list of the condition expression, e.g., for expression "0&&1||2", get [0 1 2]
-	idxStrList := idxGetReg.FindAllString(expr, -1)
-	// Convert to int slice
-	idxList, err := convert.ToIntSlice(idxStrList)
+	tokens, err := tokenize(expr)
 	if err != nil {
-		return nil, nil, gerrs.Wrap(err, "convert rule idx err")
-	}
-	// Get the logical operators, e.g., for expression "0&&1||2", get ["&&", "||"]
-	optList := idxGetReg.Split(expr, -1)
-	// Remove leading and trailing empty strings from the result of "0&&1" split, resulting in ["", "&&", ""]
-	if len(optList) >= 2 {
-		optList = optList[1 : len(optList)-1]
+		return nil, gerrs.Wrap(err, "tokenize rule expression err")
 	}
-
-	// Validate the operators
-	for _, o := range optList {
-		if o != AndOpt && o != OrOpt {
-			return nil, nil, errs.Newf(gerrs.ErrWrongConfig, "invalid opt:%s", o)
-		}
+	p := &parser{tokens: tokens, condCount: condCount}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, gerrs.Wrap(err, "parse rule expression err")
 	}
-	// Validate the index positions: the maximum index should be less than the number of conditions, and the minimum
-	// index should be greater than 0 (already checked by the regular expression)
-
-	tmpSlice := sort.IntSlice(idxList)
-	if !sort.IsSorted(sort.IntSlice(idxList)) {
-		return nil, nil, errs.New(gerrs.ErrWrongConfig, "rule idx is not sorted")
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, unexpectedToken(t, "expect || or &&")
 	}
-
-	maxIdx := tmpSlice[len(tmpSlice)-1]
-	if maxIdx+1 > condCount {
-		return nil, nil, errs.Newf(gerrs.ErrWrongConfig,
-			"invalid max idx:%v,cond count:%v", maxIdx, condCount)
+	if mixesAndOr(tokens) {
+		log.Warnf("rule expression %q mixes && and || without parentheses, && is evaluated before ||, "+
+			"which was evaluated from left to right in the earlier versions", expr)
 	}
-
-	return idxList, optList, nil
+	return e, nil
 }
 
-// judgeCondition filters a single condition, currently only supports ">,>=,<,<=,==,!=,in,!in,regexp" operators
+// judgeCondition filters a single condition with the operators in compareFuncs
 func judgeCondition(ctx context.Context, cond *entity.Condition, getString GetStringFunc) bool {
 	compare, ok := compareFuncs[cond.Oper]
 	if !ok {
 		// Unsupported operator
 		return false
 	}
-	val := getString(ctx, cond.Key)
+	val := GetValue(ctx, cond.Key, cond.ParsedKey, getString)
 	return compare(val, cond.Val, cond.ParsedVal)
 }
 
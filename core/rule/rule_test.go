@@ -15,9 +15,12 @@ package rule
 
 import (
 	"context"
+	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
 	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	trpc "trpc.group/trpc-go/trpc-go"
 )
@@ -53,7 +56,7 @@ func TestMatchRule(t *testing.T) {
 		{Key: "c", Val: "5", Oper: "<"},
 		{Key: "d", Val: "\\uFFFD", Oper: RegexpOpt},
 	}
-	ruleItem.Expression = "0&&1||"
+	ruleItem.Expression = "0&&1||3"
 	assert.NotNil(t, FormatRule(ruleItem))
 
 	// match success
@@ -64,6 +67,8 @@ func TestMatchRule(t *testing.T) {
 		{Key: "d", Val: "b", Oper: "<="},
 	}
 	ruleItem.Expression = "0&&1||"
+	assert.NotNil(t, FormatRule(ruleItem))
+	ruleItem.Expression = "0&&1||2"
 	assert.Nil(t, FormatRule(ruleItem))
 	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
 	assert.Nil(t, err)
@@ -81,69 +86,113 @@ func TestMatchRule(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, matched)
 
-	ruleItem.ConditionIdxList = []int{5, 6}
-	ruleItem.OptList = []string{"||"}
+	// && takes precedence over ||, it was evaluated from left to right before
+	ruleItem.Expression = "0||2&&3"
+	assert.Nil(t, FormatRule(ruleItem))
 	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
-	assert.NotNil(t, err)
-	assert.False(t, matched)
-}
+	assert.Nil(t, err)
+	assert.True(t, matched)
 
-func TestParseRuleExpression(t *testing.T) {
-	exp := "0&&1||2||3"
-	idxList, optList, err := ParseRuleExpression(exp, 4)
+	ruleItem.Expression = "(0||2)&&!3"
+	assert.Nil(t, FormatRule(ruleItem))
+	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
 	assert.Nil(t, err)
-	assert.Equal(t, idxList[2], 2)
-	assert.Equal(t, optList[0], "&&")
-	exp = "0&&1||2||"
-	idxList, optList, err = ParseRuleExpression(exp, 3)
+	assert.False(t, matched)
+
+	ruleItem.Expression = "(2 or 3) and not 2"
+	assert.Nil(t, FormatRule(ruleItem))
+	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
 	assert.Nil(t, err)
-	assert.ElementsMatch(t, idxList, []int{0, 1, 2})
-	assert.ElementsMatch(t, optList, []string{"&&", "||"})
+	assert.True(t, matched)
 
-	exp = "0&&||2||"
-	_, _, err = ParseRuleExpression(exp, 2)
+	// Conditions are inconsistent with the compiled expression
+	ruleItem.Expression = "2&&0||1"
+	assert.Nil(t, FormatRule(ruleItem))
+	ruleItem.Conditions = ruleItem.Conditions[:2]
+	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
 	assert.NotNil(t, err)
+	assert.False(t, matched)
 
-	exp = "||0&&1||2||"
-	idxList, optList, err = ParseRuleExpression(exp, 3)
+	// Not formatted
+	ruleItem.ParsedExpression = nil
+	matched, err = MatchRule(ctx, ruleItem, fakeGetIntStr)
 	assert.Nil(t, err)
-	assert.ElementsMatch(t, idxList, []int{0, 1, 2})
-	assert.ElementsMatch(t, optList, []string{"&&", "||"})
+	assert.False(t, matched)
+}
 
-	exp = "0&&1&"
-	idxList, optList, err = ParseRuleExpression(exp, 2)
+func TestMatchRuleAllocs(t *testing.T) {
+	ctx := context.Background()
+	ruleItem := &entity.RuleItem{
+		Conditions: []*entity.Condition{
+			{Key: "a", Val: "5", Oper: ">"},
+			{Key: "b", Val: "666,777", Oper: "in"},
+			{Key: "c", Val: "5", Oper: "<"},
+		},
+		Expression: "(0||1)&&!2",
+	}
+	assert.Nil(t, FormatRule(ruleItem))
+	allocs := testing.AllocsPerRun(100, func() {
+		matched, err := MatchRule(ctx, ruleItem, fakeGetIntStr)
+		if err != nil || !matched {
+			t.Fatal("match rule failed")
+		}
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func BenchmarkMatchRule(b *testing.B) {
+	ctx := context.Background()
+	ruleItem := &entity.RuleItem{
+		Conditions: []*entity.Condition{
+			{Key: "a", Val: "5", Oper: ">"},
+			{Key: "b", Val: "666,777", Oper: "in"},
+			{Key: "c", Val: "5", Oper: "<"},
+		},
+		Expression: "(0||1)&&!2",
+	}
+	if err := FormatRule(ruleItem); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = MatchRule(ctx, ruleItem, fakeGetIntStr)
+	}
+}
+
+func TestParseRuleExpression(t *testing.T) {
+	expr, err := ParseRuleExpression("0&&1||2||3", 4)
 	assert.Nil(t, err)
-	assert.ElementsMatch(t, idxList, []int{0, 1})
-	assert.ElementsMatch(t, optList, []string{"&&"})
+	assert.Equal(t, "((0&&1)||2||3)", expr.String())
 
-	exp = "&&0"
-	idxList, optList, err = ParseRuleExpression(exp, 1)
+	// Indexes do not need to be sorted, and can be reused
+	expr, err = ParseRuleExpression("1&&0||!1", 2)
 	assert.Nil(t, err)
-	assert.ElementsMatch(t, idxList, []int{0})
-	assert.ElementsMatch(t, optList, []string{})
+	assert.Equal(t, "((1&&0)||!1)", expr.String())
 
-	exp = "0&&-1"
-	_, _, err = ParseRuleExpression(exp, 3)
-	assert.NotNil(t, err)
+	expr, err = ParseRuleExpression("0", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "0", expr.String())
 
-	exp = "1&&0"
-	_, _, err = ParseRuleExpression(exp, 3)
+	_, err = ParseRuleExpression("", 3)
 	assert.NotNil(t, err)
-	assert.Contains(t, err.Error(), "not sorted")
+	assert.Contains(t, err.Error(), "empty expression or condition")
 
-	exp = ""
-	_, _, err = ParseRuleExpression(exp, 3)
+	_, err = ParseRuleExpression("0", 0)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "empty expression or condition")
 
-	exp = "0&&1*"
-	_, _, err = ParseRuleExpression(exp, 1)
+	_, err = ParseRuleExpression("0&&1*", 2)
 	assert.NotNil(t, err)
-	assert.Contains(t, err.Error(), "invalid max idx")
+	assert.Contains(t, err.Error(), "invalid character '*' at position 5")
 
-	exp = "0"
-	_, _, err = ParseRuleExpression(exp, 1)
-	assert.Nil(t, err)
+	_, err = ParseRuleExpression("0&&1 2", 3)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), `unexpected "2" at position 6`)
+
+	_, err = ParseRuleExpression("0&&-1", 3)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "position 4")
 }
 
 func TestFormatRule(t *testing.T) {
@@ -174,6 +223,114 @@ func TestFormatRule(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestFormatRule_ConditionKey(t *testing.T) {
+	ruleItem := &entity.RuleItem{
+		Expression: "0&&1",
+		Conditions: []*entity.Condition{
+			{Key: "uid", Val: "1", Oper: "=="},
+			{Key: "json:user.level", Val: "1", Oper: "=="},
+		},
+	}
+	err := FormatRule(ruleItem)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid key of condition 1")
+
+	ruleItem.Conditions[1].Key = "json:$.user.level"
+	assert.Nil(t, FormatRule(ruleItem))
+	src, ok := ruleItem.Conditions[1].ParsedKey.(*http.Source)
+	assert.True(t, ok)
+	assert.Equal(t, http.SourceJSON, src.Type)
+}
+
+func TestMatchRule_ConditionKey(t *testing.T) {
+	ruleItem := &entity.RuleItem{
+		Expression: "0&&1&&2",
+		Conditions: []*entity.Condition{
+			{Key: "header:x-uid", Val: "vip", Oper: "=="},
+			{Key: "json:$.user.level", Val: "3", Oper: ">="},
+			{Key: "req:method", Val: "POST", Oper: "=="},
+		},
+	}
+	assert.Nil(t, FormatRule(ruleItem))
+	getString := func(ctx context.Context, key string) string {
+		return http.GetString(ctx.(*fasthttp.RequestCtx), key)
+	}
+
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	fctx.Request.SetBodyString(`{"user":{"level":5}}`)
+	// The query parameter with the same name can not spoof the header
+	fctx.Request.SetRequestURI("/user/info?x-uid=vip")
+	matched, err := MatchRule(fctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+
+	fctx.Request.Header.Set("x-uid", "vip")
+	matched, err = MatchRule(fctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	// The request context is carried in the context
+	ctx := http.WithRequestContext(context.Background(), fctx)
+	matched, err = MatchRule(ctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+
+	// Not an HTTP request
+	matched, err = MatchRule(context.Background(), ruleItem, getString)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+}
+
+func TestMatchRule_CIDR(t *testing.T) {
+	defer func() { _ = http.SetTrustedProxies(nil) }()
+	ruleItem := &entity.RuleItem{
+		Expression: "0",
+		Conditions: []*entity.Condition{{Key: "req:ip", Val: "10.0.0.0/8", Oper: CIDROpt}},
+	}
+	assert.Nil(t, FormatRule(ruleItem))
+	getString := func(ctx context.Context, key string) string {
+		return http.GetString(ctx.(*fasthttp.RequestCtx), key)
+	}
+	fctx := &fasthttp.RequestCtx{}
+	fctx.SetRemoteAddr(&net.TCPAddr{IP: net.ParseIP("1.1.1.1"), Port: 1234})
+	fctx.Request.Header.Set(fasthttp.HeaderXForwardedFor, "10.0.0.1")
+	fctx.Request.Header.Set("X-Real-Ip", "10.0.0.1")
+
+	// The forwarded headers spoofed by an untrusted peer do not match
+	matched, err := MatchRule(fctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+
+	// The spoofed hop on the left of the trusted proxy does not match either
+	assert.Nil(t, http.SetTrustedProxies([]string{"1.1.1.1"}))
+	fctx.Request.Header.Set(fasthttp.HeaderXForwardedFor, "10.0.0.1, 2.2.2.2")
+	matched, err = MatchRule(fctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.False(t, matched)
+
+	// The client IP forwarded by the trusted proxy
+	fctx.Request.Header.Set(fasthttp.HeaderXForwardedFor, "2.2.2.2, 10.0.0.1")
+	matched, err = MatchRule(fctx, ruleItem, getString)
+	assert.Nil(t, err)
+	assert.True(t, matched)
+}
+
+func TestGetValue(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.Set("uid", "header")
+	// Keys without source prefix are resolved by getString
+	assert.Equal(t, "666", GetValue(fctx, "uid", nil, fakeGetIntStr))
+	src, err := http.ParseSource("uid")
+	assert.Nil(t, err)
+	assert.Equal(t, "666", GetValue(fctx, "uid", src, fakeGetIntStr))
+
+	src, err = http.ParseSource("header:uid")
+	assert.Nil(t, err)
+	assert.Equal(t, "header", GetValue(fctx, "header:uid", src, fakeGetIntStr))
+	assert.Equal(t, "", GetValue(context.Background(), "header:uid", src, fakeGetIntStr))
+}
+
 func TestJudgeCondition(t *testing.T) {
 	cond := &entity.Condition{
 		Key:  "a",
@@ -334,8 +491,3 @@ func TestJudgeCondition(t *testing.T) {
 	err = parseRuleConditionVal([]*entity.Condition{cond})
 	assert.NotNil(t, err)
 }
-
-func TestReg(t *testing.T) {
-	idList := idxGetReg.FindAllString("0&&1||2", -1)
-	t.Log(idList)
-}
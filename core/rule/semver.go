@@ -0,0 +1,200 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"strings"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// maxSemverParts is the max number of the numeric parts, such as 1.2.3.4
+const maxSemverParts = 4
+
+// semver is the parsed version, such as v1.2.3-beta.1+build.
+// Missing numeric parts are treated as 0, so 1.2 equals 1.2.0.
+type semver struct {
+	parts [maxSemverParts]uint64
+	// pre is the pre-release, a version with pre-release is lower than the release
+	pre string
+}
+
+// parseSemver parses the version, it does not allocate memory
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimSpace(s)
+	if len(s) > 0 && (s[0] == 'v' || s[0] == 'V') {
+		s = s[1:]
+	}
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = s[i+1:]
+		s = s[:i]
+		if v.pre == "" {
+			return v, false
+		}
+	}
+	n := 0
+	for {
+		i := strings.IndexByte(s, '.')
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		if n == maxSemverParts || part == "" {
+			return v, false
+		}
+		for j := 0; j < len(part); j++ {
+			if part[j] < '0' || part[j] > '9' {
+				return v, false
+			}
+			v.parts[n] = v.parts[n]*10 + uint64(part[j]-'0')
+		}
+		n++
+		if i < 0 {
+			return v, true
+		}
+		s = s[i+1:]
+	}
+}
+
+// compareSemver returns -1, 0 or 1 when a is lower than, equal to or greater than b
+func compareSemver(a, b semver) int {
+	for i := range a.parts {
+		if a.parts[i] != b.parts[i] {
+			if a.parts[i] < b.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePreRelease(a.pre, b.pre)
+}
+
+// comparePreRelease compares the pre-release by the dot separated identifiers. Numeric identifiers are compared
+// numerically and are lower than the alphanumeric ones, which are compared in ASCII order.
+func comparePreRelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	for a != "" && b != "" {
+		var idA, idB string
+		idA, a = cutIdentifier(a)
+		idB, b = cutIdentifier(b)
+		if c := compareIdentifier(idA, idB); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// cutIdentifier returns the first identifier of the pre-release and the rest
+func cutIdentifier(s string) (string, string) {
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
+
+// compareIdentifier compares a single pre-release identifier
+func compareIdentifier(a, b string) int {
+	numA, numB := isNumeric(a), isNumeric(b)
+	switch {
+	case numA && numB:
+		a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+	case numA:
+		return -1
+	case numB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// isNumeric checks if the identifier only contains digits
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSemverVal parses the condition value of the semver operators
+func parseSemverVal(val string) (semver, error) {
+	v, ok := parseSemver(val)
+	if !ok {
+		return v, errs.Newf(gerrs.ErrWrongConfig, "invalid semver:%s", val)
+	}
+	return v, nil
+}
+
+// semverCompare compares the version with the parsed version, an invalid version never matches
+func semverCompare(a string, parsedB interface{}, match func(c int) bool) bool {
+	b, ok := parsedB.(semver)
+	if !ok {
+		log.Errorf("invalid parsedB type:%T", parsedB)
+		return false
+	}
+	v, ok := parseSemver(a)
+	if !ok {
+		return false
+	}
+	return match(compareSemver(v, b))
+}
+
+// semverGt is greater than by semver
+func semverGt(a, _ string, parsedB interface{}) bool {
+	return semverCompare(a, parsedB, func(c int) bool { return c > 0 })
+}
+
+// semverGe is greater than or equal to by semver
+func semverGe(a, _ string, parsedB interface{}) bool {
+	return semverCompare(a, parsedB, func(c int) bool { return c >= 0 })
+}
+
+// semverLt is less than by semver
+func semverLt(a, _ string, parsedB interface{}) bool {
+	return semverCompare(a, parsedB, func(c int) bool { return c < 0 })
+}
+
+// semverLe is less than or equal to by semver
+func semverLe(a, _ string, parsedB interface{}) bool {
+	return semverCompare(a, parsedB, func(c int) bool { return c <= 0 })
+}
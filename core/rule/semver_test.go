@@ -0,0 +1,73 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package rule
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSemver(t *testing.T) {
+	v, ok := parseSemver("v1.2.3-beta.1+build.5")
+	assert.True(t, ok)
+	assert.Equal(t, semver{parts: [maxSemverParts]uint64{1, 2, 3}, pre: "beta.1"}, v)
+
+	v, ok = parseSemver(" 6.6.0.1 ")
+	assert.True(t, ok)
+	assert.Equal(t, semver{parts: [maxSemverParts]uint64{6, 6, 0, 1}}, v)
+
+	v, ok = parseSemver("660")
+	assert.True(t, ok)
+	assert.Equal(t, semver{parts: [maxSemverParts]uint64{660}}, v)
+
+	for _, s := range []string{"", "v", "1.", ".1", "1..2", "1.2.3.4.5", "1.x", "1.2-", "-beta", "1.2 .3"} {
+		_, ok = parseSemver(s)
+		assert.False(t, ok, s)
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "1.2.3", b: "1.2.3", want: 0},
+		{a: "1.2", b: "1.2.0", want: 0},
+		{a: "v1.2.3", b: "1.2.3+build", want: 0},
+		{a: "1.10.0", b: "1.9.0", want: 1},
+		{a: "1.2.3", b: "1.2.4", want: -1},
+		{a: "2", b: "1.99.99", want: 1},
+		{a: "1.2.3.1", b: "1.2.3", want: 1},
+		// Pre-release examples from semver.org
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", want: -1},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha.beta", want: -1},
+		{a: "1.0.0-alpha.beta", b: "1.0.0-beta", want: -1},
+		{a: "1.0.0-beta", b: "1.0.0-beta.2", want: -1},
+		{a: "1.0.0-beta.2", b: "1.0.0-beta.11", want: -1},
+		{a: "1.0.0-beta.11", b: "1.0.0-rc.1", want: -1},
+		{a: "1.0.0-rc.1", b: "1.0.0", want: -1},
+		{a: "1.0.0", b: "1.0.0-rc.1", want: 1},
+		{a: "1.0.0-beta.011", b: "1.0.0-beta.11", want: 0},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha", want: 1},
+	}
+	for _, tt := range tests {
+		a, ok := parseSemver(tt.a)
+		assert.True(t, ok, tt.a)
+		b, ok := parseSemver(tt.b)
+		assert.True(t, ok, tt.b)
+		assert.Equal(t, tt.want, compareSemver(a, b), "%s %s", tt.a, tt.b)
+	}
+}
@@ -0,0 +1,352 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package breaker implements the circuit breaker of the target services.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+	"trpc.group/trpc-go/trpc-go/metrics"
+)
+
+// State is the state of the circuit breaker
+type State int
+
+const (
+	// StateClosed lets all requests through
+	StateClosed State = iota
+	// StateOpen rejects all requests
+	StateOpen
+	// StateHalfOpen lets a few probing requests through
+	StateHalfOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "unknown"
+}
+
+const (
+	// ScopeService shares the circuit breaker between the routers of the same upstream service
+	ScopeService = "service"
+	// ScopeRouter uses a circuit breaker for each router
+	ScopeRouter = "router"
+)
+
+const (
+	defaultWindow           = 10
+	defaultMinRequests      = 20
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenRequests = 5
+)
+
+// Options are the options of the circuit breaker parsed from entity.CircuitBreakerConfig, which are comparable so
+// that the circuit breakers of the same service and options can be shared
+type Options struct {
+	Window           int
+	MinRequests      int
+	ErrorRatio       float64
+	SlowCallDuration time.Duration
+	SlowCallRatio    float64
+	OpenDuration     time.Duration
+	HalfOpenRequests int
+}
+
+// NewOptions validates the configuration and sets the default values
+func NewOptions(conf *entity.CircuitBreakerConfig) (Options, error) {
+	if conf.Scope != "" && conf.Scope != ScopeService && conf.Scope != ScopeRouter {
+		return Options{}, errs.Newf(gerrs.ErrWrongConfig, "invalid circuit breaker scope:%s", conf.Scope)
+	}
+	if conf.Window < 0 || conf.MinRequests < 0 || conf.SlowCallDuration < 0 || conf.OpenDuration < 0 ||
+		conf.HalfOpenRequests < 0 {
+		return Options{}, errs.New(gerrs.ErrWrongConfig, "circuit breaker options can not be negative")
+	}
+	if conf.ErrorRatio < 0 || conf.ErrorRatio > 1 || conf.SlowCallRatio < 0 || conf.SlowCallRatio > 1 {
+		return Options{}, errs.New(gerrs.ErrWrongConfig, "circuit breaker ratios must be between 0 and 1")
+	}
+	if conf.ErrorRatio == 0 && conf.SlowCallRatio == 0 {
+		return Options{}, errs.New(gerrs.ErrWrongConfig, "circuit breaker requires error ratio or slow call ratio")
+	}
+	if conf.SlowCallRatio > 0 && conf.SlowCallDuration == 0 {
+		return Options{}, errs.New(gerrs.ErrWrongConfig, "circuit breaker slow call ratio requires slow call duration")
+	}
+	opts := Options{
+		Window:           conf.Window,
+		MinRequests:      conf.MinRequests,
+		ErrorRatio:       conf.ErrorRatio,
+		SlowCallDuration: time.Duration(conf.SlowCallDuration) * time.Millisecond,
+		SlowCallRatio:    conf.SlowCallRatio,
+		OpenDuration:     time.Duration(conf.OpenDuration) * time.Second,
+		HalfOpenRequests: conf.HalfOpenRequests,
+	}
+	if opts.Window == 0 {
+		opts.Window = defaultWindow
+	}
+	if opts.MinRequests == 0 {
+		opts.MinRequests = defaultMinRequests
+	}
+	if opts.OpenDuration == 0 {
+		opts.OpenDuration = defaultOpenDuration
+	}
+	if opts.HalfOpenRequests == 0 {
+		opts.HalfOpenRequests = defaultHalfOpenRequests
+	}
+	return opts, nil
+}
+
+// bucket is the counts of a second in the rolling window
+type bucket struct {
+	second   int64
+	total    int
+	failures int
+	slow     int
+}
+
+// Breaker is the circuit breaker, which is safe for concurrent use
+type Breaker struct {
+	name string
+	opts Options
+	now  func() time.Time
+
+	mu    sync.Mutex
+	state State
+	// generation changes with the state, so that the results of the requests allowed in a previous state are ignored
+	generation uint64
+	openUntil  time.Time
+	buckets    []bucket
+	// probes and successes are the numbers of the probing requests and their successes in the half-open state
+	probes    int
+	successes int
+}
+
+// New creates a circuit breaker, the name is used to report the state transitions
+func New(name string, opts Options) *Breaker {
+	return &Breaker{
+		name:    name,
+		opts:    opts,
+		now:     time.Now,
+		buckets: make([]bucket, opts.Window),
+	}
+}
+
+// Name returns the name of the circuit breaker
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state of the circuit breaker
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow checks if the request can be sent, and returns the generation which must be passed to Report with the result
+func (b *Breaker) Allow() (uint64, bool) {
+	b.mu.Lock()
+	from, now := b.state, b.now()
+	if b.state == StateOpen && !now.Before(b.openUntil) {
+		b.setState(StateHalfOpen, now)
+	}
+	allowed := true
+	switch b.state {
+	case StateOpen:
+		allowed = false
+	case StateHalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			allowed = false
+		} else {
+			b.probes++
+		}
+	}
+	generation, to := b.generation, b.state
+	b.mu.Unlock()
+	b.report(from, to)
+	return generation, allowed
+}
+
+// Report reports the result of the request allowed in the generation
+func (b *Breaker) Report(generation uint64, failed bool, cost time.Duration) {
+	slow := b.opts.SlowCallRatio > 0 && cost >= b.opts.SlowCallDuration
+	b.mu.Lock()
+	from, now := b.state, b.now()
+	if generation == b.generation {
+		switch b.state {
+		case StateClosed:
+			b.record(now, failed, slow)
+		case StateHalfOpen:
+			b.probe(now, failed || slow)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.report(from, to)
+}
+
+// Release gives back the request allowed in the generation without reporting its result, such as the request
+// canceled by the client, so that the half-open circuit breaker can send another probing request
+func (b *Breaker) Release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation == b.generation && b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// record counts the result in the rolling window, and opens the circuit breaker if any ratio exceeds the threshold
+func (b *Breaker) record(now time.Time, failed, slow bool) {
+	second := now.Unix()
+	bk := &b.buckets[second%int64(len(b.buckets))]
+	if bk.second != second {
+		*bk = bucket{second: second}
+	}
+	bk.total++
+	if failed {
+		bk.failures++
+	}
+	if slow {
+		bk.slow++
+	}
+	var total, failures, slowCalls int
+	for _, bk := range b.buckets {
+		if second-bk.second < int64(len(b.buckets)) {
+			total += bk.total
+			failures += bk.failures
+			slowCalls += bk.slow
+		}
+	}
+	if total < b.opts.MinRequests {
+		return
+	}
+	if (b.opts.ErrorRatio > 0 && float64(failures) >= b.opts.ErrorRatio*float64(total)) ||
+		(b.opts.SlowCallRatio > 0 && float64(slowCalls) >= b.opts.SlowCallRatio*float64(total)) {
+		b.setState(StateOpen, now)
+	}
+}
+
+// probe counts the result of the probing request, any failure opens the circuit breaker again
+func (b *Breaker) probe(now time.Time, failed bool) {
+	if failed {
+		b.setState(StateOpen, now)
+		return
+	}
+	b.successes++
+	if b.successes >= b.opts.HalfOpenRequests {
+		b.setState(StateClosed, now)
+	}
+}
+
+// setState changes the state and resets the counts
+func (b *Breaker) setState(state State, now time.Time) {
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case StateOpen:
+		b.openUntil = now.Add(b.opts.OpenDuration)
+	case StateClosed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+}
+
+// report reports the state transition
+func (b *Breaker) report(from, to State) {
+	if from == to {
+		return
+	}
+	log.Warnf("circuit breaker %s changes from %s to %s", b.name, from, to)
+	DefaultReportState(b.name, from, to)
+}
+
+// ReportStateFunc is a function type used for reporting the state transitions of the circuit breakers.
+type ReportStateFunc func(name string, from, to State)
+
+// DefaultReportState is the default function of reporting the state transitions. It can be overridden by the user.
+var DefaultReportState ReportStateFunc = func(name string, from, to State) {
+	dims := []*metrics.Dimension{
+		{
+			Name:  "circuit_breaker",
+			Value: name,
+		},
+		{
+			Name:  "from",
+			Value: from.String(),
+		},
+		{
+			Name:  "to",
+			Value: to.String(),
+		},
+	}
+	indices := []*metrics.Metrics{
+		metrics.NewMetrics("circuit_breaker_state_count", float64(1), metrics.PolicySUM),
+	}
+	err := metrics.Report(metrics.NewMultiDimensionMetricsX(gerrs.GatewayERRKey, dims, indices))
+	if err != nil {
+		log.Errorf("report circuit breaker state failed:%s", err)
+	}
+}
+
+// IsFailure checks if the error of the upstream request is counted as a failure, which includes the framework errors
+// such as connect errors and timeouts, and the upstream HTTP status 5xx. Business errors are not failures, and the
+// requests canceled by the client are not counted.
+func IsFailure(ctx context.Context, fctx *fasthttp.RequestCtx, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errs.Code(err) == gerrs.ErrUpstreamRspErr {
+		return fctx != nil && fctx.Response.StatusCode() >= fasthttp.StatusInternalServerError
+	}
+	var e *errs.Error
+	return errors.As(err, &e) && e.Type == errs.ErrorTypeFramework
+}
+
+// Fallback writes the fallback response while the circuit breaker is open, the error is returned if there is no
+// static response body
+func Fallback(fctx *fasthttp.RequestCtx, fallback *entity.CircuitBreakerFallback, name string) error {
+	if fallback != nil && fallback.Body != "" {
+		status := fallback.Status
+		if status == 0 {
+			status = fasthttp.StatusOK
+		}
+		fctx.Response.Reset()
+		fctx.SetStatusCode(status)
+		if fallback.ContentType != "" {
+			fctx.SetContentType(fallback.ContentType)
+		}
+		fctx.SetBodyString(fallback.Body)
+		return nil
+	}
+	if fallback != nil && fallback.Code != 0 {
+		return errs.New(fallback.Code, "circuit breaker open:"+name)
+	}
+	return errs.New(gerrs.ErrCircuitBreakerOpen, "circuit breaker open:"+name)
+}
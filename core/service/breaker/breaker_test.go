@@ -0,0 +1,236 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func TestNewOptions(t *testing.T) {
+	opts, err := NewOptions(&entity.CircuitBreakerConfig{ErrorRatio: 0.5})
+	assert.Nil(t, err)
+	assert.Equal(t, Options{
+		Window:           defaultWindow,
+		MinRequests:      defaultMinRequests,
+		ErrorRatio:       0.5,
+		OpenDuration:     defaultOpenDuration,
+		HalfOpenRequests: defaultHalfOpenRequests,
+	}, opts)
+
+	opts, err = NewOptions(&entity.CircuitBreakerConfig{
+		Scope:            ScopeRouter,
+		Window:           5,
+		MinRequests:      10,
+		SlowCallDuration: 200,
+		SlowCallRatio:    0.8,
+		OpenDuration:     3,
+		HalfOpenRequests: 2,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, Options{
+		Window:           5,
+		MinRequests:      10,
+		SlowCallDuration: 200 * time.Millisecond,
+		SlowCallRatio:    0.8,
+		OpenDuration:     3 * time.Second,
+		HalfOpenRequests: 2,
+	}, opts)
+
+	for _, conf := range []*entity.CircuitBreakerConfig{
+		{Scope: "global", ErrorRatio: 0.5},
+		{Window: -1, ErrorRatio: 0.5},
+		{ErrorRatio: 1.5},
+		{SlowCallRatio: -0.1, SlowCallDuration: 100},
+		{},
+		{SlowCallRatio: 0.5},
+	} {
+		_, err := NewOptions(conf)
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err))
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	var reports []string
+	old := DefaultReportState
+	defer func() { DefaultReportState = old }()
+	DefaultReportState = func(name string, from, to State) {
+		reports = append(reports, name+":"+from.String()+"->"+to.String())
+	}
+
+	now := time.Unix(1000, 0)
+	b := New("svr", Options{
+		Window:           2,
+		MinRequests:      4,
+		ErrorRatio:       0.5,
+		OpenDuration:     time.Second,
+		HalfOpenRequests: 2,
+	})
+	b.now = func() time.Time { return now }
+	assert.Equal(t, "svr", b.Name())
+
+	// Not opened below the minimum requests
+	for i := 0; i < 3; i++ {
+		gen, ok := b.Allow()
+		assert.True(t, ok)
+		b.Report(gen, true, 0)
+	}
+	assert.Equal(t, StateClosed, b.State())
+
+	// The counts out of the window are dropped
+	now = now.Add(2 * time.Second)
+	gen, _ := b.Allow()
+	b.Report(gen, true, 0)
+	assert.Equal(t, StateClosed, b.State())
+	for i := 0; i < 3; i++ {
+		gen, _ := b.Allow()
+		b.Report(gen, false, 0)
+	}
+	assert.Equal(t, StateClosed, b.State())
+	now = now.Add(time.Second)
+	gen, _ = b.Allow()
+	b.Report(gen, true, 0)
+	assert.Equal(t, StateClosed, b.State())
+	gen, _ = b.Allow()
+	b.Report(gen, true, 0)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Rejected while open, and the results of the previous generation are ignored
+	_, ok := b.Allow()
+	assert.False(t, ok)
+	b.Report(gen, false, 0)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Half-open after the open duration, a failed probe opens again
+	now = now.Add(time.Second)
+	gen, ok = b.Allow()
+	assert.True(t, ok)
+	assert.Equal(t, StateHalfOpen, b.State())
+	b.Report(gen, true, 0)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Only the configured number of probes are allowed, and all successes close
+	now = now.Add(time.Second)
+	gen1, ok := b.Allow()
+	assert.True(t, ok)
+	gen2, ok := b.Allow()
+	assert.True(t, ok)
+	_, ok = b.Allow()
+	assert.False(t, ok)
+	// The released probe allows another one
+	b.Release(gen2)
+	gen2, ok = b.Allow()
+	assert.True(t, ok)
+	b.Report(gen1, false, 0)
+	assert.Equal(t, StateHalfOpen, b.State())
+	b.Report(gen2, false, 0)
+	assert.Equal(t, StateClosed, b.State())
+	// Released in the closed state
+	b.Release(gen2)
+	assert.Equal(t, StateClosed, b.State())
+
+	assert.Equal(t, []string{
+		"svr:closed->open",
+		"svr:open->half_open",
+		"svr:half_open->open",
+		"svr:open->half_open",
+		"svr:half_open->closed",
+	}, reports)
+}
+
+func TestBreaker_slowCall(t *testing.T) {
+	b := New("svr", Options{
+		Window:           10,
+		MinRequests:      2,
+		SlowCallDuration: 100 * time.Millisecond,
+		SlowCallRatio:    1,
+		OpenDuration:     time.Second,
+		HalfOpenRequests: 1,
+	})
+	gen, _ := b.Allow()
+	b.Report(gen, false, 200*time.Millisecond)
+	gen, _ = b.Allow()
+	b.Report(gen, false, 50*time.Millisecond)
+	assert.Equal(t, StateClosed, b.State())
+	gen, _ = b.Allow()
+	b.Report(gen, false, 100*time.Millisecond)
+	gen, _ = b.Allow()
+	b.Report(gen, false, time.Second)
+	assert.Equal(t, StateClosed, b.State())
+
+	b = New("svr", Options{
+		Window:           10,
+		MinRequests:      2,
+		SlowCallDuration: 100 * time.Millisecond,
+		SlowCallRatio:    1,
+		OpenDuration:     time.Second,
+		HalfOpenRequests: 1,
+	})
+	for i := 0; i < 2; i++ {
+		gen, _ := b.Allow()
+		b.Report(gen, false, time.Second)
+	}
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestState_String(t *testing.T) {
+	assert.Equal(t, "closed", StateClosed.String())
+	assert.Equal(t, "open", StateOpen.String())
+	assert.Equal(t, "half_open", StateHalfOpen.String())
+	assert.Equal(t, "unknown", State(10).String())
+}
+
+func TestDefaultReportState(t *testing.T) {
+	DefaultReportState("svr", StateClosed, StateOpen)
+}
+
+func TestIsFailure(t *testing.T) {
+	ctx := context.Background()
+	fctx := &fasthttp.RequestCtx{}
+	assert.False(t, IsFailure(ctx, fctx, nil))
+	assert.True(t, IsFailure(ctx, fctx, errs.NewFrameError(errs.RetClientConnectFail, "dial")))
+	assert.True(t, IsFailure(ctx, fctx, gerrs.Wrap(errs.NewFrameError(errs.RetClientTimeout, "timeout"), "invoke")))
+	assert.False(t, IsFailure(ctx, fctx, errs.New(10001, "business err")))
+	assert.False(t, IsFailure(ctx, fctx, errors.New("err")))
+
+	fctx.SetStatusCode(fasthttp.StatusBadGateway)
+	assert.True(t, IsFailure(ctx, fctx, errs.New(gerrs.ErrUpstreamRspErr, "rsp err")))
+	fctx.SetStatusCode(fasthttp.StatusNotFound)
+	assert.False(t, IsFailure(ctx, fctx, errs.New(gerrs.ErrUpstreamRspErr, "rsp err")))
+
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, IsFailure(ctx, fctx, errs.NewFrameError(errs.RetClientConnectFail, "dial")))
+}
+
+func TestFallback(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	err := Fallback(fctx, nil, "svr")
+	assert.Equal(t, gerrs.ErrCircuitBreakerOpen, errs.Code(err))
+	err = Fallback(fctx, &entity.CircuitBreakerFallback{Code: 10001}, "svr")
+	assert.Equal(t, 10001, int(errs.Code(err)))
+
+	assert.Nil(t, Fallback(fctx, &entity.CircuitBreakerFallback{Body: "busy", ContentType: "text/plain"}, "svr"))
+	assert.Equal(t, fasthttp.StatusOK, fctx.Response.StatusCode())
+	assert.Equal(t, "text/plain", string(fctx.Response.Header.ContentType()))
+	assert.Equal(t, "busy", string(fctx.Response.Body()))
+}
@@ -116,6 +116,10 @@ func setGatewayHeader(ctx context.Context) error {
 	// Proxy latency
 	fctx.Response.Header.Set(ghttp.XProxyLatencyHeader,
 		fmt.Sprint(time.Since(fctx.ConnTime()).Milliseconds()-upstreamLatency))
+	// Set the cookies issued by the gateway, such as the sticky target cookie
+	for _, cookie := range gwMsg.RspCookies() {
+		fctx.Response.Header.Add(fasthttp.HeaderSetCookie, cookie)
+	}
 	// Set router_id
 	if !gtrpc.DefaultIsProduction() {
 		fctx.Response.Header.Set(ghttp.XRouterIDHeader, gwMsg.RouterID())
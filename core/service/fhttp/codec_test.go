@@ -21,6 +21,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
 	ghttp "trpc.group/trpc-go/trpc-gateway/common/http"
 	trpc "trpc.group/trpc-go/trpc-go"
 	"trpc.group/trpc-go/trpc-go/codec"
@@ -45,6 +46,19 @@ func TestServerCodec_Encode(t *testing.T) {
 	_, err = c.Encode(msg, nil)
 	assert.Nil(t, err)
 
+	// Cookies issued by the gateway
+	ctx, _ = gwmsg.WithNewGWMessage(trpc.BackgroundContext())
+	gwmsg.GwMessage(ctx).WithRspCookie("gw_sticky=abc; path=/")
+	fctx = &fasthttp.RequestCtx{}
+	ctx = ghttp.WithRequestContext(ctx, fctx)
+	_, msg = codec.WithNewMessage(ctx)
+	_, err = c.Encode(msg, nil)
+	assert.Nil(t, err)
+	cookie := &fasthttp.Cookie{}
+	cookie.SetKey("gw_sticky")
+	assert.True(t, fctx.Response.Header.Cookie(cookie))
+	assert.Equal(t, "abc", string(cookie.Value()))
+
 	ctx = ghttp.WithRequestContext(ctx, &fasthttp.RequestCtx{})
 	_, msg = codec.WithNewMessage(ctx)
 	msg.WithServerRspErr(errs.New(102, "err"))
@@ -17,18 +17,25 @@ import (
 	"context"
 	"time"
 
+	"github.com/valyala/fasthttp"
 	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
 	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
 	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-gateway/core/service/breaker"
 	"trpc.group/trpc-go/trpc-gateway/core/service/protocol"
 	"trpc.group/trpc-go/trpc-go/client"
 	"trpc.group/trpc-go/trpc-go/codec"
 	terrs "trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
 )
 
 var h = &handler{}
 
+// errCircuitBreakerOpen is returned by invoke if the circuit breaker of the target service is open
+var errCircuitBreakerOpen = terrs.New(gerrs.ErrCircuitBreakerOpen, "circuit breaker open")
+
 // handler is a router handler
 type handler struct {
 	router router.Router
@@ -53,7 +60,56 @@ func (h *handler) HTTPHandler(ctx context.Context) error {
 	if cliConf == nil {
 		return terrs.New(gerrs.ErrContextNoServiceVal, "get no target service")
 	}
+	targetService := targetServiceFromContext(ctx)
+	// Copy the sampled request before forwarding, which is modified by the protocol conversion
+	sr := newShadowRequest(ctx, fCtx, targetService)
+	err := h.forward(ctx, fCtx, msg, cliConf, targetService)
+	if sr != nil {
+		h.shadow(ctx, sr, fCtx, err)
+	}
+	return err
+}
 
+// forward forwards the request to the target service, and fails over to the other target services if possible
+func (h *handler) forward(ctx context.Context, fCtx *fasthttp.RequestCtx, msg codec.Msg,
+	cliConf *client.BackendConfig, targetService *entity.TargetService) error {
+	gwMsg := gwmsg.GwMessage(ctx)
+	for {
+		// Fail over to the target services of larger priorities on connect errors, timeouts and overload errors
+		next := router.NextFailoverTarget(targetService)
+		err := h.invoke(ctx, fCtx, msg, cliConf, targetService, next != nil)
+		if err == errCircuitBreakerOpen {
+			fallback := targetService.CircuitBreaker.Fallback
+			if fallback == nil || !fallback.Failover || next == nil {
+				return breaker.Fallback(fCtx, fallback, router.GetBreaker(targetService).Name())
+			}
+			log.WarnContextf(ctx, "circuit breaker of service:%s is open, fail over to service:%s",
+				targetService.Service, next.Service)
+			targetService, cliConf = next, next.BackendConfig
+			gwMsg.WithTargetService(cliConf)
+			router.RewriteFailoverTarget(ctx, targetService)
+			continue
+		}
+		failed := router.IsFailoverErr(ctx, fCtx, err)
+		router.ReportTarget(targetService, failed)
+		// The non-idempotent requests that may have been applied by the upstream are not sent again
+		if !failed || next == nil || !router.CanFailover(targetService, fCtx, err) {
+			return err
+		}
+		log.WarnContextf(ctx, "fail over from service:%s to service:%s, err:%s", targetService.Service,
+			next.Service, err)
+		targetService, cliConf = next, next.BackendConfig
+		gwMsg.WithTargetService(cliConf)
+		// Rewrite the original path with the rewrite of the target service
+		router.RewriteFailoverTarget(ctx, targetService)
+	}
+}
+
+// invoke forwards the request to the target service, the failover errors are returned as is if the request can fail
+// over to another target service
+func (h *handler) invoke(ctx context.Context, fCtx *fasthttp.RequestCtx, msg codec.Msg,
+	cliConf *client.BackendConfig, targetService *entity.TargetService, canFailover bool) error {
+	gwMsg := gwmsg.GwMessage(ctx)
 	opts := []client.Option{
 		client.WithNetwork(cliConf.Network),
 		client.WithTarget(cliConf.Target),
@@ -68,6 +124,10 @@ func (h *handler) HTTPHandler(ctx context.Context) error {
 	if cliConf.DisableServiceRouter {
 		opts = append(opts, client.WithDisableServiceRouter())
 	}
+	// Set the timeout and the retry policy of the route, which override the client configuration
+	if targetService != nil {
+		opts = append(opts, routeCliOptions(targetService)...)
+	}
 	// Set custom options
 	opts = append(opts, gwMsg.TRPCClientOpts()...)
 	for k, v := range msg.ServerMetaData() {
@@ -76,6 +136,8 @@ func (h *handler) HTTPHandler(ctx context.Context) error {
 	msg.WithClientRPCName(string(fCtx.Path()))
 	msg.WithCalleeServiceName(cliConf.ServiceName)
 	msg.WithCalleeMethod(gwmsg.GwMessage(ctx).UpstreamMethod())
+	// The retry filter updates the number of attempts if the route is retried
+	gwMsg.WithUpstreamAttempts(1)
 
 	// Protocol conversion
 	pt, err := protocol.GetCliProtocolHandler(cliConf.Protocol)
@@ -102,7 +164,30 @@ func (h *handler) HTTPHandler(ctx context.Context) error {
 	if err != nil {
 		return gerrs.Wrap(err, "transform rsp body err")
 	}
-	if err := client.DefaultClient.Invoke(ctx, reqBody, rspBody, opts...); err != nil {
+	// Reject the request if the circuit breaker of the target service is open. The breaker is checked right before
+	// the request is sent, so that every allowed request is reported.
+	cb := router.GetBreaker(targetService)
+	var generation uint64
+	if cb != nil {
+		var allowed bool
+		if generation, allowed = cb.Allow(); !allowed {
+			return errCircuitBreakerOpen
+		}
+	}
+	start := time.Now()
+	err = client.DefaultClient.Invoke(ctx, reqBody, rspBody, opts...)
+	if cb != nil {
+		// The request canceled by the client tells nothing about the target service
+		if ctx.Err() != nil {
+			cb.Release(generation)
+		} else {
+			cb.Report(generation, breaker.IsFailure(ctx, fCtx, err), time.Since(start))
+		}
+	}
+	if err != nil {
+		if canFailover && router.IsFailoverErr(ctx, fCtx, err) && router.CanFailover(targetService, fCtx, err) {
+			return err
+		}
 		err = pt.HandleErr(ctx, err)
 		if err == nil {
 			return nil
@@ -111,3 +196,17 @@ func (h *handler) HTTPHandler(ctx context.Context) error {
 	}
 	return pt.HandleRspBody(ctx, rspBody)
 }
+
+// targetServiceKey is the context key of the matched target service
+type targetServiceKey struct{}
+
+// withTargetService saves the matched target service in the context
+func withTargetService(ctx context.Context, targetService *entity.TargetService) context.Context {
+	return context.WithValue(ctx, targetServiceKey{}, targetService)
+}
+
+// targetServiceFromContext returns the matched target service, nil is returned if there is none
+func targetServiceFromContext(ctx context.Context) *entity.TargetService {
+	targetService, _ := ctx.Value(targetServiceKey{}).(*entity.TargetService)
+	return targetService
+}
@@ -17,20 +17,25 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/prashantv/gostub"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
 	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
 	"trpc.group/trpc-go/trpc-gateway/common/http"
 	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-gateway/core/service/breaker"
 	"trpc.group/trpc-go/trpc-gateway/core/service/protocol"
 	pmock "trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
 	trpc "trpc.group/trpc-go/trpc-go"
 	"trpc.group/trpc-go/trpc-go/client"
 	"trpc.group/trpc-go/trpc-go/client/mockclient"
 	"trpc.group/trpc-go/trpc-go/codec"
+	terrs "trpc.group/trpc-go/trpc-go/errs"
 )
 
 type fakeRouter struct{}
@@ -162,3 +167,328 @@ func Test_handler_HTTPHandler(t *testing.T) {
 	err = h.HTTPHandler(ctx)
 	assert.NotNil(t, err)
 }
+
+func Test_handler_HTTPHandler_failover(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	mockClient := mockclient.NewMockClient(ctrl)
+	stub.Stub(&client.DefaultClient, mockClient)
+
+	mockCliProtocol := pmock.NewMockCliProtocolHandler(ctrl)
+	protocol.RegisterCliProtocolHandler("fasthttp", mockCliProtocol)
+	mockCliProtocol.EXPECT().GetCliOptions(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().WithCtx(gomock.Any()).Return(context.Background(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransRspBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().HandleErr(gomock.Any(), gomock.Any()).Return(errors.New("err")).AnyTimes()
+	mockCliProtocol.EXPECT().HandleRspBody(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	newClient := func(name string) *entity.BackendConfig {
+		return &entity.BackendConfig{BackendConfig: client.BackendConfig{
+			ServiceName: name,
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}}
+	}
+	item := &entity.RouterItem{
+		Method:   "/user/info",
+		Failover: &entity.FailoverConfig{MaxFailures: 2},
+		TargetService: []*entity.TargetService{
+			{Service: "primary"},
+			{Service: "backup", Priority: 1},
+		},
+	}
+	err := router.NewFastHTTPRouter().InitRouterConfig(context.Background(), &entity.ProxyConfig{
+		Router: []*entity.RouterItem{item},
+		Client: []*entity.BackendConfig{newClient("primary"), newClient("backup")},
+	})
+	assert.Nil(t, err)
+	primary, backup := item.TargetService[0], item.TargetService[1]
+
+	newMethodCtx := func(method string) (context.Context, gwmsg.GwMsg) {
+		ctx, gMsg := gwmsg.WithNewGWMessage(context.Background())
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.Header.SetMethod(method)
+		ctx = http.WithRequestContext(ctx, fctx)
+		ctx, _ = codec.WithNewMessage(ctx)
+		gMsg.WithTargetService(primary.BackendConfig)
+		return withTargetService(ctx, primary), gMsg
+	}
+	newCtx := func() (context.Context, gwmsg.GwMsg) {
+		return newMethodCtx(fasthttp.MethodGet)
+	}
+
+	// Fail over to the backup on connect errors
+	ctx, gMsg := newCtx()
+	gomock.InOrder(
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(terrs.NewFrameError(terrs.RetClientConnectFail, "dial")),
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+	)
+	assert.Nil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, "backup", gMsg.TargetService().ServiceName)
+
+	// Not failed over on the other errors
+	ctx, gMsg = newCtx()
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.New(10001, "business err")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, "primary", gMsg.TargetService().ServiceName)
+
+	// The POST request may have been applied after the timeout, so it is not sent to the backup again
+	ctx, gMsg = newMethodCtx(fasthttp.MethodPost)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientTimeout, "timeout")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, "primary", gMsg.TargetService().ServiceName)
+
+	// The POST request fails over on connect errors, since it was never sent
+	ctx, gMsg = newMethodCtx(fasthttp.MethodPost)
+	gomock.InOrder(
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(terrs.NewFrameError(terrs.RetClientConnectFail, "dial")),
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+	)
+	assert.Nil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, "backup", gMsg.TargetService().ServiceName)
+
+	// The backup fails as well
+	ctx, _ = newCtx()
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientTimeout, "timeout")).Times(2)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	assert.NotNil(t, primary.Health)
+	assert.Nil(t, router.NextFailoverTarget(backup))
+}
+
+func Test_handler_HTTPHandler_failoverNonIdempotent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	mockClient := mockclient.NewMockClient(ctrl)
+	stub.Stub(&client.DefaultClient, mockClient)
+
+	mockCliProtocol := pmock.NewMockCliProtocolHandler(ctrl)
+	protocol.RegisterCliProtocolHandler("fasthttp", mockCliProtocol)
+	mockCliProtocol.EXPECT().GetCliOptions(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().WithCtx(gomock.Any()).Return(context.Background(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransRspBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().HandleErr(gomock.Any(), gomock.Any()).Return(errors.New("err")).AnyTimes()
+	mockCliProtocol.EXPECT().HandleRspBody(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	newClient := func(name string) *entity.BackendConfig {
+		return &entity.BackendConfig{BackendConfig: client.BackendConfig{
+			ServiceName: name,
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}}
+	}
+	item := &entity.RouterItem{
+		Method:   "/user/info",
+		Failover: &entity.FailoverConfig{NonIdempotent: true},
+		TargetService: []*entity.TargetService{
+			{Service: "primary"},
+			{Service: "backup", Priority: 1},
+		},
+	}
+	err := router.NewFastHTTPRouter().InitRouterConfig(context.Background(), &entity.ProxyConfig{
+		Router: []*entity.RouterItem{item},
+		Client: []*entity.BackendConfig{newClient("primary"), newClient("backup")},
+	})
+	assert.Nil(t, err)
+	primary := item.TargetService[0]
+
+	// The POST request fails over after the timeout if opted in
+	ctx, gMsg := gwmsg.WithNewGWMessage(context.Background())
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx = http.WithRequestContext(ctx, fctx)
+	ctx, _ = codec.WithNewMessage(ctx)
+	gMsg.WithTargetService(primary.BackendConfig)
+	gomock.InOrder(
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(terrs.NewFrameError(terrs.RetClientTimeout, "timeout")),
+		mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil),
+	)
+	assert.Nil(t, h.HTTPHandler(withTargetService(ctx, primary)))
+	assert.Equal(t, "backup", gMsg.TargetService().ServiceName)
+}
+
+func Test_handler_HTTPHandler_circuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	mockClient := mockclient.NewMockClient(ctrl)
+	stub.Stub(&client.DefaultClient, mockClient)
+
+	mockCliProtocol := pmock.NewMockCliProtocolHandler(ctrl)
+	protocol.RegisterCliProtocolHandler("fasthttp", mockCliProtocol)
+	mockCliProtocol.EXPECT().GetCliOptions(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().WithCtx(gomock.Any()).Return(context.Background(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransRspBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().HandleErr(gomock.Any(), gomock.Any()).Return(errors.New("err")).AnyTimes()
+	mockCliProtocol.EXPECT().HandleRspBody(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	newClient := func(name string) *entity.BackendConfig {
+		return &entity.BackendConfig{BackendConfig: client.BackendConfig{
+			ServiceName: name,
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}}
+	}
+	newItem := func(fallback *entity.CircuitBreakerFallback, svrs ...*entity.TargetService) *entity.RouterItem {
+		item := &entity.RouterItem{
+			Method: "/user/info",
+			CircuitBreaker: &entity.CircuitBreakerConfig{
+				Scope:       "router",
+				MinRequests: 1,
+				ErrorRatio:  0.5,
+				Fallback:    fallback,
+			},
+			TargetService: svrs,
+		}
+		err := router.NewFastHTTPRouter().InitRouterConfig(context.Background(), &entity.ProxyConfig{
+			Router: []*entity.RouterItem{item},
+			Client: []*entity.BackendConfig{newClient("primary"), newClient("backup")},
+		})
+		assert.Nil(t, err)
+		return item
+	}
+	newCtx := func(svr *entity.TargetService) (context.Context, gwmsg.GwMsg, *fasthttp.RequestCtx) {
+		fctx := &fasthttp.RequestCtx{}
+		ctx, gMsg := gwmsg.WithNewGWMessage(context.Background())
+		ctx = http.WithRequestContext(ctx, fctx)
+		ctx, _ = codec.WithNewMessage(ctx)
+		gMsg.WithTargetService(svr.BackendConfig)
+		return withTargetService(ctx, svr), gMsg, fctx
+	}
+
+	// The circuit breaker opens on the error and rejects the next request with the error code
+	item := newItem(nil, &entity.TargetService{Service: "primary"})
+	primary := item.TargetService[0]
+	ctx, _, _ := newCtx(primary)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientNetErr, "reset")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	ctx, _, _ = newCtx(primary)
+	assert.Equal(t, gerrs.ErrCircuitBreakerOpen, terrs.Code(h.HTTPHandler(ctx)))
+
+	// The static response body
+	item = newItem(&entity.CircuitBreakerFallback{Body: `{"code":1}`, ContentType: "application/json", Status: 503},
+		&entity.TargetService{Service: "primary"})
+	primary = item.TargetService[0]
+	ctx, _, _ = newCtx(primary)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientNetErr, "reset")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	ctx, _, fctx := newCtx(primary)
+	assert.Nil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, 503, fctx.Response.StatusCode())
+	assert.Equal(t, `{"code":1}`, string(fctx.Response.Body()))
+
+	// Fail over to the backup
+	item = newItem(&entity.CircuitBreakerFallback{Failover: true},
+		&entity.TargetService{Service: "primary"}, &entity.TargetService{Service: "backup", Priority: 1})
+	primary = item.TargetService[0]
+	ctx, _, _ = newCtx(primary)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.New(10001, "business err")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, breaker.StateClosed, router.GetBreaker(primary).State())
+	ctx, _, _ = newCtx(primary)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientNetErr, "reset")).Times(1)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	assert.Nil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, breaker.StateOpen, router.GetBreaker(primary).State())
+	ctx, gMsg, _ := newCtx(primary)
+	assert.Nil(t, h.HTTPHandler(ctx))
+	assert.Equal(t, "backup", gMsg.TargetService().ServiceName)
+}
+
+func Test_handler_HTTPHandler_circuitBreakerProbe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	mockClient := mockclient.NewMockClient(ctrl)
+	stub.Stub(&client.DefaultClient, mockClient)
+
+	mockCliProtocol := pmock.NewMockCliProtocolHandler(ctrl)
+	protocol.RegisterCliProtocolHandler("fasthttp", mockCliProtocol)
+	mockCliProtocol.EXPECT().GetCliOptions(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().WithCtx(gomock.Any()).DoAndReturn(func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}).AnyTimes()
+	mockCliProtocol.EXPECT().TransRspBody(gomock.Any()).Return(gomock.Any(), nil).AnyTimes()
+	mockCliProtocol.EXPECT().HandleErr(gomock.Any(), gomock.Any()).Return(errors.New("err")).AnyTimes()
+	mockCliProtocol.EXPECT().HandleRspBody(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	item := &entity.RouterItem{
+		Method: "/user/info",
+		CircuitBreaker: &entity.CircuitBreakerConfig{
+			Scope:            "router",
+			MinRequests:      1,
+			ErrorRatio:       0.5,
+			OpenDuration:     1,
+			HalfOpenRequests: 1,
+		},
+		TargetService: []*entity.TargetService{{Service: "primary"}},
+	}
+	err := router.NewFastHTTPRouter().InitRouterConfig(context.Background(), &entity.ProxyConfig{
+		Router: []*entity.RouterItem{item},
+		Client: []*entity.BackendConfig{{BackendConfig: client.BackendConfig{
+			ServiceName: "primary",
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}}},
+	})
+	assert.Nil(t, err)
+	primary := item.TargetService[0]
+	cb := router.GetBreaker(primary)
+	newCtx := func(ctx context.Context) context.Context {
+		ctx, gMsg := gwmsg.WithNewGWMessage(ctx)
+		ctx = http.WithRequestContext(ctx, &fasthttp.RequestCtx{})
+		ctx, _ = codec.WithNewMessage(ctx)
+		gMsg.WithTargetService(primary.BackendConfig)
+		return withTargetService(ctx, primary)
+	}
+
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(gomock.Any(), nil).Times(1)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientNetErr, "reset")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(newCtx(context.Background())))
+	assert.Equal(t, breaker.StateOpen, cb.State())
+	time.Sleep(time.Second)
+
+	// The request failed before sending does not take the probe
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(nil, errors.New("err")).Times(1)
+	assert.NotNil(t, h.HTTPHandler(newCtx(context.Background())))
+	assert.Equal(t, breaker.StateOpen, cb.State())
+
+	// The probe canceled by the client is not reported
+	ctx, cancel := context.WithCancel(context.Background())
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(gomock.Any(), nil).Times(2)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, interface{}, interface{}, ...client.Option) error {
+			cancel()
+			return nil
+		}).Times(1)
+	assert.Nil(t, h.HTTPHandler(newCtx(ctx)))
+	assert.Equal(t, breaker.StateHalfOpen, cb.State())
+
+	// The next probe is allowed and closes the circuit breaker
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	assert.Nil(t, h.HTTPHandler(newCtx(context.Background())))
+	assert.Equal(t, breaker.StateClosed, cb.State())
+}
@@ -0,0 +1,71 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package fhttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	terrs "trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// notFoundData is the data of the not found body template
+type notFoundData struct {
+	Method string
+	Host   string
+	Path   string
+	Query  string
+}
+
+// bodyTemplate is the parsed not found body, which is a text/template, or an html/template for the HTML body
+type bodyTemplate interface {
+	Execute(wr io.Writer, data interface{}) error
+}
+
+// notFoundHandleFunc returns the handler writing the configured response of the requests not found. The error is
+// reported as the requests not found, but not returned, so that the response is not overwritten by the error handler.
+func notFoundHandleFunc(conf *entity.NotFoundConfig) filter.ServerHandleFunc {
+	return func(ctx context.Context, _ interface{}) (interface{}, error) {
+		fctx := http.RequestContext(ctx)
+		if fctx == nil {
+			return nil, terrs.New(gerrs.ErrWrongContext, "invalid fasthttp ctx")
+		}
+		fctx.SetStatusCode(conf.Status)
+		if conf.ContentType != "" {
+			fctx.SetContentType(conf.ContentType)
+		}
+		if tmpl, ok := conf.Template.(bodyTemplate); ok {
+			data := &notFoundData{
+				Method: string(fctx.Method()),
+				Host:   string(fctx.Host()),
+				Path:   string(fctx.Path()),
+				Query:  string(fctx.QueryArgs().QueryString()),
+			}
+			var body bytes.Buffer
+			if err := tmpl.Execute(&body, data); err != nil {
+				log.ErrorContextf(ctx, "execute not found body template err:%s", err)
+			} else {
+				fctx.SetBody(body.Bytes())
+			}
+		}
+		DefaultReportErr(ctx, terrs.New(gerrs.ErrPathNotFound, "path not found"))
+		return nil, nil
+	}
+}
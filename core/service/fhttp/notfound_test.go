@@ -0,0 +1,99 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package fhttp
+
+import (
+	"context"
+	htmltemplate "html/template"
+	"testing"
+	"text/template"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	mockrouter "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	terrs "trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+)
+
+func Test_notFoundHandleFunc(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	var reported error
+	stub.Stub(&DefaultReportErr, ReportErrFunc(func(_ context.Context, err error) {
+		reported = err
+	}))
+
+	var plugged bool
+	conf := &entity.NotFoundConfig{
+		Status:      fasthttp.StatusNotFound,
+		ContentType: "application/json",
+		Template: template.Must(template.New("").Parse(
+			`{"method":"{{.Method}}","path":"{{.Path}}","query":"{{.Query}}"}`)),
+	}
+	conf.Target = &entity.TargetService{
+		NotFound: conf,
+		Filters: []filter.ServerFilter{func(ctx context.Context, req interface{},
+			next filter.ServerHandleFunc) (interface{}, error) {
+			plugged = true
+			return next(ctx, req)
+		}},
+	}
+	mockRouter := mockrouter.NewMockRouter(ctrl)
+	h.SetRouter(mockRouter)
+	mockRouter.EXPECT().GetMatchRouter(gomock.Any()).Return(conf.Target, nil)
+
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/legacy/page?a=1")
+	ctx := http.WithRequestContext(context.Background(), fctx)
+	_, err := generateMethod("*", h.HTTPHandler).Func(nil, ctx, nil)
+	assert.Nil(t, err)
+	assert.True(t, plugged)
+	assert.Equal(t, fasthttp.StatusNotFound, fctx.Response.StatusCode())
+	assert.Equal(t, "application/json", string(fctx.Response.Header.ContentType()))
+	assert.Equal(t, `{"method":"GET","path":"/legacy/page","query":"a=1"}`, string(fctx.Response.Body()))
+	assert.Equal(t, gerrs.ErrPathNotFound, terrs.Code(reported))
+
+	// The body is not written if the template fails
+	conf = &entity.NotFoundConfig{
+		Status:   fasthttp.StatusGone,
+		Template: template.Must(template.New("").Parse(`{{.Unknown}}`)),
+	}
+	fctx = &fasthttp.RequestCtx{}
+	_, err = notFoundHandleFunc(conf)(http.WithRequestContext(context.Background(), fctx), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, fasthttp.StatusGone, fctx.Response.StatusCode())
+	assert.Empty(t, fctx.Response.Body())
+
+	// The request fields are escaped in the HTML body
+	conf = &entity.NotFoundConfig{
+		Status:      fasthttp.StatusNotFound,
+		ContentType: "text/html",
+		Template:    htmltemplate.Must(htmltemplate.New("").Parse(`<p>{{.Path}} not found</p>`)),
+	}
+	fctx = &fasthttp.RequestCtx{}
+	fctx.Request.SetRequestURI("/<script>alert(1)</script>")
+	_, err = notFoundHandleFunc(conf)(http.WithRequestContext(context.Background(), fctx), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "<p>/&lt;script&gt;alert(1)&lt;/script&gt; not found</p>", string(fctx.Response.Body()))
+
+	_, err = notFoundHandleFunc(conf)(context.Background(), nil)
+	assert.Equal(t, gerrs.ErrWrongContext, terrs.Code(err))
+}
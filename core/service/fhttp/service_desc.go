@@ -18,12 +18,15 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/valyala/fasthttp"
 	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
 	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
 	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	"trpc.group/trpc-go/trpc-gateway/core/router"
+	"trpc.group/trpc-go/trpc-gateway/core/service/retry"
 	"trpc.group/trpc-go/trpc-go/client"
 	"trpc.group/trpc-go/trpc-go/codec"
 	terrs "trpc.group/trpc-go/trpc-go/errs"
@@ -72,16 +75,24 @@ func generateMethod(pattern string, handler func(ctx context.Context) error) ser
 		targetService, err := h.router.GetMatchRouter(ctx)
 		if err != nil {
 			fCtx := http.RequestContext(ctx)
-			if terrs.Code(err) != gerrs.ErrPathNotFound {
+			code := terrs.Code(err)
+			if code != gerrs.ErrPathNotFound && code != gerrs.ErrMethodNotAllowed {
 				log.ErrorContextf(ctx, "get http router failed:%s,path:%s", err, fCtx.Path())
 			}
 			log.Debugf("get http router failed:%s,path:%s", err, fCtx.Path())
+			if code == gerrs.ErrMethodNotAllowed {
+				// The Allow header has been set by the router
+				fCtx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
+				return nil, err
+			}
 			fCtx.SetStatusCode(fasthttp.StatusNotFound)
 			return nil, err
 		}
 		// Set route information to the context for use in the handleFunc function
 		gMsg := gwmsg.GwMessage(ctx)
 		gMsg.WithTargetService((*client.BackendConfig)(targetService.BackendConfig))
+		// Save the target service for the route client options and the failover
+		ctx = withTargetService(ctx, targetService)
 
 		// Add all gateway plugin configurations to the context for use in the plugin logic
 		var pluginsNameList []string
@@ -90,6 +101,10 @@ func generateMethod(pattern string, handler func(ctx context.Context) error) ser
 			gMsg.WithPluginConfig(plugin.Name, plugin.Props)
 		}
 
+		// Respond to the requests not found with the configured response after the plugins
+		if targetService.NotFound != nil {
+			handleFunc = notFoundHandleFunc(targetService.NotFound)
+		}
 		// Execute the plugins and perform the final request forwarding
 		rsp, err = filter.ServerChain(targetService.Filters).Filter(ctx, nil, handleFunc)
 		if err != nil {
@@ -104,6 +119,20 @@ func generateMethod(pattern string, handler func(ctx context.Context) error) ser
 	}
 }
 
+// routeCliOptions returns the client options of the timeout and the retry policy of the target service
+func routeCliOptions(targetService *entity.TargetService) []client.Option {
+	var opts []client.Option
+	if targetService.Timeout > 0 {
+		opts = append(opts, client.WithTimeout(time.Duration(targetService.Timeout)*time.Millisecond))
+	}
+	if targetService.Retry != nil {
+		if policy, ok := targetService.Retry.Policy.(*retry.Policy); ok {
+			opts = append(opts, client.WithNamedFilter("gateway_retry", policy.Filter))
+		}
+	}
+	return opts
+}
+
 // PreProcessRouteFunc is a function type used for preprocessing before route matching. It can be used to perform
 // pre-processing on requests.
 type PreProcessRouteFunc func(ctx context.Context) error
@@ -130,6 +159,9 @@ var DefaultReportErr ReportErrFunc = func(ctx context.Context, err error) {
 	if terrs.Code(err) == gerrs.ErrPathNotFound || fctx.Response.StatusCode() == fasthttp.StatusNotFound {
 		method = "NotFound"
 	}
+	if terrs.Code(err) == gerrs.ErrMethodNotAllowed {
+		method = "MethodNotAllowed"
+	}
 	// Report error code for monitoring and alerting. Error code can be used to differentiate between gateway errors
 	// and upstream service errors.
 	dims := []*metrics.Dimension{
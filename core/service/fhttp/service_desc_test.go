@@ -17,14 +17,17 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
 	"trpc.group/trpc-go/trpc-gateway/common/http"
 	"trpc.group/trpc-go/trpc-gateway/core/entity"
 	"trpc.group/trpc-go/trpc-gateway/core/router"
 	mockrouter "trpc.group/trpc-go/trpc-gateway/core/router/mock"
+	"trpc.group/trpc-go/trpc-gateway/core/service/retry"
 	trpc "trpc.group/trpc-go/trpc-go"
 	"trpc.group/trpc-go/trpc-go/client"
 	"trpc.group/trpc-go/trpc-go/errs"
@@ -107,6 +110,15 @@ func Test_generateMethod(t *testing.T) {
 	// Execution failure
 	_, err = method.Func(nil, ctx, nil)
 	assert.NotNil(t, err)
+	assert.Equal(t, fasthttp.StatusNotFound, fCtx.Response.StatusCode())
+
+	// HTTP method not allowed
+	mockRouter.EXPECT().GetMatchRouter(gomock.Any()).Return(nil,
+		errs.New(gerrs.ErrMethodNotAllowed, "not allowed"))
+	_, err = method.Func(nil, ctx, nil)
+	assert.Equal(t, gerrs.ErrMethodNotAllowed, errs.Code(err))
+	assert.Equal(t, fasthttp.StatusMethodNotAllowed, fCtx.Response.StatusCode())
+	fCtx.Response.SetStatusCode(fasthttp.StatusOK)
 
 	// Function execution error
 	mockRouter.EXPECT().GetMatchRouter(gomock.Any()).Return(
@@ -179,6 +191,23 @@ func Test_generateMethod(t *testing.T) {
 	assert.Contains(t, err.Error(), "filter err")
 }
 
+func Test_routeCliOptions(t *testing.T) {
+	assert.Empty(t, routeCliOptions(&entity.TargetService{}))
+
+	policy, err := retry.NewPolicy(&entity.RetryConfig{Attempts: 2})
+	assert.Nil(t, err)
+	opts := routeCliOptions(&entity.TargetService{
+		Timeout: 1000,
+		Retry:   &entity.RetryConfig{Attempts: 2, Policy: policy},
+	})
+	o := client.NewOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	assert.Equal(t, time.Second, o.Timeout)
+	assert.Equal(t, []string{"gateway_retry"}, o.FilterNames)
+}
+
 func TestDefaultReportErr(t *testing.T) {
 	DefaultReportErr(context.Background(), nil)
 	DefaultReportErr(context.Background(), errors.New("err"))
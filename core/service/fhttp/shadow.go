@@ -0,0 +1,114 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package fhttp
+
+import (
+	"context"
+	"runtime/debug"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/shadow"
+	trpc "trpc.group/trpc-go/trpc-go"
+	"trpc.group/trpc-go/trpc-go/codec"
+	"trpc.group/trpc-go/trpc-go/log"
+)
+
+// shadowRequest is the request copied to the shadow service
+type shadowRequest struct {
+	conf           *entity.ShadowConfig
+	req            *fasthttp.Request
+	routerID       string
+	upstreamMethod string
+	// primaryStatus and primaryBody are the primary response to be compared with
+	primaryStatus int
+	primaryBody   []byte
+	compare       bool
+}
+
+// newShadowRequest copies the request if it is sampled for the shadow service, nil is returned if not. The sampled
+// request is dropped without being copied if too many shadow requests are in flight.
+func newShadowRequest(ctx context.Context, fCtx *fasthttp.RequestCtx,
+	targetService *entity.TargetService) *shadowRequest {
+	if targetService == nil || targetService.Shadow == nil || !shadow.Sampled(targetService.Shadow) {
+		return nil
+	}
+	gwMsg := gwmsg.GwMessage(ctx)
+	if !shadow.Acquire() {
+		shadow.DefaultReport(gwMsg.RouterID(), targetService.Shadow.Service, shadow.ResultDropped)
+		return nil
+	}
+	sr := &shadowRequest{
+		conf:           targetService.Shadow,
+		req:            fasthttp.AcquireRequest(),
+		routerID:       gwMsg.RouterID(),
+		upstreamMethod: gwMsg.UpstreamMethod(),
+	}
+	fCtx.Request.CopyTo(sr.req)
+	return sr
+}
+
+// shadow sends the shadow request asynchronously, and releases its slot of the requests in flight when it is done. The
+// response is compared only if the primary request succeeded and the primary response is not streamed.
+func (h *handler) shadow(ctx context.Context, sr *shadowRequest, fCtx *fasthttp.RequestCtx, primaryErr error) {
+	if sr.conf.Compare && primaryErr == nil && !fCtx.Response.IsBodyStream() {
+		sr.compare = true
+		sr.primaryStatus = fCtx.Response.StatusCode()
+		sr.primaryBody = append([]byte(nil), fCtx.Response.Body()...)
+	}
+	ctx = trpc.CloneContext(ctx)
+	go h.sendShadow(ctx, sr)
+}
+
+// sendShadow forwards the request to the shadow service, and reports the result
+func (h *handler) sendShadow(ctx context.Context, sr *shadowRequest) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ErrorContextf(ctx, "shadow panic:%s,stack:%s", r, debug.Stack())
+		}
+		fasthttp.ReleaseRequest(sr.req)
+		shadow.Release()
+	}()
+	target := sr.conf.Target
+	fCtx := &fasthttp.RequestCtx{}
+	sr.req.CopyTo(&fCtx.Request)
+	ctx = http.WithRequestContext(ctx, fCtx)
+	ctx, gwMsg := gwmsg.WithNewGWMessage(ctx)
+	defer gwmsg.PutBackGwMessage(gwMsg)
+	gwMsg.WithRouterID(sr.routerID)
+	gwMsg.WithUpstreamMethod(sr.upstreamMethod)
+	gwMsg.WithTargetService(target.BackendConfig)
+	msg := codec.Message(ctx)
+	if err := h.invoke(ctx, fCtx, msg, target.BackendConfig, target, false); err != nil {
+		log.WarnContextf(ctx, "shadow request err:%s,service:%s,path:%s", err, target.Service, fCtx.Path())
+		shadow.DefaultReport(sr.routerID, target.Service, shadow.ResultError)
+		return
+	}
+	if !sr.compare {
+		shadow.DefaultReport(sr.routerID, target.Service, shadow.ResultSent)
+		return
+	}
+	diffs := shadow.Compare(sr.conf, sr.primaryStatus, sr.primaryBody, fCtx.Response.StatusCode(),
+		fCtx.Response.Body())
+	if len(diffs) == 0 {
+		shadow.DefaultReport(sr.routerID, target.Service, shadow.ResultMatch)
+		return
+	}
+	log.WarnContextf(ctx, "shadow response mismatch,service:%s,path:%s,diffs:%s", target.Service, fCtx.Path(),
+		strings.Join(diffs, "; "))
+	shadow.DefaultReport(sr.routerID, target.Service, shadow.ResultMismatch)
+}
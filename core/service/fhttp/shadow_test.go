@@ -0,0 +1,149 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package fhttp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prashantv/gostub"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-gateway/core/service/protocol"
+	pmock "trpc.group/trpc-go/trpc-gateway/core/service/protocol/mock"
+	"trpc.group/trpc-go/trpc-gateway/core/service/shadow"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/client/mockclient"
+	"trpc.group/trpc-go/trpc-go/codec"
+	terrs "trpc.group/trpc-go/trpc-go/errs"
+)
+
+func Test_handler_shadow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	stub := gostub.New()
+	defer stub.Reset()
+	mockClient := mockclient.NewMockClient(ctrl)
+	stub.Stub(&client.DefaultClient, mockClient)
+	results := make(chan string, 1)
+	stub.Stub(&shadow.DefaultReport, shadow.ReportFunc(func(routerID, service, result string) {
+		assert.Equal(t, "router", routerID)
+		assert.Equal(t, "shadow", service)
+		results <- result
+	}))
+
+	mockCliProtocol := pmock.NewMockCliProtocolHandler(ctrl)
+	protocol.RegisterCliProtocolHandler("fasthttp", mockCliProtocol)
+	mockCliProtocol.EXPECT().GetCliOptions(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().WithCtx(gomock.Any()).DoAndReturn(func(ctx context.Context) (context.Context, error) {
+		return ctx, nil
+	}).AnyTimes()
+	mockCliProtocol.EXPECT().TransReqBody(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().TransRspBody(gomock.Any()).Return(nil, nil).AnyTimes()
+	mockCliProtocol.EXPECT().HandleErr(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context,
+		err error) error {
+		return err
+	}).AnyTimes()
+	mockCliProtocol.EXPECT().HandleRspBody(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	newBackend := func(name string) *client.BackendConfig {
+		return &client.BackendConfig{
+			ServiceName: name,
+			Network:     "tcp",
+			Target:      "ip://127.0.0.1:8080",
+			Protocol:    "fasthttp",
+		}
+	}
+	conf := &entity.ShadowConfig{Service: "shadow", Percent: 100, Compare: true, IgnorePaths: []string{"ts"}}
+	assert.Nil(t, shadow.Init(conf))
+	conf.Target = &entity.TargetService{Service: "shadow", BackendConfig: newBackend("shadow")}
+	primary := &entity.TargetService{Service: "primary", BackendConfig: newBackend("primary"), Shadow: conf}
+
+	newCtx := func() context.Context {
+		fctx := &fasthttp.RequestCtx{}
+		fctx.Request.SetRequestURI("/user/info")
+		ctx, gMsg := gwmsg.WithNewGWMessage(context.Background())
+		ctx = http.WithRequestContext(ctx, fctx)
+		ctx, _ = codec.WithNewMessage(ctx)
+		gMsg.WithTargetService(primary.BackendConfig)
+		gMsg.WithRouterID("router")
+		return withTargetService(ctx, primary)
+	}
+	respond := func(body string) func(context.Context, interface{}, interface{}, ...client.Option) error {
+		return func(ctx context.Context, _, _ interface{}, _ ...client.Option) error {
+			http.RequestContext(ctx).Response.SetBodyString(body)
+			return nil
+		}
+	}
+	wait := func() string {
+		select {
+		case result := <-results:
+			return result
+		case <-time.After(time.Second):
+			return "timeout"
+		}
+	}
+
+	// The shadow response matches except the ignored paths
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(respond(`{"code":0,"ts":1}`))
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _, _ interface{}, _ ...client.Option) error {
+			assert.Equal(t, "shadow", gwmsg.GwMessage(ctx).TargetService().ServiceName)
+			assert.Equal(t, "/user/info", string(http.RequestContext(ctx).Path()))
+			return respond(`{"ts":2,"code":0}`)(ctx, nil, nil)
+		})
+	assert.Nil(t, h.HTTPHandler(newCtx()))
+	assert.Equal(t, shadow.ResultMatch, wait())
+
+	// Mismatch
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(respond(`{"code":0}`))
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(respond(`{"code":1}`))
+	assert.Nil(t, h.HTTPHandler(newCtx()))
+	assert.Equal(t, shadow.ResultMismatch, wait())
+
+	// The shadow request fails
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientConnectFail, "dial"))
+	assert.Nil(t, h.HTTPHandler(newCtx()))
+	assert.Equal(t, shadow.ResultError, wait())
+
+	// Not compared if the primary request fails
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(terrs.NewFrameError(terrs.RetClientConnectFail, "dial"))
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	assert.NotNil(t, h.HTTPHandler(newCtx()))
+	assert.Equal(t, shadow.ResultSent, wait())
+
+	// Dropped if too many shadow requests are in flight
+	stub.Stub(&shadow.DefaultMaxInflight, 0)
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	assert.Nil(t, h.HTTPHandler(newCtx()))
+	assert.Equal(t, shadow.ResultDropped, wait())
+	stub.Stub(&shadow.DefaultMaxInflight, 1000)
+
+	// Not sampled
+	conf.Percent = 0
+	mockClient.EXPECT().Invoke(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	assert.Nil(t, h.HTTPHandler(newCtx()))
+	assert.Nil(t, newShadowRequest(context.Background(), &fasthttp.RequestCtx{}, nil))
+}
@@ -53,8 +53,9 @@ var (
 	// DefaultClientTransport is the default client HTTP transport.
 	DefaultClientTransport = NewClientTransport()
 
-	// defaultTimeout is the default timeout for backend services (500ms).
-	defaultTimeout = time.Duration(500) * time.Millisecond
+	// DefaultClientTimeout is the timeout for backend services (500ms) if neither the route nor the client configures
+	// the timeout. Clients can override this configuration.
+	DefaultClientTimeout = time.Duration(500) * time.Millisecond
 )
 
 // ServerTransport is the HTTP transport layer.
@@ -296,7 +297,7 @@ func (ct *ClientTransport) RoundTrip(ctx context.Context, _ []byte,
 	// Get the timeout
 	timeout := msg.RequestTimeout()
 	if timeout == 0 {
-		timeout = defaultTimeout
+		timeout = DefaultClientTimeout
 	}
 	proxyClient.MaxIdleConnDuration = timeout
 	proxyClient.ReadTimeout = timeout
@@ -0,0 +1,249 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package retry implements the retry policy of the upstream requests.
+package retry
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/codec"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/naming/registry"
+	"trpc.group/trpc-go/trpc-go/naming/selector"
+)
+
+const (
+	// OnConnectError retries when the connection to the upstream fails
+	OnConnectError = "connect_error"
+	// OnTimeout retries when the attempt times out
+	OnTimeout = "timeout"
+)
+
+const (
+	// defaultBaseInterval is the default base interval of the backoff
+	defaultBaseInterval = 25 * time.Millisecond
+	// maxIntervalFactor is the default max interval of the backoff in multiples of the base interval
+	maxIntervalFactor = 10
+	// maxSelectTimes is the max number of times to select a node that has not been tried
+	maxSelectTimes = 3
+)
+
+// defaultRetryOn are the default retry conditions
+var defaultRetryOn = []string{OnConnectError, "502", "503", "504"}
+
+// Policy is the retry policy parsed from entity.RetryConfig
+type Policy struct {
+	attempts       int
+	perTryTimeout  time.Duration
+	connectError   bool
+	timeout        bool
+	statusCodes    map[int]struct{}
+	retriableCodes map[int]struct{}
+	nonIdempotent  bool
+	baseInterval   time.Duration
+	maxInterval    time.Duration
+}
+
+// NewPolicy parses the retry configuration
+func NewPolicy(conf *entity.RetryConfig) (*Policy, error) {
+	if conf.Attempts < 0 || conf.PerTryTimeout < 0 || conf.BaseInterval < 0 || conf.MaxInterval < 0 {
+		return nil, errs.New(gerrs.ErrWrongConfig, "retry attempts, timeout and intervals can not be negative")
+	}
+	p := &Policy{
+		attempts:       conf.Attempts,
+		perTryTimeout:  time.Duration(conf.PerTryTimeout) * time.Millisecond,
+		statusCodes:    make(map[int]struct{}),
+		retriableCodes: make(map[int]struct{}),
+		nonIdempotent:  conf.NonIdempotent,
+		baseInterval:   time.Duration(conf.BaseInterval) * time.Millisecond,
+		maxInterval:    time.Duration(conf.MaxInterval) * time.Millisecond,
+	}
+	if p.attempts == 0 {
+		p.attempts = 1
+	}
+	if p.baseInterval == 0 {
+		p.baseInterval = defaultBaseInterval
+	}
+	if p.maxInterval == 0 {
+		p.maxInterval = maxIntervalFactor * p.baseInterval
+	}
+	if p.maxInterval < p.baseInterval {
+		return nil, errs.Newf(gerrs.ErrWrongConfig, "retry max interval %dms is less than base interval %dms",
+			conf.MaxInterval, conf.BaseInterval)
+	}
+	retryOn := conf.RetryOn
+	if len(retryOn) == 0 && len(conf.RetriableCodes) == 0 {
+		retryOn = defaultRetryOn
+	}
+	for _, on := range retryOn {
+		switch on = strings.TrimSpace(on); on {
+		case OnConnectError:
+			p.connectError = true
+		case OnTimeout:
+			p.timeout = true
+		default:
+			code, err := strconv.Atoi(on)
+			if err != nil || code < fasthttp.StatusContinue || code > 599 {
+				return nil, errs.Newf(gerrs.ErrWrongConfig, "invalid retry on:%s", on)
+			}
+			p.statusCodes[code] = struct{}{}
+		}
+	}
+	for _, code := range conf.RetriableCodes {
+		p.retriableCodes[code] = struct{}{}
+	}
+	return p, nil
+}
+
+// Filter is the client filter that retries the upstream request by the policy, and records the number of attempts in
+// gwmsg. It must be placed before the selector filter, so that each attempt selects a node again.
+func (p *Policy) Filter(ctx context.Context, req, rsp interface{}, next filter.ClientHandleFunc) error {
+	attempts := p.attempts
+	if !p.retriable(ctx) {
+		attempts = 1
+	}
+	// Prefer the nodes that have not been tried
+	if opts := client.OptionsFromContext(ctx); attempts > 1 && opts.Selector != nil {
+		opts.Selector = &untriedSelector{Selector: opts.Selector, tried: make(map[string]struct{}, attempts)}
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if !sleep(ctx, p.backoff(i)) {
+				return err
+			}
+		}
+		gwmsg.GwMessage(ctx).WithUpstreamAttempts(i + 1)
+		err = p.attempt(ctx, req, rsp, next)
+		if err == nil || ctx.Err() != nil || !p.shouldRetry(ctx, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt sends the request once with the per try timeout
+func (p *Policy) attempt(ctx context.Context, req, rsp interface{}, next filter.ClientHandleFunc) error {
+	timeout := p.perTryTimeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout == 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+		// The transport reads the timeout from the message
+		codec.Message(ctx).WithRequestTimeout(timeout)
+	}
+	return next(ctx, req, rsp)
+}
+
+// retriable checks if the request method can be retried
+func (p *Policy) retriable(ctx context.Context) bool {
+	if p.attempts < 2 {
+		return false
+	}
+	if p.nonIdempotent {
+		return true
+	}
+	fctx := http.RequestContext(ctx)
+	if fctx == nil {
+		return false
+	}
+	return http.IsIdempotent(fctx.Method())
+}
+
+// shouldRetry checks if the error matches the retry conditions
+func (p *Policy) shouldRetry(ctx context.Context, err error) bool {
+	code := errs.Code(err)
+	switch code {
+	case errs.RetClientConnectFail, errs.RetClientNetErr:
+		if p.connectError {
+			return true
+		}
+	case errs.RetClientTimeout:
+		if p.timeout {
+			return true
+		}
+	case gerrs.ErrUpstreamRspErr:
+		if fctx := http.RequestContext(ctx); fctx != nil {
+			if _, ok := p.statusCodes[fctx.Response.StatusCode()]; ok {
+				return true
+			}
+		}
+	}
+	_, ok := p.retriableCodes[int(code)]
+	return ok
+}
+
+// backoff returns the interval before the retry, which is randomized between zero and the exponential backoff
+func (p *Policy) backoff(retry int) time.Duration {
+	interval := p.maxInterval
+	if retry < 32 {
+		if d := p.baseInterval << (retry - 1); d > 0 && d < interval {
+			interval = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(interval) + 1))
+}
+
+// sleep waits for the duration, and returns false if the context is done
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// untriedSelector selects the nodes that have not been tried, and falls back to the tried nodes if there are no
+// others
+type untriedSelector struct {
+	selector.Selector
+	tried map[string]struct{}
+}
+
+// Select selects a node that has not been tried
+func (s *untriedSelector) Select(serviceName string, opt ...selector.Option) (*registry.Node, error) {
+	var node *registry.Node
+	for i := 0; i < maxSelectTimes; i++ {
+		n, err := s.Selector.Select(serviceName, opt...)
+		if err != nil {
+			if node != nil {
+				break
+			}
+			return nil, err
+		}
+		node = n
+		if _, ok := s.tried[n.Address]; !ok {
+			break
+		}
+	}
+	s.tried[node.Address] = struct{}{}
+	return node, nil
+}
@@ -0,0 +1,254 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
+	"trpc.group/trpc-go/trpc-gateway/common/http"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/client"
+	"trpc.group/trpc-go/trpc-go/codec"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/filter"
+	"trpc.group/trpc-go/trpc-go/naming/registry"
+	"trpc.group/trpc-go/trpc-go/naming/selector"
+)
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy(&entity.RetryConfig{Attempts: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, p.attempts)
+	assert.True(t, p.connectError)
+	assert.False(t, p.timeout)
+	assert.Equal(t, map[int]struct{}{502: {}, 503: {}, 504: {}}, p.statusCodes)
+	assert.Equal(t, defaultBaseInterval, p.baseInterval)
+	assert.Equal(t, maxIntervalFactor*defaultBaseInterval, p.maxInterval)
+
+	p, err = NewPolicy(&entity.RetryConfig{
+		Attempts:       2,
+		PerTryTimeout:  100,
+		RetryOn:        []string{"timeout", " 500"},
+		RetriableCodes: []int{141},
+		BaseInterval:   10,
+		MaxInterval:    50,
+	})
+	assert.Nil(t, err)
+	assert.False(t, p.connectError)
+	assert.True(t, p.timeout)
+	assert.Equal(t, map[int]struct{}{500: {}}, p.statusCodes)
+	assert.Equal(t, map[int]struct{}{141: {}}, p.retriableCodes)
+	assert.Equal(t, 100*time.Millisecond, p.perTryTimeout)
+	assert.Equal(t, 50*time.Millisecond, p.maxInterval)
+
+	// Only the tRPC codes are retried
+	p, err = NewPolicy(&entity.RetryConfig{Attempts: 2, RetriableCodes: []int{141}})
+	assert.Nil(t, err)
+	assert.False(t, p.connectError)
+	assert.Empty(t, p.statusCodes)
+
+	for _, conf := range []*entity.RetryConfig{
+		{Attempts: -1},
+		{PerTryTimeout: -1},
+		{RetryOn: []string{"reset"}},
+		{RetryOn: []string{"600"}},
+		{BaseInterval: 100, MaxInterval: 10},
+	} {
+		_, err := NewPolicy(conf)
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(err), conf)
+	}
+}
+
+func newRequestContext(method string) context.Context {
+	ctx, _ := gwmsg.WithNewGWMessage(context.Background())
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(method)
+	ctx = http.WithRequestContext(ctx, fctx)
+	ctx, _ = codec.WithNewMessage(ctx)
+	return ctx
+}
+
+func TestPolicy_retriable(t *testing.T) {
+	p, _ := NewPolicy(&entity.RetryConfig{Attempts: 2})
+	assert.True(t, p.retriable(newRequestContext(fasthttp.MethodGet)))
+	assert.True(t, p.retriable(newRequestContext(fasthttp.MethodPut)))
+	assert.False(t, p.retriable(newRequestContext(fasthttp.MethodPost)))
+	assert.False(t, p.retriable(context.Background()))
+
+	p.nonIdempotent = true
+	assert.True(t, p.retriable(newRequestContext(fasthttp.MethodPost)))
+
+	p, _ = NewPolicy(&entity.RetryConfig{Attempts: 1, NonIdempotent: true})
+	assert.False(t, p.retriable(newRequestContext(fasthttp.MethodGet)))
+}
+
+func TestPolicy_shouldRetry(t *testing.T) {
+	p, _ := NewPolicy(&entity.RetryConfig{Attempts: 2, RetryOn: []string{"connect_error", "503"},
+		RetriableCodes: []int{141}})
+	ctx := newRequestContext(fasthttp.MethodGet)
+	fctx := http.RequestContext(ctx)
+
+	assert.True(t, p.shouldRetry(ctx, errs.NewFrameError(errs.RetClientConnectFail, "dial")))
+	assert.True(t, p.shouldRetry(ctx, errs.NewFrameError(errs.RetClientNetErr, "reset")))
+	assert.False(t, p.shouldRetry(ctx, errs.NewFrameError(errs.RetClientTimeout, "timeout")))
+	assert.True(t, p.shouldRetry(ctx, errs.New(141, "overload")))
+	assert.False(t, p.shouldRetry(ctx, errs.New(142, "other")))
+	assert.False(t, p.shouldRetry(ctx, errors.New("unknown")))
+
+	fctx.Response.SetStatusCode(fasthttp.StatusServiceUnavailable)
+	assert.True(t, p.shouldRetry(ctx, errs.New(gerrs.ErrUpstreamRspErr, "503")))
+	fctx.Response.SetStatusCode(fasthttp.StatusBadGateway)
+	assert.False(t, p.shouldRetry(ctx, errs.New(gerrs.ErrUpstreamRspErr, "502")))
+
+	p.timeout = true
+	assert.True(t, p.shouldRetry(ctx, errs.NewFrameError(errs.RetClientTimeout, "timeout")))
+}
+
+func TestPolicy_backoff(t *testing.T) {
+	p, _ := NewPolicy(&entity.RetryConfig{Attempts: 2, BaseInterval: 10, MaxInterval: 30})
+	for i := 0; i < 100; i++ {
+		assert.LessOrEqual(t, p.backoff(1), 10*time.Millisecond)
+		assert.LessOrEqual(t, p.backoff(2), 20*time.Millisecond)
+		assert.LessOrEqual(t, p.backoff(3), 30*time.Millisecond)
+		assert.LessOrEqual(t, p.backoff(64), 30*time.Millisecond)
+		assert.GreaterOrEqual(t, p.backoff(64), time.Duration(0))
+	}
+}
+
+// fakeSelector selects the nodes in turn
+type fakeSelector struct {
+	selector.Selector
+	addrs []string
+	next  int
+}
+
+func (s *fakeSelector) Select(string, ...selector.Option) (*registry.Node, error) {
+	if len(s.addrs) == 0 {
+		return nil, errors.New("no node")
+	}
+	addr := s.addrs[s.next%len(s.addrs)]
+	s.next++
+	return &registry.Node{Address: addr}, nil
+}
+
+func Test_untriedSelector(t *testing.T) {
+	s := &untriedSelector{
+		Selector: &fakeSelector{addrs: []string{"a", "a", "b"}},
+		tried:    make(map[string]struct{}),
+	}
+	node, err := s.Select("svr")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", node.Address)
+	// a has been tried, select again
+	node, err = s.Select("svr")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", node.Address)
+
+	// Fall back to the tried node if there is no other node
+	s = &untriedSelector{Selector: &fakeSelector{addrs: []string{"a"}}, tried: map[string]struct{}{"a": {}}}
+	node, err = s.Select("svr")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", node.Address)
+
+	s = &untriedSelector{Selector: &fakeSelector{}, tried: make(map[string]struct{})}
+	_, err = s.Select("svr")
+	assert.NotNil(t, err)
+}
+
+// testSelector is the selector of the target retrytest://svr
+var testSelector = &fakeSelector{}
+
+func init() {
+	selector.Register("retrytest", testSelector)
+}
+
+// invoke calls the client with the retry filter, and next instead of the selector filter
+func invoke(ctx context.Context, p *Policy, next filter.ClientHandleFunc) error {
+	return client.New().Invoke(ctx, nil, nil, client.WithTarget("retrytest://svr"), client.WithFilters(
+		[]filter.ClientFilter{p.Filter, func(ctx context.Context, req, rsp interface{}, _ filter.ClientHandleFunc) error {
+			return next(ctx, req, rsp)
+		}}))
+}
+
+func TestPolicy_Filter(t *testing.T) {
+	p, _ := NewPolicy(&entity.RetryConfig{Attempts: 3, PerTryTimeout: 50, BaseInterval: 1})
+	ctx := newRequestContext(fasthttp.MethodGet)
+	testSelector.addrs, testSelector.next = []string{"a", "a", "b"}, 0
+
+	// Retry until success, each attempt has the per try timeout and selects an untried node
+	var nodes []string
+	err := invoke(ctx, p, func(ctx context.Context, _, _ interface{}) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.LessOrEqual(t, time.Until(deadline), 50*time.Millisecond)
+		assert.Equal(t, 50*time.Millisecond, codec.Message(ctx).RequestTimeout())
+		node, _ := client.OptionsFromContext(ctx).Selector.Select("svr")
+		nodes = append(nodes, node.Address)
+		if len(nodes) < 2 {
+			return errs.NewFrameError(errs.RetClientConnectFail, "dial")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, nodes)
+	assert.Equal(t, 2, gwmsg.GwMessage(ctx).UpstreamAttempts())
+
+	// Give up after the max attempts
+	var count int
+	err = invoke(ctx, p, func(context.Context, interface{}, interface{}) error {
+		count++
+		return errs.NewFrameError(errs.RetClientConnectFail, "dial")
+	})
+	assert.Equal(t, errs.RetClientConnectFail, errs.Code(err))
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 3, gwmsg.GwMessage(ctx).UpstreamAttempts())
+
+	// Not retried on the errors that do not match
+	count = 0
+	err = invoke(ctx, p, func(context.Context, interface{}, interface{}) error {
+		count++
+		return errs.NewFrameError(errs.RetClientTimeout, "timeout")
+	})
+	assert.Equal(t, errs.RetClientTimeout, errs.Code(err))
+	assert.Equal(t, 1, count)
+
+	// Non-idempotent methods are not retried
+	postCtx := newRequestContext(fasthttp.MethodPost)
+	count = 0
+	err = invoke(postCtx, p, func(context.Context, interface{}, interface{}) error {
+		count++
+		return errs.NewFrameError(errs.RetClientConnectFail, "dial")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 1, gwmsg.GwMessage(postCtx).UpstreamAttempts())
+
+	// Stop retrying when the request is canceled
+	cancelCtx, cancel := context.WithCancel(ctx)
+	count = 0
+	err = invoke(cancelCtx, p, func(context.Context, interface{}, interface{}) error {
+		count++
+		cancel()
+		return errs.NewFrameError(errs.RetClientConnectFail, "dial")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,305 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+// Package shadow implements the comparison and reporting of the traffic shadowing.
+package shadow
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+	"trpc.group/trpc-go/trpc-go/log"
+	"trpc.group/trpc-go/trpc-go/metrics"
+)
+
+const (
+	// ResultMatch means the shadow response is the same as the primary response
+	ResultMatch = "match"
+	// ResultMismatch means the shadow response is different from the primary response
+	ResultMismatch = "mismatch"
+	// ResultError means the shadow request failed
+	ResultError = "error"
+	// ResultSent means the shadow request succeeded and was not compared
+	ResultSent = "sent"
+	// ResultDropped means the sampled request was not copied since too many shadow requests are in flight
+	ResultDropped = "dropped"
+)
+
+const (
+	defaultMaxDiffs = 5
+	// wildcard matches any key or array index in the ignore paths
+	wildcard = "*"
+)
+
+// DefaultMaxInflight is the maximum number of the shadow requests in flight of the gateway. The sampled requests are
+// dropped when it is reached, so that a slow shadow service can not pile up the goroutines and the copied requests.
+var DefaultMaxInflight = 1000
+
+// inflight is the number of the shadow requests in flight
+var inflight int64
+
+func init() {
+	flag.IntVar(&DefaultMaxInflight, "shadow_max_inflight", DefaultMaxInflight, "max shadow requests in flight")
+}
+
+// Acquire takes a slot of the shadow requests in flight, false is returned if DefaultMaxInflight is reached. The slot
+// must be returned by Release after the shadow request is done.
+func Acquire() bool {
+	if atomic.AddInt64(&inflight, 1) > int64(DefaultMaxInflight) {
+		atomic.AddInt64(&inflight, -1)
+		return false
+	}
+	return true
+}
+
+// Release returns the slot taken by Acquire
+func Release() {
+	atomic.AddInt64(&inflight, -1)
+}
+
+// Init validates the shadow configuration and parses the ignore paths
+func Init(conf *entity.ShadowConfig) error {
+	if conf.Service == "" {
+		return errs.New(gerrs.ErrWrongConfig, "empty shadow service")
+	}
+	if conf.Percent <= 0 || conf.Percent > 100 {
+		return errs.Newf(gerrs.ErrWrongConfig, "invalid shadow percent:%v", conf.Percent)
+	}
+	if conf.Timeout < 0 || conf.MaxDiffs < 0 {
+		return errs.New(gerrs.ErrWrongConfig, "shadow timeout and max diffs can not be negative")
+	}
+	if conf.MaxDiffs == 0 {
+		conf.MaxDiffs = defaultMaxDiffs
+	}
+	ignore := make([][]string, 0, len(conf.IgnorePaths))
+	for _, p := range conf.IgnorePaths {
+		segments := strings.Split(p, ".")
+		for _, s := range segments {
+			if s == "" {
+				return errs.Newf(gerrs.ErrWrongConfig, "invalid shadow ignore path:%s", p)
+			}
+		}
+		ignore = append(ignore, segments)
+	}
+	conf.Ignore = ignore
+	return nil
+}
+
+// Sampled checks if the request is copied to the shadow service
+func Sampled(conf *entity.ShadowConfig) bool {
+	// Random number seed has been set during gateway initialization
+	return conf.Percent >= 100 || rand.Float64()*100 < conf.Percent
+}
+
+// Compare compares the shadow response with the primary response, and returns the differences, at most max diffs
+// are returned. JSON bodies are compared field by field except the ignored paths, other bodies are compared byte by
+// byte.
+func Compare(conf *entity.ShadowConfig, primaryStatus int, primaryBody []byte, shadowStatus int,
+	shadowBody []byte) []string {
+	d := &differ{max: conf.MaxDiffs}
+	if primaryStatus != shadowStatus {
+		d.add("status: %d != %d", primaryStatus, shadowStatus)
+	}
+	primary, perr := decode(primaryBody)
+	shadow, serr := decode(shadowBody)
+	if perr != nil || serr != nil {
+		if !bytes.Equal(primaryBody, shadowBody) {
+			d.add("body: %d bytes != %d bytes", len(primaryBody), len(shadowBody))
+		}
+		return d.diffs
+	}
+	ignore, _ := conf.Ignore.([][]string)
+	for _, segments := range ignore {
+		primary = remove(primary, segments)
+		shadow = remove(shadow, segments)
+	}
+	d.diff("", primary, shadow)
+	return d.diffs
+}
+
+// decode decodes the JSON body, numbers are kept as they are
+func decode(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errs.New(gerrs.ErrInvalidReq, "invalid json")
+	}
+	return v, nil
+}
+
+// remove removes the path from the JSON value
+func remove(v interface{}, segments []string) interface{} {
+	key, last := segments[0], len(segments) == 1
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if key != wildcard && key != k {
+				continue
+			}
+			if last {
+				delete(val, k)
+				continue
+			}
+			val[k] = remove(child, segments[1:])
+		}
+	case []interface{}:
+		for i, child := range val {
+			if key != wildcard && key != strconv.Itoa(i) {
+				continue
+			}
+			if last {
+				// Elements are not deleted to keep the indexes
+				val[i] = nil
+				continue
+			}
+			val[i] = remove(child, segments[1:])
+		}
+	}
+	return v
+}
+
+// differ collects the differences of the JSON values
+type differ struct {
+	max   int
+	diffs []string
+}
+
+// add adds a difference if not reaching the max
+func (d *differ) add(format string, args ...interface{}) {
+	if len(d.diffs) < d.max {
+		d.diffs = append(d.diffs, fmt.Sprintf(format, args...))
+	}
+}
+
+// diff compares the JSON values at the path
+func (d *differ) diff(path string, primary, shadow interface{}) {
+	if len(d.diffs) >= d.max {
+		return
+	}
+	switch p := primary.(type) {
+	case map[string]interface{}:
+		s, ok := shadow.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(p)+len(s))
+		for k := range p {
+			keys = append(keys, k)
+		}
+		for k := range s {
+			if _, ok := p[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			pv, pok := p[k]
+			sv, sok := s[k]
+			switch {
+			case !sok:
+				d.add("%s: missing in shadow", join(path, k))
+			case !pok:
+				d.add("%s: missing in primary", join(path, k))
+			default:
+				d.diff(join(path, k), pv, sv)
+			}
+		}
+		return
+	case []interface{}:
+		s, ok := shadow.([]interface{})
+		if !ok {
+			break
+		}
+		if len(p) != len(s) {
+			d.add("%s: length %d != %d", fieldPath(path), len(p), len(s))
+			return
+		}
+		for i := range p {
+			d.diff(join(path, strconv.Itoa(i)), p[i], s[i])
+		}
+		return
+	default:
+		if primary == shadow {
+			return
+		}
+	}
+	d.add("%s: %s != %s", fieldPath(path), marshal(primary), marshal(shadow))
+}
+
+// join joins the path and the key
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// fieldPath returns the path of the field, the root is named body
+func fieldPath(path string) string {
+	if path == "" {
+		return "body"
+	}
+	return path
+}
+
+// marshal returns the JSON of the value in the differences
+func marshal(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// ReportFunc is a function type used for reporting the results of the shadow requests.
+type ReportFunc func(routerID, service, result string)
+
+// DefaultReport is the default function of reporting the results of the shadow requests. It can be overridden by the
+// user.
+var DefaultReport ReportFunc = func(routerID, service, result string) {
+	dims := []*metrics.Dimension{
+		{
+			Name:  "router_id",
+			Value: routerID,
+		},
+		{
+			Name:  "shadow_service",
+			Value: service,
+		},
+		{
+			Name:  "result",
+			Value: result,
+		},
+	}
+	indices := []*metrics.Metrics{
+		metrics.NewMetrics("shadow_count", float64(1), metrics.PolicySUM),
+	}
+	err := metrics.Report(metrics.NewMultiDimensionMetricsX(gerrs.GatewayERRKey, dims, indices))
+	if err != nil {
+		log.Errorf("report shadow result failed:%s", err)
+	}
+}
@@ -0,0 +1,93 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package shadow
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-gateway/core/entity"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+func TestInit(t *testing.T) {
+	conf := &entity.ShadowConfig{Service: "svr", Percent: 10, IgnorePaths: []string{"data.ts", "list.*.id"}}
+	assert.Nil(t, Init(conf))
+	assert.Equal(t, defaultMaxDiffs, conf.MaxDiffs)
+	assert.Equal(t, [][]string{{"data", "ts"}, {"list", "*", "id"}}, conf.Ignore)
+
+	for _, conf := range []*entity.ShadowConfig{
+		{Percent: 10},
+		{Service: "svr"},
+		{Service: "svr", Percent: 101},
+		{Service: "svr", Percent: 10, Timeout: -1},
+		{Service: "svr", Percent: 10, IgnorePaths: []string{"data..ts"}},
+	} {
+		assert.Equal(t, gerrs.ErrWrongConfig, errs.Code(Init(conf)))
+	}
+}
+
+func TestSampled(t *testing.T) {
+	assert.True(t, Sampled(&entity.ShadowConfig{Percent: 100}))
+	assert.False(t, Sampled(&entity.ShadowConfig{Percent: 0}))
+}
+
+func TestCompare(t *testing.T) {
+	conf := &entity.ShadowConfig{Service: "svr", Percent: 10, IgnorePaths: []string{"ts", "list.*.id", "list.1"}}
+	assert.Nil(t, Init(conf))
+
+	// Ignored paths
+	diffs := Compare(conf, 200, []byte(`{"code":0,"ts":1,"list":[{"id":1,"n":"a"},{"n":"b"}]}`),
+		200, []byte(`{"ts":2,"code":0,"list":[{"id":2,"n":"a"},{"n":"c"}]}`))
+	assert.Empty(t, diffs)
+
+	// Differences in the order of the paths
+	diffs = Compare(conf, 200, []byte(`{"code":0,"msg":"ok","data":{"n":1.0,"tags":[1]},"a":1}`),
+		500, []byte(`{"code":1,"data":{"n":1,"tags":[1,2]},"b":null}`))
+	assert.Equal(t, []string{
+		"status: 200 != 500",
+		"a: missing in shadow",
+		"b: missing in primary",
+		"code: 0 != 1",
+		"data.n: 1.0 != 1",
+	}, diffs)
+
+	conf.MaxDiffs = 10
+	diffs = Compare(conf, 200, []byte(`{"data":{"tags":[1]},"list":{}}`),
+		200, []byte(`{"data":{"tags":[1,2]},"list":[]}`))
+	assert.Equal(t, []string{"data.tags: length 1 != 2", "list: {} != []"}, diffs)
+
+	// Non-JSON bodies
+	assert.Empty(t, Compare(conf, 200, []byte("ok"), 200, []byte("ok")))
+	assert.Equal(t, []string{"body: 2 bytes != 4 bytes"}, Compare(conf, 200, []byte("ok"), 200, []byte(`"ok"`)))
+	assert.Equal(t, []string{"body: 3 bytes != 2 bytes"}, Compare(conf, 200, []byte(`1 2`), 200, []byte(`12`)))
+	assert.Equal(t, []string{"body: 1 != \"1\""}, Compare(conf, 200, []byte(`1`), 200, []byte(`"1"`)))
+}
+
+func TestAcquire(t *testing.T) {
+	defer func(max int) { DefaultMaxInflight = max }(DefaultMaxInflight)
+	DefaultMaxInflight = 2
+	assert.True(t, Acquire())
+	assert.True(t, Acquire())
+	assert.False(t, Acquire())
+	Release()
+	assert.True(t, Acquire())
+	Release()
+	Release()
+}
+
+func TestDefaultReport(t *testing.T) {
+	DefaultReport("id", "svr", ResultMatch)
+}
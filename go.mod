@@ -1,11 +1,13 @@
 module trpc.group/trpc-go/trpc-gateway
 
-go 1.18
+go 1.19
 
 require (
 	code.cloudfoundry.org/bytefmt v0.0.0-20211005130812-5bb3c17173e5
 	github.com/armon/go-radix v1.0.0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/golang/mock v1.6.0
+	github.com/json-iterator/go v1.1.12
 	github.com/prashantv/gostub v1.1.0
 	github.com/stretchr/testify v1.8.2
 	github.com/valyala/fasthttp v1.45.0
@@ -20,12 +22,10 @@ require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
 	github.com/andybalholm/brotli v1.0.5 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/go-playground/form/v4 v4.2.0 // indirect
 	github.com/google/flatbuffers v2.0.0+incompatible // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/klauspost/compress v1.16.3 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/lestrrat-go/strftime v1.0.6 // indirect
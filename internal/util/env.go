@@ -13,7 +13,16 @@
 
 package util
 
-import "os"
+import (
+	"os"
+	"strings"
+
+	gerrs "trpc.group/trpc-go/trpc-gateway/common/errs"
+	"trpc.group/trpc-go/trpc-go/errs"
+)
+
+// fileRef is the name of the reference to the content of a file, such as ${file:/etc/secrets/sign_key}
+const fileRef = "file"
 
 // ExpandEnv looks for ${var} in s and replaces them with value of the
 // corresponding environment variable.
@@ -21,8 +30,24 @@ import "os"
 // It's not like os.ExpandEnv which will handle both ${var} and $var.
 // Since configurations like password for redis/mysql may contain $, this
 // method is needed.
-// TODO test case
-func ExpandEnv(s string) string {
+// The references also support:
+//   - ${var:-default}: the default is used if the variable is unset or empty
+//   - ${var:?message}: an error with the message is returned if the variable is unset or empty
+//   - ${file:/path}: the content of the file without the trailing newlines, such as a mounted secret. The lines after
+//     the first one are indented like the line of the reference, so that a multi-line content fits in a YAML block
+//     scalar.
+func ExpandEnv(s string) (string, error) {
+	return expandEnv(s, true)
+}
+
+// ExpandRemoteEnv expands the references like ExpandEnv except ${file:/path}, which is rejected. It is used for the
+// configuration from a remote source, so that the remote source can not read the local files of the gateway.
+func ExpandRemoteEnv(s string) (string, error) {
+	return expandEnv(s, false)
+}
+
+// expandEnv expands the references, ${file:/path} is rejected unless allowFile is true
+func expandEnv(s string, allowFile bool) (string, error) {
 	var buf []byte
 	i := 0
 	for j := 0; j < len(s); j++ {
@@ -31,33 +56,45 @@ func ExpandEnv(s string) string {
 				buf = make([]byte, 0, 2*len(s))
 			}
 			buf = append(buf, s[i:j]...)
-			name, w := getEnvName(s[j+1:])
-			if name == "" && w > 0 {
+			ref, w := getEnvRef(s[j+1:])
+			if ref == "" && w > 0 {
 				// invalid matching, remove the $
-			} else if name == "" {
+			} else if ref == "" {
 				buf = append(buf, s[j]) // keep the $
 			} else {
-				buf = append(buf, os.Getenv(name)...)
+				v, err := expandRef(ref, allowFile)
+				if err != nil {
+					return "", err
+				}
+				if strings.Contains(v, "\n") {
+					v = strings.ReplaceAll(v, "\n", "\n"+lineIndent(s, j))
+				}
+				buf = append(buf, v...)
 			}
 			j += w
 			i = j + 1
 		}
 	}
 	if buf == nil {
-		return s
+		return s, nil
 	}
-	return string(buf) + s[i:]
+	return string(buf) + s[i:], nil
 }
 
-// getEnvName gets env name, that is, var from ${var}.
-// And content of var and its len will be returned.
-func getEnvName(s string) (string, int) {
+// getEnvRef gets the reference, that is, var from ${var} or var:-default from ${var:-default}.
+// And content of the reference and its len will be returned.
+func getEnvRef(s string) (string, int) {
 	// look for right curly bracket '}'
 	// it's guaranteed that the first char is '{' and the string has at least two char
+	name := true
 	for i := 1; i < len(s); i++ {
-		if s[i] == ' ' || s[i] == '\n' || s[i] == '"' { // "xx${xxx"
+		if s[i] == '\n' || s[i] == '"' || (name && s[i] == ' ') { // "xx${xxx"
 			return "", 0 // encounter invalid char, keep the $
 		}
+		if s[i] == ':' {
+			// the default, the message and the path may contain spaces
+			name = false
+		}
 		if s[i] == '}' {
 			if i == 1 { // ${}
 				return "", 2 // remove ${}
@@ -67,3 +104,48 @@ func getEnvName(s string) (string, int) {
 	}
 	return "", 0 // no }，keep the $
 }
+
+// expandRef returns the value of the reference
+func expandRef(ref string, allowFile bool) (string, error) {
+	name, arg, ok := strings.Cut(ref, ":")
+	if !ok {
+		return os.Getenv(name), nil
+	}
+	switch {
+	case strings.HasPrefix(arg, "-"):
+		if v := os.Getenv(name); v != "" {
+			return v, nil
+		}
+		return arg[1:], nil
+	case strings.HasPrefix(arg, "?"):
+		if v := os.Getenv(name); v != "" {
+			return v, nil
+		}
+		msg := arg[1:]
+		if msg == "" {
+			msg = "required"
+		}
+		return "", errs.Newf(gerrs.ErrWrongConfig, "env %s is unset or empty: %s", name, msg)
+	case name == fileRef:
+		if !allowFile {
+			return "", errs.Newf(gerrs.ErrWrongConfig, "${file:%s} is only allowed in the local configuration", arg)
+		}
+		buf, err := os.ReadFile(arg)
+		if err != nil {
+			return "", errs.Wrapf(err, gerrs.ErrWrongConfig, "read file %s referenced by ${file:} err", arg)
+		}
+		return strings.TrimRight(string(buf), "\r\n"), nil
+	default:
+		return os.Getenv(ref), nil
+	}
+}
+
+// lineIndent returns the leading spaces and tabs of the line at the position
+func lineIndent(s string, pos int) string {
+	start := strings.LastIndexByte(s[:pos], '\n') + 1
+	end := start
+	for end < pos && (s[end] == ' ' || s[end] == '\t') {
+		end++
+	}
+	return s[start:end]
+}
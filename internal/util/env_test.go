@@ -0,0 +1,91 @@
+//
+//
+// Tencent is pleased to support the open source community by making tRPC available.
+//
+// Copyright (C) 2023 Tencent.
+// All rights reserved.
+//
+// If you have downloaded a copy of the tRPC source code from Tencent,
+// please note that tRPC source code is licensed under the  Apache 2.0 License,
+// A copy of the Apache 2.0 License is included in this file.
+//
+//
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GW_HOST", "127.0.0.1")
+	t.Setenv("GW_EMPTY", "")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "target: ip://${GW_HOST}:8080", want: "target: ip://127.0.0.1:8080"},
+		{in: "target: ${GW_MISSING}", want: "target: "},
+		{in: "port: ${GW_PORT:-8080}", want: "port: 8080"},
+		{in: "port: ${GW_EMPTY:-8080}", want: "port: 8080"},
+		{in: "host: ${GW_HOST:-localhost}", want: "host: 127.0.0.1"},
+		{in: "host: ${GW_HOST:?host required}", want: "host: 127.0.0.1"},
+		{in: "msg: ${GW_MISSING:-hello world}", want: "msg: hello world"},
+		{in: "password: a$b${}c", want: "password: a$bc"},
+		{in: "password: ${GW HOST}", want: "password: ${GW HOST}"},
+		{in: "password: ${GW_HOST", want: "password: ${GW_HOST"},
+		{in: "no ref", want: "no ref"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandEnv(tt.in)
+		assert.Nil(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	_, err := ExpandEnv("target: ${GW_MISSING:?set GW_MISSING to the upstream}")
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "GW_MISSING")
+	assert.Contains(t, err.Error(), "set GW_MISSING to the upstream")
+	_, err = ExpandEnv("target: ${GW_EMPTY:?}")
+	assert.NotNil(t, err)
+}
+
+func TestExpandEnv_file(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "sign_key")
+	require.Nil(t, os.WriteFile(key, []byte("secret\n"), 0600))
+	pem := filepath.Join(dir, "cert.pem")
+	require.Nil(t, os.WriteFile(pem, []byte("line1\nline2\n"), 0600))
+
+	got, err := ExpandEnv("sign_key: ${file:" + key + "}")
+	assert.Nil(t, err)
+	assert.Equal(t, "sign_key: secret", got)
+
+	// The lines of a multi-line content are indented like the line of the reference
+	got, err = ExpandEnv("props:\n  cert: |\n    ${file:" + pem + "}\n  name: x")
+	assert.Nil(t, err)
+	assert.Equal(t, "props:\n  cert: |\n    line1\n    line2\n  name: x", got)
+
+	_, err = ExpandEnv("sign_key: ${file:" + filepath.Join(dir, "missing") + "}")
+	assert.NotNil(t, err)
+}
+
+func TestExpandRemoteEnv(t *testing.T) {
+	t.Setenv("GW_HOST", "127.0.0.1")
+	got, err := ExpandRemoteEnv("target: ip://${GW_HOST}:${GW_PORT:-8080}")
+	assert.Nil(t, err)
+	assert.Equal(t, "target: ip://127.0.0.1:8080", got)
+
+	// The remote configuration can not read the local files
+	key := filepath.Join(t.TempDir(), "sign_key")
+	require.Nil(t, os.WriteFile(key, []byte("secret"), 0600))
+	got, err = ExpandRemoteEnv("sign_key: ${file:" + key + "}")
+	require.NotNil(t, err)
+	assert.Empty(t, got)
+	assert.Contains(t, err.Error(), "only allowed in the local configuration")
+}
@@ -64,6 +64,8 @@ func (p *Plugin) Setup(string, plugin.Decoder) error {
 type Options struct {
 	// TODO 如何保持有序？
 	FieldList []map[string]string `yaml:"field_list"`
+	// fieldSources are the parsed sources of the field names, such as header:x-uid
+	fieldSources map[string]*http.Source
 }
 
 // CheckConfig validates the plugin configuration and returns the parsed configuration object. Used in the ServerFilter
@@ -73,6 +75,16 @@ func (p *Plugin) CheckConfig(_ string, decoder plugin.Decoder) error {
 	if err := decoder.Decode(options); err != nil {
 		return gerrs.Wrap(err, "decode access log config error")
 	}
+	options.fieldSources = make(map[string]*http.Source)
+	for _, fieldMap := range options.FieldList {
+		for key, fieldName := range fieldMap {
+			src, err := http.ParseSource(fieldName)
+			if err != nil {
+				return gerrs.Wrapf(err, "invalid access log field:%s", key)
+			}
+			options.fieldSources[fieldName] = src
+		}
+	}
 	return nil
 }
 
@@ -122,6 +134,8 @@ func accessLog(ctx context.Context, err error, node *registry.Node) {
 		{Key: "host", Value: string(fctx.Host())},
 		{Key: "referer", Value: string(fctx.Referer())},
 		{Key: "server_protocol", Value: string(fctx.Request.Header.Protocol())},
+		// Number of attempts to the upstream, greater than 1 if the request is retried
+		{Key: "upstream_attempts", Value: gwmsg.GwMessage(ctx).UpstreamAttempts()},
 	}
 
 	extFieldList, err := getExtFields(ctx)
@@ -163,7 +177,7 @@ func getExtFields(ctx context.Context) ([]log.Field, error) {
 			fieldList = append(fieldList,
 				log.Field{
 					Key:   key,
-					Value: http.GetString(fctx, fieldName),
+					Value: options.fieldValue(fctx, fieldName),
 				},
 			)
 		}
@@ -171,6 +185,14 @@ func getExtFields(ctx context.Context) ([]log.Field, error) {
 	return fieldList, nil
 }
 
+// fieldValue returns the value of the field from the request
+func (o *Options) fieldValue(fctx *fasthttp.RequestCtx, fieldName string) string {
+	if src, ok := o.fieldSources[fieldName]; ok {
+		return src.Value(fctx)
+	}
+	return http.GetSourceString(fctx, fieldName)
+}
+
 // Get the protocol
 func getUpstreamProtocol(ctx context.Context) string {
 	if gwmsg.GwMessage(ctx).TargetService() == nil {
@@ -48,6 +48,27 @@ func TestPlugin_CheckConfig(t *testing.T) {
 	err = p.CheckConfig("", decoder)
 	assert.Nil(t, err)
 
+	// check config failed, invalid field source
+	invalidDecoder := &plugin.PropsDecoder{Props: &accesslog.Options{
+		FieldList: []map[string]string{
+			{"level": "json:user.level"},
+		},
+	}}
+	err = p.CheckConfig("", invalidDecoder)
+	assert.NotNil(t, err)
+
+	// field with source prefix
+	opts = &accesslog.Options{
+		FieldList: []map[string]string{
+			{"suid": "suid"},
+			{"uid": "header:x-uid"},
+			{"level": "json:$.user.level"},
+		},
+	}
+	decoder = &plugin.PropsDecoder{Props: opts}
+	err = p.CheckConfig("", decoder)
+	assert.Nil(t, err)
+
 	// execute filter success
 	_, err = accesslog.ServerFilter(context.Background(), nil, func(ctx context.Context,
 		req interface{}) (rsp interface{}, err error) {
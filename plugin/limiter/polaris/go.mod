@@ -64,3 +64,5 @@ require (
 	trpc.group/trpc-go/tnet v0.0.0-20230810071536-9d05338021cf // indirect
 	trpc.group/trpc/trpc-protocol/pb/go/trpc v0.0.0-20230803031059-de4168eb5952 // indirect
 )
+
+replace trpc.group/trpc-go/trpc-gateway => ../../..
@@ -124,8 +124,10 @@ func WithMaxRetries(maxRetries int) Opt {
 
 // Options for rate limiting
 type Options struct {
-	// Business fields
+	// Business fields, supports source prefix such as header:x-uid
 	Labels []string `yaml:"labels" json:"labels"`
+	// labelSources are the parsed sources of the labels
+	labelSources map[string]*http.Source
 	// Timeout for quota query, in milliseconds
 	Timeout int `yaml:"timeout" json:"timeout"`
 	// Number of retries
@@ -165,6 +167,14 @@ func (p *PluginFactory) CheckConfig(name string, decoder plugin.Decoder) error {
 	if options.Timeout == 0 {
 		options.Timeout = p.Timeout
 	}
+	options.labelSources = make(map[string]*http.Source, len(options.Labels))
+	for _, label := range options.Labels {
+		src, err := http.ParseSource(label)
+		if err != nil {
+			return gerrs.Wrapf(err, "invalid label:%s", label)
+		}
+		options.labelSources[label] = src
+	}
 	return nil
 }
 
@@ -209,7 +219,7 @@ func (l *Limiter) isLimit(ctx context.Context) (bool, error) {
 	// Set the retry count
 	quotaReq.SetRetryCount(options.MaxRetries)
 	// Set the request parameters
-	quotaReq.SetLabels(getLabels(ctx, options.Labels, options.ParseJSONBody))
+	quotaReq.SetLabels(getLabels(ctx, options))
 	quotaFuture, err := l.API.GetQuota(quotaReq)
 	if err != nil {
 		return false, gerrs.Wrap(err, "get quota err")
@@ -241,7 +251,7 @@ func setRspBody(ctx context.Context, body string) {
 }
 
 // Get rate limiting labels
-func getLabels(ctx context.Context, labels []string, parseJSONBody bool) map[string]string {
+func getLabels(ctx context.Context, options *Options) map[string]string {
 	labelMap := make(map[string]string)
 	fctx := http.RequestContext(ctx)
 	if fctx == nil {
@@ -250,8 +260,8 @@ func getLabels(ctx context.Context, labels []string, parseJSONBody bool) map[str
 	}
 	labelMap["method"] = string(fctx.Path())
 	labelMap["router_id"] = gwmsg.GwMessage(ctx).RouterID()
-	for _, label := range labels {
-		if val := getParams(ctx, label, parseJSONBody); val != "" {
+	for _, label := range options.Labels {
+		if val := getParams(ctx, label, options.labelSources[label], options.ParseJSONBody); val != "" {
 			labelMap[label] = val
 		}
 	}
@@ -262,19 +272,26 @@ func getLabels(ctx context.Context, labels []string, parseJSONBody bool) map[str
 type GetLabelFunc func(ctx context.Context, key string) string
 
 // DefaultGetLabelFunc is a function to get parameters, which can be overridden by yourself.
+// It is not used for the labels with source prefix, such as header:x-uid.
 var DefaultGetLabelFunc GetLabelFunc = func(ctx context.Context, label string) string {
 	fctx := http.RequestContext(ctx)
 	if fctx == nil {
 		return ""
 	}
-	if val := http.GetString(fctx, label); val != "" {
+	if val := http.GetSourceString(fctx, label); val != "" {
 		return val
 	}
 	return ""
 }
 
 // Get parameters
-func getParams(ctx context.Context, label string, parseJSONBody bool) string {
+func getParams(ctx context.Context, label string, src *http.Source, parseJSONBody bool) string {
+	if src != nil && src.Typed() {
+		if fctx := http.RequestContext(ctx); fctx != nil {
+			return src.Value(fctx)
+		}
+		return ""
+	}
 	if val := DefaultGetLabelFunc(ctx, label); val != "" {
 		return val
 	}
@@ -30,6 +30,7 @@ import (
 	"trpc.group/trpc-go/trpc-gateway/common/gwmsg"
 	"trpc.group/trpc-go/trpc-gateway/common/http"
 	gwplugin "trpc.group/trpc-go/trpc-gateway/common/plugin"
+	"trpc.group/trpc-go/trpc-gateway/plugin"
 	"trpc.group/trpc-go/trpc-gateway/plugin/limiter/polaris"
 	mockapi "trpc.group/trpc-go/trpc-gateway/plugin/limiter/polaris/mock"
 	trpc "trpc.group/trpc-go/trpc-go"
@@ -97,6 +98,17 @@ func TestPluginFactory_CheckConfig(t *testing.T) {
 		},
 	})
 	assert.Nil(t, err)
+
+	// Invalid label source
+	err = factory.CheckConfig("", &plugin.PropsDecoder{Props: &polaris.Options{
+		Labels: []string{"suid", "json:common.device_id"},
+	}})
+	assert.NotNil(t, err)
+
+	err = factory.CheckConfig("", &plugin.PropsDecoder{Props: &polaris.Options{
+		Labels: []string{"suid", "header:suid", "json:$.common.device_id"},
+	}})
+	assert.Nil(t, err)
 }
 
 type pluginDecoder struct {
@@ -133,7 +145,7 @@ func TestInterceptServer(t *testing.T) {
 	mockQuota.EXPECT().Get().Return(&model.QuotaResponse{
 		Code: 0,
 		Info: "",
-	}).Times(2)
+	}).Times(3)
 	mockQuota.EXPECT().Release().Return().AnyTimes()
 
 	factory := &polaris.PluginFactory{
@@ -173,6 +185,20 @@ func TestInterceptServer(t *testing.T) {
 	})
 	assert.Nil(t, err)
 
+	// Labels with source prefix
+	decoder := &plugin.PropsDecoder{Props: &polaris.Options{
+		Service:   "trpc.service",
+		Labels:    []string{"header:suid", "json:$.common.device_id"},
+		Namespace: "Production",
+	}}
+	assert.Nil(t, factory.CheckConfig("", decoder))
+	msg.WithPluginConfig(polaris.PluginName, decoder.DecodedProps)
+	_, err = limiter.InterceptServer(ctx, nil, func(ctx context.Context, req interface{}) (rsp interface{}, err error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
+	msg.WithPluginConfig(polaris.PluginName, options)
+
 	mockQuota.EXPECT().Get().Return(&model.QuotaResponse{
 		Code: model.QuotaResultLimited,
 		Info: "",
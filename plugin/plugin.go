@@ -36,6 +36,12 @@ type GatewayPlugin interface {
 	CheckConfig(name string, dec plugin.Decoder) error
 }
 
+// Prioritizer 网关插件可选实现，声明插件在过滤器链中的默认优先级
+type Prioritizer interface {
+	// Priority 默认优先级，值越大越先执行，未实现时为 0
+	Priority() int
+}
+
 // PropsDecoder 解析插件配置
 type PropsDecoder struct {
 	// 原始 props，类型为 map[string]interface{}
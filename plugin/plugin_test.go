@@ -47,6 +47,19 @@ func TestPropsDecoder_Decode(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestPropsDecoder_Decode_expanded(t *testing.T) {
+	type props struct {
+		Key string `yaml:"key"`
+	}
+	// The props are expanded once with the router configuration by the loaders, so the references left in the
+	// values, such as a secret containing ${, are not expanded again
+	t.Setenv("GW_SIGN_KEY", "secret")
+	decoder := &PropsDecoder{Props: map[string]interface{}{"key": "a${GW_SIGN_KEY}${GW_MISSING:-x}b"}}
+	p := &props{}
+	assert.Nil(t, decoder.Decode(p))
+	assert.Equal(t, "a${GW_SIGN_KEY}${GW_MISSING:-x}b", p.Key)
+}
+
 func TestMashal(t *testing.T) {
 
 	props, err := yaml.Marshal(make(map[string]interface{}))
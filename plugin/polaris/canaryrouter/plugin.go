@@ -65,8 +65,10 @@ func (p *Plugin) Setup(_ string, decoder plugin.Decoder) error {
 
 // Options Plugin configuration
 type Options struct {
-	// ReqKey Canary key
+	// ReqKey Canary key, supports source prefix such as header:x-uid
 	ReqKey string `yaml:"request_key"`
+	// reqKeySource Parsed source of ReqKey
+	reqKeySource *http.Source `yaml:"-"`
 	// Values Canary values
 	Values []string `yaml:"values"`
 	// valueMap Parsed values
@@ -75,6 +77,8 @@ type Options struct {
 	Scale float64 `yaml:"scale" json:"scale"`
 	// Canary traffic hash key
 	HashKey string `yaml:"hash_key" json:"hash_key"`
+	// hashKeySource Parsed source of HashKey
+	hashKeySource *http.Source `yaml:"-"`
 	// CanaryTagVal PolarisMesh Canary tag value, used with 123 to customize Canary tags, default is 1
 	CanaryTagVal string `yaml:"canary_tag_val"`
 }
@@ -96,9 +100,24 @@ func (p *Plugin) CheckConfig(_ string, decoder plugin.Decoder) error {
 	if options.CanaryTagVal == "" {
 		options.CanaryTagVal = "1"
 	}
+	var err error
+	if options.reqKeySource, err = parseKey(options.ReqKey); err != nil {
+		return gerrs.Wrap(err, "invalid canary request key")
+	}
+	if options.hashKeySource, err = parseKey(options.HashKey); err != nil {
+		return gerrs.Wrap(err, "invalid canary hash key")
+	}
 	return nil
 }
 
+// parseKey parses the source of the key, empty key and client_ip are handled by getParam
+func parseKey(key string) (*http.Source, error) {
+	if key == "" || key == clientIPKey {
+		return nil, nil
+	}
+	return http.ParseSource(key)
+}
+
 // CanaryHandler Canary handler
 type CanaryHandler struct {
 }
@@ -158,7 +177,7 @@ func (ehl *CanaryHandler) isHitCanary(ctx context.Context, fctx *fasthttp.Reques
 	}
 
 	// Hit whitelist
-	if val := getParam(fctx, options.ReqKey); val != "" {
+	if val := getParam(fctx, options.ReqKey, options.reqKeySource); val != "" {
 		if exist := options.valueMap[val]; exist {
 			log.DebugContextf(ctx, "set canary value:%s", val)
 			return true, nil
@@ -166,18 +185,18 @@ func (ehl *CanaryHandler) isHitCanary(ctx context.Context, fctx *fasthttp.Reques
 	}
 
 	// Hit gray traffic
-	if options.Scale != 0 && options.Scale > ehl.getRandNum(fctx, options.HashKey) {
+	if options.Scale != 0 && options.Scale > ehl.getRandNum(fctx, options.HashKey, options.hashKeySource) {
 		return true, nil
 	}
 	return false, nil
 }
 
 // Get random number
-func (ehl *CanaryHandler) getRandNum(fctx *fasthttp.RequestCtx, hashKey string) float64 {
+func (ehl *CanaryHandler) getRandNum(fctx *fasthttp.RequestCtx, hashKey string, src *http.Source) float64 {
 	if hashKey == "" {
 		return rand.Float64() * 100
 	}
-	val := getParam(fctx, hashKey)
+	val := getParam(fctx, hashKey, src)
 	if val != "" {
 		return float64(convert.Fnv32(val) % uint32(100))
 	}
@@ -185,12 +204,15 @@ func (ehl *CanaryHandler) getRandNum(fctx *fasthttp.RequestCtx, hashKey string)
 	return 100
 }
 
-func getParam(fctx *fasthttp.RequestCtx, reqKey string) string {
+func getParam(fctx *fasthttp.RequestCtx, reqKey string, src *http.Source) string {
 	if reqKey == "" {
 		return ""
 	}
+	if src != nil {
+		return src.Value(fctx)
+	}
 	if reqKey == clientIPKey {
 		return http.GetClientIP(fctx)
 	}
-	return http.GetString(fctx, reqKey)
+	return http.GetSourceString(fctx, reqKey)
 }
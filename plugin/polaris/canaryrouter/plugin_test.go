@@ -57,6 +57,22 @@ func TestPlugin_CheckConfig(t *testing.T) {
 	err = p.CheckConfig("", decoder)
 	assert.NotNil(t, err)
 
+	// Configuration validation failed, invalid key source
+	opts.ReqKey = "json:suid"
+	opts.Scale = 50
+	err = p.CheckConfig("", decoder)
+	assert.NotNil(t, err)
+	opts.ReqKey = "suid"
+	opts.HashKey = "header:"
+	err = p.CheckConfig("", decoder)
+	assert.NotNil(t, err)
+	opts.HashKey = ""
+
+	// Configuration validation succeeded, key with source prefix
+	opts.ReqKey = "header:suid"
+	err = p.CheckConfig("", decoder)
+	assert.Nil(t, err)
+
 	// Configuration validation succeeded
 	opts.ReqKey = "suid"
 	opts.Values = []string{"xxx"}
@@ -146,4 +162,14 @@ func TestPlugin_CheckConfig(t *testing.T) {
 		return nil, nil
 	})
 	assert.Nil(t, err)
+
+	// Key with source prefix
+	opts = &canaryrouter.Options{ReqKey: "header:suid", Values: []string{"xxx"}, HashKey: "query:suid", Scale: 1}
+	decoder = &plugin.PropsDecoder{Props: opts}
+	assert.Nil(t, p.CheckConfig("", decoder))
+	msg.WithPluginConfig("canaryrouter", decoder.DecodedProps)
+	_, err = handler.ServerFilter(ctx, nil, func(ctx context.Context, req interface{}) (rsp interface{}, err error) {
+		return nil, nil
+	})
+	assert.Nil(t, err)
 }
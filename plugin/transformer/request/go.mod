@@ -9,7 +9,7 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0
 	github.com/valyala/fasthttp v1.45.0
 	trpc.group/trpc-go/trpc-gateway v1.0.0
-	trpc.group/trpc-go/trpc-go v0.0.0-20231008070952-27a655b3e79c
+	trpc.group/trpc-go/trpc-go v1.0.3
 )
 
 require (
@@ -38,8 +38,10 @@ require (
 	go.uber.org/zap v1.24.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
-	trpc.group/trpc-go/tnet v0.0.0-20230810071536-9d05338021cf // indirect
-	trpc.group/trpc/trpc-protocol/pb/go/trpc v0.0.0-20230803031059-de4168eb5952 // indirect
+	trpc.group/trpc-go/tnet v1.0.1 // indirect
+	trpc.group/trpc/trpc-protocol/pb/go/trpc v1.0.0 // indirect
 )
+
+replace trpc.group/trpc-go/trpc-gateway => ../../..
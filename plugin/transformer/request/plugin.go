@@ -286,29 +286,43 @@ func getMultipartFormBody(ctx context.Context, fctx *fasthttp.RequestCtx) ([]byt
 
 // Add operation or replace
 func addOption(ctx context.Context, request *fasthttp.Request, options *Options) bool {
+	// Values captured by the path template route, referenced as {name} in the added values
+	var params map[string]string
+	if fctx := http.RequestContext(ctx); fctx != nil {
+		params = http.PathParams(fctx)
+	}
 	// Add headers
 	if len(options.AddHeadersKV) != 0 {
 		for _, kv := range options.AddHeadersKV {
-			request.Header.Set(kv.Key, kv.Val)
+			request.Header.Set(kv.Key, http.ExpandPathParams(kv.Val, params))
 		}
 	}
 	// Add query parameters
 	if len(options.AddQueryStrKV) != 0 {
 		for _, kv := range options.AddQueryStrKV {
-			request.URI().QueryArgs().Set(kv.Key, kv.Val)
+			request.URI().QueryArgs().Set(kv.Key, http.ExpandPathParams(kv.Val, params))
 		}
 	}
 	var modifyBody bool
 	// Add body parameters
 	if len(options.AddBodyKV) != 0 {
 		for _, kv := range options.AddBodyKV {
-			addBody(ctx, request, kv)
+			addBody(ctx, request, expandKV(kv, params))
 		}
 		modifyBody = true
 	}
 	return modifyBody
 }
 
+// expandKV replaces the path template placeholders in the value
+func expandKV(kv *KV, params map[string]string) *KV {
+	val := http.ExpandPathParams(kv.Val, params)
+	if val == kv.Val {
+		return kv
+	}
+	return &KV{Key: kv.Key, Val: val}
+}
+
 func addBody(ctx context.Context, request *fasthttp.Request, kv *KV) {
 	// Handle different content types
 	if bytes.HasPrefix(request.Header.ContentType(), strPostArgsContentType) {
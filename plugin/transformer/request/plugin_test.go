@@ -421,6 +421,25 @@ another_val
 	assert.Equal(t, ``, string(fctx.Request.Body()))
 }
 
+func Test_addOptionWithPathParams(t *testing.T) {
+	fctx := &fasthttp.RequestCtx{}
+	http.WithPathParams(fctx, map[string]string{"uid": "123"})
+	ctx := http.WithRequestContext(context.Background(), fctx)
+	fctx.Request.Header.SetContentTypeBytes(strPostArgsContentType)
+	options := &Options{
+		AddHeadersKV:  []*KV{{Key: "x-uid", Val: "{uid}"}},
+		AddQueryStrKV: []*KV{{Key: "uid", Val: "u_{uid}"}},
+		AddBodyKV:     []*KV{{Key: "uid", Val: "{uid}"}, {Key: "oid", Val: "{oid}"}},
+	}
+	assert.True(t, addOption(ctx, &fctx.Request, options))
+	assert.Equal(t, "123", string(fctx.Request.Header.Peek("x-uid")))
+	assert.Equal(t, "u_123", string(fctx.Request.URI().QueryArgs().Peek("uid")))
+	assert.Equal(t, "123", string(fctx.Request.PostArgs().Peek("uid")))
+	assert.Equal(t, "{oid}", string(fctx.Request.PostArgs().Peek("oid")))
+	// The configuration is not modified
+	assert.Equal(t, "{uid}", options.AddBodyKV[0].Val)
+}
+
 func Test_renameBody(t *testing.T) {
 	fctx := &fasthttp.RequestCtx{}
 	fctx.Request.Header.SetContentTypeBytes(strPostArgsContentType)